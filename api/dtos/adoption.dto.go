@@ -0,0 +1,44 @@
+package dtos
+
+import (
+	"strings"
+
+	"secret-svc/pkg/constants"
+)
+
+// Untagged PRIVATE secrets of an organization adopted by the secret group of a key
+type SecretAdoption struct {
+	Group     string   `json:"group"`
+	SecretIds []string `json:"secretIds"`
+	Skipped   []string `json:"skipped,omitempty"`
+}
+
+type SecretAdoptionReq struct {
+	SecretIds []string `json:"secretIds,omitempty"`
+}
+
+// Helper method for creating an adoption request
+// ///////////////////////////////////////////////////
+// - an empty body adopts every untagged secret of the organization
+func CreateNewSecretAdoptionReq(body map[string]interface{}) (SecretAdoptionReq, error) {
+	rawSecretIds, exists := body["secretIds"]
+	if !exists {
+		return SecretAdoptionReq{}, nil
+	}
+
+	values, ok := rawSecretIds.([]interface{})
+	if !ok || len(values) == 0 {
+		return SecretAdoptionReq{}, constants.ErrSecretNotUntagged
+	}
+
+	request := SecretAdoptionReq{}
+	for _, value := range values {
+		secretId, _ := value.(string)
+		if secretId == "" || strings.Contains(secretId, ",") {
+			return SecretAdoptionReq{}, constants.ErrSecretNotUntagged
+		}
+		request.SecretIds = append(request.SecretIds, secretId)
+	}
+
+	return request, nil
+}
@@ -0,0 +1,84 @@
+package dtos
+
+import (
+	"encoding/base64"
+	"net/url"
+	"secret-svc/pkg/audit"
+	"secret-svc/pkg/constants"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var AUDIT_DEFAULT_LIMIT = 50
+var AUDIT_MAX_LIMIT = 500
+
+type AuditPage struct {
+	Events    []audit.Event `json:"events"`
+	NextToken string        `json:"nextToken,omitempty"`
+}
+
+// Checkpoints of an organization with the public key verifying them, stored outside of the service
+type AuditCheckpointExport struct {
+	OrgId       string             `json:"orgId"`
+	KeyId       string             `json:"keyId"`
+	PublicKey   string             `json:"publicKey"`
+	ExportedAt  time.Time          `json:"exportedAt"`
+	Checkpoints []audit.Checkpoint `json:"checkpoints"`
+}
+
+// Helper method for creating an audit filter from the query params
+// ////////////////////////////////////////////////////////////////////
+// - events are restricted to the organization of the headers, and to its project and scope when given
+// - 'from' and 'to' are RFC 3339 timestamps, 'nextToken' is the token returned by the previous page
+func CreateNewAuditFilter(query url.Values, headers CustomHeaders) (audit.Filter, error) {
+	filter := audit.Filter{
+		OrgId:     headers.OrgId,
+		ProjectId: headers.ProjectId,
+		Scope:     headers.Scope,
+		SecretId:  query.Get("secretId"),
+		Actor:     query.Get("actor"),
+		Action:    strings.ToUpper(query.Get("action")),
+		Outcome:   strings.ToUpper(query.Get("outcome")),
+		TraceId:   query.Get("traceId"),
+		Limit:     AUDIT_DEFAULT_LIMIT,
+	}
+	if filter.ProjectId == "" {
+		filter.ProjectId = query.Get("projectId")
+	}
+	if filter.Scope == "" {
+		filter.Scope = query.Get("scope")
+	}
+
+	if filter.Outcome != "" && filter.Outcome != constants.SUCCESS_OUTCOME && filter.Outcome != constants.FAILURE_OUTCOME && filter.Outcome != constants.DENIED_OUTCOME {
+		return audit.Filter{}, constants.ErrInvalidAuditOutcome
+	}
+
+	for param, value := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if raw := query.Get(param); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return audit.Filter{}, constants.ErrInvalidAuditTime
+			}
+			*value = parsed.UTC()
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.Atoi(limit)
+		if err != nil || parsedLimit < 1 || parsedLimit > AUDIT_MAX_LIMIT {
+			return audit.Filter{}, constants.ErrInvalidAuditLimit
+		}
+		filter.Limit = parsedLimit
+	}
+
+	if nextToken := query.Get("nextToken"); nextToken != "" {
+		after, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil || len(after) == 0 {
+			return audit.Filter{}, constants.ErrInvalidNextToken
+		}
+		filter.After = string(after)
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,184 @@
+package dtos
+
+import (
+	"regexp"
+	"secret-svc/pkg/constants"
+	"time"
+)
+
+var DEFAULT_LEASE_TTL = "1h"
+var DEFAULT_LEASE_MAX_TTL = "24h"
+
+var roleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type PostgresConnectionReq struct {
+	ConnectionUrl string `json:"connectionUrl"`
+}
+
+// Role template used to create dynamic database users
+type DynamicRole struct {
+	Name                 string    `json:"name"`
+	CreationStatements   []string  `json:"creationStatements,omitempty"`
+	RenewStatements      []string  `json:"renewStatements,omitempty"`
+	RevocationStatements []string  `json:"revocationStatements,omitempty"`
+	DefaultTtl           string    `json:"defaultTtl"`
+	MaxTtl               string    `json:"maxTtl"`
+	UpdatedAt            time.Time `json:"updatedAt"`
+}
+
+// Lease of a dynamic database user
+type Lease struct {
+	LeaseId      string    `json:"leaseId"`
+	Engine       string    `json:"engine"`
+	Role         string    `json:"role"`
+	Username     string    `json:"username"`
+	OrgId        string    `json:"orgId"`
+	ProjectId    string    `json:"projectId,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	IssuedAt     time.Time `json:"issuedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	MaxExpiresAt time.Time `json:"maxExpiresAt"`
+	LastError    string    `json:"lastError,omitempty"`
+	// Next attempt of a failed revocation, the lease stays expired meanwhile
+	NextRevocationAt *time.Time `json:"nextRevocationAt,omitempty"`
+}
+
+// Response returned once when dynamic credentials are issued
+type DynamicCredentials struct {
+	LeaseId   string    `json:"leaseId"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	Ttl       int       `json:"ttl"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type LeaseRenewReq struct {
+	Increment string `json:"increment,omitempty"`
+}
+
+// Helper method for creating a PostgreSQL connection request
+// /////////////////////////////////////////////////////////////
+func CreateNewPostgresConnectionReq(body interface{}) (PostgresConnectionReq, error) {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return PostgresConnectionReq{}, constants.ErrFormat
+	}
+
+	connectionUrl, ok := bodyMap["connectionUrl"].(string)
+	if !ok || connectionUrl == "" {
+		return PostgresConnectionReq{}, constants.ErrMissingConnectionUrlAttr
+	}
+
+	return PostgresConnectionReq{
+		ConnectionUrl: connectionUrl,
+	}, nil
+}
+
+// Helper method for creating a dynamic role request
+// ////////////////////////////////////////////////////
+func CreateNewDynamicRoleReq(name string, body interface{}) (DynamicRole, error) {
+	if !roleNamePattern.MatchString(name) {
+		return DynamicRole{}, constants.ErrInvalidRoleName
+	}
+
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return DynamicRole{}, constants.ErrFormat
+	}
+
+	creationStatements, err := stringsAttr(bodyMap, "creationStatements")
+	if err != nil {
+		return DynamicRole{}, err
+	}
+	renewStatements, err := stringsAttr(bodyMap, "renewStatements")
+	if err != nil {
+		return DynamicRole{}, err
+	}
+	revocationStatements, err := stringsAttr(bodyMap, "revocationStatements")
+	if err != nil {
+		return DynamicRole{}, err
+	}
+
+	defaultTtl, _ := bodyMap["defaultTtl"].(string)
+	maxTtl, _ := bodyMap["maxTtl"].(string)
+	role := DynamicRole{
+		Name:                 name,
+		CreationStatements:   creationStatements,
+		RenewStatements:      renewStatements,
+		RevocationStatements: revocationStatements,
+		DefaultTtl:           defaultIfEmpty(defaultTtl, DEFAULT_LEASE_TTL),
+		MaxTtl:               defaultIfEmpty(maxTtl, DEFAULT_LEASE_MAX_TTL),
+	}
+
+	defaultDuration, err := ParseTtl(role.DefaultTtl)
+	if err != nil {
+		return DynamicRole{}, err
+	}
+	maxDuration, err := ParseTtl(role.MaxTtl)
+	if err != nil || defaultDuration > maxDuration {
+		return DynamicRole{}, constants.ErrInvalidTtl
+	}
+
+	return role, nil
+}
+
+// Helper method for creating a lease renew request
+// ///////////////////////////////////////////////////
+func CreateNewLeaseRenewReq(body interface{}) (LeaseRenewReq, error) {
+	bodyMap, _ := body.(map[string]interface{})
+	increment, _ := bodyMap["increment"].(string)
+
+	if increment != "" {
+		if _, err := ParseTtl(increment); err != nil {
+			return LeaseRenewReq{}, err
+		}
+	}
+
+	return LeaseRenewReq{
+		Increment: increment,
+	}, nil
+}
+
+// Helper function to parse ttl durations
+// //////////////////////////////////////////
+func ParseTtl(ttl string) (time.Duration, error) {
+	duration, err := time.ParseDuration(ttl)
+	if err != nil || duration < time.Minute {
+		return 0, constants.ErrInvalidTtl
+	}
+
+	return duration, nil
+}
+
+// Helper function to read string array attributes
+// ////////////////////////////////////////////////////
+func stringsAttr(bodyMap map[string]interface{}, key string) ([]string, error) {
+	rawValues, exists := bodyMap[key]
+	if !exists {
+		return nil, nil
+	}
+
+	values, ok := rawValues.([]interface{})
+	if !ok {
+		return nil, constants.ErrInvalidStatementsAttr
+	}
+
+	var statements []string
+	for _, value := range values {
+		statement, ok := value.(string)
+		if !ok {
+			return nil, constants.ErrInvalidStatementsAttr
+		}
+		statements = append(statements, statement)
+	}
+
+	return statements, nil
+}
+
+func defaultIfEmpty(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
@@ -0,0 +1,64 @@
+package dtos
+
+import (
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/generators"
+)
+
+// Response for secrets generated by the service, the generated value is never returned
+type GeneratedSecret struct {
+	Id        string `json:"id"`
+	Type      string `json:"type"`
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+// Helper method for creating a generator request
+// //////////////////////////////////////////////////
+func CreateNewGeneratorReq(body interface{}) (generators.Spec, error) {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return generators.Spec{}, constants.ErrFormat
+	}
+
+	return CreateNewGeneratorSpec(bodyMap)
+}
+
+// Helper method for creating a generator spec from a request body
+// //////////////////////////////////////////////////////////////////
+func CreateNewGeneratorSpec(generatorMap map[string]interface{}) (generators.Spec, error) {
+	generatorType, _ := generatorMap["type"].(string)
+	charset, _ := generatorMap["charset"].(string)
+	encoding, _ := generatorMap["encoding"].(string)
+	prefix, _ := generatorMap["prefix"].(string)
+	excludedChars, _ := generatorMap["excludeChars"].(string)
+
+	spec := generators.Spec{
+		Type:         generatorType,
+		Length:       intAttr(generatorMap, "length"),
+		Charset:      charset,
+		Encoding:     encoding,
+		Prefix:       prefix,
+		MinLower:     intAttr(generatorMap, "minLower"),
+		MinUpper:     intAttr(generatorMap, "minUpper"),
+		MinDigits:    intAttr(generatorMap, "minDigits"),
+		MinSymbols:   intAttr(generatorMap, "minSymbols"),
+		ExcludeChars: excludedChars,
+		Bits:         intAttr(generatorMap, "bits"),
+	}
+
+	if err := generators.Validate(spec); err != nil {
+		return generators.Spec{}, err
+	}
+
+	return spec, nil
+}
+
+// Helper function to read numeric attributes, JSON numbers are decoded as float64
+// //////////////////////////////////////////////////////////////////////////////////
+func intAttr(bodyMap map[string]interface{}, key string) int {
+	if value, ok := bodyMap[key].(float64); ok {
+		return int(value)
+	}
+
+	return 0
+}
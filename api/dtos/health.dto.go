@@ -0,0 +1,34 @@
+package dtos
+
+import "time"
+
+// Health of a PRIVATE registration, recorded by the periodic health checks
+type RegistrationHealth struct {
+	Status              string     `json:"status"`
+	CheckedAt           time.Time  `json:"checkedAt"`
+	LastSuccessAt       *time.Time `json:"lastSuccessAt,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Denied              []string   `json:"denied,omitempty"`
+	Error               string     `json:"error,omitempty"`
+}
+
+// PRIVATE registration along with its health
+// - the account ID of the ARN is masked like the registrations
+type PrivateRegistrationHealth struct {
+	SecretName string             `json:"secretName"`
+	OrgId      string             `json:"orgId"`
+	ProjectId  string             `json:"projectId,omitempty"`
+	Scope      string             `json:"scope,omitempty"`
+	ARN        string             `json:"arn"`
+	Region     string             `json:"region"`
+	Health     RegistrationHealth `json:"health"`
+}
+
+// Outcome of a run of the health checker
+type HealthCheckRun struct {
+	StartedAt     time.Time `json:"startedAt"`
+	FinishedAt    time.Time `json:"finishedAt"`
+	Registrations int       `json:"registrations"`
+	Roles         int       `json:"roles"`
+	Unhealthy     int       `json:"unhealthy"`
+}
@@ -0,0 +1,103 @@
+package dtos
+
+import (
+	"encoding/base64"
+	"net/url"
+	"secret-svc/pkg/constants"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var INVENTORY_DEFAULT_LIMIT = 20
+var INVENTORY_MAX_LIMIT = 100
+
+// Registered scope of an inventory registration
+// - the secret count is left out when it wasn't requested or couldn't be read
+type InventoryScope struct {
+	Scope       string              `json:"scope,omitempty"`
+	Flow        string              `json:"flow"`
+	Provider    string              `json:"provider,omitempty"`
+	Region      string              `json:"region,omitempty"`
+	CreatedAt   *time.Time          `json:"createdAt,omitempty"`
+	SecretCount *int                `json:"secretCount,omitempty"`
+	CountError  string              `json:"countError,omitempty"`
+	Health      *RegistrationHealth `json:"health,omitempty"`
+}
+
+// Organization or project registered in the System secret manager
+type InventoryRegistration struct {
+	OrgId       string           `json:"orgId"`
+	ProjectId   string           `json:"projectId,omitempty"`
+	Flows       []string         `json:"flows"`
+	Scopes      []InventoryScope `json:"scopes"`
+	CreatedAt   *time.Time       `json:"createdAt,omitempty"`
+	SecretCount *int             `json:"secretCount,omitempty"`
+}
+
+type InventoryPage struct {
+	Registrations []InventoryRegistration `json:"registrations"`
+	NextToken     string                  `json:"nextToken,omitempty"`
+	IndexedAt     *time.Time              `json:"indexedAt,omitempty"`
+}
+
+// Filters of an inventory listing, scope attributes match any scope of a registration
+type InventoryFilter struct {
+	OrgId     string
+	ProjectId string
+	Flow      string
+	Provider  string
+	Region    string
+	Scope     string
+	Counts    bool
+	Limit     int
+	After     string
+}
+
+// Helper method for creating an inventory filter from the query params
+// ////////////////////////////////////////////////////////////////////////
+// - 'nextToken' is the token returned by the previous page
+func CreateNewInventoryFilter(query url.Values) (InventoryFilter, error) {
+	filter := InventoryFilter{
+		OrgId:     query.Get("orgId"),
+		ProjectId: query.Get("projectId"),
+		Flow:      strings.ToUpper(query.Get("flow")),
+		Provider:  query.Get("provider"),
+		Region:    query.Get("region"),
+		Scope:     query.Get("scope"),
+		Counts:    query.Get("counts") != "false",
+		Limit:     INVENTORY_DEFAULT_LIMIT,
+	}
+
+	if filter.Flow != "" && filter.Flow != constants.SHARED_FLOW && filter.Flow != constants.PRIVATE_FLOW {
+		return InventoryFilter{}, constants.ErrInvalidFlow
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.Atoi(limit)
+		if err != nil || parsedLimit < 1 || parsedLimit > INVENTORY_MAX_LIMIT {
+			return InventoryFilter{}, constants.ErrInvalidInventoryLimit
+		}
+		filter.Limit = parsedLimit
+	}
+
+	if nextToken := query.Get("nextToken"); nextToken != "" {
+		after, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil || len(after) == 0 {
+			return InventoryFilter{}, constants.ErrInvalidNextToken
+		}
+		filter.After = string(after)
+	}
+
+	return filter, nil
+}
+
+// Helper method for creating the token of the page following a registration
+func CreateNewInventoryNextToken(registration InventoryRegistration) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(GetInventoryKey(registration.OrgId, registration.ProjectId)))
+}
+
+// Registrations are ordered by organization, then project
+func GetInventoryKey(orgId string, projectId string) string {
+	return orgId + "\x00" + projectId
+}
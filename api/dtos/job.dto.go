@@ -0,0 +1,34 @@
+package dtos
+
+import "time"
+
+// Progress of a running job
+type JobProgress struct {
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Message string `json:"message,omitempty"`
+}
+
+// Long-running operation processed by the job workers
+type Job struct {
+	Id              string            `json:"id"`
+	Type            string            `json:"type"`
+	OrgId           string            `json:"orgId"`
+	ProjectId       string            `json:"projectId,omitempty"`
+	Headers         CustomHeaders     `json:"headers"`
+	Request         *SystemSecretReq  `json:"request,omitempty"`
+	ResourceId      string            `json:"resourceId,omitempty"`
+	Status          string            `json:"status"`
+	Attempts        int               `json:"attempts"`
+	MaxAttempts     int               `json:"maxAttempts"`
+	Progress        JobProgress       `json:"progress"`
+	Checkpoint      map[string]string `json:"checkpoint,omitempty"`
+	Result          interface{}       `json:"result,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	CancelRequested bool              `json:"cancelRequested,omitempty"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	UpdatedAt       time.Time         `json:"updatedAt"`
+	NextAttemptAt   time.Time         `json:"nextAttemptAt"`
+	StartedAt       *time.Time        `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time        `json:"finishedAt,omitempty"`
+}
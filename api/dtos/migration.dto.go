@@ -0,0 +1,109 @@
+package dtos
+
+import "time"
+
+// Secret manager a scope is migrated from or to
+// - KmsKeyId is the customer managed KMS key of a PRIVATE secret manager
+type MigrationTarget struct {
+	Flow     string `json:"flow"`
+	ARN      string `json:"arn,omitempty"`
+	Region   string `json:"region,omitempty"`
+	KmsKeyId string `json:"kmsKeyId,omitempty"`
+}
+
+// Migration plan of a single system secret (scope)
+type MigrationScopePlan struct {
+	SecretName     string          `json:"secretName"`
+	Source         MigrationTarget `json:"source"`
+	Target         MigrationTarget `json:"target"`
+	SecretIds      []string        `json:"secretIds"`
+	PreviousValues int             `json:"previousValues"`
+	Collisions     []string        `json:"collisions,omitempty"`
+	Reencrypt      bool            `json:"reencrypt,omitempty"`
+	ApiCalls       map[string]int  `json:"apiCalls"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// Result of checking a single permission in a secret manager
+type PermissionCheck struct {
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Result of assuming the role of a secret manager and checking its permissions
+type AccessCheck struct {
+	ARN         string            `json:"arn"`
+	Region      string            `json:"region"`
+	AssumeRole  bool              `json:"assumeRole"`
+	Error       string            `json:"error,omitempty"`
+	Permissions []PermissionCheck `json:"permissions,omitempty"`
+	CheckedAt   time.Time         `json:"checkedAt"`
+}
+
+// Result of actively verifying a PRIVATE secret manager with a probe secret
+// - the probe secret is reported when it couldn't be deleted
+type AccessVerification struct {
+	AccessCheck
+	Scopes      []string `json:"scopes,omitempty"`
+	RegionMatch bool     `json:"regionMatch"`
+	Missing     []string `json:"missing,omitempty"`
+	ProbeSecret string   `json:"probeSecret,omitempty"`
+	Verified    bool     `json:"verified"`
+}
+
+// Dry-run of PUT /system, nothing is written until the plan is approved
+type MigrationPlan struct {
+	Id            string               `json:"id"`
+	OrgId         string               `json:"orgId"`
+	ProjectId     string               `json:"projectId,omitempty"`
+	Scope         string               `json:"scope,omitempty"`
+	Request       SystemSecretReq      `json:"request"`
+	Scopes        []MigrationScopePlan `json:"scopes"`
+	Access        []AccessCheck        `json:"access"`
+	ApiCalls      int                  `json:"apiCalls"`
+	Errors        []string             `json:"errors,omitempty"`
+	Warnings      []string             `json:"warnings,omitempty"`
+	Approvable    bool                 `json:"approvable"`
+	Status        string               `json:"status"`
+	MigrationId   string               `json:"migrationId,omitempty"`
+	MigratedIds   []string             `json:"migratedIds,omitempty"`
+	FailureReason string               `json:"failureReason,omitempty"`
+	CreatedAt     time.Time            `json:"createdAt"`
+	ExpiresAt     time.Time            `json:"expiresAt"`
+	ApprovedAt    *time.Time           `json:"approvedAt,omitempty"`
+}
+
+// Progress of a single system secret (scope) in a migration
+// - Reencrypt scopes stay in their secret manager, their secrets are re-encrypted with the target KMS key
+type MigrationScopeState struct {
+	SecretName       string                 `json:"secretName"`
+	Source           MigrationTarget        `json:"source"`
+	Target           MigrationTarget        `json:"target"`
+	PreviousMetadata map[string]interface{} `json:"previousMetadata"`
+	SecretIds        []string               `json:"secretIds"`
+	CreatedIds       []string               `json:"createdIds,omitempty"`
+	CreatedGroup     bool                   `json:"createdGroup,omitempty"`
+	Reencrypt        bool                   `json:"reencrypt,omitempty"`
+	ReencryptedIds   []string               `json:"reencryptedIds,omitempty"`
+	Copied           bool                   `json:"copied"`
+	Verified         bool                   `json:"verified"`
+	Switched         bool                   `json:"switched"`
+	SourceDeleted    bool                   `json:"sourceDeleted"`
+}
+
+// Persisted state of a system secret migration, secret values are never stored
+type Migration struct {
+	Id          string                `json:"id"`
+	OrgId       string                `json:"orgId"`
+	ProjectId   string                `json:"projectId,omitempty"`
+	Request     SystemSecretReq       `json:"request"`
+	Scopes      []MigrationScopeState `json:"scopes"`
+	Phase       string                `json:"phase"`
+	Status      string                `json:"status"`
+	SecretIds   []string              `json:"secretIds,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	CreatedAt   time.Time             `json:"createdAt"`
+	UpdatedAt   time.Time             `json:"updatedAt"`
+	CompletedAt *time.Time            `json:"completedAt,omitempty"`
+}
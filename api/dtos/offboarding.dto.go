@@ -0,0 +1,35 @@
+package dtos
+
+import "time"
+
+// Registration found under an organization, the organization itself has no project
+type OrgRegistration struct {
+	SecretName string `json:"secretName"`
+	ProjectId  string `json:"projectId,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	Flow       string `json:"flow"`
+}
+
+// Preview of an organization deletion, confirmed with its token
+type OrgOffboarding struct {
+	OrgId             string            `json:"orgId"`
+	Registrations     []OrgRegistration `json:"registrations"`
+	ConfirmationToken string            `json:"confirmationToken"`
+	ExpiresAt         time.Time         `json:"expiresAt"`
+}
+
+// Outcome of deleting a registration and its secret group
+type OrgDeletionItem struct {
+	OrgRegistration
+	Status         string `json:"status"`
+	DeletedSecrets int    `json:"deletedSecrets"`
+	Error          string `json:"error,omitempty"`
+}
+
+type OrgDeletion struct {
+	OrgId   string            `json:"orgId"`
+	Items   []OrgDeletionItem `json:"items"`
+	Deleted int               `json:"deleted"`
+	Failed  int               `json:"failed"`
+	Skipped int               `json:"skipped"`
+}
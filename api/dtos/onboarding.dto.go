@@ -0,0 +1,12 @@
+package dtos
+
+// Template creating the role of a PRIVATE secret manager in the account of an organization
+// - the template is a CloudFormation template or a Terraform JSON configuration
+type OnboardingTemplate struct {
+	OrgId      string                 `json:"orgId"`
+	Format     string                 `json:"format"`
+	AccountId  string                 `json:"accountId"`
+	ExternalId string                 `json:"externalId"`
+	RoleName   string                 `json:"roleName"`
+	Template   map[string]interface{} `json:"template"`
+}
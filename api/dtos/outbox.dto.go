@@ -0,0 +1,17 @@
+package dtos
+
+import (
+	"time"
+
+	"secret-svc/pkg/events"
+)
+
+// Write announced to the outbox before it's sent to the secret manager
+// - the event is recorded once the write returned, or by the reconciliation when the record was lost
+type OutboxWrite struct {
+	Event      events.Event `json:"event"`
+	SecretName string       `json:"secretName"`
+	ARN        string       `json:"arn,omitempty"`
+	Region     string       `json:"region"`
+	StartedAt  time.Time    `json:"startedAt"`
+}
@@ -0,0 +1,163 @@
+package dtos
+
+import (
+	"regexp"
+	"secret-svc/pkg/constants"
+	"strings"
+	"time"
+)
+
+var policyIdPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+type PolicyReq struct {
+	Description string   `json:"description,omitempty"`
+	Effect      string   `json:"effect"`
+	Subjects    []string `json:"subjects"`
+	Methods     []string `json:"methods,omitempty"`
+	Routes      []string `json:"routes,omitempty"`
+	OrgIds      []string `json:"orgIds,omitempty"`
+	ProjectIds  []string `json:"projectIds,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	Secrets     []string `json:"secrets,omitempty"`
+}
+
+// Authorization policy matching callers and the requests they make
+// - every attribute is a list of '*' patterns, an empty list matches any value
+// - policies of the policy file can't be changed through the admin API
+type Policy struct {
+	Id string `json:"id"`
+	PolicyReq
+	Source    string     `json:"source"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Request evaluated against the policies
+// - an empty project or scope stands for every project or scope of the organization
+type AuthorizationReq struct {
+	Subject   string `json:"subject"`
+	Method    string `json:"method"`
+	Route     string `json:"route"`
+	Path      string `json:"path,omitempty"`
+	OrgId     string `json:"orgId"`
+	ProjectId string `json:"projectId,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+}
+
+// Outcome of a policy for an authorization request, Mismatch is the first attribute which didn't match
+type PolicyEvaluation struct {
+	PolicyId string `json:"policyId"`
+	Effect   string `json:"effect"`
+	Matched  bool   `json:"matched"`
+	Mismatch string `json:"mismatch,omitempty"`
+}
+
+// Authorization decision, deny policies override allow policies and nothing is allowed by default
+type AuthorizationDecision struct {
+	Request   AuthorizationReq   `json:"request"`
+	Allowed   bool               `json:"allowed"`
+	Reason    string             `json:"reason"`
+	PolicyId  string             `json:"policyId,omitempty"`
+	Policies  []PolicyEvaluation `json:"policies,omitempty"`
+	DecidedAt time.Time          `json:"decidedAt"`
+}
+
+// Helper method for creating a policy request
+// ///////////////////////////////////////////////
+// - 'effect' is ALLOW or DENY, at least one subject is required
+// - methods and routes are upper-cased
+func CreateNewPolicyReq(body interface{}) (PolicyReq, error) {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return PolicyReq{}, constants.ErrFormat
+	}
+
+	effect, _ := bodyMap["effect"].(string)
+	effect = strings.ToUpper(effect)
+	if effect != constants.ALLOW_EFFECT && effect != constants.DENY_EFFECT {
+		return PolicyReq{}, constants.ErrInvalidPolicyEffect
+	}
+
+	subjects, ok := getPolicyValues(bodyMap, "subjects", nil)
+	if !ok || len(subjects) == 0 {
+		return PolicyReq{}, constants.ErrMissingPolicySubjects
+	}
+	methods, ok := getPolicyValues(bodyMap, "methods", constants.ACCEPTED_METHODS[:])
+	if !ok {
+		return PolicyReq{}, constants.ErrInvalidPolicyMethods
+	}
+	routes, ok := getPolicyValues(bodyMap, "routes", constants.ACCEPTED_ROUTES[:])
+	if !ok {
+		return PolicyReq{}, constants.ErrInvalidPolicyRoutes
+	}
+
+	policyReq := PolicyReq{Effect: effect, Subjects: subjects, Methods: methods, Routes: routes}
+	policyReq.Description, _ = bodyMap["description"].(string)
+	for attribute, values := range map[string]*[]string{"orgIds": &policyReq.OrgIds, "projectIds": &policyReq.ProjectIds, "scopes": &policyReq.Scopes, "secrets": &policyReq.Secrets} {
+		if *values, ok = getPolicyValues(bodyMap, attribute, nil); !ok {
+			return PolicyReq{}, constants.ErrFormat
+		}
+	}
+
+	return policyReq, nil
+}
+
+// Helper method for checking the ID of a policy
+func CheckPolicyId(id string) error {
+	if !policyIdPattern.MatchString(id) {
+		return constants.ErrInvalidPolicyId
+	}
+	return nil
+}
+
+// Helper function to read a list of strings, upper-cased and checked when accepted values are given
+func getPolicyValues(bodyMap map[string]interface{}, attribute string, accepted []string) ([]string, bool) {
+	rawValues, exists := bodyMap[attribute]
+	if !exists {
+		return nil, true
+	}
+	values, ok := rawValues.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	policyValues := []string{}
+	for _, rawValue := range values {
+		value, ok := rawValue.(string)
+		if !ok || value == "" {
+			return nil, false
+		}
+		if accepted != nil {
+			value = strings.ToUpper(value)
+			if value != "*" && !contains(accepted, value) {
+				return nil, false
+			}
+		}
+		policyValues = append(policyValues, value)
+	}
+
+	return policyValues, true
+}
+
+// Helper method for creating the request of an authorization explanation
+// //////////////////////////////////////////////////////////////////////////
+// - 'subject' and 'method' are required, the other attributes are left empty when they're missing
+func CreateNewAuthorizationReq(body interface{}) (AuthorizationReq, error) {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return AuthorizationReq{}, constants.ErrFormat
+	}
+
+	request := AuthorizationReq{}
+	for attribute, value := range map[string]*string{"subject": &request.Subject, "method": &request.Method, "route": &request.Route, "path": &request.Path,
+		"orgId": &request.OrgId, "projectId": &request.ProjectId, "scope": &request.Scope, "secret": &request.Secret} {
+		*value, _ = bodyMap[attribute].(string)
+	}
+	request.Method = strings.ToUpper(request.Method)
+	request.Route = strings.ToUpper(request.Route)
+
+	if request.Subject == "" || request.Method == "" {
+		return AuthorizationReq{}, constants.ErrFormat
+	}
+	return request, nil
+}
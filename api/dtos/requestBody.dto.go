@@ -2,29 +2,97 @@ package dtos
 
 import (
 	"fmt"
+	"regexp"
 	"secret-svc/pkg/constants"
+	"secret-svc/pkg/generators"
 	"strings"
 )
 
+// ex: arn:aws:kms:us-east-1:111111111111:key/1234abcd-12ab-34cd-56ef-1234567890ab or arn:aws:kms:us-east-1:111111111111:alias/secrets
+var kmsKeyArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:kms:([a-z0-9-]+):\d{12}:(key/[A-Za-z0-9-]+|alias/[A-Za-z0-9/_-]+)$`)
+
 type SystemSecretReq struct {
 	Flow     string `json:"flow,omitempty"`
 	ARN      string `json:"arn,omitempty"`
 	Region   string `json:"region,omitempty"`
 	Provider string `json:"provider,omitempty"`
+	// Customer managed KMS key of the PRIVATE secrets, the default aws/secretsmanager key when empty
+	KmsKeyId string `json:"kmsKeyId,omitempty"`
+	// Per-scope settings, a scope listed here overrides the top-level flow
+	Scopes map[string]SystemSecretReq `json:"scopes,omitempty"`
 }
 
 type SecretReq struct {
-	Secret string `json:"secret,omitempty"`
+	Secret   string           `json:"secret,omitempty"`
+	Generate *generators.Spec `json:"generate,omitempty"`
 }
 
 // Helper method for creating a System Secret Obj
 // ///////////////////////////////////////////////////
+// - the 'scopes' attribute maps a scope to its own flow settings, scopes are checked against the registry
+// - the top-level flow is optional when 'scopes' is provided
 func CreateNewSystemSecretReq(body interface{}) (SystemSecretReq, error) {
 	bodyMap, ok := body.(map[string]interface{})
 	if !ok {
 		return SystemSecretReq{}, constants.ErrFormat
 	}
 
+	scopesVal, hasScopes := bodyMap["scopes"]
+	if !hasScopes {
+		return createSystemSecretReq(bodyMap)
+	}
+
+	scopesMap, ok := scopesVal.(map[string]interface{})
+	if !ok || len(scopesMap) == 0 {
+		return SystemSecretReq{}, constants.ErrInvalidScopesAttr
+	}
+
+	scopes := make(map[string]SystemSecretReq)
+	for scope, scopeBody := range scopesMap {
+		scopeMap, ok := scopeBody.(map[string]interface{})
+		if !ok {
+			return SystemSecretReq{}, constants.ErrFormat
+		}
+		if _, nested := scopeMap["scopes"]; nested {
+			return SystemSecretReq{}, constants.ErrInvalidScopesAttr
+		}
+
+		scopeReq, err := createSystemSecretReq(scopeMap)
+		if err != nil {
+			return SystemSecretReq{}, fmt.Errorf("%s scope: %w", scope, err)
+		}
+		scopes[scope] = scopeReq
+	}
+
+	requestBody := SystemSecretReq{}
+	if _, hasFlow := bodyMap[strings.ToLower(constants.FLOW_META_DATA)]; hasFlow {
+		var err error
+		if requestBody, err = createSystemSecretReq(bodyMap); err != nil {
+			return SystemSecretReq{}, err
+		}
+	}
+	requestBody.Scopes = scopes
+
+	return requestBody, nil
+}
+
+// Helper method for checking the flows of a System Secret Obj
+// ///////////////////////////////////////////////////////////////
+func CheckSystemSecretFlows(requestBody SystemSecretReq) error {
+	if requestBody.Flow != "" && !contains(constants.ACCEPTED_FLOWS[:], requestBody.Flow) {
+		return constants.ErrInvalidFlow
+	}
+	for _, scopeReq := range requestBody.Scopes {
+		if !contains(constants.ACCEPTED_FLOWS[:], scopeReq.Flow) {
+			return constants.ErrInvalidFlow
+		}
+	}
+	return nil
+}
+
+// Helper method for creating the flow settings of a System Secret Obj
+// ///////////////////////////////////////////////////////////////////////
+func createSystemSecretReq(bodyMap map[string]interface{}) (SystemSecretReq, error) {
 	flow, ok := bodyMap[strings.ToLower(constants.FLOW_META_DATA)].(string)
 	if !ok {
 		return SystemSecretReq{}, constants.ErrMissingFlowAttr
@@ -61,19 +129,76 @@ func CreateNewSystemSecretReq(body interface{}) (SystemSecretReq, error) {
 		}
 	}
 
+	kmsKeyId, err := getKmsKeyId(bodyMap, flow, region)
+	if err != nil {
+		return SystemSecretReq{}, err
+	}
+
 	return SystemSecretReq{
 		Flow:     flow,
 		ARN:      arn,
 		Region:   region,
 		Provider: provider,
+		KmsKeyId: kmsKeyId,
 	}, nil
 }
 
+// Helper method for reading the KMS key of a PRIVATE flow
+// ///////////////////////////////////////////////////////////
+// - the key is a key or alias ARN, in the region of the secret manager
+func getKmsKeyId(bodyMap map[string]interface{}, flow string, region string) (string, error) {
+	rawKmsKeyId, exists := bodyMap["kmsKeyId"]
+	if !exists {
+		return "", nil
+	}
+	if flow != constants.PRIVATE_FLOW {
+		return "", constants.ErrKmsKeyNotPrivate
+	}
+
+	kmsKeyId, _ := rawKmsKeyId.(string)
+	kmsRegion, _, err := ParseKmsKeyArn(kmsKeyId)
+	if err != nil {
+		return "", err
+	}
+	if kmsRegion != region {
+		return "", constants.ErrKmsKeyRegionMismatch
+	}
+
+	return kmsKeyId, nil
+}
+
+// Helper method for validating the ARN of a KMS key or alias, returns its region and resource
+func ParseKmsKeyArn(kmsKeyId string) (string, string, error) {
+	matches := kmsKeyArnPattern.FindStringSubmatch(kmsKeyId)
+	if matches == nil {
+		return "", "", constants.ErrInvalidKmsKey
+	}
+
+	return matches[1], matches[2], nil
+}
+
 // Helper method for creating a new secret request
 // /////////////////////////////////////////////////////
+// - the secret value can be generated by the service using the 'generate' attribute
 func CreateNewSecretReq(body interface{}) (SecretReq, error) {
 	bodyMap, _ := body.(map[string]interface{})
 	secret, ok := bodyMap[strings.ToLower(constants.SECRET_META_DATA)].(string)
+
+	if generateMap, generate := bodyMap["generate"].(map[string]interface{}); generate {
+		if ok {
+			return SecretReq{}, constants.ErrConflictingSecretAttrs
+		}
+
+		spec, err := CreateNewGeneratorSpec(generateMap)
+		if err != nil {
+			return SecretReq{}, err
+		}
+
+		return SecretReq{
+			Generate: &spec,
+		}, nil
+	}
+
 	if !ok {
 		return SecretReq{}, constants.ErrMissingSecretAttr
 	}
@@ -0,0 +1,69 @@
+package dtos
+
+import (
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/generators"
+	"time"
+)
+
+type RotationPolicyReq struct {
+	Interval  string          `json:"interval,omitempty"`
+	Generator generators.Spec `json:"generator,omitempty"`
+}
+
+// Rotation policy stored for a secret
+type RotationPolicy struct {
+	SecretId     string          `json:"secretId"`
+	OrgId        string          `json:"orgId"`
+	ProjectId    string          `json:"projectId,omitempty"`
+	Scope        string          `json:"scope,omitempty"`
+	Interval     string          `json:"interval"`
+	Generator    generators.Spec `json:"generator"`
+	LastRotated  *time.Time      `json:"lastRotated,omitempty"`
+	NextRotation time.Time       `json:"nextRotation"`
+	CreatedAt    time.Time       `json:"createdAt"`
+}
+
+// Rotation history entry recorded for every rotation attempt
+type RotationRecord struct {
+	SecretId  string    `json:"secretId"`
+	Trigger   string    `json:"trigger"`
+	Outcome   string    `json:"outcome"`
+	VersionId string    `json:"versionId,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	RotatedAt time.Time `json:"rotatedAt"`
+}
+
+// Helper method for creating a new rotation policy request
+// /////////////////////////////////////////////////////////////
+func CreateNewRotationPolicyReq(body interface{}) (RotationPolicyReq, error) {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return RotationPolicyReq{}, constants.ErrFormat
+	}
+
+	interval, ok := bodyMap["interval"].(string)
+	if !ok {
+		return RotationPolicyReq{}, constants.ErrMissingIntervalAttr
+	}
+
+	duration, err := time.ParseDuration(interval)
+	if err != nil || duration < time.Minute {
+		return RotationPolicyReq{}, constants.ErrMissingIntervalAttr
+	}
+
+	generatorMap, ok := bodyMap["generator"].(map[string]interface{})
+	if !ok {
+		return RotationPolicyReq{}, constants.ErrMissingGeneratorAttr
+	}
+
+	generator, err := CreateNewGeneratorSpec(generatorMap)
+	if err != nil {
+		return RotationPolicyReq{}, err
+	}
+
+	return RotationPolicyReq{
+		Interval:  interval,
+		Generator: generator,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package dtos
+
+import (
+	"regexp"
+	"secret-svc/pkg/constants"
+	"time"
+)
+
+// Scope names are used in secret names and the x-scope header
+var scopeNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,31}$`)
+
+type ScopeReq struct {
+	DefaultFlow   *SystemSecretReq `json:"defaultFlow,omitempty"`
+	MaxSecretSize int              `json:"maxSecretSize,omitempty"`
+	Masked        bool             `json:"masked"`
+	Default       bool             `json:"default"`
+}
+
+// Scope registered for an organization
+// - built-in scopes can't be removed, only their settings changed
+type Scope struct {
+	Name          string           `json:"name"`
+	OrgId         string           `json:"orgId"`
+	DefaultFlow   *SystemSecretReq `json:"defaultFlow,omitempty"`
+	MaxSecretSize int              `json:"maxSecretSize,omitempty"`
+	Masked        bool             `json:"masked"`
+	Default       bool             `json:"default"`
+	BuiltIn       bool             `json:"builtIn"`
+	UpdatedAt     *time.Time       `json:"updatedAt,omitempty"`
+}
+
+// Helper method for creating a scope request
+// //////////////////////////////////////////////
+// - 'defaultFlow' takes the same attributes as POST /system, used for scopes missing from the request
+// - 'maxSecretSize' is in bytes, 0 means unlimited
+func CreateNewScopeReq(body interface{}) (ScopeReq, error) {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return ScopeReq{}, constants.ErrFormat
+	}
+
+	var defaultFlow *SystemSecretReq
+	if rawFlow, exists := bodyMap["defaultFlow"]; exists {
+		flowMap, ok := rawFlow.(map[string]interface{})
+		if !ok {
+			return ScopeReq{}, constants.ErrFormat
+		}
+
+		flowReq, err := createSystemSecretReq(flowMap)
+		if err != nil {
+			return ScopeReq{}, err
+		}
+		if !contains(constants.ACCEPTED_FLOWS[:], flowReq.Flow) {
+			return ScopeReq{}, constants.ErrInvalidFlow
+		}
+		defaultFlow = &flowReq
+	}
+
+	var maxSecretSize int
+	if rawSize, exists := bodyMap["maxSecretSize"]; exists {
+		size, ok := rawSize.(float64)
+		if !ok || size < 0 || size != float64(int(size)) {
+			return ScopeReq{}, constants.ErrInvalidMaxSecretSize
+		}
+		maxSecretSize = int(size)
+	}
+
+	masked, _ := bodyMap["masked"].(bool)
+	isDefault, _ := bodyMap["default"].(bool)
+
+	return ScopeReq{
+		DefaultFlow:   defaultFlow,
+		MaxSecretSize: maxSecretSize,
+		Masked:        masked,
+		Default:       isDefault,
+	}, nil
+}
+
+// Helper method for checking the name of a scope
+// //////////////////////////////////////////////////
+func CheckScopeName(name string) error {
+	if !scopeNamePattern.MatchString(name) {
+		return constants.ErrInvalidScopeName
+	}
+	return nil
+}
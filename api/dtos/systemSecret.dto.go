@@ -0,0 +1,94 @@
+package dtos
+
+import (
+	"secret-svc/pkg/constants"
+	"strings"
+	"time"
+)
+
+// Registration of a key in the System secret manager
+// - the ARN of the shared secret manager is never returned, account IDs of PRIVATE ARNs and KMS keys are masked
+type SystemSecretRegistration struct {
+	SecretName string              `json:"secretName"`
+	Scope      string              `json:"scope,omitempty"`
+	Flow       string              `json:"flow"`
+	ARN        string              `json:"arn,omitempty"`
+	Region     string              `json:"region,omitempty"`
+	Provider   string              `json:"provider,omitempty"`
+	KmsKeyId   string              `json:"kmsKeyId,omitempty"`
+	VersionId  string              `json:"versionId,omitempty"`
+	Stages     []string            `json:"stages,omitempty"`
+	CreatedAt  *time.Time          `json:"createdAt,omitempty"`
+	Health     *RegistrationHealth `json:"health,omitempty"`
+}
+
+// Version of a system secret, AWS only keeps a limited number of them
+type SystemSecretVersion struct {
+	VersionId string     `json:"versionId"`
+	Stages    []string   `json:"stages,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+type SystemSecretVersions struct {
+	SecretName string                `json:"secretName"`
+	Scope      string                `json:"scope,omitempty"`
+	Versions   []SystemSecretVersion `json:"versions"`
+}
+
+// Attribute changed between two versions of a system secret
+type SystemSecretChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type SystemSecretDiff struct {
+	SecretName string                   `json:"secretName"`
+	Scope      string                   `json:"scope,omitempty"`
+	From       SystemSecretRegistration `json:"from"`
+	To         SystemSecretRegistration `json:"to"`
+	Changes    []SystemSecretChange     `json:"changes"`
+}
+
+// Helper method for creating a redacted registration from the metadata of a system secret
+// ///////////////////////////////////////////////////////////////////////////////////////////
+// - only the flow attributes are returned, anything else stored in the system secret is left out
+func CreateNewSystemSecretRegistration(secretName string, scope string, metadata map[string]interface{}) SystemSecretRegistration {
+	flow, _ := metadata[constants.FLOW_META_DATA].(string)
+	arn, _ := metadata[constants.ARN_META_DATA].(string)
+	region, _ := metadata[constants.REGION_META_DATA].(string)
+	provider, _ := metadata[constants.PROVIDER_META_DATA].(string)
+	kmsKeyId, _ := metadata[constants.KMS_KEY_META_DATA].(string)
+
+	registration := SystemSecretRegistration{
+		SecretName: secretName,
+		Scope:      scope,
+		Flow:       flow,
+		ARN:        RedactArn(flow, arn),
+		Region:     region,
+		Provider:   provider,
+	}
+	if kmsKeyId != "" {
+		registration.KmsKeyId = RedactArn(flow, kmsKeyId)
+	}
+	return registration
+}
+
+// Helper method for redacting the ARN of a system secret
+// //////////////////////////////////////////////////////////
+// - ex: arn:aws:iam::438463683713:role/Secrets -> arn:aws:iam::********3713:role/Secrets
+func RedactArn(flow string, arn string) string {
+	if flow != constants.PRIVATE_FLOW {
+		return ""
+	}
+
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return strings.Repeat("*", len(arn))
+	}
+
+	if account := parts[4]; len(account) > 4 {
+		parts[4] = strings.Repeat("*", len(account)-4) + account[len(account)-4:]
+	}
+	return strings.Join(parts, ":")
+}
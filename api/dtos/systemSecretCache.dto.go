@@ -0,0 +1,14 @@
+package dtos
+
+// Hit/miss statistics of the system secret cache of a replica
+type SystemSecretCacheStats struct {
+	Enabled       bool    `json:"enabled"`
+	Shared        bool    `json:"shared"`
+	Ttl           string  `json:"ttl"`
+	Entries       int     `json:"entries"`
+	Hits          uint64  `json:"hits"`
+	SharedHits    uint64  `json:"sharedHits"`
+	Misses        uint64  `json:"misses"`
+	Invalidations uint64  `json:"invalidations"`
+	HitRatio      float64 `json:"hitRatio"`
+}
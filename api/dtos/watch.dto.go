@@ -0,0 +1,45 @@
+package dtos
+
+import (
+	"strings"
+	"time"
+
+	"secret-svc/pkg/events"
+)
+
+// Change notification streamed to watchers, never carries secret values
+type SecretChange struct {
+	Id        string                 `json:"id,omitempty"`
+	Type      string                 `json:"type"`
+	VersionId string                 `json:"versionId,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// Helper method for creating a change notification from an event
+// //////////////////////////////////////////////////////////////////
+func CreateNewSecretChange(event events.Event) SecretChange {
+	return SecretChange{
+		Id:        event.SecretId,
+		Type:      event.Type,
+		VersionId: event.VersionId,
+		Metadata:  event.Metadata,
+		Timestamp: event.Timestamp,
+	}
+}
+
+// Helper method for reading the watched secret IDs
+// ///////////////////////////////////////////////////
+// - accepts repeated and comma separated ids
+func CreateNewWatchIds(values []string) []string {
+	ids := []string{}
+	for _, value := range values {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids
+}
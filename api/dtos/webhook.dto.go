@@ -0,0 +1,103 @@
+package dtos
+
+import (
+	"net/url"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"time"
+)
+
+type WebhookReq struct {
+	Url         string   `json:"url,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+// Webhook endpoint registered for an organization, project or scope
+type Webhook struct {
+	Id            string    `json:"id"`
+	OrgId         string    `json:"orgId"`
+	ProjectId     string    `json:"projectId,omitempty"`
+	Scope         string    `json:"scope,omitempty"`
+	Url           string    `json:"url"`
+	Events        []string  `json:"events"`
+	Description   string    `json:"description,omitempty"`
+	Active        bool      `json:"active"`
+	SigningSecret string    `json:"signingSecret,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Pending or dead-lettered delivery of an event to a webhook
+type WebhookDelivery struct {
+	Id            string       `json:"id"`
+	WebhookId     string       `json:"webhookId"`
+	OrgId         string       `json:"orgId"`
+	ProjectId     string       `json:"projectId,omitempty"`
+	Scope         string       `json:"scope,omitempty"`
+	Event         events.Event `json:"event"`
+	Attempts      int          `json:"attempts"`
+	LastStatus    int          `json:"lastStatus,omitempty"`
+	LastError     string       `json:"lastError,omitempty"`
+	NextAttemptAt time.Time    `json:"nextAttemptAt"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	DeadAt        *time.Time   `json:"deadAt,omitempty"`
+}
+
+// Helper method for creating a webhook request
+// ////////////////////////////////////////////////
+// - url is only required when creating webhooks
+func CreateNewWebhookReq(body interface{}, requireUrl bool) (WebhookReq, error) {
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return WebhookReq{}, constants.ErrFormat
+	}
+
+	webhookUrl, _ := bodyMap["url"].(string)
+	if webhookUrl != "" || requireUrl {
+		parsedUrl, err := url.ParseRequestURI(webhookUrl)
+		if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+			return WebhookReq{}, constants.ErrMissingUrlAttr
+		}
+	}
+
+	var eventTypes []string
+	if rawEvents, exists := bodyMap["events"]; exists {
+		values, ok := rawEvents.([]interface{})
+		if !ok || len(values) == 0 {
+			return WebhookReq{}, constants.ErrInvalidEventsAttr
+		}
+
+		for _, value := range values {
+			eventType, ok := value.(string)
+			if !ok || !contains(constants.ACCEPTED_EVENTS[:], eventType) {
+				return WebhookReq{}, constants.ErrInvalidEventsAttr
+			}
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+
+	description, _ := bodyMap["description"].(string)
+	var active *bool
+	if activeVal, ok := bodyMap["active"].(bool); ok {
+		active = &activeVal
+	}
+
+	return WebhookReq{
+		Url:         webhookUrl,
+		Events:      eventTypes,
+		Description: description,
+		Active:      active,
+	}, nil
+}
+
+func contains(arr []string, value string) bool {
+	for _, item := range arr {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
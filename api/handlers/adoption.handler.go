@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"strings"
+
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET - List Untagged Secrets Handler
+// //////////////////////////////////////
+// - PRIVATE secrets of the organization without a secret group, they block its migrations
+func ListUntaggedSecretsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	data, err := services.ListUntaggedSecrets(headers)
+
+	if err != nil {
+		status := 503
+		if err == constants.ErrAdoptionNotPrivate {
+			status = 409
+		}
+		c.JSON(status, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Untagged Secrets Returned",
+		Data:    data,
+	})
+}
+
+// POST - Adopt Untagged Secrets Handler
+// ////////////////////////////////////////
+// - tags the untagged secrets with the secret group of the key, as a job
+func AdoptUntaggedSecretsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewSecretAdoptionReq(rawRequestBody)
+
+	// Invalid Request Body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if headers.Flow != constants.PRIVATE_FLOW {
+		c.JSON(409, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   constants.ErrAdoptionNotPrivate.Error(),
+		})
+		return
+	}
+
+	job, err := services.EnqueueJob(headers, constants.SECRET_ADOPTION_JOB, nil, strings.Join(requestBody.SecretIds, ","))
+
+	if err != nil {
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	respondWithJob(c, "Secret Adoption Queued", job)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET - Query Audit Events Handler
+// ////////////////////////////////////
+// - filters and pagination are given as query params, see dtos.CreateNewAuditFilter
+func QueryAuditEventsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	filter, err := dtos.CreateNewAuditFilter(c.Request.URL.Query(), headers)
+
+	// Invalid filters
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.QueryAuditEvents(filter)
+	if err != nil {
+		status := 503
+		if err == constants.ErrInvalidNextToken {
+			status = 401
+		}
+		c.JSON(status, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Audit Events Returned",
+		Data:    data,
+	})
+}
+
+// GET - Verify Audit Chain Handler
+// ////////////////////////////////////
+// - a broken chain is returned with 'verified' false and its first break
+func VerifyAuditChainHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	verification, err := services.VerifyAuditChain(headers.OrgId)
+	if err != nil {
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	message := "Audit Chain Verified"
+	if !verification.Verified {
+		message = "Audit Chain Broken"
+	}
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    verification,
+	})
+}
+
+// GET - Export Audit Checkpoints Handler
+// //////////////////////////////////////////
+// - the export is returned as a file, without the API response envelope, for cmd/auditverify
+func ExportAuditCheckpointsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	export, err := services.ExportAuditCheckpoints(headers.OrgId)
+	if err != nil {
+		switch err {
+		case constants.ErrAuditCheckpointsDisabled:
+			c.JSON(403, dtos.ApiResponse{
+				Success: false,
+				Message: "FORBIDDEN",
+				Error:   err.Error(),
+			})
+		default:
+			c.JSON(503, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=\"audit-checkpoints-"+export.OrgId+".json\"")
+	c.JSON(200, export)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function for responding with dynamic secret errors
+// ////////////////////////////////////////////////////////////
+func dynamicErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrDynamicConfigNotFound, constants.ErrDynamicRoleNotFound, constants.ErrLeaseNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrRevocationInProgress, constants.ErrLeaseExpired:
+		c.JSON(409, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// PUT - Set PostgreSQL Connection Handler
+// //////////////////////////////////////////
+func PutPostgresConnectionHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewPostgresConnectionReq(rawRequestBody)
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.SetPostgresConnection(headers, requestBody)
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "PostgreSQL Connection Saved",
+		Data:    data,
+	})
+}
+
+// DELETE - Delete PostgreSQL Connection Handler
+// ////////////////////////////////////////////////
+func DeletePostgresConnectionHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.DeletePostgresConnection(headers)
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "PostgreSQL Connection Deleted",
+		Data:    data,
+	})
+}
+
+// GET - Get Dynamic Role Handler
+// /////////////////////////////////
+func GetDynamicRoleHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.GetDynamicRole(headers, c.Param("role"))
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Dynamic Role Returned",
+		Data:    data,
+	})
+}
+
+// PUT - Set Dynamic Role Handler
+// /////////////////////////////////
+func PutDynamicRoleHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	role, err := dtos.CreateNewDynamicRoleReq(c.Param("role"), rawRequestBody)
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.SetDynamicRole(headers, role)
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Dynamic Role Saved",
+		Data:    data,
+	})
+}
+
+// DELETE - Delete Dynamic Role Handler
+// ///////////////////////////////////////
+func DeleteDynamicRoleHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.DeleteDynamicRole(headers, c.Param("role"))
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Dynamic Role Deleted",
+		Data:    data,
+	})
+}
+
+// GET - Get PostgreSQL Credentials Handler
+// ///////////////////////////////////////////
+func GetPostgresCredentialsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.IssuePostgresCredentials(headers, c.Param("role"))
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Dynamic Credentials Issued",
+		Data:    data,
+	})
+}
+
+// GET - Get Lease Handler
+// //////////////////////////
+func GetLeaseHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.GetLease(headers, c.Param("leaseId"))
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Lease Returned",
+		Data:    data,
+	})
+}
+
+// PUT - Renew Lease Handler
+// ////////////////////////////
+func RenewLeaseHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewLeaseRenewReq(rawRequestBody)
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.RenewLease(headers, c.Param("leaseId"), requestBody)
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Lease Renewed",
+		Data:    data,
+	})
+}
+
+// DELETE - Revoke Lease Handler
+// ////////////////////////////////
+func RevokeLeaseHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.RevokeLease(headers, c.Param("leaseId"))
+	if err != nil {
+		dynamicErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Lease Revoked",
+		Data:    data,
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST - Generate Secret Handler
+// /////////////////////////////////
+func GenerateSecretHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	spec, err := dtos.CreateNewGeneratorReq(rawRequestBody)
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.GenerateSecret(headers, spec)
+
+	if err != nil {
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "New Secret Generated",
+		Data:    data,
+	})
+}
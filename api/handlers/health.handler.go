@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET - List PRIVATE Registration Health Handler
+// /////////////////////////////////////////////////
+// - returns the unhealthy registrations unless ?status= is given, ALL returns every registration
+func ListPrivateHealthHandler(c *gin.Context) {
+	status := strings.ToUpper(c.DefaultQuery("status", constants.UNHEALTHY_STATUS))
+	switch status {
+	case "ALL":
+		status = ""
+	case constants.HEALTHY_STATUS, constants.UNHEALTHY_STATUS, constants.UNKNOWN_STATUS:
+	default:
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   constants.ErrInvalidHealthStatus.Error(),
+		})
+		return
+	}
+
+	data, err := services.ListPrivateRegistrationHealth(status)
+	if err != nil {
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "PRIVATE Registration Health Returned",
+		Data:    data,
+	})
+}
+
+// GET - Metrics Handler
+// ////////////////////////
+// - Prometheus text format
+func GetMetricsHandler(c *gin.Context) {
+	c.Data(200, "text/plain; version=0.0.4; charset=utf-8", []byte(services.GetHealthMetrics()))
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET - List Inventory Handler
+// ////////////////////////////////
+// - filters and pagination are given as query params, see dtos.CreateNewInventoryFilter
+func ListInventoryHandler(c *gin.Context) {
+	filter, err := dtos.CreateNewInventoryFilter(c.Request.URL.Query())
+
+	// Invalid filters
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.ListInventory(filter)
+	if err != nil {
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Inventory Returned",
+		Data:    data,
+	})
+}
+
+// POST - Rebuild Inventory Handler
+// ////////////////////////////////////
+// - the index is rebuilt from the System secret manager by a job
+func RebuildInventoryHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	job, err := services.EnqueueJob(dtos.CustomHeaders{OrgId: headers.OrgId}, constants.INVENTORY_REBUILD_JOB, nil, "")
+
+	if err != nil {
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	respondWithJob(c, "Inventory Rebuild Queued", job)
+}
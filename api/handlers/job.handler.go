@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function to respond with the status code of a job error
+func jobErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrJobNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrJobFinished:
+		c.JSON(409, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// Helper function to respond with a queued job
+func respondWithJob(c *gin.Context, message string, job dtos.Job) {
+	c.Header("Location", "/jobs/"+job.Id)
+	c.JSON(202, dtos.ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    job,
+	})
+}
+
+// GET - Get Job Handler
+// ////////////////////////
+func GetJobHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	job, err := services.GetJob(headers, c.Param("id"))
+	if err != nil {
+		jobErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Job Retrieved",
+		Data:    job,
+	})
+}
+
+// POST - Cancel Job Handler
+// ////////////////////////////
+// - running jobs stop at their next checkpoint, migrations are rolled back
+func CancelJobHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	job, err := services.CancelJob(headers, c.Param("id"))
+	if err != nil {
+		jobErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(202, dtos.ApiResponse{
+		Success: true,
+		Message: "Job Cancellation Requested",
+		Data:    job,
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function to respond with the status code of a migration error
+func migrationErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrMigrationNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrMigrationInProgress, constants.ErrMigrationFinished, constants.ErrMigrationRollbackNotAllowed:
+		c.JSON(409, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// GET - List Migrations Handler
+// ////////////////////////////////
+func ListMigrationsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	migrations, err := services.ListMigrations(headers)
+	if err != nil {
+		migrationErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Migrations Retrieved",
+		Data:    migrations,
+	})
+}
+
+// GET - Get Migration Status Handler
+// /////////////////////////////////////
+func GetMigrationHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	migration, err := services.GetMigration(headers, c.Param("migrationId"))
+	if err != nil {
+		migrationErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Migration Retrieved",
+		Data:    migration,
+	})
+}
+
+// POST - Resume Migration Handler
+// //////////////////////////////////
+// - the migration is resumed by a job
+func ResumeMigrationHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	migrationId := c.Param("migrationId")
+	if err := services.CheckMigrationResume(headers, migrationId); err != nil {
+		migrationErrorResponse(c, err)
+		return
+	}
+
+	job, err := services.EnqueueJob(headers, constants.MIGRATION_RESUME_JOB, nil, migrationId)
+	if err != nil {
+		migrationErrorResponse(c, err)
+		return
+	}
+
+	respondWithJob(c, "Migration Resume Queued", job)
+}
+
+// POST - Rollback Migration Handler
+// ////////////////////////////////////
+// - the migration is rolled back by a job
+func RollbackMigrationHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	migrationId := c.Param("migrationId")
+	if err := services.CheckMigrationRollback(headers, migrationId); err != nil {
+		migrationErrorResponse(c, err)
+		return
+	}
+
+	job, err := services.EnqueueJob(headers, constants.MIGRATION_ROLLBACK_JOB, nil, migrationId)
+	if err != nil {
+		migrationErrorResponse(c, err)
+		return
+	}
+
+	respondWithJob(c, "Migration Rollback Queued", job)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function to respond with the status code of a migration plan error
+func migrationPlanErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrUntargetedScope, constants.ErrEmptyProjId, constants.ErrInvalidScope:
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrMigrationPlanNotFound, constants.ErrUnregisteredKey, constants.ErrKeyNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrMigrationPlanExpired, constants.ErrMigrationPlanUsed, constants.ErrMigrationPlanStale, constants.ErrMigrationPlanNotApprovable,
+		constants.ErrInvalidMigration, constants.ErrSameMigrationTarget, constants.ErrUntaggedPrivateSecrets, constants.ErrMigrationInProgress:
+		c.JSON(409, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// POST - Create Migration Plan Handler
+// ///////////////////////////////////////
+// - same request body as PUT /system
+func CreateMigrationPlanHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewSystemSecretReq(rawRequestBody)
+
+	// Invalid Request Body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Invalid Flow type
+	if err := dtos.CheckSystemSecretFlows(requestBody); err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	respondWithMigrationPlan(c, headers, requestBody)
+}
+
+// GET - Get Migration Plan Handler
+// ///////////////////////////////////
+func GetMigrationPlanHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	plan, err := services.GetMigrationPlan(headers, c.Param("planId"))
+	if err != nil {
+		migrationPlanErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Migration Plan Retrieved",
+		Data:    plan,
+	})
+}
+
+// POST - Approve Migration Plan Handler
+// ////////////////////////////////////////
+// - the planned migration is run by a job, the plan records its outcome
+func ApproveMigrationPlanHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	planId := c.Param("planId")
+	if err := services.CheckMigrationPlanApproval(headers, planId); err != nil {
+		migrationPlanErrorResponse(c, err)
+		return
+	}
+
+	job, err := services.EnqueueJob(headers, constants.PLAN_APPROVAL_JOB, nil, planId)
+	if err != nil {
+		migrationPlanErrorResponse(c, err)
+		return
+	}
+
+	respondWithJob(c, "Migration Plan Approved. Migration Queued", job)
+}
+
+// Helper function to create a migration plan and respond with it
+func respondWithMigrationPlan(c *gin.Context, headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) {
+	plan, err := services.CreateMigrationPlan(headers, requestBody)
+	if err != nil {
+		migrationPlanErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Migration Plan Created. Nothing is migrated until it is approved",
+		Data:    plan,
+	})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function for responding with organization offboarding errors
+// //////////////////////////////////////////////////////////////////////
+func offboardingErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrOrgOffboardingProject, constants.ErrMissingConfirmationToken, constants.ErrInvalidConfirmationToken:
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrUnregisteredKey:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// POST - Plan Organization Offboarding Handler
+// ///////////////////////////////////////////////
+// - lists what would be deleted and returns the confirmation token of the deletion
+func PlanOrgOffboardingHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	offboarding, err := services.PlanOrgOffboarding(headers)
+	if err != nil {
+		offboardingErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Organization Offboarding Planned. Nothing is deleted until it is confirmed",
+		Data:    offboarding,
+	})
+}
+
+// DELETE - Delete Organization Handler
+// ///////////////////////////////////////
+// - refused without the confirmation token of the x-confirmation-token header
+// - the organization and its projects are deleted by a job
+func DeleteOrganizationHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	if err := services.ConfirmOrgOffboarding(headers, c.Request.Header.Get(constants.CONFIRMATION_TOKEN_HEADER)); err != nil {
+		offboardingErrorResponse(c, err)
+		return
+	}
+
+	job, err := services.EnqueueJob(headers, constants.ORG_DELETION_JOB, nil, "")
+	if err != nil {
+		offboardingErrorResponse(c, err)
+		return
+	}
+
+	respondWithJob(c, "Organization Deletion Queued", job)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET - Get Onboarding Template Handler
+// ////////////////////////////////////////
+// - ?format= is CLOUDFORMATION (default) or TERRAFORM
+// - ?kmsKeyId= lists the customer managed KMS keys of the registrations, repeatable
+func GetOnboardingTemplateHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	onboarding, err := services.GetOnboardingTemplate(headers, c.DefaultQuery("format", constants.CLOUDFORMATION_FORMAT), c.QueryArray("kmsKeyId"))
+	if err != nil {
+		switch err {
+		case constants.ErrInvalidTemplateFormat, constants.ErrInvalidKmsKey:
+			c.JSON(401, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+		case constants.ErrExternalIdDisabled:
+			c.JSON(403, dtos.ApiResponse{
+				Success: false,
+				Message: "FORBIDDEN",
+				Error:   err.Error(),
+			})
+		default:
+			c.JSON(503, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Onboarding Template Returned",
+		Data:    onboarding,
+	})
+}
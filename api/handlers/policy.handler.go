@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function for responding with policy errors
+// ////////////////////////////////////////////////////
+func policyErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrPolicyNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrReadOnlyPolicy:
+		c.JSON(409, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	case constants.ErrFormat, constants.ErrInvalidPolicyId, constants.ErrInvalidPolicyEffect, constants.ErrMissingPolicySubjects,
+		constants.ErrInvalidPolicyMethods, constants.ErrInvalidPolicyRoutes:
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// GET - List Policies Handler
+// //////////////////////////////
+func ListPoliciesHandler(c *gin.Context) {
+	data, err := services.ListPolicies()
+	if err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Policies Returned",
+		Data:    data,
+	})
+}
+
+// GET - Get Policy Handler
+// ///////////////////////////
+func GetPolicyHandler(c *gin.Context) {
+	data, err := services.GetPolicy(c.Param("policyId"))
+	if err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Policy Returned",
+		Data:    data,
+	})
+}
+
+// PUT - Create/Replace Policy Handler
+// //////////////////////////////////////
+func PutPolicyHandler(c *gin.Context) {
+	id := c.Param("policyId")
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewPolicyReq(rawRequestBody)
+	if err == nil {
+		err = dtos.CheckPolicyId(id)
+	}
+	if err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	data, err := services.PutPolicy(id, requestBody)
+	if err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Policy Saved",
+		Data:    data,
+	})
+}
+
+// DELETE - Delete Policy Handler
+// /////////////////////////////////
+func DeletePolicyHandler(c *gin.Context) {
+	if err := services.DeletePolicy(c.Param("policyId")); err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Policy Deleted",
+	})
+}
+
+// POST - Explain Authorization Handler
+// ///////////////////////////////////////
+// - the body is the request to explain, ex: {"subject": "billing-svc", "method": "PUT", "route": "SECRET", "orgId": "org1", ...}
+func ExplainAuthorizationHandler(c *gin.Context) {
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	request, err := dtos.CreateNewAuthorizationReq(rawRequestBody)
+	if err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	data, err := services.ExplainAuthorization(request)
+	if err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Authorization Explained",
+		Data:    data,
+	})
+}
+
+// GET - List Authorization Decisions Handler
+// /////////////////////////////////////////////
+// - ?limit= returns the last decisions, 100 by default
+func ListAuthorizationDecisionsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil {
+		policyErrorResponse(c, constants.ErrFormat)
+		return
+	}
+
+	data, err := services.ListAuthorizationDecisions(limit)
+	if err != nil {
+		policyErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Authorization Decisions Returned",
+		Data:    data,
+	})
+}
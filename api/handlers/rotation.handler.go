@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET - Get Rotation Policy Handler
+// ////////////////////////////////////
+func GetRotationPolicyHandler(c *gin.Context) {
+	id := c.Param("id")
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	policy, err := services.GetRotationPolicy(headers, id)
+	if err != nil {
+		if err == constants.ErrRotationPolicyNotFound {
+			c.JSON(404, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	history, err := services.GetRotationHistory(headers, id)
+	if err != nil {
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Rotation Policy Returned",
+		Data: map[string]interface{}{
+			"policy":  policy,
+			"history": history,
+		},
+	})
+}
+
+// PUT - Set Rotation Policy Handler
+// ////////////////////////////////////
+func PutRotationPolicyHandler(c *gin.Context) {
+	id := c.Param("id")
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewRotationPolicyReq(rawRequestBody)
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.SetRotationPolicy(headers, id, requestBody)
+
+	if err != nil {
+		if err == constants.ErrKeyNotFound {
+			c.JSON(404, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Rotation Policy Saved",
+		Data:    data,
+	})
+}
+
+// DELETE - Delete Rotation Policy Handler
+// //////////////////////////////////////////
+func DeleteRotationPolicyHandler(c *gin.Context) {
+	id := c.Param("id")
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.DeleteRotationPolicy(headers, id)
+	if err != nil {
+		if err == constants.ErrRotationPolicyNotFound {
+			c.JSON(404, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Rotation Policy Deleted",
+		Data:    data,
+	})
+}
+
+// POST - Rotate Secret Now Handler
+// ///////////////////////////////////
+func RotateSecretHandler(c *gin.Context) {
+	id := c.Param("id")
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.RotateSecret(headers, id, constants.MANUAL_ROTATION)
+	if err != nil {
+		if err == constants.ErrRotationPolicyNotFound || err == constants.ErrKeyNotFound {
+			c.JSON(404, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		if err == constants.ErrRotationInProgress {
+			c.JSON(409, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Secret Rotated",
+		Data:    data,
+	})
+}
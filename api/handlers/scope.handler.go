@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function for responding with scope errors
+// ///////////////////////////////////////////////////
+func scopeErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrScopeNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// GET - List Scopes Handler
+// ////////////////////////////
+func ListScopesHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.ListScopes(headers.OrgId)
+	if err != nil {
+		scopeErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Scopes Returned",
+		Data:    data,
+	})
+}
+
+// GET - Get Scope Handler
+// //////////////////////////
+func GetScopeHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.GetScope(headers.OrgId, c.Param("scope"))
+	if err != nil {
+		scopeErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Scope Returned",
+		Data:    data,
+	})
+}
+
+// PUT - Register/Update Scope Handler
+// //////////////////////////////////////
+func PutScopeHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	name := c.Param("scope")
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewScopeReq(rawRequestBody)
+
+	// Invalid scope name
+	if err == nil {
+		err = dtos.CheckScopeName(name)
+	}
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.PutScope(headers.OrgId, name, requestBody)
+	if err != nil {
+		scopeErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Scope Saved",
+		Data:    data,
+	})
+}
+
+// DELETE - Delete Scope Handler
+// ////////////////////////////////
+// - built-in scopes are reset to their default settings
+func DeleteScopeHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	name := c.Param("scope")
+
+	if err := services.DeleteScope(headers.OrgId, name); err != nil {
+		scopeErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Scope Deleted",
+		Data:    name,
+	})
+}
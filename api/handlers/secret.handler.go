@@ -20,12 +20,29 @@ func GetHealthHandler(c *gin.Context) {
 
 // GET - Get secret by ID Handler
 // //////////////////////////////////
+// - ?reveal=true returns the value of a masked scope
 func GetSecretHandler(c *gin.Context) {
 	id := c.Param("id")
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
 	version := c.Query("version")
+	stage := c.Query("stage")
 
-	data, err := services.GetSecret(headers, id, version)
+	// Only the current and previous stages are exposed
+	if stage != "" && stage != constants.CURRENT_STAGE && stage != constants.PREVIOUS_STAGE {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   constants.ErrInvalidStage.Error(),
+		})
+		return
+	}
+
+	data, err := services.GetSecret(headers, id, version, stage)
+
+	// Values of masked scopes are only returned when revealed, the reveal is authorized by the Authorize middleware
+	if err == nil && c.Query("reveal") != "true" && services.IsScopeMasked(headers) {
+		data = constants.MASKED_SECRET_VALUE
+	}
 
 	if err != nil {
 		if err == constants.ErrUUIDsNotFound || err == constants.ErrKeyNotFound {
@@ -93,6 +110,27 @@ func CreateSecretHandler(c *gin.Context) {
 		return
 	}
 
+	// Secret value generated by the service
+	if requestBody.Generate != nil {
+		data, err := services.GenerateSecret(headers, *requestBody.Generate)
+
+		if err != nil {
+			c.JSON(503, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(201, dtos.ApiResponse{
+			Success: true,
+			Message: "New Secret Generated",
+			Data:    data,
+		})
+		return
+	}
+
 	decodedSecret, err := utils.Base64Decode(requestBody.Secret)
 
 	// Invalid base64 error
@@ -107,6 +145,16 @@ func CreateSecretHandler(c *gin.Context) {
 
 	data, err := services.CreateSecret(headers, decodedSecret)
 
+	// Secret larger than the scope allows
+	if err == constants.ErrSecretTooLarge {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	if err != nil {
 		c.JSON(503, dtos.ApiResponse{
 			Success: false,
@@ -141,6 +189,36 @@ func PutSecretHandler(c *gin.Context) {
 		return
 	}
 
+	// Secret value generated by the service
+	if requestBody.Generate != nil {
+		data, err := services.RegenerateSecret(headers, id, *requestBody.Generate)
+
+		if err != nil {
+			if err == constants.ErrUUIDsNotFound || err == constants.ErrKeyNotFound {
+				c.JSON(404, dtos.ApiResponse{
+					Success: false,
+					Message: "ERROR",
+					Error:   err.Error(),
+				})
+				return
+			}
+
+			c.JSON(503, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(201, dtos.ApiResponse{
+			Success: true,
+			Message: "Secret Regenerated",
+			Data:    data,
+		})
+		return
+	}
+
 	decodedSecret, err := utils.Base64Decode(requestBody.Secret)
 
 	// Invalid base64 string
@@ -155,6 +233,16 @@ func PutSecretHandler(c *gin.Context) {
 
 	data, err := services.UpdateSecret(headers, id, decodedSecret)
 
+	// Secret larger than the scope allows
+	if err == constants.ErrSecretTooLarge {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// Error Updating secret
 	if err != nil {
 		if err == constants.ErrUUIDsNotFound || err == constants.ErrKeyNotFound {
@@ -215,9 +303,10 @@ func DeleteSecretHandler(c *gin.Context) {
 
 // DELETE - Delete Secret Group Handler
 // //////////////////////////////////////////
+// - the secret group is deleted by a job
 func DeleteSecretGroupHandler(c *gin.Context) {
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
-	data, err := services.DeleteSecretGroup(headers, headers.ARN, headers.Region)
+	job, err := services.EnqueueJob(headers, constants.GROUP_DELETION_JOB, nil, "")
 
 	if err != nil {
 		c.JSON(503, dtos.ApiResponse{
@@ -228,9 +317,5 @@ func DeleteSecretGroupHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, dtos.ApiResponse{
-		Success: true,
-		Message: "Secret Group deleted with all secrets",
-		Data:    data,
-	})
+	respondWithJob(c, "Secret Group Deletion Queued", job)
 }
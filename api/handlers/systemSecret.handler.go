@@ -9,30 +9,97 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// GET - Get System Secret Handler
-// ////////////////////////////////////
-func GetSystemSecretHandler(c *gin.Context) {
-	headers := dtos.ExtractCustomHeaders(c.Request.Header)
-	data, _, _, _, _, err := services.GetSystemSecret(headers, "")
+func systemSecretErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrUnregisteredKey, constants.ErrSystemSecretVersionNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
 
-	if err != nil {
+	default:
 		c.JSON(503, dtos.ApiResponse{
 			Success: false,
 			Message: "ERROR",
 			Error:   err.Error(),
 		})
+	}
+}
+
+// GET - Get System Secret Handler
+// ////////////////////////////////////
+// - the registrations are redacted, secret values are never returned
+func GetSystemSecretHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	registrations, err := services.GetSystemSecretRegistrations(headers)
+	if err != nil {
+		systemSecretErrorResponse(c, err)
 		return
 	}
 
 	c.JSON(200, dtos.ApiResponse{
 		Success: true,
 		Message: "System Secret Retrived",
-		Data:    data,
+		Data:    registrations,
+	})
+}
+
+// GET - Get System Secret Versions Handler
+// /////////////////////////////////////////////
+func GetSystemSecretVersionsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	versions, err := services.GetSystemSecretVersions(headers)
+	if err != nil {
+		systemSecretErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "System Secret Versions Retrieved",
+		Data:    versions,
+	})
+}
+
+// GET - Get System Secret Version Handler
+// ////////////////////////////////////////////
+func GetSystemSecretVersionHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	registration, err := services.GetSystemSecretVersion(headers, c.Param("versionId"))
+	if err != nil {
+		systemSecretErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "System Secret Version Retrieved",
+		Data:    registration,
+	})
+}
+
+// GET - Diff System Secret Versions Handler
+// //////////////////////////////////////////////
+// - compares with the current registration unless ?against= is given
+func DiffSystemSecretVersionsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	diff, err := services.DiffSystemSecretVersions(headers, c.Param("versionId"), c.Query("against"))
+	if err != nil {
+		systemSecretErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "System Secret Versions Compared",
+		Data:    diff,
 	})
 }
 
 // POST - Create System Secret Handler
 // //////////////////////////////////////////
+// - PRIVATE secret managers are verified with a probe secret, ?dryRun=true only returns the verification
 func CreateSystemSecretHandler(c *gin.Context) {
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
 	rawRequestBody, _ := utils.ExtractRequestBody(c)
@@ -49,28 +116,67 @@ func CreateSystemSecretHandler(c *gin.Context) {
 	}
 
 	// Invalid flow type
-	if !utils.ArrayContains(constants.ACCEPTED_FLOWS[:], requestBody.Flow) {
+	if err := dtos.CheckSystemSecretFlows(requestBody); err != nil {
 		c.JSON(401, dtos.ApiResponse{
 			Success: false,
 			Message: "ERROR",
-			Error:   constants.ErrInvalidFlow.Error(),
+			Error:   err.Error(),
 		})
 		return
 	}
 
 	//Check if Provider, ARN, and Region are missing
-	if requestBody.Flow == constants.PRIVATE_FLOW {
-		if requestBody.Provider == "" || requestBody.ARN == "" || requestBody.Region == "" {
-			c.JSON(401, dtos.ApiResponse{
-				Success: false,
-				Message: "ERROR",
-				Error:   constants.ErrEmptyPvtFlowData.Error(),
-			})
-			return
+	scopeRequests := []dtos.SystemSecretReq{requestBody}
+	for _, scopeReq := range requestBody.Scopes {
+		scopeRequests = append(scopeRequests, scopeReq)
+	}
+	for _, scopeReq := range scopeRequests {
+		if scopeReq.Flow == constants.PRIVATE_FLOW {
+			if scopeReq.Provider == "" || scopeReq.ARN == "" || scopeReq.Region == "" {
+				c.JSON(401, dtos.ApiResponse{
+					Success: false,
+					Message: "ERROR",
+					Error:   constants.ErrEmptyPvtFlowData.Error(),
+				})
+				return
+			}
 		}
 	}
 
-	data, err := services.CreateSystemSecret(headers, requestBody)
+	// PRIVATE secret managers are verified before anything is saved
+	access, err := services.VerifySystemSecretAccess(headers, requestBody)
+	if err == constants.ErrPrivateAccessDenied {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Data:    access,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err == nil && c.Query("dryRun") == "true" {
+		c.JSON(200, dtos.ApiResponse{
+			Success: true,
+			Message: "System Secret Access Verified. Nothing is registered on dry runs",
+			Data:    access,
+		})
+		return
+	}
+
+	var data []string
+	if err == nil {
+		data, err = services.CreateSystemSecret(headers, requestBody)
+	}
+
+	// Scopes which aren't registered or targeted by the headers
+	if err == constants.ErrUntargetedScope || err == constants.ErrEmptyProjId || err == constants.ErrInvalidScope {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
 
 	// Error Creating System secret
 	if err != nil {
@@ -90,6 +196,7 @@ func CreateSystemSecretHandler(c *gin.Context) {
 
 // PUT - Update System Secret Handler
 // /////////////////////////////////////////
+// - creates a migration plan, the migration only runs once the plan is approved
 func UpdateSystemSecretHandler(c *gin.Context) {
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
 	rawRequestBody, _ := utils.ExtractRequestBody(c)
@@ -106,48 +213,24 @@ func UpdateSystemSecretHandler(c *gin.Context) {
 	}
 
 	// Invalid Flow type
-	if !utils.ArrayContains(constants.ACCEPTED_FLOWS[:], requestBody.Flow) {
+	if err := dtos.CheckSystemSecretFlows(requestBody); err != nil {
 		c.JSON(401, dtos.ApiResponse{
-			Success: false,
-			Message: "ERROR",
-			Error:   constants.ErrInvalidFlow.Error(),
-		})
-		return
-	}
-
-	newIDs, err := services.UpdateSystemSecret(headers, requestBody)
-	// Error updating System Secret
-	if err != nil {
-		if err == constants.ErrKeyNotFound || err == constants.ErrUnexpectedFlow {
-			c.JSON(404, dtos.ApiResponse{
-				Success: false,
-				Message: "ERROR",
-				Error:   err.Error(),
-			})
-			return
-		}
-
-		c.JSON(503, dtos.ApiResponse{
 			Success: false,
 			Message: "ERROR",
 			Error:   err.Error(),
 		})
 		return
-
 	}
 
-	c.JSON(201, dtos.ApiResponse{
-		Success: true,
-		Message: "System Secret Updated. Migrated Ids...",
-		Data:    newIDs,
-	})
+	respondWithMigrationPlan(c, headers, requestBody)
 }
 
 // DELETE - Delete System Secret Handler
 // //////////////////////////////////////////
+// - the system secrets and their secret groups are deleted by a job
 func DeleteSystemSecretHandler(c *gin.Context) {
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
-	secretNames, err := services.DeleteSystemSecret(headers)
+	job, err := services.EnqueueJob(headers, constants.SYSTEM_DELETION_JOB, nil, "")
 
 	if err != nil {
 		c.JSON(503, dtos.ApiResponse{
@@ -158,9 +241,16 @@ func DeleteSystemSecretHandler(c *gin.Context) {
 		return
 	}
 
+	respondWithJob(c, "System Secret Deletion Queued", job)
+}
+
+// GET - System Secret Cache Stats Handler
+// ///////////////////////////////////////////
+// - statistics are kept per replica
+func GetSystemSecretCacheStatsHandler(c *gin.Context) {
 	c.JSON(200, dtos.ApiResponse{
 		Success: true,
-		Message: "Deleted Secrets from the System Secret Manager",
-		Data:    secretNames,
+		Message: "System Secret Cache Stats Returned",
+		Data:    services.GetSystemSecretCacheStats(),
 	})
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"io"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+var WATCH_BUFFER = 100
+var WATCH_HEARTBEAT_INTERVAL = 15 * time.Second
+
+// GET - Watch Secrets Handler
+// //////////////////////////////
+// - streams change notifications as Server-Sent Events
+// - resumes after the Last-Event-ID header (or lastEventId query)
+func WatchSecretsHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	ids := dtos.CreateNewWatchIds(c.QueryArray("ids"))
+	lastEventId := c.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.Query("lastEventId")
+	}
+
+	// Watching before reading the missed events so nothing is lost in between
+	live, stop := events.Watch(WATCH_BUFFER)
+	defer stop()
+
+	var missed []events.Event
+	if lastEventId != "" {
+		var found bool
+		var err error
+		missed, found, err = services.GetMissedSecretEvents(headers, ids, lastEventId)
+		if err != nil {
+			c.JSON(503, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		// The last event is no longer retained, watchers have to reload their secrets
+		if !found {
+			missed = []events.Event{{Type: constants.RESET_EVENT, Timestamp: time.Now().UTC()}}
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+
+	sent := map[string]bool{}
+	for _, event := range missed {
+		renderSecretChange(c, event)
+		sent[event.Id] = true
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(WATCH_HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-live:
+			// Closed when this watcher fell behind, clients resume using the last event ID
+			if !ok {
+				return false
+			}
+			if !sent[event.Id] && services.SecretEventMatches(headers, ids, event) {
+				renderSecretChange(c, event)
+			}
+			return true
+
+		case <-heartbeat.C:
+			w.Write([]byte(": heartbeat\n\n"))
+			return true
+
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// Helper function to write an event as a Server-Sent Event
+// ///////////////////////////////////////////////////////////
+func renderSecretChange(c *gin.Context, event events.Event) {
+	c.Render(-1, sse.Event{
+		Id:    event.Id,
+		Event: event.Type,
+		Data:  dtos.CreateNewSecretChange(event),
+	})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function for responding with webhook errors
+// /////////////////////////////////////////////////////
+func webhookErrorResponse(c *gin.Context, err error) {
+	switch err {
+	case constants.ErrWebhookNotFound, constants.ErrDeliveryNotFound:
+		c.JSON(404, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+
+	default:
+		c.JSON(503, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// POST - Create Webhook Handler
+// ////////////////////////////////
+func CreateWebhookHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewWebhookReq(rawRequestBody, true)
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.CreateWebhook(headers, requestBody)
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Webhook Created",
+		Data:    data,
+	})
+}
+
+// GET - List Webhooks Handler
+// //////////////////////////////
+func ListWebhooksHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.ListWebhooks(headers)
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Webhooks Returned",
+		Data:    data,
+	})
+}
+
+// GET - Get Webhook Handler
+// ////////////////////////////
+func GetWebhookHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.GetWebhook(headers, c.Param("id"))
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Webhook Returned",
+		Data:    data,
+	})
+}
+
+// PUT - Update Webhook Handler
+// ///////////////////////////////
+func PutWebhookHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	rawRequestBody, _ := utils.ExtractRequestBody(c)
+	requestBody, err := dtos.CreateNewWebhookReq(rawRequestBody, false)
+
+	// Invalid request body
+	if err != nil {
+		c.JSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "ERROR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	data, err := services.UpdateWebhook(headers, c.Param("id"), requestBody)
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(201, dtos.ApiResponse{
+		Success: true,
+		Message: "Webhook Updated",
+		Data:    data,
+	})
+}
+
+// DELETE - Delete Webhook Handler
+// //////////////////////////////////
+func DeleteWebhookHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.DeleteWebhook(headers, c.Param("id"))
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Webhook Deleted",
+		Data:    data,
+	})
+}
+
+// GET - List Dead Letters Handler
+// //////////////////////////////////
+func ListDeadLettersHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.ListDeadLetters(headers)
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Dead Letters Returned",
+		Data:    data,
+	})
+}
+
+// POST - Replay Dead Letter Handler
+// ////////////////////////////////////
+func ReplayDeadLetterHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.ReplayDeadLetter(headers, c.Param("deliveryId"))
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Dead Letter Replayed",
+		Data:    data,
+	})
+}
+
+// DELETE - Delete Dead Letter Handler
+// //////////////////////////////////////
+func DeleteDeadLetterHandler(c *gin.Context) {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+
+	data, err := services.DeleteDeadLetter(headers, c.Param("deliveryId"))
+	if err != nil {
+		webhookErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(200, dtos.ApiResponse{
+		Success: true,
+		Message: "Dead Letter Deleted",
+		Data:    data,
+	})
+}
@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"secret-svc/api/dtos"
+	"secret-svc/api/services"
 	"secret-svc/pkg/constants"
 
 	"github.com/gin-gonic/gin"
@@ -12,9 +13,9 @@ import (
 func AddDefaultScope(c *gin.Context) {
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
 
-	// Adding the "OTHERS" scope if the projectid is provided without scopes
+	// Adding the default scope of the organization if the projectid is provided without scopes
 	if headers.ProjectId != "" && headers.Scope == "" {
-		c.Request.Header.Set(constants.SCOPE_HEADER, constants.OTHERS_SCOPE)
+		c.Request.Header.Set(constants.SCOPE_HEADER, services.GetDefaultScope(headers.OrgId))
 	}
 	c.Next()
 }
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/audit"
+	"secret-svc/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware to record an audit event for every secret and system request
+// ///////////////////////////////////////////////////////////////////////////
+// - runs before the authentication, rejected and denied requests are recorded too
+// - the headers are read after the request, secret routes are recorded with their default scope
+func Audit(c *gin.Context) {
+	route := getPolicyRoute(c.FullPath())
+	if !services.IsAuditedRoute(route) {
+		c.Next()
+		return
+	}
+
+	trail := services.StartAuditTrail(dtos.ExtractCustomHeaders(c.Request.Header).TraceId)
+	c.Next()
+
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	event := audit.Event{
+		Actor:     services.ANONYMOUS_SUBJECT,
+		TraceId:   headers.TraceId,
+		OrgId:     headers.OrgId,
+		ProjectId: headers.ProjectId,
+		Scope:     headers.Scope,
+		SecretId:  c.Param("id"),
+		Action:    services.GetAuditAction(route, c.Request.Method),
+		Path:      c.FullPath(),
+		Status:    c.Writer.Status(),
+	}
+	identity, authenticated := auth.GetIdentity(c.Request.Context())
+	if authenticated {
+		event.Actor = identity.Subject
+	}
+	event.Outcome = services.GetAuditOutcome(event.Status, authenticated || !auth.Enabled())
+
+	services.FinishAuditTrail(trail, event)
+}
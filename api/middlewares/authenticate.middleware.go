@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/auth"
+	"secret-svc/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Middleware to authenticate the callers of the service
+// ////////////////////////////////////////////////////////
+// - accepts a client certificate verified by the TLS server, or a JWT signed by a key of the JWKS
+// - the identity is added to the request context, see auth.GetIdentity
+func Authenticate(c *gin.Context) {
+	if !auth.Enabled() {
+		c.Next()
+		return
+	}
+
+	identity, err := auth.Authenticate(c.Request)
+	if err != nil {
+		zap.L().Error("Authentication Failed :: " + err.Error())
+		c.AbortWithStatusJSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "UNAUTHORIZED",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Set(constants.IDENTITY_CONTEXT_KEY, identity)
+	c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), identity))
+	c.Next()
+}
@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/auth"
+	"secret-svc/pkg/constants"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// First path segment of every route group, after the API prefix
+var policyRoutes = map[string]string{
+	"system":   constants.SYSTEM_ROUTE,
+	"secret":   constants.SECRET_ROUTE,
+	"dynamic":  constants.DYNAMIC_ROUTE,
+	"webhooks": constants.WEBHOOK_ROUTE,
+	"jobs":     constants.JOB_ROUTE,
+	"admin":    constants.ADMIN_ROUTE,
+	"audit":    constants.AUDIT_ROUTE,
+}
+
+// Middleware to authorize the requests with the policies
+// /////////////////////////////////////////////////////////
+// - secret routes without a x-scope header are authorized against the default scope they use
+// - revealing the values of a masked scope is also authorized, as the REVEAL method
+// - every decision is recorded, see services.Authorize
+func Authorize(c *gin.Context) {
+	if !services.IsAuthorizationEnabled() {
+		c.Next()
+		return
+	}
+
+	request := GetAuthorizationReq(c)
+	requests := []dtos.AuthorizationReq{request}
+	if request.Route == constants.SECRET_ROUTE && c.Query("reveal") == "true" && services.IsScopeMasked(dtos.CustomHeaders{OrgId: request.OrgId, ProjectId: request.ProjectId, Scope: request.Scope}) {
+		request.Method = constants.REVEAL_METHOD
+		requests = append(requests, request)
+	}
+
+	for _, request := range requests {
+		decision, err := services.Authorize(request)
+		if err != nil {
+			c.AbortWithStatusJSON(503, dtos.ApiResponse{
+				Success: false,
+				Message: "ERROR",
+				Error:   err.Error(),
+			})
+			return
+		}
+		if !decision.Allowed {
+			c.AbortWithStatusJSON(403, dtos.ApiResponse{
+				Success: false,
+				Message: "FORBIDDEN",
+				Error:   constants.ErrAccessDenied.Error(),
+			})
+			return
+		}
+	}
+
+	c.Next()
+}
+
+// Helper function to get the authorization request of a request
+// /////////////////////////////////////////////////////////////////
+func GetAuthorizationReq(c *gin.Context) dtos.AuthorizationReq {
+	headers := dtos.ExtractCustomHeaders(c.Request.Header)
+	request := dtos.AuthorizationReq{
+		Subject:   services.ANONYMOUS_SUBJECT,
+		Method:    c.Request.Method,
+		Path:      c.FullPath(),
+		OrgId:     headers.OrgId,
+		ProjectId: headers.ProjectId,
+		Scope:     headers.Scope,
+		Secret:    c.Param("id"),
+	}
+	if identity, ok := auth.GetIdentity(c.Request.Context()); ok {
+		request.Subject = identity.Subject
+	}
+
+	request.Route = getPolicyRoute(c.FullPath())
+
+	if (request.Route == constants.SECRET_ROUTE || request.Route == constants.DYNAMIC_ROUTE) && request.ProjectId != "" && request.Scope == "" {
+		request.Scope = services.GetDefaultScope(request.OrgId)
+	}
+
+	return request
+}
+
+// Helper function to get the route group of a route path, empty for unmatched paths
+func getPolicyRoute(path string) string {
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if route, found := policyRoutes[segment]; found {
+			return route
+		}
+	}
+
+	return ""
+}
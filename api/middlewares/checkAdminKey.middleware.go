@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Middleware to protect the admin routes
+// ////////////////////////////////////////////////
+// - the x-admin-key header has to match ADMIN_API_KEY, admin routes are disabled without it
+func CheckAdminKey(c *gin.Context) {
+	adminKey := utils.GetEnvVar("ADMIN_API_KEY")
+	if adminKey == "" {
+		zap.L().Error(constants.ErrAdminApiDisabled.Error())
+		c.AbortWithStatusJSON(403, dtos.ApiResponse{
+			Success: false,
+			Message: "FORBIDDEN",
+			Error:   constants.ErrAdminApiDisabled.Error(),
+		})
+		return
+	}
+
+	providedKey := c.Request.Header.Get(constants.ADMIN_KEY_HEADER)
+	if subtle.ConstantTimeCompare([]byte(providedKey), []byte(adminKey)) != 1 {
+		zap.L().Error(constants.ErrInvalidAdminKey.Error())
+		c.AbortWithStatusJSON(401, dtos.ApiResponse{
+			Success: false,
+			Message: "UNAUTHORIZED",
+			Error:   constants.ErrInvalidAdminKey.Error(),
+		})
+		return
+	}
+
+	c.Next()
+}
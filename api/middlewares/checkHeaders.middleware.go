@@ -2,8 +2,8 @@ package middlewares
 
 import (
 	"secret-svc/api/dtos"
+	"secret-svc/api/services"
 	"secret-svc/pkg/constants"
-	"secret-svc/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -15,6 +15,7 @@ import (
 	- Trace Id is required.
 	- OrganizationId is required if the ProjectId is provided.
 	- ProjectId is required if the Scope is provided.
+	- Scope has to be registered for the organization.
 */
 func CheckHeaders(c *gin.Context) {
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
@@ -50,8 +51,8 @@ func CheckHeaders(c *gin.Context) {
 			Error:   constants.ErrEmptyProjId.Error(),
 		})
 		c.Abort()
-	} else if headers.ProjectId != "" && headers.Scope != "" && !utils.ArrayContains(constants.ACCEPTED_SCOPES[:], headers.Scope) {
-		// Invalid Scope provided
+	} else if headers.ProjectId != "" && headers.Scope != "" && !services.IsScopeRegistered(headers.OrgId, headers.Scope) {
+		// Scope not registered for the organization
 		zap.L().Error(constants.ErrInvalidScope.Error())
 		c.JSON(401, dtos.ApiResponse{
 			Success: false,
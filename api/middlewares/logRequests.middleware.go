@@ -10,9 +10,9 @@ import (
 
 var req *dtos.RequestLog
 
-// TODO :: Implement Auditing (Ex: redshift)
 // Middleware to Log Requests
 // /////////////////////////////////
+// - secret and system requests are also audited, see Audit
 func LogRequests(c *gin.Context) {
 	req = dtos.CreateNewApiRequestLog(c.Request)
 	loggers.UpdateLoggerData(req)
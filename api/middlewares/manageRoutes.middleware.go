@@ -15,8 +15,8 @@ func ManageSecretRoutes(c *gin.Context) {
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
 	version := c.Query("version")
 
-	// Get system secret including ARN, Region, and Provider
-	_, arn, region, provider, flow, err := services.GetSystemSecret(headers, version)
+	// Get system secret including ARN, Region, and Provider (cached)
+	arn, region, provider, flow, err := services.LookupSystemSecret(headers, version)
 	// Check registrations
 	if err != nil {
 		if err == constants.ErrUnregisteredKey {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"secret-svc/api/dtos"
+	"secret-svc/api/services"
 	"secret-svc/pkg/constants"
 	"secret-svc/pkg/utils"
 	"time"
@@ -19,11 +20,19 @@ var redisPool *redis.Pool
 
 // Middleware used for the redis Implementation
 // //////////////////////////////////////////////////
+// - registered on the secret and system routes after the authorization, a rejected request never holds a lock
+// - requests pass through when Redis was bypassed
 func RedisLockMiddleware(c *gin.Context) {
+	if redisPool == nil {
+		c.Next()
+		return
+	}
+
 	headers := dtos.ExtractCustomHeaders(c.Request.Header)
-	// Adding default scope to lighten traffic
+	// Locking on the default scope to lighten traffic
+	// - the request header is left untouched so system routes can still target every scope
 	if headers.ProjectId != "" && headers.Scope == "" {
-		c.Request.Header.Set(constants.SCOPE_HEADER, constants.OTHERS_SCOPE)
+		headers.Scope = services.GetDefaultScope(headers.OrgId)
 	}
 
 	lockId := utils.CreatePrefix(headers)
@@ -36,6 +45,20 @@ func RedisLockMiddleware(c *gin.Context) {
 		if acquiredLock {
 			zap.L().Info("Lock Accquired for :: " + lockId)
 			defer ReleaseLock(lockId)
+
+			// Jobs and migrations of the key rewrite its secret groups, writes wait for them to finish
+			if err := services.CheckSecretWritable(headers); err != nil {
+				status := 503
+				if err == constants.ErrSecretGroupBusy {
+					status = 409
+				}
+				c.AbortWithStatusJSON(status, dtos.ApiResponse{
+					Success: false,
+					Message: "ERROR",
+					Error:   err.Error(),
+				})
+				return
+			}
 			c.Next()
 		} else {
 			zap.L().Info("Failed to acquire Redis lock :: " + lockId + " :: " + err.Error())
@@ -74,6 +97,12 @@ func InitiallizeRedis(redisAddr string, redisPassword string) error {
 	return nil
 }
 
+// Returns the Redis pool, nil when Redis was not initialized
+// ///////////////////////////////////////////////////////////////
+func GetRedisPool() *redis.Pool {
+	return redisPool
+}
+
 // Method for pinging Redis
 // ////////////////////////////
 func pingRedis() error {
@@ -118,6 +147,31 @@ func AcquireLock(key string) (bool, error) {
 	}
 }
 
+// Returns true while a lock of the prefix is held
+// ///////////////////////////////////////////////////
+// - prefixes are matched loosely, 'org1' also matches the locks of 'org10'
+func GroupLocksHeld(prefix string) (bool, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", "secretlock:"+prefix+"*", "COUNT", 100))
+		if err != nil {
+			return false, err
+		}
+
+		cursor, _ = redis.Int(values[0], nil)
+		keys, _ := redis.Strings(values[1], nil)
+		if len(keys) > 0 {
+			return true, nil
+		}
+		if cursor == 0 {
+			return false, nil
+		}
+	}
+}
+
 // Method for releazing Locks
 // ///////////////////////////////
 func ReleaseLock(key string) {
@@ -14,15 +14,31 @@ var API string = ""
 func SetHealthRoute(router *gin.Engine) {
 	healthRouter := router.Group(API)
 	healthRouter.GET("/health", handlers.GetHealthHandler)
+	healthRouter.GET("/metrics", handlers.GetMetricsHandler)
 }
 
 // System Secret Routes
 // /////////////////////////
 func SetSystemSecretRoutes(router *gin.Engine) {
 	systemSecretRouter := router.Group(API + "/system")
+	systemSecretRouter.Use(middlewares.RedisLockMiddleware)
+	systemSecretRouter.GET("/", handlers.GetSystemSecretHandler)
+	systemSecretRouter.GET("/versions", handlers.GetSystemSecretVersionsHandler)
+	systemSecretRouter.GET("/versions/:versionId", handlers.GetSystemSecretVersionHandler)
+	systemSecretRouter.GET("/versions/:versionId/diff", handlers.DiffSystemSecretVersionsHandler)
 	systemSecretRouter.POST("/", handlers.CreateSystemSecretHandler)
 	systemSecretRouter.PUT("/", handlers.UpdateSystemSecretHandler)
 	systemSecretRouter.DELETE("/", handlers.DeleteSystemSecretHandler)
+	systemSecretRouter.GET("/onboarding/template", handlers.GetOnboardingTemplateHandler)
+	systemSecretRouter.POST("/org/offboard", handlers.PlanOrgOffboardingHandler)
+	systemSecretRouter.DELETE("/org", handlers.DeleteOrganizationHandler)
+	systemSecretRouter.POST("/plans", handlers.CreateMigrationPlanHandler)
+	systemSecretRouter.GET("/plans/:planId", handlers.GetMigrationPlanHandler)
+	systemSecretRouter.POST("/plans/:planId/approve", handlers.ApproveMigrationPlanHandler)
+	systemSecretRouter.GET("/migrations", handlers.ListMigrationsHandler)
+	systemSecretRouter.GET("/migrations/:migrationId", handlers.GetMigrationHandler)
+	systemSecretRouter.POST("/migrations/:migrationId/resume", handlers.ResumeMigrationHandler)
+	systemSecretRouter.POST("/migrations/:migrationId/rollback", handlers.RollbackMigrationHandler)
 }
 
 // Secret Routes
@@ -30,10 +46,91 @@ func SetSystemSecretRoutes(router *gin.Engine) {
 func SetSecretRoutes(router *gin.Engine) {
 	secretRouter := router.Group(API + "/secret")
 	secretRouter.Use(middlewares.ManageSecretRoutes)
+	secretRouter.Use(middlewares.RedisLockMiddleware)
+	secretRouter.GET("/watch", handlers.WatchSecretsHandler)
 	secretRouter.GET("/:id", handlers.GetSecretHandler)
 	secretRouter.GET("/versions/:id", handlers.GetSecretVersionsHandler)
 	secretRouter.POST("/", handlers.CreateSecretHandler)
+	secretRouter.POST("/generate", handlers.GenerateSecretHandler)
 	secretRouter.PUT("/:id", handlers.PutSecretHandler)
 	secretRouter.DELETE("/:id", handlers.DeleteSecretHandler)
 	secretRouter.DELETE("/group", handlers.DeleteSecretGroupHandler)
+	secretRouter.GET("/untagged", handlers.ListUntaggedSecretsHandler)
+	secretRouter.POST("/adopt", handlers.AdoptUntaggedSecretsHandler)
+	secretRouter.GET("/rotation/:id", handlers.GetRotationPolicyHandler)
+	secretRouter.PUT("/rotation/:id", handlers.PutRotationPolicyHandler)
+	secretRouter.DELETE("/rotation/:id", handlers.DeleteRotationPolicyHandler)
+	secretRouter.POST("/rotate/:id", handlers.RotateSecretHandler)
+}
+
+// Dynamic Secret Routes
+// //////////////////////////
+func SetDynamicSecretRoutes(router *gin.Engine) {
+	dynamicRouter := router.Group(API + "/dynamic")
+	dynamicRouter.Use(middlewares.ManageSecretRoutes)
+	dynamicRouter.PUT("/postgres/config", handlers.PutPostgresConnectionHandler)
+	dynamicRouter.DELETE("/postgres/config", handlers.DeletePostgresConnectionHandler)
+	dynamicRouter.GET("/postgres/roles/:role", handlers.GetDynamicRoleHandler)
+	dynamicRouter.PUT("/postgres/roles/:role", handlers.PutDynamicRoleHandler)
+	dynamicRouter.DELETE("/postgres/roles/:role", handlers.DeleteDynamicRoleHandler)
+	dynamicRouter.GET("/postgres/creds/:role", handlers.GetPostgresCredentialsHandler)
+	dynamicRouter.GET("/leases/:leaseId", handlers.GetLeaseHandler)
+	dynamicRouter.PUT("/leases/:leaseId/renew", handlers.RenewLeaseHandler)
+	dynamicRouter.DELETE("/leases/:leaseId", handlers.RevokeLeaseHandler)
+}
+
+// Job Routes
+// ///////////////
+// - registered before the default scope so jobs of a whole project can be queried
+func SetJobRoutes(router *gin.Engine) {
+	jobRouter := router.Group(API + "/jobs")
+	jobRouter.GET("/:id", handlers.GetJobHandler)
+	jobRouter.POST("/:id/cancel", handlers.CancelJobHandler)
+}
+
+// Webhook Routes
+// ///////////////////
+// - registered before the default scope so webhooks can cover a whole project
+func SetWebhookRoutes(router *gin.Engine) {
+	webhookRouter := router.Group(API + "/webhooks")
+	webhookRouter.POST("/", handlers.CreateWebhookHandler)
+	webhookRouter.GET("/", handlers.ListWebhooksHandler)
+	webhookRouter.GET("/deadletters", handlers.ListDeadLettersHandler)
+	webhookRouter.POST("/deadletters/:deliveryId/replay", handlers.ReplayDeadLetterHandler)
+	webhookRouter.DELETE("/deadletters/:deliveryId", handlers.DeleteDeadLetterHandler)
+	webhookRouter.GET("/:id", handlers.GetWebhookHandler)
+	webhookRouter.PUT("/:id", handlers.PutWebhookHandler)
+	webhookRouter.DELETE("/:id", handlers.DeleteWebhookHandler)
+}
+
+// Audit Routes
+// /////////////////
+// - registered before the default scope so the events of a whole project can be queried
+func SetAuditRoutes(router *gin.Engine) {
+	auditRouter := router.Group(API + "/audit")
+	auditRouter.GET("/", handlers.QueryAuditEventsHandler)
+	auditRouter.GET("/verify", handlers.VerifyAuditChainHandler)
+	auditRouter.GET("/checkpoints", handlers.ExportAuditCheckpointsHandler)
+}
+
+// Admin Routes
+// /////////////////
+// - registered before the default scope so scopes can be managed for a whole organization
+func SetAdminRoutes(router *gin.Engine) {
+	adminRouter := router.Group(API + "/admin")
+	adminRouter.Use(middlewares.CheckAdminKey)
+	adminRouter.GET("/scopes", handlers.ListScopesHandler)
+	adminRouter.GET("/scopes/:scope", handlers.GetScopeHandler)
+	adminRouter.PUT("/scopes/:scope", handlers.PutScopeHandler)
+	adminRouter.DELETE("/scopes/:scope", handlers.DeleteScopeHandler)
+	adminRouter.GET("/cache/system", handlers.GetSystemSecretCacheStatsHandler)
+	adminRouter.GET("/inventory", handlers.ListInventoryHandler)
+	adminRouter.POST("/inventory/rebuild", handlers.RebuildInventoryHandler)
+	adminRouter.GET("/health/private", handlers.ListPrivateHealthHandler)
+	adminRouter.GET("/policies", handlers.ListPoliciesHandler)
+	adminRouter.GET("/policies/:policyId", handlers.GetPolicyHandler)
+	adminRouter.PUT("/policies/:policyId", handlers.PutPolicyHandler)
+	adminRouter.DELETE("/policies/:policyId", handlers.DeletePolicyHandler)
+	adminRouter.POST("/authz/explain", handlers.ExplainAuthorizationHandler)
+	adminRouter.GET("/authz/decisions", handlers.ListAuthorizationDecisionsHandler)
 }
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Permissions used by the secret routes and migrations on a PRIVATE secret manager
+// - in the order they are verified, the probe secret is created first and deleted last
+var PRIVATE_FLOW_PERMISSIONS = []string{
+	"secretsmanager:CreateSecret",
+	"secretsmanager:GetSecretValue",
+	"secretsmanager:PutSecretValue",
+	"secretsmanager:UpdateSecret",
+	"secretsmanager:DescribeSecret",
+	"secretsmanager:ListSecretVersionIds",
+	"secretsmanager:ListSecrets",
+	"secretsmanager:TagResource",
+	"secretsmanager:DeleteSecret",
+}
+
+// Permissions used to re-encrypt the secrets of a PRIVATE secret manager with another KMS key
+var REENCRYPTION_PERMISSIONS = append(append([]string{}, PRIVATE_FLOW_PERMISSIONS...), "secretsmanager:UpdateSecretVersionStage")
+
+// Permissions of the role on the customer managed KMS key of a registration, used through Secrets Manager
+var KMS_KEY_PERMISSIONS = []string{
+	"kms:GenerateDataKey",
+	"kms:Decrypt",
+}
+
+// Region names, ex: us-east-1, ap-southeast-2, us-gov-west-1
+var AWS_REGION_REGEX = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// Permissions used by the secret routes and migrations on the SHARED secret manager
+var SHARED_FLOW_PERMISSIONS = []string{
+	"secretsmanager:CreateSecret",
+	"secretsmanager:GetSecretValue",
+	"secretsmanager:PutSecretValue",
+	"secretsmanager:UpdateSecret",
+	"secretsmanager:ListSecretVersionIds",
+	"secretsmanager:DeleteSecret",
+}
+
+// Assumes the role of a secret manager and checks the given permissions without writing
+// ////////////////////////////////////////////////////////////////////////////////////////
+// - permissions are simulated with IAM when the role is allowed to, and probed otherwise
+func CheckSecretManagerAccess(orgId string, arn string, region string, actions []string) dtos.AccessCheck {
+	check := dtos.AccessCheck{ARN: arn, Region: region, CheckedAt: time.Now().UTC()}
+	defaultConfig, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+
+	assumedConfig, err := assumeRoleConfig(defaultConfig, orgId, arn, region)
+	if err != nil {
+		zap.L().Error("AssumeRole Failed :: " + arn + " :: " + err.Error())
+		check.Error = err.Error()
+		return check
+	}
+	check.AssumeRole = true
+
+	check.Permissions, err = simulatePermissions(assumedConfig, arn, actions)
+	if err != nil {
+		zap.L().Info("Simulating Permissions Failed, probing instead :: " + arn + " :: " + err.Error())
+		check.Permissions = probePermissions(secretsmanager.NewFromConfig(assumedConfig), actions)
+	}
+
+	return check
+}
+
+// Verifies a PRIVATE secret manager by writing, reading and deleting a probe secret
+// ////////////////////////////////////////////////////////////////////////////////////
+// - the region is verified by the ARN of the probe secret
+// - permissions which couldn't be called because of a previous failure are left unverified
+// - the probe secret is encrypted with the KMS key of the registration, when it has one
+func VerifySecretManagerAccess(orgId string, arn string, region string, kmsKeyId string) dtos.AccessVerification {
+	verification := dtos.AccessVerification{AccessCheck: dtos.AccessCheck{ARN: arn, Region: region, CheckedAt: time.Now().UTC()}}
+	if !AWS_REGION_REGEX.MatchString(region) {
+		verification.Error = constants.ErrInvalidRegion.Error()
+		return verification
+	}
+
+	defaultConfig, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	assumedConfig, err := assumeRoleConfig(defaultConfig, orgId, arn, region)
+	if err != nil {
+		zap.L().Error("AssumeRole Failed :: " + arn + " :: " + err.Error())
+		verification.Error = err.Error()
+		return verification
+	}
+	verification.AssumeRole = true
+	svc := secretsmanager.NewFromConfig(assumedConfig)
+
+	probeId := aws.String(constants.PERMISSION_PROBE_PREFIX + uuid.NewString())
+	createInput := &secretsmanager.CreateSecretInput{
+		Name:         probeId,
+		Description:  aws.String("Access verification of the Secret Service, safe to delete"),
+		SecretString: aws.String("{}"),
+	}
+	if kmsKeyId != "" {
+		createInput.KmsKeyId = aws.String(kmsKeyId)
+	}
+	output, err := svc.CreateSecret(context.TODO(), createInput)
+	kmsChecks := map[string]dtos.PermissionCheck{"kms:GenerateDataKey": getKmsProbeResult("kms:GenerateDataKey", err)}
+	verification.Permissions = append(verification.Permissions, getSecretsManagerProbeResult("secretsmanager:CreateSecret", err))
+	if err != nil {
+		// Nothing else can be called without the probe secret
+		for _, action := range PRIVATE_FLOW_PERMISSIONS[1:] {
+			verification.Permissions = append(verification.Permissions, dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED})
+		}
+		return getAccessVerification(appendKmsChecks(verification, kmsKeyId, kmsChecks))
+	}
+	verification.ProbeSecret = aws.ToString(probeId)
+	verification.RegionMatch = getArnRegion(aws.ToString(output.ARN)) == region
+
+	deleteAsap := true
+	for _, action := range PRIVATE_FLOW_PERMISSIONS[1:] {
+		switch strings.TrimPrefix(action, "secretsmanager:") {
+		case "GetSecretValue":
+			_, err = svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{SecretId: probeId})
+			kmsChecks["kms:Decrypt"] = getKmsProbeResult("kms:Decrypt", err)
+		case "PutSecretValue":
+			_, err = svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{SecretId: probeId, SecretString: aws.String(`{"probe": true}`)})
+		case "UpdateSecret":
+			_, err = svc.UpdateSecret(context.TODO(), &secretsmanager.UpdateSecretInput{SecretId: probeId, SecretString: aws.String("{}")})
+		case "DescribeSecret":
+			_, err = svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: probeId})
+		case "ListSecretVersionIds":
+			_, err = svc.ListSecretVersionIds(context.TODO(), &secretsmanager.ListSecretVersionIdsInput{SecretId: probeId})
+		case "ListSecrets":
+			_, err = svc.ListSecrets(context.TODO(), &secretsmanager.ListSecretsInput{MaxResults: aws.Int32(1)})
+		case "TagResource":
+			_, err = svc.TagResource(context.TODO(), &secretsmanager.TagResourceInput{SecretId: probeId, Tags: []types.Tag{{Key: aws.String(constants.SECRET_GROUP_TAG), Value: aws.String("probe")}}})
+		case "DeleteSecret":
+			_, err = svc.DeleteSecret(context.TODO(), &secretsmanager.DeleteSecretInput{SecretId: probeId, ForceDeleteWithoutRecovery: &deleteAsap})
+			if err == nil {
+				verification.ProbeSecret = ""
+			}
+		default:
+			verification.Permissions = append(verification.Permissions, dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED})
+			continue
+		}
+
+		// The probe secret exists, so a not found error isn't an allowed call here
+		if err != nil && strings.Contains(err.Error(), "ResourceNotFoundException") {
+			verification.Permissions = append(verification.Permissions, dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED, Error: err.Error()})
+			continue
+		}
+		verification.Permissions = append(verification.Permissions, getSecretsManagerProbeResult(action, err))
+	}
+	if verification.ProbeSecret != "" {
+		zap.L().Error("Probe Secret Left Behind :: " + arn + " :: " + verification.ProbeSecret)
+	}
+
+	return getAccessVerification(appendKmsChecks(verification, kmsKeyId, kmsChecks))
+}
+
+// Helper function to add the checks of the KMS key to a verification, in the order of KMS_KEY_PERMISSIONS
+func appendKmsChecks(verification dtos.AccessVerification, kmsKeyId string, kmsChecks map[string]dtos.PermissionCheck) dtos.AccessVerification {
+	if kmsKeyId == "" {
+		return verification
+	}
+
+	for _, action := range KMS_KEY_PERMISSIONS {
+		check, found := kmsChecks[action]
+		if !found {
+			check = dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED}
+		}
+		verification.Permissions = append(verification.Permissions, check)
+	}
+	return verification
+}
+
+// Calls failing on the KMS key are reported against the key, not the Secrets Manager action
+func getSecretsManagerProbeResult(action string, err error) dtos.PermissionCheck {
+	if err != nil && isKmsError(err) {
+		return dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED, Error: err.Error()}
+	}
+	return getProbeResult(action, err)
+}
+
+func getKmsProbeResult(action string, err error) dtos.PermissionCheck {
+	switch {
+	case err == nil:
+		return dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_ALLOWED}
+
+	case isKmsError(err):
+		return dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_DENIED, Error: err.Error()}
+
+	default:
+		return dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED, Error: err.Error()}
+	}
+}
+
+// Secrets Manager reports the KMS failures as AccessDeniedException or KMS* errors naming the key
+func isKmsError(err error) bool {
+	return strings.Contains(err.Error(), "KMS") || strings.Contains(err.Error(), "kms:")
+}
+
+// Helper function to get the outcome of an access verification
+// ///////////////////////////////////////////////////////////////
+// - unverified permissions are reported as missing, the registration can't rely on them
+func getAccessVerification(verification dtos.AccessVerification) dtos.AccessVerification {
+	verification.Missing = nil
+	for _, permission := range verification.Permissions {
+		if permission.Status != constants.PERMISSION_ALLOWED {
+			verification.Missing = append(verification.Missing, permission.Action)
+		}
+	}
+	verification.Verified = verification.AssumeRole && verification.RegionMatch && len(verification.Missing) == 0
+
+	return verification
+}
+
+// Helper function to get the region of an ARN, ex: arn:aws:secretsmanager:us-east-1:...
+func getArnRegion(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[3]
+}
+
+// Returns the actions which are not allowed by an access check
+// ///////////////////////////////////////////////////////////////
+func GetDeniedPermissions(check dtos.AccessCheck) []string {
+	var denied []string
+	for _, permission := range check.Permissions {
+		if permission.Status == constants.PERMISSION_DENIED {
+			denied = append(denied, permission.Action)
+		}
+	}
+
+	return denied
+}
+
+// Helper function to evaluate the policies of a role using the IAM policy simulator
+// ////////////////////////////////////////////////////////////////////////////////////
+func simulatePermissions(assumedConfig aws.Config, arn string, actions []string) ([]dtos.PermissionCheck, error) {
+	output, err := iam.NewFromConfig(assumedConfig).SimulatePrincipalPolicy(context.TODO(), &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(arn),
+		ActionNames:     actions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions []dtos.PermissionCheck
+	for _, result := range output.EvaluationResults {
+		status := constants.PERMISSION_DENIED
+		if result.EvalDecision == iamTypes.PolicyEvaluationDecisionTypeAllowed {
+			status = constants.PERMISSION_ALLOWED
+		}
+		permissions = append(permissions, dtos.PermissionCheck{Action: aws.ToString(result.EvalActionName), Status: status})
+	}
+
+	return permissions, nil
+}
+
+// Helper function to check permissions by calling them on a secret which doesn't exist
+// ///////////////////////////////////////////////////////////////////////////////////////
+// - a not found error means the call was authorized, nothing can be written
+// - CreateSecret can't be probed without writing and is left unverified
+func probePermissions(svc *secretsmanager.Client, actions []string) []dtos.PermissionCheck {
+	probeId := aws.String(constants.PERMISSION_PROBE_PREFIX + uuid.NewString())
+	deleteAsap := true
+	var permissions []dtos.PermissionCheck
+
+	for _, action := range actions {
+		var err error
+		switch strings.TrimPrefix(action, "secretsmanager:") {
+		case "GetSecretValue":
+			_, err = svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{SecretId: probeId})
+		case "PutSecretValue":
+			_, err = svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{SecretId: probeId, SecretString: aws.String("{}")})
+		case "UpdateSecret":
+			_, err = svc.UpdateSecret(context.TODO(), &secretsmanager.UpdateSecretInput{SecretId: probeId, SecretString: aws.String("{}")})
+		case "DescribeSecret":
+			_, err = svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: probeId})
+		case "ListSecretVersionIds":
+			_, err = svc.ListSecretVersionIds(context.TODO(), &secretsmanager.ListSecretVersionIdsInput{SecretId: probeId})
+		case "ListSecrets":
+			_, err = svc.ListSecrets(context.TODO(), &secretsmanager.ListSecretsInput{MaxResults: aws.Int32(1)})
+		case "TagResource":
+			_, err = svc.TagResource(context.TODO(), &secretsmanager.TagResourceInput{SecretId: probeId, Tags: []types.Tag{{Key: aws.String(constants.SECRET_GROUP_TAG), Value: aws.String("probe")}}})
+		case "DeleteSecret":
+			_, err = svc.DeleteSecret(context.TODO(), &secretsmanager.DeleteSecretInput{SecretId: probeId, ForceDeleteWithoutRecovery: &deleteAsap})
+		case "UpdateSecretVersionStage":
+			_, err = svc.UpdateSecretVersionStage(context.TODO(), &secretsmanager.UpdateSecretVersionStageInput{SecretId: probeId, VersionStage: aws.String(constants.REENCRYPTION_STAGE), RemoveFromVersionId: aws.String(uuid.NewString())})
+		default:
+			permissions = append(permissions, dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED})
+			continue
+		}
+
+		permissions = append(permissions, getProbeResult(action, err))
+	}
+
+	return permissions
+}
+
+func getProbeResult(action string, err error) dtos.PermissionCheck {
+	switch {
+	case err == nil || strings.Contains(err.Error(), "ResourceNotFoundException"):
+		return dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_ALLOWED}
+
+	case strings.Contains(err.Error(), "AccessDenied"):
+		return dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_DENIED, Error: err.Error()}
+
+	default:
+		return dtos.PermissionCheck{Action: action, Status: constants.PERMISSION_UNVERIFIED, Error: err.Error()}
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"go.uber.org/zap"
+)
+
+// Lists the PRIVATE secrets of the organization without a secret group tag
+// ///////////////////////////////////////////////////////////////////////////
+// - secrets created before the tagging are found by the 'Organization ID: <orgId>' description of the service
+func ListUntaggedSecrets(headers dtos.CustomHeaders) ([]string, error) {
+	svc, err := getAdoptionSecretManager(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := findUntaggedPrivateSecrets(svc, headers.OrgId)
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, err
+}
+
+// Tags untagged PRIVATE secrets of the organization with the secret group of the headers key
+// /////////////////////////////////////////////////////////////////////////////////////////////
+// - adopted secrets are migrated with the group, untagged secrets block the migrations of the organization
+// - 'secretIds' restricts the adoption, every untagged secret is adopted when it's empty
+// - secrets already in the group are skipped so an interrupted adoption can be retried, secrets of other groups are refused
+func AdoptUntaggedSecrets(ctx context.Context, headers dtos.CustomHeaders, secretIds []string) (dtos.SecretAdoption, error) {
+	group := utils.CreatePrefix(headers)
+	adoption := dtos.SecretAdoption{Group: group, SecretIds: []string{}}
+
+	svc, err := getAdoptionSecretManager(headers)
+	if err != nil {
+		return adoption, err
+	}
+	untaggedIds, err := findUntaggedPrivateSecrets(svc, headers.OrgId)
+	if err != nil {
+		return adoption, err
+	}
+
+	selectedIds := untaggedIds
+	if len(secretIds) > 0 {
+		groupIds, err := listPrivateGroupSecrets(svc, group)
+		if err != nil {
+			return adoption, err
+		}
+
+		selectedIds = nil
+		for _, id := range secretIds {
+			switch {
+			case utils.ArrayContains(untaggedIds, id):
+				selectedIds = append(selectedIds, id)
+			case utils.ArrayContains(groupIds, id):
+				adoption.Skipped = append(adoption.Skipped, id)
+			default:
+				return adoption, constants.ErrSecretNotUntagged
+			}
+		}
+	}
+
+	for i, id := range selectedIds {
+		if err := ctx.Err(); err != nil {
+			return adoption, err
+		}
+
+		zap.L().Info("Adopting Secret :: " + group + " :: " + id)
+		_, err := svc.TagResource(context.TODO(), &secretsmanager.TagResourceInput{
+			SecretId: aws.String(id),
+			Tags:     getSecretGroupTags(group),
+		})
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("TagResource Failed :: %s :: ", id) + err.Error())
+			return adoption, err
+		}
+		adoption.SecretIds = append(adoption.SecretIds, id)
+		reportJobProgress(ctx, i+1, len(selectedIds), "adopted")
+	}
+
+	return adoption, nil
+}
+
+// Helper function to get the PRIVATE secret manager of the headers key
+func getAdoptionSecretManager(headers dtos.CustomHeaders) (*secretsmanager.Client, error) {
+	if headers.Flow != constants.PRIVATE_FLOW {
+		return nil, constants.ErrAdoptionNotPrivate
+	}
+
+	awsConfig, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
+	svc, err := getSecretManager(awsConfig, headers.OrgId, headers.ARN, headers.Region)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/audit"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/utils"
+
+	"go.uber.org/zap"
+)
+
+var AUDIT_DEFAULT_FILE = "audit.log"
+var AUDIT_DEFAULT_BATCH_DIR = "audit"
+var AUDIT_DEFAULT_BATCH_SIZE = 500
+var AUDIT_DEFAULT_BATCH_INTERVAL = time.Minute
+
+// Routes whose requests are audited, other routes don't read or change secrets
+var AUDITED_ROUTES = []string{constants.SYSTEM_ROUTE, constants.SECRET_ROUTE, constants.DYNAMIC_ROUTE, constants.AUDIT_ROUTE}
+
+var auditVerbs = map[string]string{
+	"GET":    "READ",
+	"POST":   "CREATE",
+	"PUT":    "UPDATE",
+	"PATCH":  "UPDATE",
+	"DELETE": "DELETE",
+}
+
+// Events published while a request runs, merged into its audit event
+type AuditTrail struct {
+	traceId string
+	events  []events.Event
+}
+
+var auditTrails = map[string][]*AuditTrail{}
+var auditTrailsMutex sync.Mutex
+var useAuditOnce sync.Once
+
+// Creates the audit sink of AUDIT_SINK
+// ///////////////////////////////////////
+// - FILE (AUDIT_FILE), SQL (AUDIT_DATABASE_URL) or BATCH (AUDIT_BATCH_DIR, AUDIT_BATCH_SIZE, AUDIT_BATCH_INTERVAL)
+func NewAuditSink(kind string) (audit.Sink, error) {
+	switch strings.ToUpper(kind) {
+	case audit.FILE_SINK:
+		return audit.NewFileSink(utils.SetDefaultIfEmptyValue(utils.GetEnvVar("AUDIT_FILE"), AUDIT_DEFAULT_FILE))
+
+	case audit.SQL_SINK:
+		return audit.NewSQLSink(utils.GetEnvVar("AUDIT_DATABASE_URL"))
+
+	case audit.BATCH_SINK:
+		batchSize, err := strconv.Atoi(utils.SetDefaultIfEmptyValue(utils.GetEnvVar("AUDIT_BATCH_SIZE"), strconv.Itoa(AUDIT_DEFAULT_BATCH_SIZE)))
+		if err != nil {
+			return nil, constants.ErrInvalidAuditBatch
+		}
+		interval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(utils.GetEnvVar("AUDIT_BATCH_INTERVAL"), AUDIT_DEFAULT_BATCH_INTERVAL.String()))
+		if err != nil {
+			return nil, err
+		}
+		return audit.NewBatchExporter(utils.SetDefaultIfEmptyValue(utils.GetEnvVar("AUDIT_BATCH_DIR"), AUDIT_DEFAULT_BATCH_DIR), batchSize, interval)
+
+	default:
+		return nil, constants.ErrInvalidAuditSink
+	}
+}
+
+// Records the audit events of the requests and of the published events in a sink
+// /////////////////////////////////////////////////////////////////////////////////
+// - events published outside of a request (schedulers, jobs) are recorded with the system actor
+func UseAuditSink(sink audit.Sink) {
+	audit.Use(sink)
+	zap.L().Info("Auditing Enabled :: " + sink.Name())
+
+	useAuditOnce.Do(func() {
+		events.Subscribe(recordPublishedEvent)
+	})
+}
+
+// Returns true when the requests of a route are audited
+func IsAuditedRoute(route string) bool {
+	return audit.Enabled() && utils.ArrayContains(AUDITED_ROUTES, route)
+}
+
+// Starts collecting the events published by a request, see FinishAuditTrail
+// ////////////////////////////////////////////////////////////////////////////
+func StartAuditTrail(traceId string) *AuditTrail {
+	trail := &AuditTrail{traceId: traceId}
+	if traceId == "" {
+		return trail
+	}
+
+	auditTrailsMutex.Lock()
+	defer auditTrailsMutex.Unlock()
+	auditTrails[traceId] = append(auditTrails[traceId], trail)
+	return trail
+}
+
+// Records the audit event of a request with the events it published
+// /////////////////////////////////////////////////////////////////////
+// - the secret ID and version of the last published event fill the ones the request didn't have
+func FinishAuditTrail(trail *AuditTrail, event audit.Event) (audit.Event, error) {
+	auditTrailsMutex.Lock()
+	trails := auditTrails[trail.traceId]
+	for i, existing := range trails {
+		if existing == trail {
+			trails = append(trails[:i], trails[i+1:]...)
+			break
+		}
+	}
+	if len(trails) == 0 {
+		delete(auditTrails, trail.traceId)
+	} else {
+		auditTrails[trail.traceId] = trails
+	}
+	auditTrailsMutex.Unlock()
+
+	if len(trail.events) > 0 {
+		published := trail.events[len(trail.events)-1]
+		event.SecretId = utils.SetDefaultIfEmptyValue(event.SecretId, published.SecretId)
+		event.Version = utils.SetDefaultIfEmptyValue(event.Version, published.VersionId)
+	}
+
+	recorded, err := audit.Record(event)
+	if err != nil {
+		zap.L().Error("Recording Audit Event Failed :: " + event.Action + " :: " + err.Error())
+	}
+	return recorded, err
+}
+
+// Builds the audit action of a request, ex: SECRET_READ
+func GetAuditAction(route string, method string) string {
+	return route + "_" + utils.SetDefaultIfEmptyValue(auditVerbs[method], method)
+}
+
+// Returns the outcome of a request from its status
+// - 403, and 401 without an authenticated caller, are denials
+func GetAuditOutcome(status int, authenticated bool) string {
+	switch {
+	case status == 403 || (status == 401 && !authenticated):
+		return constants.DENIED_OUTCOME
+	case status >= 400:
+		return constants.FAILURE_OUTCOME
+	}
+
+	return constants.SUCCESS_OUTCOME
+}
+
+// Queries the audit events, oldest first
+// //////////////////////////////////////////
+func QueryAuditEvents(filter audit.Filter) (dtos.AuditPage, error) {
+	page, err := audit.Query(filter)
+	if err != nil {
+		return dtos.AuditPage{}, err
+	}
+
+	auditPage := dtos.AuditPage{Events: page.Events}
+	if page.Next != "" {
+		auditPage.NextToken = base64.RawURLEncoding.EncodeToString([]byte(page.Next))
+	}
+	return auditPage, nil
+}
+
+// Helper function to add a published event to the trails of its request, or record it on its own
+// //////////////////////////////////////////////////////////////////////////////////////////////////
+func recordPublishedEvent(event events.Event) {
+	auditTrailsMutex.Lock()
+	trails := auditTrails[event.TraceId]
+	for _, trail := range trails {
+		trail.events = append(trail.events, event)
+	}
+	auditTrailsMutex.Unlock()
+	if event.TraceId != "" && len(trails) > 0 {
+		return
+	}
+
+	route := constants.SECRET_ROUTE
+	if _, systemEvent := event.Metadata["group"]; systemEvent {
+		route = constants.SYSTEM_ROUTE
+	}
+	_, err := audit.Record(audit.Event{
+		Time:      event.Timestamp,
+		Actor:     constants.SYSTEM_ACTOR,
+		TraceId:   event.TraceId,
+		OrgId:     event.OrgId,
+		ProjectId: event.ProjectId,
+		Scope:     event.Scope,
+		SecretId:  event.SecretId,
+		Action:    route + "_" + strings.ToUpper(event.Type),
+		Outcome:   constants.SUCCESS_OUTCOME,
+		Version:   event.VersionId,
+	})
+	if err != nil && err != constants.ErrAuditDisabled {
+		zap.L().Error("Recording Audit Event Failed :: " + event.Type + " :: " + err.Error())
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/audit"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+
+	"go.uber.org/zap"
+)
+
+var AUDIT_DEFAULT_CHECKPOINT_INTERVAL = time.Hour
+
+var auditSigningKey ed25519.PrivateKey
+
+// Signs the checkpoints of the audit chains with an ed25519 key
+// /////////////////////////////////////////////////////////////////
+// - the key is a base64 32 byte seed or 64 byte private key, an empty key disables the checkpoints
+func UseAuditSigningKey(encodedKey string) error {
+	if encodedKey == "" {
+		auditSigningKey = nil
+		return nil
+	}
+
+	signingKey, err := audit.ParseSigningKey(encodedKey)
+	if err != nil {
+		return err
+	}
+	auditSigningKey = signingKey
+	zap.L().Info("Audit Checkpoints Enabled :: " + audit.KeyId(signingKey.Public().(ed25519.PublicKey)))
+	return nil
+}
+
+// Starts the background signer of the audit checkpoints
+// /////////////////////////////////////////////////////////
+func StartAuditCheckpointer(interval time.Duration) {
+	zap.L().Info("Starting Audit Checkpointer :: every " + interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			CreateAuditCheckpoints(time.Now().UTC())
+		}
+	}()
+}
+
+// Signs a checkpoint of every chain that grew since its last checkpoint
+// /////////////////////////////////////////////////////////////////////////
+func CreateAuditCheckpoints(now time.Time) []audit.Checkpoint {
+	if auditSigningKey == nil {
+		return nil
+	}
+
+	heads, err := audit.ListChainHeads()
+	if err != nil {
+		zap.L().Error("Listing Audit Chains Failed :: " + err.Error())
+		return nil
+	}
+
+	var created []audit.Checkpoint
+	for orgId, head := range heads {
+		last, err := store.Default().List(auditCheckpointsKey(orgId), -1, -1)
+		if err != nil {
+			zap.L().Error("Reading Audit Checkpoint Failed :: " + orgId + " :: " + err.Error())
+			continue
+		}
+		if len(last) > 0 {
+			var previous audit.Checkpoint
+			if json.Unmarshal([]byte(last[0]), &previous) == nil && previous.Seq == head.Seq {
+				continue
+			}
+		}
+
+		checkpoint := audit.SignCheckpoint(auditSigningKey, orgId, head, now)
+		if err := store.AppendJSON(auditCheckpointsKey(orgId), checkpoint); err != nil {
+			zap.L().Error("Storing Audit Checkpoint Failed :: " + orgId + " :: " + err.Error())
+			continue
+		}
+		created = append(created, checkpoint)
+	}
+	return created
+}
+
+// Returns the checkpoints of an organization, oldest first
+// ////////////////////////////////////////////////////////////
+func ListAuditCheckpoints(orgId string) ([]audit.Checkpoint, error) {
+	values, err := store.Default().List(auditCheckpointsKey(orgId), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := []audit.Checkpoint{}
+	for _, value := range values {
+		var checkpoint audit.Checkpoint
+		if err := json.Unmarshal([]byte(value), &checkpoint); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, nil
+}
+
+// Exports the checkpoints of an organization with the public key verifying them
+// /////////////////////////////////////////////////////////////////////////////////
+// - the export is meant to be stored outside of the service, see cmd/auditverify
+func ExportAuditCheckpoints(orgId string) (dtos.AuditCheckpointExport, error) {
+	if auditSigningKey == nil {
+		return dtos.AuditCheckpointExport{}, constants.ErrAuditCheckpointsDisabled
+	}
+
+	checkpoints, err := ListAuditCheckpoints(orgId)
+	if err != nil {
+		return dtos.AuditCheckpointExport{}, err
+	}
+
+	publicKey := auditSigningKey.Public().(ed25519.PublicKey)
+	return dtos.AuditCheckpointExport{
+		OrgId:       orgId,
+		KeyId:       audit.KeyId(publicKey),
+		PublicKey:   base64.StdEncoding.EncodeToString(publicKey),
+		ExportedAt:  time.Now().UTC(),
+		Checkpoints: checkpoints,
+	}, nil
+}
+
+// Walks the audit chain of an organization against its checkpoints
+// ////////////////////////////////////////////////////////////////////
+// - without a signing key only the links between the events are verified
+func VerifyAuditChain(orgId string) (audit.Verification, error) {
+	var checkpoints []audit.Checkpoint
+	var publicKey ed25519.PublicKey
+	if auditSigningKey != nil {
+		var err error
+		if checkpoints, err = ListAuditCheckpoints(orgId); err != nil {
+			return audit.Verification{}, err
+		}
+		publicKey = auditSigningKey.Public().(ed25519.PublicKey)
+	}
+
+	return audit.Verify(orgId, checkpoints, publicKey)
+}
+
+func auditCheckpointsKey(orgId string) string {
+	return "audit:checkpoints:" + orgId
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+
+	"go.uber.org/zap"
+)
+
+var AUTHORIZATION_DECISIONS_KEY = "authz:decisions"
+var AUTHORIZATION_DECISIONS_LIMIT = 1000
+
+// Subject of the requests made without an identity, when the authentication is disabled
+var ANONYMOUS_SUBJECT = "anonymous"
+
+var authorizationEnabled bool
+var filePolicies []dtos.Policy
+
+func policyKey(id string) string {
+	return policyPrefix() + id
+}
+
+func policyPrefix() string {
+	return "authz:policy:"
+}
+
+// Enables the authorization of every request, along with the policies of a file
+// /////////////////////////////////////////////////////////////////////////////////
+// - the file is a JSON list of policies, each with an 'id', or empty to only use the policies of the admin API
+func UseAuthorization(policyFile string) error {
+	policies := []dtos.Policy{}
+	if policyFile != "" {
+		data, err := os.ReadFile(policyFile)
+		if err != nil {
+			return err
+		}
+		if policies, err = ParsePolicies(data); err != nil {
+			return err
+		}
+	}
+
+	filePolicies = policies
+	authorizationEnabled = true
+	zap.L().Info("Authorization Enabled", zap.Int("filePolicies", len(policies)))
+	return nil
+}
+
+// Method for disabling the authorization, every request is allowed
+func DisableAuthorization() {
+	authorizationEnabled = false
+	filePolicies = nil
+}
+
+func IsAuthorizationEnabled() bool {
+	return authorizationEnabled
+}
+
+// Parses the policies of a policy file
+// ////////////////////////////////////////
+func ParsePolicies(data []byte) ([]dtos.Policy, error) {
+	var rawPolicies []interface{}
+	if err := json.Unmarshal(data, &rawPolicies); err != nil {
+		return nil, constants.ErrFormat
+	}
+
+	policies := []dtos.Policy{}
+	ids := map[string]bool{}
+	for _, rawPolicy := range rawPolicies {
+		policyMap, _ := rawPolicy.(map[string]interface{})
+		id, _ := policyMap["id"].(string)
+		if err := dtos.CheckPolicyId(id); err != nil || ids[id] {
+			return nil, constants.ErrInvalidPolicyId
+		}
+		policyReq, err := dtos.CreateNewPolicyReq(rawPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		ids[id] = true
+		policies = append(policies, dtos.Policy{Id: id, PolicyReq: policyReq, Source: constants.FILE_POLICY_SOURCE})
+	}
+
+	return policies, nil
+}
+
+// Lists the policies of the policy file and the admin API, ordered by ID
+// //////////////////////////////////////////////////////////////////////////
+func ListPolicies() ([]dtos.Policy, error) {
+	policies := append([]dtos.Policy{}, filePolicies...)
+
+	keys, err := store.Default().Keys(policyPrefix())
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		var policy dtos.Policy
+		if err := store.GetJSON(key, &policy); err != nil {
+			if err == constants.ErrRecordNotFound {
+				continue
+			}
+			return nil, err
+		}
+		if getFilePolicy(policy.Id) == nil {
+			policies = append(policies, policy)
+		}
+	}
+
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Id < policies[j].Id })
+	return policies, nil
+}
+
+// Returns a policy of the policy file or the admin API
+// ///////////////////////////////////////////////////////
+func GetPolicy(id string) (dtos.Policy, error) {
+	if policy := getFilePolicy(id); policy != nil {
+		return *policy, nil
+	}
+
+	var policy dtos.Policy
+	if err := store.GetJSON(policyKey(id), &policy); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.Policy{}, constants.ErrPolicyNotFound
+		}
+		return dtos.Policy{}, err
+	}
+	return policy, nil
+}
+
+// Creates or replaces a policy of the admin API
+// /////////////////////////////////////////////////
+func PutPolicy(id string, requestBody dtos.PolicyReq) (dtos.Policy, error) {
+	if getFilePolicy(id) != nil {
+		return dtos.Policy{}, constants.ErrReadOnlyPolicy
+	}
+
+	now := time.Now().UTC()
+	policy := dtos.Policy{Id: id, PolicyReq: requestBody, Source: constants.API_POLICY_SOURCE, UpdatedAt: &now}
+	zap.L().Info("Saving Policy :: " + id)
+	if err := store.SetJSON(policyKey(id), policy, 0); err != nil {
+		zap.L().Error("Saving Policy Failed :: " + err.Error())
+		return dtos.Policy{}, err
+	}
+
+	return policy, nil
+}
+
+// Removes a policy of the admin API
+// /////////////////////////////////////
+func DeletePolicy(id string) error {
+	if getFilePolicy(id) != nil {
+		return constants.ErrReadOnlyPolicy
+	}
+	if _, err := store.Default().Get(policyKey(id)); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return constants.ErrPolicyNotFound
+		}
+		return err
+	}
+
+	zap.L().Info("Deleting Policy :: " + id)
+	return store.Default().Delete(policyKey(id))
+}
+
+// Authorizes a request, recording the decision
+// ////////////////////////////////////////////////
+// - deny policies override allow policies, requests no policy allows are denied
+func Authorize(request dtos.AuthorizationReq) (dtos.AuthorizationDecision, error) {
+	policies, err := ListPolicies()
+	if err != nil {
+		zap.L().Error("Listing Policies Failed :: " + err.Error())
+		return dtos.AuthorizationDecision{}, err
+	}
+
+	decision := evaluatePolicies(request, policies, false)
+	recordAuthorizationDecision(decision)
+	return decision, nil
+}
+
+// Explains the decision of a request, listing the outcome of every policy
+// ///////////////////////////////////////////////////////////////////////////
+// - nothing is recorded, the request isn't made
+func ExplainAuthorization(request dtos.AuthorizationReq) (dtos.AuthorizationDecision, error) {
+	policies, err := ListPolicies()
+	if err != nil {
+		return dtos.AuthorizationDecision{}, err
+	}
+
+	return evaluatePolicies(request, policies, true), nil
+}
+
+// Lists the last authorization decisions, newest first
+// ////////////////////////////////////////////////////////
+func ListAuthorizationDecisions(limit int) ([]dtos.AuthorizationDecision, error) {
+	if limit <= 0 || limit > AUTHORIZATION_DECISIONS_LIMIT {
+		limit = AUTHORIZATION_DECISIONS_LIMIT
+	}
+	entries, err := store.Default().List(AUTHORIZATION_DECISIONS_KEY, -limit, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := []dtos.AuthorizationDecision{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		var decision dtos.AuthorizationDecision
+		if err := json.Unmarshal([]byte(entries[i]), &decision); err == nil {
+			decisions = append(decisions, decision)
+		}
+	}
+	return decisions, nil
+}
+
+// Helper function to evaluate the policies of a request
+// /////////////////////////////////////////////////////////
+// - every policy is evaluated when explaining, the first matching deny policy decides otherwise
+func evaluatePolicies(request dtos.AuthorizationReq, policies []dtos.Policy, explain bool) dtos.AuthorizationDecision {
+	decision := dtos.AuthorizationDecision{
+		Request:   request,
+		Reason:    constants.ErrAccessDenied.Error(),
+		DecidedAt: time.Now().UTC(),
+	}
+
+	var allowedBy, deniedBy string
+	for _, policy := range policies {
+		mismatch := matchPolicy(policy, request)
+		if explain {
+			decision.Policies = append(decision.Policies, dtos.PolicyEvaluation{PolicyId: policy.Id, Effect: policy.Effect, Matched: mismatch == "", Mismatch: mismatch})
+		}
+		if mismatch != "" {
+			continue
+		}
+
+		if policy.Effect == constants.DENY_EFFECT && deniedBy == "" {
+			deniedBy = policy.Id
+			if !explain {
+				break
+			}
+		} else if policy.Effect == constants.ALLOW_EFFECT && allowedBy == "" {
+			allowedBy = policy.Id
+		}
+	}
+
+	switch {
+	case deniedBy != "":
+		decision.PolicyId = deniedBy
+		decision.Reason = "denied by policy " + deniedBy
+	case allowedBy != "":
+		decision.Allowed = true
+		decision.PolicyId = allowedBy
+		decision.Reason = "allowed by policy " + allowedBy
+	}
+
+	return decision
+}
+
+// Helper function to match a policy, returning the first attribute which doesn't match
+// ////////////////////////////////////////////////////////////////////////////////////////
+// - requests without a project, scope or secret reach all of them,
+// they only match the allow policies which aren't restricted to some of them, and every deny policy
+func matchPolicy(policy dtos.Policy, request dtos.AuthorizationReq) string {
+	deny := policy.Effect == constants.DENY_EFFECT
+	attributes := []struct {
+		name     string
+		patterns []string
+		value    string
+	}{
+		{"subjects", policy.Subjects, request.Subject},
+		{"methods", policy.Methods, request.Method},
+		{"routes", policy.Routes, request.Route},
+		{"orgIds", policy.OrgIds, request.OrgId},
+		{"projectIds", policy.ProjectIds, request.ProjectId},
+		{"scopes", policy.Scopes, request.Scope},
+		{"secrets", policy.Secrets, request.Secret},
+	}
+
+	for _, attribute := range attributes {
+		if len(attribute.patterns) == 0 {
+			continue
+		}
+
+		matched := false
+		for _, pattern := range attribute.patterns {
+			matched = matched || pattern == "*" || (attribute.value != "" && matchPolicyPattern(pattern, attribute.value))
+		}
+		if !matched && !(deny && attribute.value == "") {
+			return attribute.name
+		}
+	}
+
+	return ""
+}
+
+// '*' matches any sequence of characters, '/' included
+func matchPolicyPattern(pattern string, value string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	matched, _ := regexp.MatchString("^"+strings.Join(parts, ".*")+"$", value)
+	return matched
+}
+
+func recordAuthorizationDecision(decision dtos.AuthorizationDecision) {
+	if !decision.Allowed {
+		zap.L().Warn("Request Denied :: " + decision.Request.Subject + " :: " + decision.Request.Method + " " + decision.Request.Path + " :: " + decision.Reason)
+	}
+	if err := store.AppendJSON(AUTHORIZATION_DECISIONS_KEY, decision); err != nil {
+		zap.L().Error("Recording Authorization Decision Failed :: " + err.Error())
+		return
+	}
+	store.Default().Trim(AUTHORIZATION_DECISIONS_KEY, -AUTHORIZATION_DECISIONS_LIMIT, -1)
+}
+
+func getFilePolicy(id string) *dtos.Policy {
+	for i := range filePolicies {
+		if filePolicies[i].Id == id {
+			return &filePolicies[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/dynamic"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var LEASE_LOCK_TTL = time.Minute
+var LEASE_RETRY_DELAY = time.Minute
+
+func dynamicConnectionName(prefix string) string {
+	return "dynamic_postgres_" + prefix
+}
+
+func dynamicRoleKey(prefix string, role string) string {
+	return "dynamic:role:" + prefix + ":" + role
+}
+
+func leaseKey(leaseId string) string {
+	return "dynamic:lease:" + leaseId
+}
+
+func leaseLockKey(leaseId string) string {
+	return "dynamic:lock:" + leaseId
+}
+
+// Registers the PostgreSQL connection used to create dynamic users
+// ///////////////////////////////////////////////////////////////////
+// - the connection url holds admin credentials so it is kept in the system secret manager
+func SetPostgresConnection(headers dtos.CustomHeaders, requestBody dtos.PostgresConnectionReq) (string, error) {
+	secretName := dynamicConnectionName(utils.CreatePrefix(headers))
+	zap.L().Info("Setting Dynamic Secret Connection :: " + secretName)
+
+	// Checking the connection before saving it
+	db, err := dynamic.OpenPostgres(requestBody.ConnectionUrl)
+	if err != nil {
+		zap.L().Error("Connecting to PostgreSQL Failed :: " + err.Error())
+		return "", err
+	}
+	db.Close()
+
+	secretString, _ := utils.StringifyJson(requestBody)
+	if err := putSystemRecord(headers, secretName, secretString); err != nil {
+		return "", err
+	}
+
+	return secretName, nil
+}
+
+// Removes the PostgreSQL connection of a key
+// //////////////////////////////////////////////
+func DeletePostgresConnection(headers dtos.CustomHeaders) (string, error) {
+	REGION := utils.GetEnvVar("REGION")
+	secretName := dynamicConnectionName(utils.CreatePrefix(headers))
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+	deleteAsap := true
+	zap.L().Info("Deleting Dynamic Secret Connection :: " + secretName)
+
+	_, err := svc.DeleteSecret(context.TODO(), &secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(secretName),
+		ForceDeleteWithoutRecovery: &deleteAsap,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return "", constants.ErrDynamicConfigNotFound
+		}
+		zap.L().Error("DeleteSecret Failed :: " + err.Error())
+		return "", err
+	}
+
+	return secretName, nil
+}
+
+// Helper function to open the PostgreSQL connection of a key
+// /////////////////////////////////////////////////////////////
+func openPostgresConnection(headers dtos.CustomHeaders) (*sql.DB, error) {
+	REGION := utils.GetEnvVar("REGION")
+	secretName := dynamicConnectionName(utils.CreatePrefix(headers))
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	result, err := svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return nil, constants.ErrDynamicConfigNotFound
+		}
+		zap.L().Error("GetSecretValue Failed :: " + err.Error())
+		return nil, err
+	}
+
+	var connection dtos.PostgresConnectionReq
+	if err := json.Unmarshal([]byte(*result.SecretString), &connection); err != nil {
+		return nil, err
+	}
+
+	return dynamic.OpenPostgres(connection.ConnectionUrl)
+}
+
+// Helper function to create or update a record in the system secret manager
+// /////////////////////////////////////////////////////////////////////////////
+func putSystemRecord(headers dtos.CustomHeaders, secretName string, secretString string) error {
+	REGION := utils.GetEnvVar("REGION")
+	secretDescription := fmt.Sprintf("Organization ID: %s", headers.OrgId)
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	_, err := svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName),
+		SecretString: aws.String(secretString),
+	})
+	if err == nil {
+		return nil
+	}
+
+	if !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		zap.L().Error(fmt.Sprintf("PutSecretValue failed :: %s :: ", secretName) + err.Error())
+		return err
+	}
+
+	_, err = svc.CreateSecret(context.TODO(), &secretsmanager.CreateSecretInput{
+		Name:         aws.String(secretName),
+		Description:  &secretDescription,
+		SecretString: aws.String(secretString),
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("CreateSecret failed :: %s :: ", secretName) + err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Creates or replaces a dynamic role template
+// ///////////////////////////////////////////////
+func SetDynamicRole(headers dtos.CustomHeaders, role dtos.DynamicRole) (dtos.DynamicRole, error) {
+	prefix := utils.CreatePrefix(headers)
+	zap.L().Info("Setting Dynamic Role :: " + prefix + " :: " + role.Name)
+
+	role.UpdatedAt = time.Now().UTC()
+	if err := store.SetJSON(dynamicRoleKey(prefix, role.Name), role, 0); err != nil {
+		zap.L().Error("Saving Dynamic Role Failed :: " + err.Error())
+		return dtos.DynamicRole{}, err
+	}
+
+	return role, nil
+}
+
+// Returns a dynamic role template
+// ///////////////////////////////////
+func GetDynamicRole(headers dtos.CustomHeaders, name string) (dtos.DynamicRole, error) {
+	prefix := utils.CreatePrefix(headers)
+	var role dtos.DynamicRole
+
+	if err := store.GetJSON(dynamicRoleKey(prefix, name), &role); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.DynamicRole{}, constants.ErrDynamicRoleNotFound
+		}
+		return dtos.DynamicRole{}, err
+	}
+
+	return role, nil
+}
+
+// Deletes a dynamic role template, existing leases are kept until they expire
+// //////////////////////////////////////////////////////////////////////////////
+func DeleteDynamicRole(headers dtos.CustomHeaders, name string) (string, error) {
+	prefix := utils.CreatePrefix(headers)
+	if _, err := GetDynamicRole(headers, name); err != nil {
+		return "", err
+	}
+
+	zap.L().Info("Deleting Dynamic Role :: " + prefix + " :: " + name)
+	if err := store.Default().Delete(dynamicRoleKey(prefix, name)); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// Creates a new database user for a role and leases it
+// ////////////////////////////////////////////////////////
+func IssuePostgresCredentials(headers dtos.CustomHeaders, roleName string) (dtos.DynamicCredentials, error) {
+	role, err := GetDynamicRole(headers, roleName)
+	if err != nil {
+		return dtos.DynamicCredentials{}, err
+	}
+
+	db, err := openPostgresConnection(headers)
+	if err != nil {
+		return dtos.DynamicCredentials{}, err
+	}
+	defer db.Close()
+
+	ttl, _ := time.ParseDuration(role.DefaultTtl)
+	maxTtl, _ := time.ParseDuration(role.MaxTtl)
+	now := time.Now().UTC()
+
+	credentials, err := dynamic.CreatePostgresUser(db, role.Name, role.CreationStatements, now.Add(ttl))
+	if err != nil {
+		zap.L().Error("Creating Dynamic User Failed :: " + err.Error())
+		return dtos.DynamicCredentials{}, err
+	}
+
+	leaseId, _ := uuid.NewRandom()
+	lease := dtos.Lease{
+		LeaseId:      "lease_" + leaseId.String(),
+		Engine:       constants.POSTGRES_ENGINE,
+		Role:         role.Name,
+		Username:     credentials.Username,
+		OrgId:        headers.OrgId,
+		ProjectId:    headers.ProjectId,
+		Scope:        headers.Scope,
+		IssuedAt:     now,
+		ExpiresAt:    credentials.Expiration,
+		MaxExpiresAt: now.Add(maxTtl),
+	}
+
+	if err := store.SetJSON(leaseKey(lease.LeaseId), lease, 0); err != nil {
+		// A user without a lease would never be revoked
+		zap.L().Error("Saving Lease Failed :: " + err.Error())
+		dynamic.RevokePostgresUser(db, credentials.Username, role.RevocationStatements)
+		return dtos.DynamicCredentials{}, err
+	}
+	zap.L().Info("Issued Dynamic Credentials :: " + lease.LeaseId + " :: " + lease.Username)
+
+	return dtos.DynamicCredentials{
+		LeaseId:   lease.LeaseId,
+		Username:  credentials.Username,
+		Password:  credentials.Password,
+		Ttl:       int(ttl.Seconds()),
+		ExpiresAt: credentials.Expiration,
+	}, nil
+}
+
+// Returns a lease owned by the key
+// ///////////////////////////////////
+func GetLease(headers dtos.CustomHeaders, leaseId string) (dtos.Lease, error) {
+	var lease dtos.Lease
+	if err := store.GetJSON(leaseKey(leaseId), &lease); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.Lease{}, constants.ErrLeaseNotFound
+		}
+		return dtos.Lease{}, err
+	}
+
+	// Leases of other keys are reported as missing
+	if lease.OrgId != headers.OrgId || lease.ProjectId != headers.ProjectId || lease.Scope != headers.Scope {
+		return dtos.Lease{}, constants.ErrLeaseNotFound
+	}
+
+	return lease, nil
+}
+
+// Extends a lease up to the max ttl of its role
+// /////////////////////////////////////////////////
+// - expired leases can't be renewed, even while their revocation is retried
+func RenewLease(headers dtos.CustomHeaders, leaseId string, requestBody dtos.LeaseRenewReq) (dtos.Lease, error) {
+	lease, err := GetLease(headers, leaseId)
+	if err != nil {
+		return dtos.Lease{}, err
+	}
+	if !lease.ExpiresAt.After(time.Now().UTC()) {
+		return dtos.Lease{}, constants.ErrLeaseExpired
+	}
+
+	role, err := GetDynamicRole(headers, lease.Role)
+	if err != nil {
+		return dtos.Lease{}, err
+	}
+
+	increment, _ := time.ParseDuration(utils.SetDefaultIfEmptyValue(requestBody.Increment, role.DefaultTtl))
+	expiresAt := time.Now().UTC().Add(increment)
+	if expiresAt.After(lease.MaxExpiresAt) {
+		expiresAt = lease.MaxExpiresAt
+	}
+
+	db, err := openPostgresConnection(headers)
+	if err != nil {
+		return dtos.Lease{}, err
+	}
+	defer db.Close()
+
+	zap.L().Info("Renewing Lease :: " + lease.LeaseId)
+	if err := dynamic.RenewPostgresUser(db, lease.Username, role.RenewStatements, expiresAt); err != nil {
+		zap.L().Error("Renewing Dynamic User Failed :: " + err.Error())
+		return dtos.Lease{}, err
+	}
+
+	lease.ExpiresAt = expiresAt
+	if err := store.SetJSON(leaseKey(lease.LeaseId), lease, 0); err != nil {
+		return dtos.Lease{}, err
+	}
+
+	return lease, nil
+}
+
+// Revokes a lease by removing its database user
+// /////////////////////////////////////////////////
+func RevokeLease(headers dtos.CustomHeaders, leaseId string) (string, error) {
+	lease, err := GetLease(headers, leaseId)
+	if err != nil {
+		return "", err
+	}
+
+	if err := revokeLease(lease); err != nil {
+		return "", err
+	}
+
+	return lease.LeaseId, nil
+}
+
+// Helper function to revoke a lease once across replicas
+// /////////////////////////////////////////////////////////
+func revokeLease(lease dtos.Lease) error {
+	acquired, err := store.Default().SetNX(leaseLockKey(lease.LeaseId), lease.Username, LEASE_LOCK_TTL)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return constants.ErrRevocationInProgress
+	}
+	defer store.Default().Delete(leaseLockKey(lease.LeaseId))
+
+	headers := dtos.CustomHeaders{
+		OrgId:     lease.OrgId,
+		ProjectId: lease.ProjectId,
+		Scope:     lease.Scope,
+	}
+
+	// Revocation statements of a deleted role fall back to the defaults
+	role, err := GetDynamicRole(headers, lease.Role)
+	if err != nil && err != constants.ErrDynamicRoleNotFound {
+		return err
+	}
+
+	db, err := openPostgresConnection(headers)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	zap.L().Info("Revoking Lease :: " + lease.LeaseId + " :: " + lease.Username)
+	if err := dynamic.RevokePostgresUser(db, lease.Username, role.RevocationStatements); err != nil {
+		zap.L().Error("Revoking Dynamic User Failed :: " + err.Error())
+		return err
+	}
+
+	return store.Default().Delete(leaseKey(lease.LeaseId))
+}
+
+// Starts the background reaper revoking expired leases
+// ////////////////////////////////////////////////////////
+func StartLeaseReaper(interval time.Duration) {
+	zap.L().Info("Starting Lease Reaper :: every " + interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			RevokeExpiredLeases(time.Now().UTC())
+		}
+	}()
+}
+
+// Revokes every lease expired at the given time
+// /////////////////////////////////////////////////
+// - failed revocations are retried after LEASE_RETRY_DELAY, the expiry of the lease is kept
+func RevokeExpiredLeases(now time.Time) []string {
+	keys, err := store.Default().Keys("dynamic:lease:")
+	if err != nil {
+		zap.L().Error("Listing Leases Failed :: " + err.Error())
+		return nil
+	}
+
+	var revoked []string
+	for _, key := range keys {
+		var lease dtos.Lease
+		if err := store.GetJSON(key, &lease); err != nil || lease.ExpiresAt.After(now) {
+			continue
+		}
+		if lease.NextRevocationAt != nil && lease.NextRevocationAt.After(now) {
+			continue
+		}
+
+		err := revokeLease(lease)
+		if err == constants.ErrRevocationInProgress {
+			continue
+		}
+		if err != nil {
+			// Failed revocations are retried on a later run
+			zap.L().Error(fmt.Sprintf("Revoking Expired Lease Failed :: %s :: ", lease.LeaseId) + err.Error())
+			lease.LastError = err.Error()
+			nextRevocationAt := now.Add(LEASE_RETRY_DELAY)
+			lease.NextRevocationAt = &nextRevocationAt
+			store.SetJSON(key, lease, 0)
+			continue
+		}
+		revoked = append(revoked, lease.LeaseId)
+	}
+
+	return revoked
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"encoding/json"
+
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/envelope"
+
+	"go.uber.org/zap"
+)
+
+var envelopeKeyScope = constants.ORGANIZATION_KEY_SCOPE
+
+// Enables the envelope encryption of the SHARED secret values
+// //////////////////////////////////////////////////////////////
+// - every organization, or every project of an organization, gets its own data key
+// - values written before are kept in plaintext until they are updated
+func UseEnvelopeEncryption(keyWrapper envelope.KeyWrapper, keyScope string) error {
+	if keyScope != constants.ORGANIZATION_KEY_SCOPE && keyScope != constants.PROJECT_KEY_SCOPE {
+		return constants.ErrInvalidEnvelopeKeyScope
+	}
+
+	envelopeKeyScope = keyScope
+	envelope.Use(keyWrapper)
+	zap.L().Info("Envelope Encryption Enabled", zap.String("wrapper", keyWrapper.Name()), zap.String("keyScope", keyScope))
+	return nil
+}
+
+// Returns the name of the data key of a tenant, projects share the key of their organization by default
+func getDataKeyName(orgId string, projectId string) string {
+	if envelopeKeyScope == constants.PROJECT_KEY_SCOPE && projectId != "" {
+		return orgId + "_" + projectId
+	}
+	return orgId
+}
+
+// Helper function to seal a value of a SHARED secret group
+// ///////////////////////////////////////////////////////////
+// - the value is bound to its group and ID, values are returned as they are when the encryption is disabled
+func sealSharedValue(orgId string, projectId string, secretName string, id string, value interface{}) (interface{}, error) {
+	if !envelope.Enabled() {
+		return value, nil
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := envelope.Seal(getDataKeyName(orgId, projectId), secretName+"/"+id, plaintext)
+	if err != nil {
+		zap.L().Error("Sealing Secret Value Failed :: " + secretName + " :: " + err.Error())
+		return nil, err
+	}
+
+	return sealed, nil
+}
+
+// Helper function to open a value of a SHARED secret group, plaintext values are returned as they are
+// ///////////////////////////////////////////////////////////////////////////////////////////////////////
+func openSharedValue(secretName string, id string, value interface{}) (interface{}, error) {
+	sealed, ok := envelope.FromValue(value)
+	if !ok {
+		return value, nil
+	}
+
+	plaintext, err := envelope.Open(sealed, secretName+"/"+id)
+	if err != nil {
+		zap.L().Error("Opening Secret Value Failed :: " + secretName + " :: " + id + " :: " + err.Error())
+		return nil, err
+	}
+
+	var opened interface{}
+	if err := json.Unmarshal(plaintext, &opened); err != nil {
+		return nil, constants.ErrInvalidEnvelope
+	}
+	return opened, nil
+}
+
+// Helper function to open the current and previous values of a SHARED secret group
+func openSharedGroupValues(secretName string, values map[string]migratedValue) error {
+	for id, value := range values {
+		current, err := openSharedValue(secretName, id, value.current)
+		if err != nil {
+			return err
+		}
+		previous := value.previous
+		if value.hasPrevious {
+			if previous, err = openSharedValue(secretName, id, value.previous); err != nil {
+				return err
+			}
+		}
+		values[id] = migratedValue{current: current, previous: previous, hasPrevious: value.hasPrevious}
+	}
+
+	return nil
+}
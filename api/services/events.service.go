@@ -0,0 +1,21 @@
+package services
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/events"
+)
+
+// Helper function to publish secret lifecycle events
+// /////////////////////////////////////////////////////
+func publishSecretEvent(headers dtos.CustomHeaders, eventType string, secretId string, versionId string, metadata map[string]interface{}) {
+	events.Publish(events.Event{
+		Type:      eventType,
+		OrgId:     headers.OrgId,
+		ProjectId: headers.ProjectId,
+		Scope:     headers.Scope,
+		SecretId:  secretId,
+		VersionId: versionId,
+		TraceId:   headers.TraceId,
+		Metadata:  metadata,
+	})
+}
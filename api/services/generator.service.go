@@ -0,0 +1,53 @@
+package services
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/generators"
+
+	"go.uber.org/zap"
+)
+
+// Generates a secret value and stores it as a new secret
+// /////////////////////////////////////////////////////////
+// - the generated value never leaves the service, only the public key of key pairs is returned
+func GenerateSecret(headers dtos.CustomHeaders, spec generators.Spec) (dtos.GeneratedSecret, error) {
+	zap.L().Info("Generating Secret :: " + spec.Type)
+	value, err := generators.Generate(spec)
+	if err != nil {
+		zap.L().Error("Generating Secret Failed :: " + err.Error())
+		return dtos.GeneratedSecret{}, err
+	}
+
+	id, err := CreateSecret(headers, value)
+	if err != nil {
+		return dtos.GeneratedSecret{}, err
+	}
+
+	return dtos.GeneratedSecret{
+		Id:        id,
+		Type:      spec.Type,
+		PublicKey: generators.PublicPart(spec, value),
+	}, nil
+}
+
+// Generates a secret value and replaces the value of an existing secret
+// ////////////////////////////////////////////////////////////////////////
+func RegenerateSecret(headers dtos.CustomHeaders, id string, spec generators.Spec) (dtos.GeneratedSecret, error) {
+	zap.L().Info("Regenerating Secret :: " + id + " :: " + spec.Type)
+	value, err := generators.Generate(spec)
+	if err != nil {
+		zap.L().Error("Generating Secret Failed :: " + err.Error())
+		return dtos.GeneratedSecret{}, err
+	}
+
+	_, err = UpdateSecret(headers, id, value)
+	if err != nil {
+		return dtos.GeneratedSecret{}, err
+	}
+
+	return dtos.GeneratedSecret{
+		Id:        id,
+		Type:      spec.Type,
+		PublicKey: generators.PublicPart(spec, value),
+	}, nil
+}
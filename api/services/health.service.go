@@ -0,0 +1,196 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+
+	"go.uber.org/zap"
+)
+
+var HEALTH_CHECK_LOCK_KEY = "health:lock"
+var HEALTH_CHECK_LAST_RUN_KEY = "health:last-run"
+
+func registrationHealthKey(secretName string) string {
+	return "registry:health:" + secretName
+}
+
+// Starts the periodic health checks of the PRIVATE registrations
+// //////////////////////////////////////////////////////////////////
+// - a single replica runs the checks of every interval
+func StartHealthChecker(interval time.Duration) {
+	zap.L().Info("Starting PRIVATE Health Checker :: every " + interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// The lock expires with the interval, it's never released so other replicas skip this run
+			acquired, err := store.Default().SetNX(HEALTH_CHECK_LOCK_KEY, "1", interval)
+			if err != nil || !acquired {
+				continue
+			}
+			RunHealthChecks()
+		}
+	}()
+}
+
+// Checks the access of every PRIVATE registration, recording its health
+// //////////////////////////////////////////////////////////////////////////
+// - every role is assumed once per organization and its permissions are checked without writing, see CheckSecretManagerAccess
+// - registrations are found in the inventory index, rebuilt first when it was never built in this store
+func RunHealthChecks() (dtos.HealthCheckRun, error) {
+	run := dtos.HealthCheckRun{StartedAt: time.Now().UTC()}
+	if err := ensureInventory(); err != nil {
+		zap.L().Error("Rebuilding Inventory Failed :: " + err.Error())
+		return run, err
+	}
+
+	entries, err := getInventoryEntries()
+	if err != nil {
+		zap.L().Error("Listing Registrations Failed :: " + err.Error())
+		return run, err
+	}
+
+	targets := map[string][]inventoryEntry{}
+	for _, entry := range entries {
+		if entry.Flow == constants.PRIVATE_FLOW {
+			// The ExternalId of the role depends on the organization
+			target := entry.ARN + "|" + entry.Region + "|" + entry.OrgId
+			targets[target] = append(targets[target], entry)
+		}
+	}
+
+	for _, targetEntries := range targets {
+		check := CheckSecretManagerAccess(targetEntries[0].OrgId, targetEntries[0].ARN, targetEntries[0].Region, PRIVATE_FLOW_PERMISSIONS)
+		for _, entry := range targetEntries {
+			if health := recordRegistrationHealth(entry.SecretName, check); health.Status == constants.UNHEALTHY_STATUS {
+				run.Unhealthy++
+			}
+			run.Registrations++
+		}
+		run.Roles++
+	}
+
+	run.FinishedAt = time.Now().UTC()
+	store.SetJSON(HEALTH_CHECK_LAST_RUN_KEY, run, 0)
+	zap.L().Info(fmt.Sprintf("PRIVATE Health Checks Done :: %d registrations :: %d unhealthy", run.Registrations, run.Unhealthy))
+
+	return run, nil
+}
+
+// Lists the PRIVATE registrations with their health
+// ////////////////////////////////////////////////////
+// - registrations which weren't checked yet are UNKNOWN, every status is returned when none is given
+func ListPrivateRegistrationHealth(status string) ([]dtos.PrivateRegistrationHealth, error) {
+	entries, err := getInventoryEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	registrations := []dtos.PrivateRegistrationHealth{}
+	for _, entry := range entries {
+		if entry.Flow != constants.PRIVATE_FLOW {
+			continue
+		}
+
+		registration := dtos.PrivateRegistrationHealth{
+			SecretName: entry.SecretName,
+			OrgId:      entry.OrgId,
+			ProjectId:  entry.ProjectId,
+			Scope:      entry.Scope,
+			ARN:        dtos.RedactArn(entry.Flow, entry.ARN),
+			Region:     entry.Region,
+			Health:     dtos.RegistrationHealth{Status: constants.UNKNOWN_STATUS},
+		}
+		if health := GetRegistrationHealth(entry.SecretName); health != nil {
+			registration.Health = *health
+		}
+
+		if status == "" || registration.Health.Status == status {
+			registrations = append(registrations, registration)
+		}
+	}
+
+	sort.Slice(registrations, func(i, j int) bool { return registrations[i].SecretName < registrations[j].SecretName })
+	return registrations, nil
+}
+
+// Returns the recorded health of a registration, nil until it is checked
+// //////////////////////////////////////////////////////////////////////////
+func GetRegistrationHealth(secretName string) *dtos.RegistrationHealth {
+	var health dtos.RegistrationHealth
+	if err := store.GetJSON(registrationHealthKey(secretName), &health); err != nil {
+		return nil
+	}
+	return &health
+}
+
+// Returns the health of the PRIVATE registrations in the Prometheus text format
+// /////////////////////////////////////////////////////////////////////////////////
+// - only totals are exposed, the registrations are listed by the admin endpoint
+func GetHealthMetrics() string {
+	counts := map[string]int{constants.HEALTHY_STATUS: 0, constants.UNHEALTHY_STATUS: 0, constants.UNKNOWN_STATUS: 0}
+	if registrations, err := ListPrivateRegistrationHealth(""); err == nil {
+		for _, registration := range registrations {
+			counts[registration.Health.Status]++
+		}
+	}
+
+	var metrics strings.Builder
+	metrics.WriteString("# HELP secret_svc_private_registrations PRIVATE registrations by health status.\n")
+	metrics.WriteString("# TYPE secret_svc_private_registrations gauge\n")
+	for _, status := range []string{constants.HEALTHY_STATUS, constants.UNHEALTHY_STATUS, constants.UNKNOWN_STATUS} {
+		metrics.WriteString(fmt.Sprintf("secret_svc_private_registrations{status=\"%s\"} %d\n", strings.ToLower(status), counts[status]))
+	}
+
+	var run dtos.HealthCheckRun
+	if store.GetJSON(HEALTH_CHECK_LAST_RUN_KEY, &run) == nil {
+		metrics.WriteString("# HELP secret_svc_private_health_check_last_run_timestamp_seconds Time of the last run of the PRIVATE health checks.\n")
+		metrics.WriteString("# TYPE secret_svc_private_health_check_last_run_timestamp_seconds gauge\n")
+		metrics.WriteString(fmt.Sprintf("secret_svc_private_health_check_last_run_timestamp_seconds %d\n", run.FinishedAt.Unix()))
+		metrics.WriteString("# HELP secret_svc_private_health_check_duration_seconds Duration of the last run of the PRIVATE health checks.\n")
+		metrics.WriteString("# TYPE secret_svc_private_health_check_duration_seconds gauge\n")
+		metrics.WriteString(fmt.Sprintf("secret_svc_private_health_check_duration_seconds %g\n", run.FinishedAt.Sub(run.StartedAt).Seconds()))
+	}
+
+	return metrics.String()
+}
+
+// Helper function to record the outcome of an access check on a registration
+// //////////////////////////////////////////////////////////////////////////////
+// - the last success is kept while the registration is unhealthy
+func recordRegistrationHealth(secretName string, check dtos.AccessCheck) dtos.RegistrationHealth {
+	health := dtos.RegistrationHealth{
+		Status:    constants.HEALTHY_STATUS,
+		CheckedAt: check.CheckedAt,
+		Denied:    GetDeniedPermissions(check),
+		Error:     check.Error,
+	}
+	previous := GetRegistrationHealth(secretName)
+
+	if !check.AssumeRole || len(health.Denied) > 0 {
+		health.Status = constants.UNHEALTHY_STATUS
+		health.ConsecutiveFailures = 1
+		if previous != nil {
+			health.LastSuccessAt = previous.LastSuccessAt
+			health.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		}
+		if previous == nil || previous.Status != constants.UNHEALTHY_STATUS {
+			zap.L().Error("PRIVATE Registration Unhealthy :: " + secretName)
+		}
+	} else {
+		health.LastSuccessAt = &health.CheckedAt
+	}
+
+	if err := store.SetJSON(registrationHealthKey(secretName), health, 0); err != nil {
+		zap.L().Error("Saving Registration Health Failed :: " + secretName + " :: " + err.Error())
+	}
+	return health
+}
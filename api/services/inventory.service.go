@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"go.uber.org/zap"
+)
+
+var INVENTORY_INDEX_PREFIX = "registry:index:"
+var INVENTORY_INDEXED_AT_KEY = "registry:indexed-at"
+
+// Index entry of a system secret, never holds secret values
+type inventoryEntry struct {
+	SecretName string     `json:"secretName"`
+	OrgId      string     `json:"orgId"`
+	ProjectId  string     `json:"projectId,omitempty"`
+	Scope      string     `json:"scope,omitempty"`
+	Flow       string     `json:"flow"`
+	ARN        string     `json:"arn"`
+	Region     string     `json:"region"`
+	Provider   string     `json:"provider"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+}
+
+func inventoryKey(secretName string) string {
+	return INVENTORY_INDEX_PREFIX + secretName
+}
+
+// Lists the organizations and projects registered in the System secret manager
+// /////////////////////////////////////////////////////////////////////////////////
+// - served from the inventory index, kept up to date by registrations, migrations and deletions
+// - secret counts are read from the secret manager of every scope in the page
+func ListInventory(filter dtos.InventoryFilter) (dtos.InventoryPage, error) {
+	indexEntries, err := getInventoryEntries()
+	if err != nil {
+		return dtos.InventoryPage{}, err
+	}
+
+	registrations := map[string]*dtos.InventoryRegistration{}
+	entries := map[string][]inventoryEntry{}
+	for _, entry := range indexEntries {
+		if !matchInventoryEntry(filter, entry) {
+			continue
+		}
+
+		registrationKey := dtos.GetInventoryKey(entry.OrgId, entry.ProjectId)
+		if filter.After != "" && registrationKey <= filter.After {
+			continue
+		}
+		if _, ok := registrations[registrationKey]; !ok {
+			registrations[registrationKey] = &dtos.InventoryRegistration{OrgId: entry.OrgId, ProjectId: entry.ProjectId}
+		}
+		entries[registrationKey] = append(entries[registrationKey], entry)
+	}
+
+	registrationKeys := []string{}
+	for registrationKey := range registrations {
+		registrationKeys = append(registrationKeys, registrationKey)
+	}
+	sort.Strings(registrationKeys)
+
+	page := dtos.InventoryPage{Registrations: []dtos.InventoryRegistration{}}
+	if len(registrationKeys) > filter.Limit {
+		registrationKeys = registrationKeys[:filter.Limit]
+		page.NextToken = dtos.CreateNewInventoryNextToken(*registrations[registrationKeys[filter.Limit-1]])
+	}
+
+	counter := newInventoryCounter()
+	for _, registrationKey := range registrationKeys {
+		registration := registrations[registrationKey]
+		scopeEntries := entries[registrationKey]
+		sort.Slice(scopeEntries, func(i, j int) bool { return scopeEntries[i].Scope < scopeEntries[j].Scope })
+
+		for _, entry := range scopeEntries {
+			scope := dtos.InventoryScope{
+				Scope:     entry.Scope,
+				Flow:      entry.Flow,
+				Provider:  entry.Provider,
+				Region:    entry.Region,
+				CreatedAt: entry.CreatedAt,
+			}
+			if entry.Flow == constants.PRIVATE_FLOW {
+				scope.Health = GetRegistrationHealth(entry.SecretName)
+			}
+			if filter.Counts {
+				count, err := counter.count(entry)
+				if err != nil {
+					scope.CountError = err.Error()
+				} else {
+					scope.SecretCount = &count
+				}
+			}
+			addInventoryScope(registration, scope)
+		}
+		page.Registrations = append(page.Registrations, *registration)
+	}
+
+	var indexedAt time.Time
+	if store.GetJSON(INVENTORY_INDEXED_AT_KEY, &indexedAt) == nil {
+		page.IndexedAt = &indexedAt
+	}
+
+	return page, nil
+}
+
+// Rebuilds the inventory index from the System secret manager
+// ///////////////////////////////////////////////////////////////
+// - system secrets are found with ListSecrets, entries of removed system secrets are dropped
+// - needed once for system secrets registered before the index, or after losing the store
+func RebuildInventory(ctx context.Context) (int, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	reportJobProgress(ctx, 0, 1, "listing system secrets")
+	systemSecrets, err := listPrivateSecrets(svc, []types.Filter{
+		{Key: types.FilterNameStringTypeDescription, Values: []string{"Organization ID: "}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	indexed := map[string]bool{}
+	for i, systemSecret := range systemSecrets {
+		if ctx.Err() != nil {
+			return len(indexed), constants.ErrJobCancelled
+		}
+		reportJobProgress(ctx, i, len(systemSecrets), "indexing "+aws.ToString(systemSecret.Name))
+
+		entry, ok := getInventoryEntry(systemSecret)
+		if !ok {
+			continue
+		}
+		metadata, err := getSystemSecretData(svc, entry.SecretName)
+		if err != nil {
+			if strings.Contains(err.Error(), "ResourceNotFoundException") {
+				continue
+			}
+			return len(indexed), err
+		}
+		// Only system secrets hold a flow, other secrets of the account are left out
+		if flow, _ := metadata[constants.FLOW_META_DATA].(string); flow == "" {
+			continue
+		}
+
+		setInventoryEntry(entry, metadata)
+		indexed[entry.SecretName] = true
+	}
+
+	keys, err := store.Default().Keys(INVENTORY_INDEX_PREFIX)
+	if err != nil {
+		return len(indexed), err
+	}
+	for _, key := range keys {
+		if !indexed[strings.TrimPrefix(key, INVENTORY_INDEX_PREFIX)] {
+			store.Default().Delete(key)
+		}
+	}
+
+	store.SetJSON(INVENTORY_INDEXED_AT_KEY, time.Now().UTC(), 0)
+	reportJobProgress(ctx, len(systemSecrets), len(systemSecrets), "indexed")
+	zap.L().Info(fmt.Sprintf("Inventory Rebuilt :: %d system secrets", len(indexed)))
+
+	return len(indexed), nil
+}
+
+// Helper function to rebuild the inventory index unless it was built in this store
+// ////////////////////////////////////////////////////////////////////////////////////
+// - the index misses the registrations made before it, and every registration after losing the store
+func ensureInventory() error {
+	var indexedAt time.Time
+	err := store.GetJSON(INVENTORY_INDEXED_AT_KEY, &indexedAt)
+	if err != constants.ErrRecordNotFound {
+		return err
+	}
+
+	_, err = RebuildInventory(context.Background())
+	return err
+}
+
+// Helper function to index a registered system secret
+// ///////////////////////////////////////////////////////
+func indexSystemSecret(headers dtos.CustomHeaders, secretName string, metadata map[string]interface{}) {
+	now := time.Now().UTC()
+	setInventoryEntry(inventoryEntry{
+		SecretName: secretName,
+		OrgId:      headers.OrgId,
+		ProjectId:  headers.ProjectId,
+		Scope:      getSecretNameScope(headers, secretName),
+		CreatedAt:  &now,
+	}, metadata)
+}
+
+// Helper function to update the index entry of a migrated system secret
+// /////////////////////////////////////////////////////////////////////////
+// - system secrets which aren't indexed yet are left to the next rebuild
+func reindexSystemSecret(secretName string, metadata map[string]interface{}) {
+	var entry inventoryEntry
+	if err := store.GetJSON(inventoryKey(secretName), &entry); err != nil {
+		return
+	}
+	setInventoryEntry(entry, metadata)
+}
+
+func unindexSystemSecret(secretName string) {
+	for _, key := range []string{inventoryKey(secretName), registrationHealthKey(secretName)} {
+		if err := store.Default().Delete(key); err != nil && err != constants.ErrRecordNotFound {
+			zap.L().Error("Removing Inventory Entry Failed :: " + key + " :: " + err.Error())
+		}
+	}
+}
+
+// Helper function to read every entry of the inventory index
+func getInventoryEntries() ([]inventoryEntry, error) {
+	keys, err := store.Default().Keys(INVENTORY_INDEX_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []inventoryEntry{}
+	for _, key := range keys {
+		var entry inventoryEntry
+		if err := store.GetJSON(key, &entry); err != nil {
+			if err == constants.ErrRecordNotFound {
+				continue
+			}
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func setInventoryEntry(entry inventoryEntry, metadata map[string]interface{}) {
+	entry = getInventoryMetadata(entry, metadata)
+	if err := store.SetJSON(inventoryKey(entry.SecretName), entry, 0); err != nil {
+		zap.L().Error("Saving Inventory Entry Failed :: " + entry.SecretName + " :: " + err.Error())
+	}
+}
+
+func getInventoryMetadata(entry inventoryEntry, metadata map[string]interface{}) inventoryEntry {
+	entry.Flow, _ = metadata[constants.FLOW_META_DATA].(string)
+	entry.ARN, _ = metadata[constants.ARN_META_DATA].(string)
+	entry.Region, _ = metadata[constants.REGION_META_DATA].(string)
+	entry.Provider, _ = metadata[constants.PROVIDER_META_DATA].(string)
+
+	return entry
+}
+
+// Helper function to get the index entry of a listed system secret
+// ////////////////////////////////////////////////////////////////////
+// - system secrets registered before they were tagged are parsed from their name (<orgId>[_<projectId>_<scope>])
+func getInventoryEntry(systemSecret types.SecretListEntry) (inventoryEntry, bool) {
+	entry := inventoryEntry{SecretName: aws.ToString(systemSecret.Name), CreatedAt: systemSecret.CreatedDate}
+	for _, tag := range systemSecret.Tags {
+		switch aws.ToString(tag.Key) {
+		case constants.ORGANIZATION_TAG:
+			entry.OrgId = aws.ToString(tag.Value)
+		case constants.PROJECT_TAG:
+			entry.ProjectId = aws.ToString(tag.Value)
+		case constants.SCOPE_TAG:
+			entry.Scope = aws.ToString(tag.Value)
+		}
+	}
+	if entry.OrgId != "" {
+		return entry, true
+	}
+
+	// Organization IDs may contain '_', the organization is taken from the description
+	entry.OrgId = strings.TrimPrefix(aws.ToString(systemSecret.Description), "Organization ID: ")
+	if entry.SecretName == entry.OrgId {
+		return entry, true
+	}
+
+	project := strings.TrimPrefix(entry.SecretName, entry.OrgId+"_")
+	separator := strings.LastIndex(project, "_")
+	if project == entry.SecretName || separator <= 0 {
+		return entry, false
+	}
+	entry.ProjectId = project[:separator]
+	entry.Scope = project[separator+1:]
+
+	return entry, true
+}
+
+// Helper function to get the tags of a system secret
+func getSystemSecretTags(headers dtos.CustomHeaders, secretName string) []types.Tag {
+	tags := []types.Tag{{Key: aws.String(constants.ORGANIZATION_TAG), Value: aws.String(headers.OrgId)}}
+	if headers.ProjectId != "" {
+		tags = append(tags,
+			types.Tag{Key: aws.String(constants.PROJECT_TAG), Value: aws.String(headers.ProjectId)},
+			types.Tag{Key: aws.String(constants.SCOPE_TAG), Value: aws.String(getSecretNameScope(headers, secretName))},
+		)
+	}
+
+	return tags
+}
+
+func matchInventoryEntry(filter dtos.InventoryFilter, entry inventoryEntry) bool {
+	return (filter.OrgId == "" || filter.OrgId == entry.OrgId) &&
+		(filter.ProjectId == "" || filter.ProjectId == entry.ProjectId) &&
+		(filter.Flow == "" || filter.Flow == entry.Flow) &&
+		(filter.Provider == "" || filter.Provider == entry.Provider) &&
+		(filter.Region == "" || filter.Region == entry.Region) &&
+		(filter.Scope == "" || filter.Scope == entry.Scope)
+}
+
+// Helper function to add a scope to a registration, summing its flows, creation time and secret count
+func addInventoryScope(registration *dtos.InventoryRegistration, scope dtos.InventoryScope) {
+	registration.Scopes = append(registration.Scopes, scope)
+	if !utils.ArrayContains(registration.Flows, scope.Flow) {
+		registration.Flows = append(registration.Flows, scope.Flow)
+		sort.Strings(registration.Flows)
+	}
+
+	if scope.CreatedAt != nil && (registration.CreatedAt == nil || scope.CreatedAt.Before(*registration.CreatedAt)) {
+		registration.CreatedAt = scope.CreatedAt
+	}
+
+	if scope.SecretCount != nil {
+		count := *scope.SecretCount
+		if registration.SecretCount != nil {
+			count += *registration.SecretCount
+		}
+		registration.SecretCount = &count
+	}
+}
+
+// Counts the secrets of the scopes in a page, assuming every role once
+type inventoryCounter struct {
+	clients map[string]*secretsmanager.Client
+	errors  map[string]error
+}
+
+func newInventoryCounter() *inventoryCounter {
+	return &inventoryCounter{clients: map[string]*secretsmanager.Client{}, errors: map[string]error{}}
+}
+
+func (counter *inventoryCounter) count(entry inventoryEntry) (int, error) {
+	target := dtos.MigrationTarget{Flow: entry.Flow, ARN: entry.ARN, Region: entry.Region}
+	clientKey := target.ARN + "|" + target.Region
+	if err := counter.errors[clientKey]; err != nil {
+		return 0, err
+	}
+
+	svc, ok := counter.clients[clientKey]
+	if !ok {
+		var err error
+		if svc, err = getMigrationSecretManager(entry.OrgId, target); err != nil {
+			counter.errors[clientKey] = err
+			return 0, err
+		}
+		counter.clients[clientKey] = svc
+	}
+
+	if entry.Flow == constants.SHARED_FLOW {
+		secretData, _, err := getSharedGroupData(svc, entry.SecretName)
+		if err != nil {
+			return 0, err
+		}
+		return len(getSharedGroupValues(secretData)), nil
+	}
+
+	ids, err := listPrivateGroupSecrets(svc, entry.SecretName)
+	return len(ids), err
+}
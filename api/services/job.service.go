@@ -0,0 +1,548 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var JOB_MAX_ATTEMPTS = 3
+var JOB_BASE_DELAY = 10 * time.Second
+var JOB_LOCK_TTL = time.Minute
+var JOB_HEARTBEAT = 10 * time.Second
+var JOB_RETENTION = 7 * 24 * time.Hour
+var JOB_WRITE_DRAIN_TIMEOUT = 15 * time.Second
+
+// Errors which can't be fixed by retrying a job
+var NON_RETRYABLE_JOB_ERRORS = []error{
+	constants.ErrInvalidMigration,
+	constants.ErrSameMigrationTarget,
+	constants.ErrUntaggedPrivateSecrets,
+	constants.ErrUnregisteredKey,
+	constants.ErrUntargetedScope,
+	constants.ErrInvalidScope,
+	constants.ErrMigrationInProgress,
+	constants.ErrMigrationNotFound,
+	constants.ErrMigrationFinished,
+	constants.ErrMigrationRollbackNotAllowed,
+	constants.ErrMigrationPlanNotFound,
+	constants.ErrMigrationPlanExpired,
+	constants.ErrMigrationPlanNotApprovable,
+	constants.ErrMigrationPlanUsed,
+	constants.ErrMigrationPlanStale,
+	constants.ErrInvalidJobType,
+	constants.ErrJobCancelled,
+	constants.ErrOrgOffboardingProject,
+	constants.ErrAdoptionNotPrivate,
+	constants.ErrSecretNotUntagged,
+}
+
+// Runs a job, returning its result
+type jobHandler func(ctx context.Context, job *dtos.Job) (interface{}, error)
+
+// Job of the current worker, reachable from the operations it runs
+type jobRun struct {
+	job  *dtos.Job
+	save func()
+}
+
+type jobRunKey struct{}
+
+func jobKey(id string) string {
+	return "job:record:" + id
+}
+
+func jobLockKey(id string) string {
+	return "job:lock:" + id
+}
+
+func jobCancelKey(id string) string {
+	return "job:cancel:" + id
+}
+
+// Jobs of a system secret key run one at a time, whatever their scope
+// - inventory rebuilds span every organization, one runs at a time
+func jobKeyLockKey(job dtos.Job) string {
+	if job.Type == constants.INVENTORY_REBUILD_JOB {
+		return "job:key:inventory"
+	}
+	return "job:key:" + utils.CreatePrefix(dtos.CustomHeaders{OrgId: job.OrgId, ProjectId: job.ProjectId})
+}
+
+// Queues a long-running operation for the job workers
+// //////////////////////////////////////////////////////
+func EnqueueJob(headers dtos.CustomHeaders, jobType string, request *dtos.SystemSecretReq, resourceId string) (dtos.Job, error) {
+	if _, err := getJobHandler(jobType); err != nil {
+		return dtos.Job{}, err
+	}
+
+	now := time.Now().UTC()
+	job := dtos.Job{
+		Id:            "job_" + uuid.NewString(),
+		Type:          jobType,
+		OrgId:         headers.OrgId,
+		ProjectId:     headers.ProjectId,
+		Headers:       headers,
+		Request:       request,
+		ResourceId:    resourceId,
+		Status:        constants.QUEUED_STATUS,
+		MaxAttempts:   JOB_MAX_ATTEMPTS,
+		Checkpoint:    map[string]string{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		NextAttemptAt: now,
+	}
+
+	if err := store.SetJSON(jobKey(job.Id), job, JOB_RETENTION); err != nil {
+		zap.L().Error("Saving Job Failed :: " + err.Error())
+		return dtos.Job{}, err
+	}
+	zap.L().Info("Job Queued :: " + job.Type + " :: " + job.Id)
+
+	return job, nil
+}
+
+// Returns a job of the headers key
+// ///////////////////////////////////
+func GetJob(headers dtos.CustomHeaders, id string) (dtos.Job, error) {
+	var job dtos.Job
+	if err := store.GetJSON(jobKey(id), &job); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.Job{}, constants.ErrJobNotFound
+		}
+		return dtos.Job{}, err
+	}
+
+	if job.OrgId != headers.OrgId || job.ProjectId != headers.ProjectId {
+		return dtos.Job{}, constants.ErrJobNotFound
+	}
+
+	if _, err := store.Default().Get(jobCancelKey(id)); err == nil && !isJobFinished(job) {
+		job.CancelRequested = true
+	}
+
+	return job, nil
+}
+
+// Cancels a job of the headers key
+// ///////////////////////////////////
+// - queued jobs are cancelled right away, running jobs stop at their next checkpoint
+func CancelJob(headers dtos.CustomHeaders, id string) (dtos.Job, error) {
+	job, err := GetJob(headers, id)
+	if err != nil {
+		return dtos.Job{}, err
+	}
+	if isJobFinished(job) {
+		return job, constants.ErrJobFinished
+	}
+
+	store.Default().Set(jobCancelKey(id), "1", JOB_RETENTION)
+
+	// A job which isn't claimed by a worker can be cancelled here
+	acquired, err := store.Default().SetNX(jobLockKey(id), "1", JOB_LOCK_TTL)
+	if err != nil {
+		return job, err
+	}
+	if !acquired {
+		job.CancelRequested = true
+		return job, nil
+	}
+	defer store.Default().Delete(jobLockKey(id))
+
+	// Reloaded, a worker may have finished it meanwhile
+	if err := store.GetJSON(jobKey(id), &job); err != nil {
+		return job, err
+	}
+	if isJobFinished(job) {
+		return job, constants.ErrJobFinished
+	}
+	finishJob(&job, constants.CANCELLED_STATUS, nil, constants.ErrJobCancelled)
+
+	return job, nil
+}
+
+// Starts the job workers
+// /////////////////////////
+// - every worker claims one job at a time, any replica can claim a job
+func StartJobWorkers(interval time.Duration, workers int) {
+	zap.L().Info(fmt.Sprintf("Starting %d Job Workers :: every %s", workers, interval.String()))
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				for ProcessNextJob() {
+				}
+			}
+		}()
+	}
+}
+
+// Claims and runs the oldest due job
+// /////////////////////////////////////
+// - running jobs whose worker died are claimed again once their lock expires
+func ProcessNextJob() bool {
+	keys, err := store.Default().Keys(jobKey(""))
+	if err != nil {
+		zap.L().Error("Listing Jobs Failed :: " + err.Error())
+		return false
+	}
+
+	now := time.Now().UTC()
+	var due []dtos.Job
+	for _, key := range keys {
+		var job dtos.Job
+		if err := store.GetJSON(key, &job); err != nil {
+			continue
+		}
+		if isJobDue(job, now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+
+	for _, listed := range due {
+		if job, claimed := claimJob(listed.Id); claimed {
+			runJob(&job)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reports the progress of the job running an operation
+// ///////////////////////////////////////////////////////
+// - operations run outside of a job are not affected
+func reportJobProgress(ctx context.Context, done int, total int, message string) {
+	run, ok := ctx.Value(jobRunKey{}).(*jobRun)
+	if !ok {
+		return
+	}
+
+	run.job.Progress = dtos.JobProgress{Done: done, Total: total, Message: message}
+	run.save()
+}
+
+// Records a value the job needs to resume its operation after a crash
+func setJobCheckpoint(ctx context.Context, key string, value string) {
+	run, ok := ctx.Value(jobRunKey{}).(*jobRun)
+	if !ok {
+		return
+	}
+
+	run.job.Checkpoint[key] = value
+	run.save()
+}
+
+// Helper function to claim a job and the lock of its system secret key
+// ///////////////////////////////////////////////////////////////////////
+// - the job is reloaded once its lock is held, another replica may have run or rescheduled it since it was listed
+func claimJob(id string) (dtos.Job, bool) {
+	acquired, err := store.Default().SetNX(jobLockKey(id), "1", JOB_LOCK_TTL)
+	if err != nil || !acquired {
+		return dtos.Job{}, false
+	}
+
+	var job dtos.Job
+	if err := store.GetJSON(jobKey(id), &job); err != nil || !isJobDue(job, time.Now().UTC()) {
+		store.Default().Delete(jobLockKey(id))
+		return dtos.Job{}, false
+	}
+
+	acquired, err = store.Default().SetNX(jobKeyLockKey(job), job.Id, JOB_LOCK_TTL)
+	if err != nil || !acquired {
+		// Jobs resumed after a crash still own the key lock
+		owner, _ := store.Default().Get(jobKeyLockKey(job))
+		if owner != job.Id {
+			store.Default().Delete(jobLockKey(job.Id))
+			return dtos.Job{}, false
+		}
+	}
+
+	// Secret writes are rejected once the key lock is held, the ones already running are waited for
+	if err := drainSecretWrites(job); err != nil {
+		zap.L().Error("Waiting For Secret Writes Failed :: " + job.Id + " :: " + err.Error())
+		store.Default().Delete(jobKeyLockKey(job))
+		store.Default().Delete(jobLockKey(job.Id))
+		return dtos.Job{}, false
+	}
+
+	return job, true
+}
+
+// Helper function to check if a job is running (interrupted by a crash) or queued and due
+func isJobDue(job dtos.Job, now time.Time) bool {
+	return job.Status == constants.RUNNING_STATUS || (job.Status == constants.QUEUED_STATUS && !now.Before(job.NextAttemptAt))
+}
+
+// Checks no job or migration of the headers key rewrites its secret groups before a secret write
+// /////////////////////////////////////////////////////////////////////////////////////////////////
+// - called while holding the group lock, jobs of the organization and of its project are checked
+func CheckSecretWritable(headers dtos.CustomHeaders) error {
+	keyHeaders := dtos.CustomHeaders{OrgId: headers.OrgId, ProjectId: headers.ProjectId}
+	for _, key := range []string{
+		jobKeyLockKey(dtos.Job{OrgId: headers.OrgId}),
+		jobKeyLockKey(dtos.Job{OrgId: headers.OrgId, ProjectId: headers.ProjectId}),
+		migrationActiveKey(dtos.Migration{OrgId: keyHeaders.OrgId, ProjectId: keyHeaders.ProjectId}),
+	} {
+		_, err := store.Default().Get(key)
+		if err == nil {
+			return constants.ErrSecretGroupBusy
+		}
+		if err != constants.ErrRecordNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Helper function to wait for the secret writes of a job's key which started before its key lock
+// ///////////////////////////////////////////////////////////////////////////////////////////////////
+func drainSecretWrites(job dtos.Job) error {
+	if job.Type == constants.INVENTORY_REBUILD_JOB {
+		return nil
+	}
+
+	prefix := utils.CreatePrefix(dtos.CustomHeaders{OrgId: job.OrgId, ProjectId: job.ProjectId})
+	deadline := time.Now().Add(JOB_WRITE_DRAIN_TIMEOUT)
+	for {
+		held, err := GroupLocksHeld(prefix)
+		if err != nil {
+			return err
+		}
+		if !held {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return constants.ErrSecretGroupBusy
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Helper function to run a claimed job, retrying failures with a backoff
+// /////////////////////////////////////////////////////////////////////////
+func runJob(job *dtos.Job) {
+	defer store.Default().Delete(jobLockKey(job.Id))
+	defer store.Default().Delete(jobKeyLockKey(*job))
+
+	handler, err := getJobHandler(job.Type)
+	if err != nil {
+		finishJob(job, constants.FAILED_STATUS, nil, err)
+		return
+	}
+	if job.Checkpoint == nil {
+		job.Checkpoint = map[string]string{}
+	}
+
+	startedAt := time.Now().UTC()
+	job.Status = constants.RUNNING_STATUS
+	job.StartedAt = &startedAt
+	job.Attempts++
+	saveJob(job)
+	zap.L().Info(fmt.Sprintf("Running Job :: %s :: %s :: attempt %d", job.Type, job.Id, job.Attempts))
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), jobRunKey{}, &jobRun{
+		job:  job,
+		save: func() { saveJob(job) },
+	}))
+	stopped := make(chan struct{})
+	go heartbeatJob(*job, cancel, stopped)
+
+	result, err := callJobHandler(ctx, handler, job)
+	close(stopped)
+	cancel()
+
+	switch {
+	case err == nil:
+		finishJob(job, constants.SUCCEEDED_STATUS, result, nil)
+
+	case isJobCancelled(job.Id):
+		finishJob(job, constants.CANCELLED_STATUS, result, err)
+
+	case job.Attempts >= job.MaxAttempts || !isRetryableJobError(err):
+		finishJob(job, constants.FAILED_STATUS, result, err)
+
+	default:
+		zap.L().Error(fmt.Sprintf("Job Failed, Retrying :: %s :: ", job.Id) + err.Error())
+		job.Status = constants.QUEUED_STATUS
+		job.Error = err.Error()
+		job.NextAttemptAt = time.Now().UTC().Add(JobBackoff(job.Attempts))
+		saveJob(job)
+	}
+}
+
+// Returns the delay before the next attempt of a job
+// /////////////////////////////////////////////////////
+func JobBackoff(attempts int) time.Duration {
+	delay := JOB_BASE_DELAY
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+	}
+
+	return delay
+}
+
+// Operations panic when a role can't be assumed, which would kill the worker
+func callJobHandler(ctx context.Context, handler jobHandler, job *dtos.Job) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked :: %v", recovered)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// Helper function to keep the locks of a running job and watch for cancellations
+// /////////////////////////////////////////////////////////////////////////////////
+func heartbeatJob(job dtos.Job, cancel context.CancelFunc, stopped chan struct{}) {
+	ticker := time.NewTicker(JOB_HEARTBEAT)
+	defer ticker.Stop()
+
+	for {
+		if isJobCancelled(job.Id) {
+			cancel()
+		}
+
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+			store.Default().Set(jobLockKey(job.Id), "1", JOB_LOCK_TTL)
+			store.Default().Set(jobKeyLockKey(job), job.Id, JOB_LOCK_TTL)
+		}
+	}
+}
+
+func finishJob(job *dtos.Job, status string, result interface{}, err error) {
+	finishedAt := time.Now().UTC()
+	job.Status = status
+	job.Result = result
+	job.FinishedAt = &finishedAt
+	job.Error = ""
+	if err != nil {
+		job.Error = err.Error()
+	}
+	job.CancelRequested = false
+	saveJob(job)
+	store.Default().Delete(jobCancelKey(job.Id))
+
+	zap.L().Info("Job Finished :: " + job.Id + " :: " + status)
+}
+
+func saveJob(job *dtos.Job) {
+	job.UpdatedAt = time.Now().UTC()
+	if err := store.SetJSON(jobKey(job.Id), job, JOB_RETENTION); err != nil {
+		zap.L().Error("Saving Job Failed :: " + job.Id + " :: " + err.Error())
+	}
+}
+
+func isJobFinished(job dtos.Job) bool {
+	return job.Status == constants.SUCCEEDED_STATUS || job.Status == constants.FAILED_STATUS || job.Status == constants.CANCELLED_STATUS
+}
+
+func isJobCancelled(id string) bool {
+	_, err := store.Default().Get(jobCancelKey(id))
+	return err == nil
+}
+
+func isRetryableJobError(err error) bool {
+	for _, permanent := range NON_RETRYABLE_JOB_ERRORS {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	return !errors.Is(err, context.Canceled)
+}
+
+// Helper function to get the operation run by a job type
+// /////////////////////////////////////////////////////////
+func getJobHandler(jobType string) (jobHandler, error) {
+	switch jobType {
+	case constants.PLAN_APPROVAL_JOB:
+		return runPlanApprovalJob, nil
+	case constants.MIGRATION_RESUME_JOB:
+		return runMigrationResumeJob, nil
+	case constants.MIGRATION_ROLLBACK_JOB:
+		return runMigrationRollbackJob, nil
+	case constants.SYSTEM_DELETION_JOB:
+		return runSystemDeletionJob, nil
+	case constants.GROUP_DELETION_JOB:
+		return runGroupDeletionJob, nil
+	case constants.INVENTORY_REBUILD_JOB:
+		return runInventoryRebuildJob, nil
+	case constants.ORG_DELETION_JOB:
+		return runOrgDeletionJob, nil
+	case constants.SECRET_ADOPTION_JOB:
+		return runSecretAdoptionJob, nil
+	}
+
+	return nil, constants.ErrInvalidJobType
+}
+
+// A migration interrupted with its job is resumed instead of starting a new one
+func runPlanApprovalJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	if migrationId := job.Checkpoint["migrationId"]; migrationId != "" {
+		return resumeMigrationPlan(ctx, job.Headers, job.ResourceId, migrationId)
+	}
+	return ApproveMigrationPlan(ctx, job.Headers, job.ResourceId)
+}
+
+func runMigrationResumeJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	return ResumeMigration(ctx, job.Headers, job.ResourceId)
+}
+
+func runMigrationRollbackJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	return RollbackMigration(job.Headers, job.ResourceId)
+}
+
+func runSystemDeletionJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	return DeleteSystemSecret(ctx, job.Headers)
+}
+
+func runGroupDeletionJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	reportJobProgress(ctx, 0, 1, strings.ToLower(job.Type))
+	group, err := DeleteSecretGroup(job.Headers, job.Headers.ARN, job.Headers.Region)
+	if err == nil {
+		reportJobProgress(ctx, 1, 1, strings.ToLower(job.Type))
+	}
+
+	return group, err
+}
+
+func runInventoryRebuildJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	return RebuildInventory(ctx)
+}
+
+func runOrgDeletionJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	return DeleteOrganization(ctx, job.Headers)
+}
+
+// The adopted secret IDs are comma separated in the resource ID, every untagged secret when it's empty
+func runSecretAdoptionJob(ctx context.Context, job *dtos.Job) (interface{}, error) {
+	var secretIds []string
+	if job.ResourceId != "" {
+		secretIds = strings.Split(job.ResourceId, ",")
+	}
+
+	return AdoptUntaggedSecrets(ctx, job.Headers, secretIds)
+}
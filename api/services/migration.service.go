@@ -0,0 +1,600 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"go.uber.org/zap"
+)
+
+// Checks if a system secret can be migrated to the requested flow
+// //////////////////////////////////////////////////////////////////
+// - SHARED -> PRIVATE, PRIVATE -> PRIVATE (another account, region or KMS key) and PRIVATE -> SHARED
+func CheckMigration(prevMetaData map[string]interface{}, requestBody dtos.SystemSecretReq) error {
+	prevFlow, _ := prevMetaData[constants.FLOW_META_DATA].(string)
+
+	switch {
+	case prevFlow == constants.SHARED_FLOW && requestBody.Flow == constants.PRIVATE_FLOW:
+		return nil
+
+	case prevFlow == constants.PRIVATE_FLOW && requestBody.Flow == constants.SHARED_FLOW:
+		return nil
+
+	case prevFlow == constants.PRIVATE_FLOW && requestBody.Flow == constants.PRIVATE_FLOW:
+		prevKmsKeyId, _ := prevMetaData[constants.KMS_KEY_META_DATA].(string)
+		if prevMetaData[constants.ARN_META_DATA] == requestBody.ARN && prevMetaData[constants.REGION_META_DATA] == requestBody.Region && prevKmsKeyId == requestBody.KmsKeyId {
+			return constants.ErrSameMigrationTarget
+		}
+		return nil
+	}
+
+	return constants.ErrInvalidMigration
+}
+
+// Values of a migrated secret, only kept in memory
+type migratedValue struct {
+	current     interface{}
+	previous    interface{}
+	hasPrevious bool
+}
+
+// Copies the secrets of a scope to the target secret manager
+// /////////////////////////////////////////////////////////////
+// - secrets which didn't exist in the target are recorded before they are written, for rollbacks
+// - secret IDs and previous versions are preserved
+func copyMigrationScope(migration *dtos.Migration, scope *dtos.MigrationScopeState, save func()) error {
+	if scope.Reencrypt {
+		return reencryptMigrationScope(migration, scope, save)
+	}
+
+	values, err := readMigrationSource(migration.OrgId, *scope)
+	if err != nil {
+		return err
+	}
+	scope.SecretIds = getMigratedIds(values)
+
+	targetSvc, err := getMigrationSecretManager(migration.OrgId, scope.Target)
+	if err != nil {
+		return err
+	}
+	secretDescription := fmt.Sprintf("Organization ID: %s", migration.OrgId)
+
+	// SHARED -> PRIVATE and PRIVATE -> PRIVATE
+	if scope.Target.Flow == constants.PRIVATE_FLOW {
+		for _, id := range scope.SecretIds {
+			if !utils.ArrayContains(scope.CreatedIds, id) {
+				exists, err := privateSecretExists(targetSvc, id)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					scope.CreatedIds = append(scope.CreatedIds, id)
+					save()
+				}
+			}
+
+			value := values[id]
+			if err := putPrivateSecret(targetSvc, scope.SecretName, secretDescription, scope.Target.KmsKeyId, id, value.current, value.previous, value.hasPrevious); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// PRIVATE -> SHARED, existing secrets of the group are kept
+	if !scope.CreatedGroup && len(scope.CreatedIds) == 0 {
+		existingData, exists, err := getSharedGroupData(targetSvc, scope.SecretName)
+		if err != nil {
+			return err
+		}
+		scope.CreatedGroup = !exists
+		for _, id := range scope.SecretIds {
+			if _, found := existingData[id]; exists && !found {
+				scope.CreatedIds = append(scope.CreatedIds, id)
+			}
+		}
+		save()
+	}
+
+	secretData := map[string]interface{}{}
+	previousValues := map[string]interface{}{}
+	for id, value := range values {
+		if secretData[id], err = sealSharedValue(migration.OrgId, migration.ProjectId, scope.SecretName, id, value.current); err != nil {
+			return err
+		}
+		if value.hasPrevious {
+			if previousValues[id], err = sealSharedValue(migration.OrgId, migration.ProjectId, scope.SecretName, id, value.previous); err != nil {
+				return err
+			}
+		}
+	}
+	if len(previousValues) > 0 {
+		secretData[constants.PREVIOUS_VALUES_KEY] = previousValues
+	}
+
+	return putSharedSecretGroup(targetSvc, scope.SecretName, secretDescription, secretData)
+}
+
+// Checks the migrated secrets of a scope match their source
+// ////////////////////////////////////////////////////////////
+func verifyMigrationScope(orgId string, scope *dtos.MigrationScopeState) error {
+	if scope.Reencrypt {
+		return verifyReencryptedScope(orgId, scope)
+	}
+
+	values, err := readMigrationSource(orgId, *scope)
+	if err != nil {
+		return err
+	}
+	targetSvc, err := getMigrationSecretManager(orgId, scope.Target)
+	if err != nil {
+		return err
+	}
+
+	// Secrets added to the source while copying would be deleted without a copy
+	if strings.Join(getMigratedIds(values), ",") != strings.Join(scope.SecretIds, ",") {
+		return fmt.Errorf("%w :: %s :: source secrets changed", constants.ErrMigrationVerificationFailed, scope.SecretName)
+	}
+
+	var targetValues map[string]migratedValue
+	if scope.Target.Flow == constants.PRIVATE_FLOW {
+		targetValues = map[string]migratedValue{}
+		for _, id := range scope.SecretIds {
+			current, previous, hasPrevious, err := getPrivateSecretValues(targetSvc, id)
+			if err != nil {
+				return err
+			}
+			targetValues[id] = migratedValue{current: current, previous: previous, hasPrevious: hasPrevious}
+		}
+	} else {
+		secretData, _, err := getSharedGroupData(targetSvc, scope.SecretName)
+		if err != nil {
+			return err
+		}
+		targetValues = getSharedGroupValues(secretData)
+		if err := openSharedGroupValues(scope.SecretName, targetValues); err != nil {
+			return err
+		}
+	}
+
+	for id, value := range values {
+		target, found := targetValues[id]
+		if !found || !sameSecretValue(value.current, target.current) || (value.hasPrevious && !sameSecretValue(value.previous, target.previous)) {
+			return fmt.Errorf("%w :: %s", constants.ErrMigrationVerificationFailed, id)
+		}
+	}
+
+	return nil
+}
+
+// Deletes the migrated secrets of a scope from the source secret manager
+// /////////////////////////////////////////////////////////////////////////
+func deleteMigrationSource(orgId string, scope *dtos.MigrationScopeState) error {
+	// Re-encrypted secrets are their own source
+	if scope.Reencrypt {
+		return nil
+	}
+
+	sourceSvc, err := getMigrationSecretManager(orgId, scope.Source)
+	if err != nil {
+		return err
+	}
+
+	// SHARED secrets of a scope are stored in a single secret group
+	if scope.Source.Flow == constants.SHARED_FLOW {
+		return deletePrivateSecrets(sourceSvc, []string{scope.SecretName})
+	}
+
+	return deletePrivateSecrets(sourceSvc, scope.SecretIds)
+}
+
+// Removes the secrets a migration created in the target secret manager
+// ///////////////////////////////////////////////////////////////////////
+// - secrets which existed before the migration are kept with their migrated values
+func rollbackMigrationTarget(orgId string, scope *dtos.MigrationScopeState) error {
+	if !scope.CreatedGroup && len(scope.CreatedIds) == 0 {
+		return nil
+	}
+
+	targetSvc, err := getMigrationSecretManager(orgId, scope.Target)
+	if err != nil {
+		return err
+	}
+
+	if scope.Target.Flow == constants.PRIVATE_FLOW {
+		return deletePrivateSecrets(targetSvc, scope.CreatedIds)
+	}
+
+	if scope.CreatedGroup {
+		return deletePrivateSecrets(targetSvc, []string{scope.SecretName})
+	}
+
+	secretData, exists, err := getSharedGroupData(targetSvc, scope.SecretName)
+	if err != nil || !exists {
+		return err
+	}
+	previousValues, _ := secretData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{})
+	for _, id := range scope.CreatedIds {
+		delete(secretData, id)
+		delete(previousValues, id)
+	}
+
+	secretString, err := utils.StringifyJson(secretData)
+	if err != nil {
+		return err
+	}
+	_, err = targetSvc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(scope.SecretName),
+		SecretString: aws.String(secretString),
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("PutSecretValue Failed :: %s :: ", scope.SecretName) + err.Error())
+	}
+
+	return err
+}
+
+// Helper function to read the secrets of a scope from its source secret manager
+// ////////////////////////////////////////////////////////////////////////////////
+func readMigrationSource(orgId string, scope dtos.MigrationScopeState) (map[string]migratedValue, error) {
+	sourceSvc, err := getMigrationSecretManager(orgId, scope.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	if scope.Source.Flow == constants.SHARED_FLOW {
+		secretData, _, err := getSharedGroupData(sourceSvc, scope.SecretName)
+		if err != nil {
+			return nil, err
+		}
+		values := getSharedGroupValues(secretData)
+		if err := openSharedGroupValues(scope.SecretName, values); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+
+	ids, err := listPrivateGroupSecrets(sourceSvc, scope.SecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]migratedValue{}
+	for _, id := range ids {
+		current, previous, hasPrevious, err := getPrivateSecretValues(sourceSvc, id)
+		if err != nil {
+			return nil, err
+		}
+		values[id] = migratedValue{current: current, previous: previous, hasPrevious: hasPrevious}
+	}
+
+	return values, nil
+}
+
+// Previous values of a secret group are kept under the reserved previous values key
+func getSharedGroupValues(secretData map[string]interface{}) map[string]migratedValue {
+	previousValues, _ := secretData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{})
+
+	values := map[string]migratedValue{}
+	for id, current := range secretData {
+		if id == constants.PREVIOUS_VALUES_KEY {
+			continue
+		}
+		previous, hasPrevious := previousValues[id]
+		values[id] = migratedValue{current: current, previous: previous, hasPrevious: hasPrevious}
+	}
+
+	return values
+}
+
+func getMigratedIds(values map[string]migratedValue) []string {
+	ids := []string{}
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func sameSecretValue(value interface{}, other interface{}) bool {
+	valueString, _ := utils.StringifyJson(value)
+	otherString, _ := utils.StringifyJson(other)
+
+	return valueString == otherString
+}
+
+func privateSecretExists(svc *secretsmanager.Client, id string) (bool, error) {
+	_, err := svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(id)})
+	if err == nil {
+		return true, nil
+	}
+	if strings.Contains(err.Error(), "ResourceNotFoundException") {
+		return false, nil
+	}
+
+	zap.L().Error(fmt.Sprintf("DescribeSecret Failed :: %s :: ", id) + err.Error())
+	return false, err
+}
+
+// Helper function to get a secret manager of a migration without panicking on AssumeRole
+// /////////////////////////////////////////////////////////////////////////////////////////
+func getMigrationSecretManager(orgId string, target dtos.MigrationTarget) (*secretsmanager.Client, error) {
+	defaultConfig, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(target.Region))
+	assumedConfig, err := assumeRoleConfig(defaultConfig, orgId, target.ARN, target.Region)
+	if err != nil {
+		zap.L().Error("AssumeRole Failed :: " + target.ARN + " :: " + err.Error())
+		return nil, err
+	}
+
+	return secretsmanager.NewFromConfig(assumedConfig), nil
+}
+
+// Helper function to list the PRIVATE secrets of a secret group
+// ////////////////////////////////////////////////////////////////
+func listPrivateGroupSecrets(svc *secretsmanager.Client, secretName string) ([]string, error) {
+	var ids []string
+	entries, err := listPrivateSecrets(svc, []types.Filter{
+		{Key: types.FilterNameStringTypeTagKey, Values: []string{constants.SECRET_GROUP_TAG}},
+		{Key: types.FilterNameStringTypeTagValue, Values: []string{secretName}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Tag value filters match prefixes, other groups may start with the same name
+	for _, entry := range entries {
+		if getSecretGroup(entry) == secretName {
+			ids = append(ids, aws.ToString(entry.Name))
+		}
+	}
+
+	return ids, nil
+}
+
+// Helper function to find PRIVATE secrets of an organization without a group tag
+// //////////////////////////////////////////////////////////////////////////////////
+// - these were created before secrets were tagged and can't be matched to a group
+func findUntaggedPrivateSecrets(svc *secretsmanager.Client, orgId string) ([]string, error) {
+	secretDescription := fmt.Sprintf("Organization ID: %s", orgId)
+
+	var ids []string
+	entries, err := listPrivateSecrets(svc, []types.Filter{
+		{Key: types.FilterNameStringTypeDescription, Values: []string{secretDescription}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if aws.ToString(entry.Description) == secretDescription && getSecretGroup(entry) == "" {
+			ids = append(ids, aws.ToString(entry.Name))
+		}
+	}
+
+	return ids, nil
+}
+
+func listPrivateSecrets(svc *secretsmanager.Client, filters []types.Filter) ([]types.SecretListEntry, error) {
+	var entries []types.SecretListEntry
+	paginator := secretsmanager.NewListSecretsPaginator(svc, &secretsmanager.ListSecretsInput{Filters: filters})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			zap.L().Error("ListSecrets Failed :: " + err.Error())
+			return nil, err
+		}
+		entries = append(entries, page.SecretList...)
+	}
+
+	return entries, nil
+}
+
+func getSecretGroup(entry types.SecretListEntry) string {
+	for _, tag := range entry.Tags {
+		if aws.ToString(tag.Key) == constants.SECRET_GROUP_TAG {
+			return aws.ToString(tag.Value)
+		}
+	}
+
+	return ""
+}
+
+// Helper function to read the current and previous values of a PRIVATE secret
+// //////////////////////////////////////////////////////////////////////////////
+func getPrivateSecretValues(svc *secretsmanager.Client, id string) (interface{}, interface{}, bool, error) {
+	currentOutput, err := svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Failed to GetSecretValue :: %s :: ", id) + err.Error())
+		return nil, nil, false, err
+	}
+
+	previousOutput, err := svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(id),
+		VersionStage: aws.String(constants.PREVIOUS_STAGE),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return decodePrivateSecretValue(currentOutput.SecretString), nil, false, nil
+		}
+		zap.L().Error(fmt.Sprintf("Failed to GetSecretValue :: %s :: %s :: ", id, constants.PREVIOUS_STAGE) + err.Error())
+		return nil, nil, false, err
+	}
+
+	return decodePrivateSecretValue(currentOutput.SecretString), decodePrivateSecretValue(previousOutput.SecretString), true, nil
+}
+
+// PRIVATE values are stored JSON encoded, raw values are kept as they are
+func decodePrivateSecretValue(secretString *string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(aws.ToString(secretString)), &value); err != nil {
+		return aws.ToString(secretString)
+	}
+
+	return value
+}
+
+// Helper function to write a PRIVATE secret keeping its ID and previous value
+// //////////////////////////////////////////////////////////////////////////////
+// - existing secrets (from an interrupted migration) are overwritten and moved to the KMS key
+func putPrivateSecret(svc *secretsmanager.Client, secretName string, secretDescription string, kmsKeyId string, id string, current interface{}, previous interface{}, hasPrevious bool) error {
+	initialValue := current
+	if hasPrevious {
+		initialValue = previous
+	}
+
+	valueStringyfied, _ := utils.StringifyJson(initialValue)
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(id),
+		Description:  aws.String(secretDescription),
+		SecretString: aws.String(valueStringyfied),
+		Tags:         getSecretGroupTags(secretName),
+	}
+	if kmsKeyId != "" {
+		input.KmsKeyId = aws.String(kmsKeyId)
+	}
+	_, err := svc.CreateSecret(context.TODO(), input)
+	if err != nil && strings.Contains(err.Error(), "ResourceExistsException") {
+		err = updatePrivateSecretKmsKey(svc, id, kmsKeyId)
+		if err == nil {
+			_, err = svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+				SecretId:     aws.String(id),
+				SecretString: aws.String(valueStringyfied),
+			})
+		}
+		if err == nil {
+			_, err = svc.TagResource(context.TODO(), &secretsmanager.TagResourceInput{
+				SecretId: aws.String(id),
+				Tags:     getSecretGroupTags(secretName),
+			})
+		}
+	}
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("CreateSecret Failed :: %s :: ", id) + err.Error())
+		return err
+	}
+
+	if hasPrevious {
+		valueStringyfied, _ = utils.StringifyJson(current)
+		_, err = svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+			SecretId:     aws.String(id),
+			SecretString: aws.String(valueStringyfied),
+		})
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("PutSecretValue Failed :: %s :: ", id) + err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Helper function to write a SHARED secret group, merging into an existing group
+// /////////////////////////////////////////////////////////////////////////////////
+func putSharedSecretGroup(svc *secretsmanager.Client, secretName string, secretDescription string, secretData map[string]interface{}) error {
+	input := getSecretInput(secretName, "")
+	getSecretValueResponse, err := svc.GetSecretValue(context.TODO(), &input)
+	if err != nil && !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		zap.L().Error(fmt.Sprintf("Failed to GetSecretValue :: %s :: ", secretName) + err.Error())
+		return err
+	}
+	exists := err == nil
+
+	if exists {
+		var existingData map[string]interface{}
+		if err := json.Unmarshal([]byte(aws.ToString(getSecretValueResponse.SecretString)), &existingData); err != nil {
+			zap.L().Error("Unmarshalling json Failed :: " + err.Error())
+			return err
+		}
+		secretData = mergeSecretGroups(existingData, secretData)
+	}
+
+	secretString, err := utils.StringifyJson(secretData)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		_, err = svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+			SecretId:     aws.String(secretName),
+			SecretString: aws.String(secretString),
+		})
+	} else {
+		_, err = svc.CreateSecret(context.TODO(), &secretsmanager.CreateSecretInput{
+			Name:         aws.String(secretName),
+			Description:  aws.String(secretDescription),
+			SecretString: aws.String(secretString),
+		})
+	}
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Writing Secret Group Failed :: %s :: ", secretName) + err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Helper function to merge migrated secrets and previous values into a secret group
+// ////////////////////////////////////////////////////////////////////////////////////
+func mergeSecretGroups(existingData map[string]interface{}, secretData map[string]interface{}) map[string]interface{} {
+	for key, value := range secretData {
+		if key != constants.PREVIOUS_VALUES_KEY {
+			existingData[key] = value
+		}
+	}
+
+	migratedPrevious, ok := secretData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{})
+	if !ok {
+		return existingData
+	}
+
+	previousValues, ok := existingData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{})
+	if !ok {
+		previousValues = map[string]interface{}{}
+	}
+	for key, value := range migratedPrevious {
+		previousValues[key] = value
+	}
+	existingData[constants.PREVIOUS_VALUES_KEY] = previousValues
+
+	return existingData
+}
+
+// Helper function to delete migrated PRIVATE secrets from their previous account
+// /////////////////////////////////////////////////////////////////////////////////
+func deletePrivateSecrets(svc *secretsmanager.Client, ids []string) error {
+	deleteAsap := true
+
+	for _, id := range ids {
+		zap.L().Info("Deleting Previous Account Secret :: " + id)
+		_, err := svc.DeleteSecret(context.TODO(), &secretsmanager.DeleteSecretInput{
+			SecretId:                   aws.String(id),
+			ForceDeleteWithoutRecovery: &deleteAsap,
+		})
+		if err != nil && !strings.Contains(err.Error(), "ResourceNotFoundException") {
+			zap.L().Error(fmt.Sprintf("DeleteSecret failed :: %s :: ", id) + err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Tags PRIVATE secrets with their secret group so they can be migrated
+func getSecretGroupTags(secretName string) []types.Tag {
+	return []types.Tag{{Key: aws.String(constants.SECRET_GROUP_TAG), Value: aws.String(secretName)}}
+}
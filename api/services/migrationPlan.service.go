@@ -0,0 +1,582 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var MIGRATION_PLAN_TTL = time.Hour
+var MIGRATION_PLAN_RETENTION = 7 * 24 * time.Hour
+var MIGRATION_PLAN_LOCK_TTL = time.Hour
+
+// Permissions needed on the secret manager secrets are migrated from
+var MIGRATION_SOURCE_PERMISSIONS = []string{
+	"secretsmanager:GetSecretValue",
+	"secretsmanager:DescribeSecret",
+	"secretsmanager:ListSecrets",
+	"secretsmanager:DeleteSecret",
+}
+
+// ListSecrets returns at most 100 secrets per page
+var LIST_SECRETS_PAGE_SIZE = 100
+
+func migrationPlanKey(id string) string {
+	return "migration:plan:" + id
+}
+
+func migrationPlanLockKey(id string) string {
+	return "migration:plan-lock:" + id
+}
+
+// Creates a migration plan for PUT /system without writing anything
+// ////////////////////////////////////////////////////////////////////
+// - reports the secret IDs, collisions and AWS API calls of every scope
+// - checks AssumeRole and the permissions of every secret manager involved
+func CreateMigrationPlan(headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) (dtos.MigrationPlan, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+	secretNames, scopeRequests, err := getScopeRequests(headers, requestBody)
+	if err != nil {
+		return dtos.MigrationPlan{}, err
+	}
+	now := time.Now().UTC()
+	zap.L().Info("Planning Migration of System Secrets :: " + strings.Join(secretNames, ","))
+
+	plan := dtos.MigrationPlan{
+		Id:        "plan_" + uuid.NewString(),
+		OrgId:     headers.OrgId,
+		ProjectId: headers.ProjectId,
+		Scope:     headers.Scope,
+		Request:   requestBody,
+		Scopes:    []dtos.MigrationScopePlan{},
+		Access:    []dtos.AccessCheck{},
+		Status:    constants.PLANNED_STATUS,
+		CreatedAt: now,
+		ExpiresAt: now.Add(MIGRATION_PLAN_TTL),
+	}
+
+	var sources, targets, reencryptTargets []dtos.MigrationTarget
+	for _, secretName := range secretNames {
+		existingData, err := getSystemSecretData(svc, secretName)
+		if err != nil {
+			if strings.Contains(err.Error(), "ResourceNotFoundException") {
+				continue
+			}
+			return dtos.MigrationPlan{}, err
+		}
+
+		target := getMigrationTarget(scopeRequests[secretName])
+		scope := planMigrationScope(headers, secretName, existingData, scopeRequests[secretName], target)
+		if scope.Error != "" {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("%s :: %s", secretName, scope.Error))
+		}
+		for _, collision := range scope.Collisions {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s :: %s already exists in the target and will be overwritten", secretName, collision))
+		}
+		for _, calls := range scope.ApiCalls {
+			plan.ApiCalls += calls
+		}
+		if scope.Source.Flow == constants.PRIVATE_FLOW && !containsMigrationTarget(sources, scope.Source) {
+			sources = append(sources, scope.Source)
+		}
+		if scope.Reencrypt && !containsMigrationTarget(reencryptTargets, target) {
+			reencryptTargets = append(reencryptTargets, target)
+		} else if !scope.Reencrypt && !containsMigrationTarget(targets, target) {
+			targets = append(targets, target)
+		}
+		plan.Scopes = append(plan.Scopes, scope)
+	}
+
+	if len(plan.Scopes) == 0 {
+		return dtos.MigrationPlan{}, constants.ErrUnregisteredKey
+	}
+
+	// Scopes sharing a secret manager are only checked once
+	for _, target := range targets {
+		if target.Flow == constants.PRIVATE_FLOW {
+			plan.Access = append(plan.Access, checkMigrationAccess(&plan, "target", target, PRIVATE_FLOW_PERMISSIONS))
+		} else {
+			plan.Access = append(plan.Access, checkMigrationAccess(&plan, "target", target, SHARED_FLOW_PERMISSIONS))
+		}
+	}
+	for _, target := range reencryptTargets {
+		plan.Access = append(plan.Access, checkMigrationAccess(&plan, "target", target, REENCRYPTION_PERMISSIONS))
+	}
+	for _, source := range sources {
+		plan.Access = append(plan.Access, checkMigrationAccess(&plan, "source", source, MIGRATION_SOURCE_PERMISSIONS))
+	}
+
+	plan.Approvable = len(plan.Errors) == 0
+	if err := store.SetJSON(migrationPlanKey(plan.Id), plan, MIGRATION_PLAN_RETENTION); err != nil {
+		zap.L().Error("Saving Migration Plan Failed :: " + err.Error())
+		return dtos.MigrationPlan{}, err
+	}
+
+	return plan, nil
+}
+
+// Returns a migration plan of the headers key
+// ///////////////////////////////////////////////
+func GetMigrationPlan(headers dtos.CustomHeaders, id string) (dtos.MigrationPlan, error) {
+	var plan dtos.MigrationPlan
+	if err := store.GetJSON(migrationPlanKey(id), &plan); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.MigrationPlan{}, constants.ErrMigrationPlanNotFound
+		}
+		return dtos.MigrationPlan{}, err
+	}
+
+	if plan.OrgId != headers.OrgId || plan.ProjectId != headers.ProjectId {
+		return dtos.MigrationPlan{}, constants.ErrMigrationPlanNotFound
+	}
+
+	return plan, nil
+}
+
+// Checks a migration plan can be approved before its approval is queued
+// /////////////////////////////////////////////////////////////////////////
+func CheckMigrationPlanApproval(headers dtos.CustomHeaders, id string) error {
+	plan, err := GetMigrationPlan(headers, id)
+	if err != nil {
+		return err
+	}
+
+	return checkMigrationPlanApproval(plan, time.Now().UTC())
+}
+
+// Approves a migration plan and runs the planned migration
+// ///////////////////////////////////////////////////////////
+// - a plan is only executed once, and only if the system secrets didn't change since
+func ApproveMigrationPlan(ctx context.Context, headers dtos.CustomHeaders, id string) (dtos.MigrationPlan, error) {
+	plan, err := GetMigrationPlan(headers, id)
+	if err != nil {
+		return dtos.MigrationPlan{}, err
+	}
+
+	if err := checkMigrationPlanApproval(plan, time.Now().UTC()); err != nil {
+		return plan, err
+	}
+
+	// Only one request (and replica) can execute a plan
+	acquired, err := store.Default().SetNX(migrationPlanLockKey(id), "1", MIGRATION_PLAN_LOCK_TTL)
+	if err != nil {
+		return plan, err
+	}
+	if !acquired {
+		return plan, constants.ErrMigrationPlanUsed
+	}
+
+	if err := checkMigrationPlanSources(plan); err != nil {
+		store.Default().Delete(migrationPlanLockKey(id))
+		return plan, err
+	}
+
+	approvedAt := time.Now().UTC()
+	plan.ApprovedAt = &approvedAt
+	plan.Status = constants.RUNNING_STATUS
+	if err := store.SetJSON(migrationPlanKey(id), plan, MIGRATION_PLAN_RETENTION); err != nil {
+		store.Default().Delete(migrationPlanLockKey(id))
+		return plan, err
+	}
+
+	// The plan only covers the scope it was created for
+	headers.Scope = plan.Scope
+
+	zap.L().Info("Executing Migration Plan :: " + id)
+	migration, err := MigrateSystemSecrets(ctx, headers, plan.Request)
+	saveMigrationPlanOutcome(&plan, migration, err)
+
+	return plan, err
+}
+
+// Resumes the migration of an approved plan interrupted with its job
+// /////////////////////////////////////////////////////////////////////
+// - the plan was already executed once, a retried approval job only resumes its migration
+func resumeMigrationPlan(ctx context.Context, headers dtos.CustomHeaders, id string, migrationId string) (dtos.MigrationPlan, error) {
+	plan, err := GetMigrationPlan(headers, id)
+	if err != nil {
+		return dtos.MigrationPlan{}, err
+	}
+
+	migration, err := GetMigration(headers, migrationId)
+	if err != nil {
+		return plan, err
+	}
+
+	switch migration.Status {
+	case constants.RUNNING_STATUS, constants.FAILED_STATUS:
+		migration, err = ResumeMigration(ctx, headers, migrationId)
+	case constants.COMPLETED_STATUS:
+	default:
+		return plan, constants.ErrMigrationFinished
+	}
+
+	saveMigrationPlanOutcome(&plan, migration, err)
+	return plan, err
+}
+
+// Helper function to record the outcome of the migration of a plan
+func saveMigrationPlanOutcome(plan *dtos.MigrationPlan, migration dtos.Migration, err error) {
+	plan.MigrationId = migration.Id
+	if err != nil {
+		plan.Status = constants.FAILED_STATUS
+		plan.FailureReason = err.Error()
+	} else {
+		plan.Status = constants.EXECUTED_STATUS
+		plan.FailureReason = ""
+		plan.MigratedIds = migration.SecretIds
+	}
+
+	if err := store.SetJSON(migrationPlanKey(plan.Id), plan, MIGRATION_PLAN_RETENTION); err != nil {
+		zap.L().Error("Saving Migration Plan Failed :: " + plan.Id + " :: " + err.Error())
+	}
+}
+
+// Estimates the AWS API calls of migrating a scope
+// ///////////////////////////////////////////////////
+// - mirrors the calls made by the migration functions, including the system secret update
+func EstimateMigrationApiCalls(fromFlow string, toFlow string, secretCount int, previousCount int) map[string]int {
+	listPages := secretCount/LIST_SECRETS_PAGE_SIZE + 1
+	calls := map[string]int{
+		"AssumeRole":     3,
+		"GetSecretValue": 1,
+		"UpdateSecret":   1,
+	}
+
+	switch {
+	// SHARED -> PRIVATE Migration
+	case fromFlow == constants.SHARED_FLOW:
+		calls["GetSecretValue"] += 1
+		calls["CreateSecret"] = secretCount
+		calls["PutSecretValue"] = previousCount
+		calls["DeleteSecret"] = 1
+
+	// PRIVATE -> PRIVATE Migration
+	case toFlow == constants.PRIVATE_FLOW:
+		calls["ListSecrets"] = 2 * listPages
+		calls["GetSecretValue"] += 2 * secretCount
+		calls["CreateSecret"] = secretCount
+		calls["PutSecretValue"] = previousCount
+		calls["DeleteSecret"] = secretCount
+
+	// PRIVATE -> SHARED Migration
+	default:
+		calls["ListSecrets"] = 2 * listPages
+		calls["GetSecretValue"] += 2*secretCount + 1
+		calls["PutSecretValue"] = 1
+		calls["DeleteSecret"] = secretCount
+	}
+
+	return calls
+}
+
+// Estimates the AWS API calls of re-encrypting a PRIVATE scope with another KMS key
+// /////////////////////////////////////////////////////////////////////////////////////
+// - previous values are rewritten too, their staging labels are moved back afterwards
+func EstimateReencryptionApiCalls(secretCount int, previousCount int) map[string]int {
+	listPages := secretCount/LIST_SECRETS_PAGE_SIZE + 1
+
+	return map[string]int{
+		"AssumeRole":               2,
+		"ListSecrets":              2 * listPages,
+		"DescribeSecret":           2*secretCount + previousCount,
+		"GetSecretValue":           1 + secretCount + previousCount,
+		"UpdateSecret":             1 + secretCount,
+		"PutSecretValue":           secretCount + previousCount,
+		"UpdateSecretVersionStage": 2 * previousCount,
+	}
+}
+
+// Helper function to check if a plan can still be approved
+// ///////////////////////////////////////////////////////////
+func checkMigrationPlanApproval(plan dtos.MigrationPlan, now time.Time) error {
+	switch {
+	case plan.Status != constants.PLANNED_STATUS:
+		return constants.ErrMigrationPlanUsed
+
+	case now.After(plan.ExpiresAt):
+		return constants.ErrMigrationPlanExpired
+
+	case !plan.Approvable:
+		return constants.ErrMigrationPlanNotApprovable
+	}
+
+	return nil
+}
+
+// Helper function to check the system secrets still point to the planned sources
+// /////////////////////////////////////////////////////////////////////////////////
+func checkMigrationPlanSources(plan dtos.MigrationPlan) error {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	for _, scope := range plan.Scopes {
+		existingData, err := getSystemSecretData(svc, scope.SecretName)
+		if err != nil {
+			return err
+		}
+
+		if getMigrationSource(existingData) != scope.Source {
+			zap.L().Error(scope.SecretName + " :: " + constants.ErrMigrationPlanStale.Error())
+			return constants.ErrMigrationPlanStale
+		}
+	}
+
+	return nil
+}
+
+// Helper function to plan the migration of a single system secret
+// //////////////////////////////////////////////////////////////////
+func planMigrationScope(headers dtos.CustomHeaders, secretName string, existingData map[string]interface{}, requestBody dtos.SystemSecretReq, target dtos.MigrationTarget) dtos.MigrationScopePlan {
+	scope := dtos.MigrationScopePlan{
+		SecretName: secretName,
+		Source:     getMigrationSource(existingData),
+		Target:     target,
+		SecretIds:  []string{},
+		ApiCalls:   map[string]int{},
+	}
+
+	if err := CheckMigration(existingData, requestBody); err != nil {
+		scope.Error = err.Error()
+		return scope
+	}
+
+	sourceSvc, err := getMigrationSecretManager(headers.OrgId, scope.Source)
+	if err != nil {
+		scope.Error = "AssumeRole into the source failed :: " + err.Error()
+		return scope
+	}
+
+	if scope.Source.Flow == constants.SHARED_FLOW {
+		scope.SecretIds, scope.PreviousValues, err = listSharedGroupSecrets(sourceSvc, secretName)
+	} else {
+		scope.SecretIds, scope.PreviousValues, err = listPrivateGroupPlan(sourceSvc, secretName, headers.OrgId)
+	}
+	if err != nil {
+		scope.Error = err.Error()
+		return scope
+	}
+	sort.Strings(scope.SecretIds)
+
+	// Re-encrypted secrets are rewritten in place, they can't collide
+	if isReencryption(scope.Source, target) {
+		scope.Reencrypt = true
+		scope.ApiCalls = EstimateReencryptionApiCalls(len(scope.SecretIds), scope.PreviousValues)
+		return scope
+	}
+
+	// A target which can't be assumed is reported by the access checks
+	if targetSvc, err := getMigrationSecretManager(headers.OrgId, target); err == nil {
+		scope.Collisions, err = findMigrationCollisions(targetSvc, target.Flow, secretName, scope.SecretIds)
+		if err != nil {
+			scope.Error = err.Error()
+		}
+	}
+
+	scope.ApiCalls = EstimateMigrationApiCalls(scope.Source.Flow, target.Flow, len(scope.SecretIds), scope.PreviousValues)
+	return scope
+}
+
+// Helper function to list the secret IDs of a SHARED secret group
+// //////////////////////////////////////////////////////////////////
+// - a missing group has no secrets to migrate
+func listSharedGroupSecrets(svc *secretsmanager.Client, secretName string) ([]string, int, error) {
+	secretData, exists, err := getSharedGroupData(svc, secretName)
+	if err != nil || !exists {
+		return []string{}, 0, err
+	}
+
+	previousValues, _ := secretData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{})
+	delete(secretData, constants.PREVIOUS_VALUES_KEY)
+
+	ids := []string{}
+	previousCount := 0
+	for id := range secretData {
+		ids = append(ids, id)
+		if _, hasPrevious := previousValues[id]; hasPrevious {
+			previousCount++
+		}
+	}
+
+	return ids, previousCount, nil
+}
+
+// Helper function to list the secret IDs of a PRIVATE secret group
+// ///////////////////////////////////////////////////////////////////
+// - untagged secrets of the organization block the migration
+func listPrivateGroupPlan(svc *secretsmanager.Client, secretName string, orgId string) ([]string, int, error) {
+	untaggedIds, err := findUntaggedPrivateSecrets(svc, orgId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(untaggedIds) > 0 {
+		return nil, 0, fmt.Errorf("%s :: %s", constants.ErrUntaggedPrivateSecrets.Error(), strings.Join(untaggedIds, ","))
+	}
+
+	ids, err := listPrivateGroupSecrets(svc, secretName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	previousCount := 0
+	for _, id := range ids {
+		output, err := svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(id)})
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("DescribeSecret Failed :: %s :: ", id) + err.Error())
+			return nil, 0, err
+		}
+
+		for _, stages := range output.VersionIdsToStages {
+			if containsStage(stages, constants.PREVIOUS_STAGE) {
+				previousCount++
+				break
+			}
+		}
+	}
+
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, previousCount, nil
+}
+
+// Helper function to find the secret IDs which already exist in the target
+// ///////////////////////////////////////////////////////////////////////////
+func findMigrationCollisions(svc *secretsmanager.Client, targetFlow string, secretName string, ids []string) ([]string, error) {
+	var collisions []string
+
+	if targetFlow == constants.SHARED_FLOW {
+		secretData, _, err := getSharedGroupData(svc, secretName)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if _, exists := secretData[id]; exists {
+				collisions = append(collisions, id)
+			}
+		}
+
+		return collisions, nil
+	}
+
+	for _, id := range ids {
+		_, err := svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(id)})
+		if err == nil {
+			collisions = append(collisions, id)
+			continue
+		}
+		if !strings.Contains(err.Error(), "ResourceNotFoundException") {
+			zap.L().Error(fmt.Sprintf("DescribeSecret Failed :: %s :: ", id) + err.Error())
+			return nil, err
+		}
+	}
+
+	return collisions, nil
+}
+
+// Helper function to read a SHARED secret group, reporting if it exists
+func getSharedGroupData(svc *secretsmanager.Client, secretName string) (map[string]interface{}, bool, error) {
+	output, err := svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretName)})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return map[string]interface{}{}, false, nil
+		}
+		zap.L().Error(fmt.Sprintf("GetSecretValue Failed :: %s :: ", secretName) + err.Error())
+		return nil, false, err
+	}
+
+	var secretData map[string]interface{}
+	if err := json.Unmarshal([]byte(aws.ToString(output.SecretString)), &secretData); err != nil {
+		zap.L().Error("json unmarshalling failed :: " + err.Error())
+		return nil, false, err
+	}
+
+	return secretData, true, nil
+}
+
+// Helper function to check a secret manager of the plan, recording errors and warnings
+// ///////////////////////////////////////////////////////////////////////////////////////
+func checkMigrationAccess(plan *dtos.MigrationPlan, role string, target dtos.MigrationTarget, actions []string) dtos.AccessCheck {
+	check := CheckSecretManagerAccess(plan.OrgId, target.ARN, target.Region, actions)
+	name := fmt.Sprintf("%s %s (%s)", role, target.ARN, target.Region)
+
+	if !check.AssumeRole {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("%s :: AssumeRole failed :: %s", name, check.Error))
+		return check
+	}
+
+	if denied := GetDeniedPermissions(check); len(denied) > 0 {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("%s :: missing permissions :: %s", name, strings.Join(denied, ",")))
+	}
+	for _, permission := range check.Permissions {
+		if permission.Status == constants.PERMISSION_UNVERIFIED {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s :: %s could not be verified", name, permission.Action))
+		}
+	}
+
+	return check
+}
+
+func getMigrationSource(existingData map[string]interface{}) dtos.MigrationTarget {
+	flow, _ := existingData[constants.FLOW_META_DATA].(string)
+	arn, _ := existingData[constants.ARN_META_DATA].(string)
+	region, _ := existingData[constants.REGION_META_DATA].(string)
+	kmsKeyId, _ := existingData[constants.KMS_KEY_META_DATA].(string)
+
+	return dtos.MigrationTarget{Flow: flow, ARN: arn, Region: region, KmsKeyId: kmsKeyId}
+}
+
+// SHARED targets always use the secret manager of the service
+func getMigrationTarget(requestBody dtos.SystemSecretReq) dtos.MigrationTarget {
+	if requestBody.Flow == constants.SHARED_FLOW {
+		return dtos.MigrationTarget{
+			Flow:   constants.SHARED_FLOW,
+			ARN:    utils.GetEnvVar("SHARED_SECRET_MNGR_ARN"),
+			Region: utils.GetEnvVar("REGION"),
+		}
+	}
+
+	return dtos.MigrationTarget{Flow: requestBody.Flow, ARN: requestBody.ARN, Region: requestBody.Region, KmsKeyId: requestBody.KmsKeyId}
+}
+
+// A PRIVATE scope staying in its secret manager only changes its KMS key
+func isReencryption(source dtos.MigrationTarget, target dtos.MigrationTarget) bool {
+	return source.Flow == constants.PRIVATE_FLOW && target.Flow == constants.PRIVATE_FLOW && source.ARN == target.ARN && source.Region == target.Region
+}
+
+func containsStage(stages []string, stage string) bool {
+	for _, existing := range stages {
+		if existing == stage {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsMigrationTarget(targets []dtos.MigrationTarget, target dtos.MigrationTarget) bool {
+	for _, existing := range targets {
+		if existing == target {
+			return true
+		}
+	}
+
+	return false
+}
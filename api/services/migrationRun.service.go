@@ -0,0 +1,613 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var MIGRATION_LOCK_TTL = 5 * time.Minute
+var MIGRATION_HEARTBEAT = time.Minute
+var MIGRATION_RETENTION = 30 * 24 * time.Hour
+
+// A migration step applied to every scope, in order
+type migrationStep struct {
+	phase string
+	run   func(migration *dtos.Migration, scope *dtos.MigrationScopeState, save func()) error
+}
+
+var migrationSteps = []migrationStep{
+	{constants.COPY_PHASE, copyMigrationStep},
+	{constants.VERIFY_PHASE, verifyMigrationStep},
+	{constants.SWITCH_PHASE, switchMigrationStep},
+	{constants.DELETE_PHASE, deleteMigrationStep},
+}
+
+func migrationKey(id string) string {
+	return "migration:run:" + id
+}
+
+func migrationLockKey(id string) string {
+	return "migration:lock:" + id
+}
+
+// Only one migration of a system secret key runs at a time
+// - the key holds the ID of the running migration and expires with the migration record
+func migrationActiveKey(migration dtos.Migration) string {
+	return "migration:active:" + utils.CreatePrefix(getMigrationHeaders(migration))
+}
+
+// Migrates the system secrets of the headers key to the requested flow
+// ///////////////////////////////////////////////////////////////////////
+// - every system secret is checked before any of them is migrated
+// - runs as a persisted state machine (copy, verify, switch registry, delete source)
+// - failures before the source is deleted are rolled back
+func MigrateSystemSecrets(ctx context.Context, headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) (dtos.Migration, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+	secretNames, scopeRequests, err := getScopeRequests(headers, requestBody)
+	if err != nil {
+		return dtos.Migration{}, err
+	}
+	now := time.Now().UTC()
+	zap.L().Info("Migrating System Secrets :: " + strings.Join(secretNames, ","))
+
+	migration := dtos.Migration{
+		Id:        "migration_" + uuid.NewString(),
+		OrgId:     headers.OrgId,
+		ProjectId: headers.ProjectId,
+		Request:   requestBody,
+		Phase:     constants.COPY_PHASE,
+		Status:    constants.RUNNING_STATUS,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for _, secretName := range secretNames {
+		existingData, err := getSystemSecretData(svc, secretName)
+		if err != nil {
+			// Scopes the key never registered have nothing to migrate
+			if strings.Contains(err.Error(), "ResourceNotFoundException") {
+				continue
+			}
+			return dtos.Migration{}, err
+		}
+
+		if err := CheckMigration(existingData, scopeRequests[secretName]); err != nil {
+			zap.L().Error(fmt.Sprintf("%s :: ", secretName) + err.Error())
+			return dtos.Migration{}, err
+		}
+
+		// Untagged PRIVATE secrets can't be matched to a group and would be left behind
+		source := getMigrationSource(existingData)
+		if source.Flow == constants.PRIVATE_FLOW {
+			sourceSvc, err := getMigrationSecretManager(headers.OrgId, source)
+			if err != nil {
+				return dtos.Migration{}, err
+			}
+			untaggedIds, err := findUntaggedPrivateSecrets(sourceSvc, headers.OrgId)
+			if err != nil {
+				return dtos.Migration{}, err
+			}
+			if len(untaggedIds) > 0 {
+				zap.L().Error(fmt.Sprintf("%s :: %s :: ", secretName, strings.Join(untaggedIds, ",")) + constants.ErrUntaggedPrivateSecrets.Error())
+				return dtos.Migration{}, constants.ErrUntaggedPrivateSecrets
+			}
+		}
+
+		target := getMigrationTarget(scopeRequests[secretName])
+		migration.Scopes = append(migration.Scopes, dtos.MigrationScopeState{
+			SecretName:       secretName,
+			Source:           source,
+			Target:           target,
+			PreviousMetadata: existingData,
+			SecretIds:        []string{},
+			Reencrypt:        isReencryption(source, target),
+		})
+	}
+
+	if len(migration.Scopes) == 0 {
+		return dtos.Migration{}, constants.ErrUnregisteredKey
+	}
+
+	if err := acquireMigrationKey(migration); err != nil {
+		return dtos.Migration{}, err
+	}
+	store.Default().Set(migrationLockKey(migration.Id), "1", MIGRATION_LOCK_TTL)
+	saveMigration(&migration)
+	setJobCheckpoint(ctx, "migrationId", migration.Id)
+
+	err = runMigration(ctx, &migration)
+	store.Default().Delete(migrationLockKey(migration.Id))
+
+	return migration, err
+}
+
+// Returns a migration of the headers key
+// //////////////////////////////////////////
+func GetMigration(headers dtos.CustomHeaders, id string) (dtos.Migration, error) {
+	var migration dtos.Migration
+	if err := store.GetJSON(migrationKey(id), &migration); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.Migration{}, constants.ErrMigrationNotFound
+		}
+		return dtos.Migration{}, err
+	}
+
+	if migration.OrgId != headers.OrgId || migration.ProjectId != headers.ProjectId {
+		return dtos.Migration{}, constants.ErrMigrationNotFound
+	}
+
+	return migration, nil
+}
+
+// Lists the migrations of the headers key, latest first
+// ////////////////////////////////////////////////////////
+func ListMigrations(headers dtos.CustomHeaders) ([]dtos.Migration, error) {
+	keys, err := store.Default().Keys(migrationKey(""))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []dtos.Migration{}
+	for _, key := range keys {
+		migration, err := GetMigration(headers, strings.TrimPrefix(key, migrationKey("")))
+		if err != nil {
+			continue
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].CreatedAt.After(migrations[j].CreatedAt)
+	})
+
+	return migrations, nil
+}
+
+// Resumes an interrupted or failed migration from its persisted phase
+// //////////////////////////////////////////////////////////////////////
+// - migrations which failed while rolling back continue their rollback
+func ResumeMigration(ctx context.Context, headers dtos.CustomHeaders, id string) (dtos.Migration, error) {
+	migration, err := claimMigration(headers, id)
+	if err != nil {
+		return migration, err
+	}
+	defer store.Default().Delete(migrationLockKey(id))
+	if err := acquireMigrationKey(migration); err != nil {
+		return migration, err
+	}
+
+	zap.L().Info("Resuming Migration :: " + id + " :: " + migration.Phase)
+	migration.Status = constants.RUNNING_STATUS
+	migration.Error = ""
+	saveMigration(&migration)
+
+	err = runMigration(ctx, &migration)
+	return migration, err
+}
+
+// Rolls back an interrupted or failed migration
+// ////////////////////////////////////////////////
+// - not allowed once source secrets are being deleted
+func RollbackMigration(headers dtos.CustomHeaders, id string) (dtos.Migration, error) {
+	migration, err := claimMigration(headers, id)
+	if err != nil {
+		return migration, err
+	}
+	defer store.Default().Delete(migrationLockKey(id))
+
+	if migration.Phase == constants.DELETE_PHASE {
+		return migration, constants.ErrMigrationRollbackNotAllowed
+	}
+	if err := acquireMigrationKey(migration); err != nil {
+		return migration, err
+	}
+
+	zap.L().Info("Rolling Back Migration :: " + id)
+	migration.Phase = constants.ROLLBACK_PHASE
+	migration.Status = constants.RUNNING_STATUS
+	saveMigration(&migration)
+
+	err = runMigration(context.Background(), &migration)
+	return migration, err
+}
+
+// Checks a migration can be resumed before its resume is queued
+// /////////////////////////////////////////////////////////////////
+func CheckMigrationResume(headers dtos.CustomHeaders, id string) error {
+	migration, err := GetMigration(headers, id)
+	if err != nil {
+		return err
+	}
+	if migration.Status == constants.COMPLETED_STATUS || migration.Status == constants.ROLLED_BACK_STATUS {
+		return constants.ErrMigrationFinished
+	}
+
+	return nil
+}
+
+// Checks a migration can be rolled back before its rollback is queued
+// //////////////////////////////////////////////////////////////////////
+func CheckMigrationRollback(headers dtos.CustomHeaders, id string) error {
+	if err := CheckMigrationResume(headers, id); err != nil {
+		return err
+	}
+
+	migration, _ := GetMigration(headers, id)
+	if migration.Phase == constants.DELETE_PHASE {
+		return constants.ErrMigrationRollbackNotAllowed
+	}
+
+	return nil
+}
+
+// Starts the background resumer of migrations interrupted by a restart
+// ///////////////////////////////////////////////////////////////////////
+func StartMigrationResumer(interval time.Duration) {
+	zap.L().Info("Starting Migration Resumer :: every " + interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ResumeInterruptedMigrations()
+		}
+	}()
+}
+
+// Resumes the running migrations which lost their owner
+// /////////////////////////////////////////////////////////
+// - a migration's lock expires when the replica running it dies
+func ResumeInterruptedMigrations() int {
+	keys, err := store.Default().Keys(migrationKey(""))
+	if err != nil {
+		zap.L().Error("Listing Migrations Failed :: " + err.Error())
+		return 0
+	}
+
+	resumed := 0
+	for _, key := range keys {
+		var migration dtos.Migration
+		if err := store.GetJSON(key, &migration); err != nil || migration.Status != constants.RUNNING_STATUS {
+			continue
+		}
+
+		acquired, err := store.Default().SetNX(migrationLockKey(migration.Id), "1", MIGRATION_LOCK_TTL)
+		if err != nil || !acquired {
+			continue
+		}
+
+		zap.L().Info("Resuming Interrupted Migration :: " + migration.Id + " :: " + migration.Phase)
+		runMigration(context.Background(), &migration)
+		store.Default().Delete(migrationLockKey(migration.Id))
+		resumed++
+	}
+
+	return resumed
+}
+
+// Helper function to run a migration from its persisted phase
+// //////////////////////////////////////////////////////////////
+// - cancelled migrations are rolled back, unless their source is being deleted
+// - the lock is kept by a heartbeat, a single scope can take longer than the lock TTL
+func runMigration(ctx context.Context, migration *dtos.Migration) error {
+	stopped, done := make(chan struct{}), make(chan struct{})
+	go heartbeatMigration(migration.Id, stopped, done)
+	defer func() {
+		close(stopped)
+		<-done
+	}()
+
+	if migration.Phase == constants.ROLLBACK_PHASE {
+		return rollbackMigration(migration)
+	}
+
+	started := false
+	for stepIndex, step := range migrationSteps {
+		if !started && step.phase != migration.Phase {
+			continue
+		}
+		started = true
+
+		migration.Phase = step.phase
+		saveMigration(migration)
+
+		for i := range migration.Scopes {
+			if ctx.Err() != nil && step.phase != constants.DELETE_PHASE {
+				return failMigration(migration, constants.ErrJobCancelled)
+			}
+			reportJobProgress(ctx, stepIndex*len(migration.Scopes)+i, len(migrationSteps)*len(migration.Scopes), step.phase+" "+migration.Scopes[i].SecretName)
+
+			if err := step.run(migration, &migration.Scopes[i], func() { saveMigration(migration) }); err != nil {
+				zap.L().Error(fmt.Sprintf("Migration %s :: %s :: %s Failed :: ", migration.Id, migration.Scopes[i].SecretName, step.phase) + err.Error())
+				return failMigration(migration, err)
+			}
+			saveMigration(migration)
+		}
+	}
+
+	completedAt := time.Now().UTC()
+	reportJobProgress(ctx, len(migrationSteps)*len(migration.Scopes), len(migrationSteps)*len(migration.Scopes), constants.COMPLETED_STATUS)
+	migration.Status = constants.COMPLETED_STATUS
+	migration.CompletedAt = &completedAt
+	migration.SecretIds = nil
+	for _, scope := range migration.Scopes {
+		migration.SecretIds = append(migration.SecretIds, scope.SecretIds...)
+	}
+	saveMigration(migration)
+	releaseMigrationKey(*migration)
+	zap.L().Info("Migration Completed :: " + migration.Id)
+
+	return nil
+}
+
+// Helper function to roll a failed migration back, unless its source is being deleted
+// //////////////////////////////////////////////////////////////////////////////////////
+func failMigration(migration *dtos.Migration, err error) error {
+	migration.Error = err.Error()
+
+	if migration.Phase == constants.DELETE_PHASE {
+		migration.Status = constants.FAILED_STATUS
+		saveMigration(migration)
+		releaseMigrationKey(*migration)
+		return err
+	}
+
+	migration.Phase = constants.ROLLBACK_PHASE
+	saveMigration(migration)
+	if rollbackErr := rollbackMigration(migration); rollbackErr != nil {
+		migration.Error = fmt.Sprintf("%s :: rollback failed :: %s", err.Error(), rollbackErr.Error())
+		saveMigration(migration)
+	}
+
+	return err
+}
+
+// Helper function to restore the registry and remove the migrated secrets from the target
+// //////////////////////////////////////////////////////////////////////////////////////////
+func rollbackMigration(migration *dtos.Migration) error {
+	for i := range migration.Scopes {
+		scope := &migration.Scopes[i]
+
+		if scope.Switched {
+			if err := updateSystemSecretData(scope.SecretName, scope.PreviousMetadata); err != nil {
+				return failRollback(migration, err)
+			}
+			scope.Switched = false
+			saveMigration(migration)
+
+			publishSystemSecretEvent(getMigrationHeaders(*migration), constants.MIGRATED_EVENT, scope.SecretName, map[string]interface{}{
+				"fromFlow":   scope.Target.Flow,
+				"toFlow":     scope.Source.Flow,
+				"secretIds":  scope.SecretIds,
+				"rolledBack": true,
+			})
+		}
+
+		if err := rollbackMigrationTarget(migration.OrgId, scope); err != nil {
+			return failRollback(migration, err)
+		}
+		scope.CreatedIds = nil
+		scope.CreatedGroup = false
+		scope.Copied = false
+		scope.Verified = false
+		saveMigration(migration)
+	}
+
+	migration.Status = constants.ROLLED_BACK_STATUS
+	saveMigration(migration)
+	releaseMigrationKey(*migration)
+	zap.L().Info("Migration Rolled Back :: " + migration.Id)
+
+	return nil
+}
+
+func failRollback(migration *dtos.Migration, err error) error {
+	zap.L().Error("Migration Rollback Failed :: " + migration.Id + " :: " + err.Error())
+	migration.Status = constants.FAILED_STATUS
+	saveMigration(migration)
+	releaseMigrationKey(*migration)
+
+	return err
+}
+
+func copyMigrationStep(migration *dtos.Migration, scope *dtos.MigrationScopeState, save func()) error {
+	if scope.Copied {
+		return nil
+	}
+	if err := copyMigrationScope(migration, scope, save); err != nil {
+		return err
+	}
+	scope.Copied = true
+
+	return nil
+}
+
+func verifyMigrationStep(migration *dtos.Migration, scope *dtos.MigrationScopeState, save func()) error {
+	if scope.Verified {
+		return nil
+	}
+	if err := verifyMigrationScope(migration.OrgId, scope); err != nil {
+		return err
+	}
+	scope.Verified = true
+
+	return nil
+}
+
+// Points the system secret of a scope to the target secret manager
+func switchMigrationStep(migration *dtos.Migration, scope *dtos.MigrationScopeState, save func()) error {
+	if scope.Switched {
+		return nil
+	}
+
+	metadata := map[string]interface{}{}
+	for key, value := range scope.PreviousMetadata {
+		metadata[key] = value
+	}
+	metadata[constants.ARN_META_DATA] = scope.Target.ARN
+	metadata[constants.REGION_META_DATA] = scope.Target.Region
+	scopeReq := getScopeRequest(migration.Request, getSecretNameScope(getMigrationHeaders(*migration), scope.SecretName))
+	metadata[constants.PROVIDER_META_DATA] = scopeReq.Provider
+	metadata[constants.FLOW_META_DATA] = scope.Target.Flow
+	delete(metadata, constants.KMS_KEY_META_DATA)
+	if scope.Target.KmsKeyId != "" {
+		metadata[constants.KMS_KEY_META_DATA] = scope.Target.KmsKeyId
+	}
+	if scope.Target.Flow == constants.SHARED_FLOW {
+		metadata[constants.PROVIDER_META_DATA] = utils.SetDefaultIfEmptyValue(scopeReq.Provider, "AWS")
+	}
+
+	if err := updateSystemSecretData(scope.SecretName, metadata); err != nil {
+		return err
+	}
+	scope.Switched = true
+
+	publishSystemSecretEvent(getMigrationHeaders(*migration), constants.MIGRATED_EVENT, scope.SecretName, map[string]interface{}{
+		"fromFlow":  scope.Source.Flow,
+		"toFlow":    scope.Target.Flow,
+		"secretIds": scope.SecretIds,
+	})
+
+	return nil
+}
+
+func deleteMigrationStep(migration *dtos.Migration, scope *dtos.MigrationScopeState, save func()) error {
+	if scope.SourceDeleted {
+		return nil
+	}
+	if err := deleteMigrationSource(migration.OrgId, scope); err != nil {
+		return err
+	}
+	scope.SourceDeleted = true
+
+	return nil
+}
+
+// Helper function to claim a migration which isn't running on any replica
+// ///////////////////////////////////////////////////////////////////////////
+func claimMigration(headers dtos.CustomHeaders, id string) (dtos.Migration, error) {
+	migration, err := GetMigration(headers, id)
+	if err != nil {
+		return dtos.Migration{}, err
+	}
+
+	if migration.Status == constants.COMPLETED_STATUS || migration.Status == constants.ROLLED_BACK_STATUS {
+		return migration, constants.ErrMigrationFinished
+	}
+
+	acquired, err := store.Default().SetNX(migrationLockKey(id), "1", MIGRATION_LOCK_TTL)
+	if err != nil {
+		return migration, err
+	}
+	if !acquired {
+		return migration, constants.ErrMigrationInProgress
+	}
+
+	return migration, nil
+}
+
+// Helper function to take the active key of a migration's system secret key
+// //////////////////////////////////////////////////////////////////////////////
+// - failed migrations released the key, resuming them takes it again unless another migration started
+func acquireMigrationKey(migration dtos.Migration) error {
+	acquired, err := store.Default().SetNX(migrationActiveKey(migration), migration.Id, MIGRATION_RETENTION)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		if owner, _ := store.Default().Get(migrationActiveKey(migration)); owner != migration.Id {
+			return constants.ErrMigrationInProgress
+		}
+	}
+
+	return nil
+}
+
+// Helper function to release the active key of a finished or failed migration
+func releaseMigrationKey(migration dtos.Migration) {
+	if owner, _ := store.Default().Get(migrationActiveKey(migration)); owner == migration.Id {
+		store.Default().Delete(migrationActiveKey(migration))
+	}
+}
+
+// Helper function to keep the lock of a running migration
+// - done is closed once it stopped, so the lock can be released after it
+func heartbeatMigration(id string, stopped chan struct{}, done chan struct{}) {
+	ticker := time.NewTicker(MIGRATION_HEARTBEAT)
+	defer ticker.Stop()
+	defer close(done)
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+			store.Default().Set(migrationLockKey(id), "1", MIGRATION_LOCK_TTL)
+		}
+	}
+}
+
+// Helper function to persist a migration, extending the lock of its owner
+// ///////////////////////////////////////////////////////////////////////////
+func saveMigration(migration *dtos.Migration) {
+	migration.UpdatedAt = time.Now().UTC()
+	if err := store.SetJSON(migrationKey(migration.Id), migration, MIGRATION_RETENTION); err != nil {
+		zap.L().Error("Saving Migration Failed :: " + migration.Id + " :: " + err.Error())
+	}
+	store.Default().Set(migrationLockKey(migration.Id), "1", MIGRATION_LOCK_TTL)
+
+	// The active key of a running migration lives as long as its record
+	if migration.Status == constants.RUNNING_STATUS {
+		if owner, _ := store.Default().Get(migrationActiveKey(*migration)); owner == migration.Id {
+			store.Default().Set(migrationActiveKey(*migration), migration.Id, MIGRATION_RETENTION)
+		}
+	}
+}
+
+// Helper function to write the metadata of a system secret
+// ///////////////////////////////////////////////////////////
+func updateSystemSecretData(secretName string, metadata map[string]interface{}) error {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	secretString, err := utils.StringifyJson(metadata)
+	if err != nil {
+		zap.L().Error("StringifyJson Failed :: " + err.Error())
+		return err
+	}
+
+	_, err = svc.UpdateSecret(context.TODO(), &secretsmanager.UpdateSecretInput{
+		SecretId:     aws.String(secretName),
+		SecretString: aws.String(secretString),
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("UpdateSecret %s Failed :: ", secretName) + err.Error())
+		return err
+	}
+	invalidateSystemSecret(secretName)
+	reindexSystemSecret(secretName, metadata)
+
+	return nil
+}
+
+// Migrations resumed in the background have no request headers
+func getMigrationHeaders(migration dtos.Migration) dtos.CustomHeaders {
+	return dtos.CustomHeaders{OrgId: migration.OrgId, ProjectId: migration.ProjectId}
+}
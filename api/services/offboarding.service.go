@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"go.uber.org/zap"
+)
+
+var ORG_OFFBOARDING_TOKEN_TTL = 15 * time.Minute
+
+type offboardingToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func offboardingTokenKey(orgId string) string {
+	return "offboarding:token:" + orgId
+}
+
+func offboardingUsedKey(token string) string {
+	return "offboarding:used:" + token
+}
+
+// Previews the deletion of an organization, returning its confirmation token
+// //////////////////////////////////////////////////////////////////////////////
+// - every registration of the organization and its projects is listed, nothing is deleted
+// - a new preview replaces the token of the previous one
+func PlanOrgOffboarding(headers dtos.CustomHeaders) (dtos.OrgOffboarding, error) {
+	if headers.ProjectId != "" || headers.Scope != "" {
+		return dtos.OrgOffboarding{}, constants.ErrOrgOffboardingProject
+	}
+
+	entries, err := discoverOrgRegistrations(headers.OrgId)
+	if err != nil {
+		return dtos.OrgOffboarding{}, err
+	}
+	if len(entries) == 0 {
+		return dtos.OrgOffboarding{}, constants.ErrUnregisteredKey
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return dtos.OrgOffboarding{}, err
+	}
+	token := offboardingToken{
+		Token:     hex.EncodeToString(tokenBytes),
+		ExpiresAt: time.Now().UTC().Add(ORG_OFFBOARDING_TOKEN_TTL),
+	}
+	if err := store.SetJSON(offboardingTokenKey(headers.OrgId), token, ORG_OFFBOARDING_TOKEN_TTL); err != nil {
+		return dtos.OrgOffboarding{}, err
+	}
+
+	offboarding := dtos.OrgOffboarding{
+		OrgId:             headers.OrgId,
+		Registrations:     []dtos.OrgRegistration{},
+		ConfirmationToken: token.Token,
+		ExpiresAt:         token.ExpiresAt,
+	}
+	for _, entry := range entries {
+		offboarding.Registrations = append(offboarding.Registrations, getOrgRegistration(entry))
+	}
+
+	return offboarding, nil
+}
+
+// Consumes the confirmation token of an organization deletion
+// //////////////////////////////////////////////////////////////
+// - tokens can only be used once
+func ConfirmOrgOffboarding(headers dtos.CustomHeaders, confirmationToken string) error {
+	if headers.ProjectId != "" || headers.Scope != "" {
+		return constants.ErrOrgOffboardingProject
+	}
+	if confirmationToken == "" {
+		return constants.ErrMissingConfirmationToken
+	}
+
+	var token offboardingToken
+	if err := store.GetJSON(offboardingTokenKey(headers.OrgId), &token); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return constants.ErrInvalidConfirmationToken
+		}
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Token), []byte(confirmationToken)) != 1 || time.Now().After(token.ExpiresAt) {
+		return constants.ErrInvalidConfirmationToken
+	}
+
+	// Confirmations racing for the same token, only the first one is accepted
+	acquired, err := store.Default().SetNX(offboardingUsedKey(token.Token), "1", ORG_OFFBOARDING_TOKEN_TTL)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return constants.ErrInvalidConfirmationToken
+	}
+	store.Default().Delete(offboardingTokenKey(headers.OrgId))
+
+	return nil
+}
+
+// Deletes an organization with every project registration and secret group
+// ////////////////////////////////////////////////////////////////////////////
+// - SHARED groups are deleted from the shared secret manager, PRIVATE secrets from the customer account
+// - every registration is deleted on its own, failures are reported and retried by the job
+// - the organization registration is deleted last, once every project is gone
+func DeleteOrganization(ctx context.Context, headers dtos.CustomHeaders) (dtos.OrgDeletion, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+	deletion := dtos.OrgDeletion{OrgId: headers.OrgId, Items: getDeletedOrgItems(ctx)}
+
+	entries, err := discoverOrgRegistrations(headers.OrgId)
+	if err != nil {
+		return deletion, err
+	}
+	zap.L().Info(fmt.Sprintf("Deleting Organization :: %s :: %d registrations", headers.OrgId, len(entries)))
+
+	for i, entry := range entries {
+		if ctx.Err() != nil {
+			return deletion, constants.ErrJobCancelled
+		}
+		reportJobProgress(ctx, i, len(entries), "deleting "+entry.SecretName)
+
+		item := dtos.OrgDeletionItem{OrgRegistration: getOrgRegistration(entry)}
+		if entry.ProjectId == "" && deletion.Failed > 0 {
+			item.Status = constants.SKIPPED_STATUS
+			item.Error = constants.ErrOrgDeletionIncomplete.Error()
+			deletion.Items = append(deletion.Items, item)
+			continue
+		}
+
+		item.DeletedSecrets, err = deleteOrgRegistration(svc, entry)
+		if err != nil {
+			zap.L().Error("Deleting Registration Failed :: " + entry.SecretName + " :: " + err.Error())
+			item.Status = constants.FAILED_STATUS
+			item.Error = err.Error()
+			deletion.Failed++
+		} else {
+			item.Status = constants.DELETED_STATUS
+			if itemString, err := utils.StringifyJson(item); err == nil {
+				setJobCheckpoint(ctx, "deleted:"+entry.SecretName, itemString)
+			}
+		}
+		deletion.Items = append(deletion.Items, item)
+	}
+	reportJobProgress(ctx, len(entries), len(entries), "deleted")
+
+	for _, item := range deletion.Items {
+		switch item.Status {
+		case constants.DELETED_STATUS:
+			deletion.Deleted++
+		case constants.SKIPPED_STATUS:
+			deletion.Skipped++
+		}
+	}
+	if deletion.Failed > 0 {
+		return deletion, constants.ErrOrgDeletionIncomplete
+	}
+	if len(deletion.Items) == 0 {
+		return deletion, constants.ErrUnregisteredKey
+	}
+
+	return deletion, nil
+}
+
+// Helper function to delete a registration along with its secret group
+// ////////////////////////////////////////////////////////////////////////
+// - returns the number of deleted secrets
+func deleteOrgRegistration(svc *secretsmanager.Client, entry inventoryEntry) (int, error) {
+	headers := dtos.CustomHeaders{OrgId: entry.OrgId, ProjectId: entry.ProjectId, Scope: entry.Scope}
+	groupSvc, err := getMigrationSecretManager(entry.OrgId, dtos.MigrationTarget{Flow: entry.Flow, ARN: entry.ARN, Region: entry.Region})
+	if err != nil {
+		return 0, err
+	}
+
+	deletedSecrets := 0
+	if entry.Flow == constants.SHARED_FLOW {
+		secretData, found, err := getSharedGroupData(groupSvc, entry.SecretName)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			deletedSecrets = len(getSharedGroupValues(secretData))
+			if _, err := DeleteSecretGroup(headers, entry.ARN, entry.Region); err != nil && !strings.Contains(err.Error(), "ResourceNotFoundException") {
+				return 0, err
+			}
+		}
+	} else {
+		ids, err := listPrivateGroupSecrets(groupSvc, entry.SecretName)
+		if err != nil {
+			return 0, err
+		}
+
+		// Secrets created before the group tag can't be matched to a group, the whole organization is deleted anyway
+		// - roles of the onboarding template can't reach them, the registration then fails and is kept
+		untaggedIds, err := findUntaggedPrivateSecrets(groupSvc, entry.OrgId)
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, untaggedIds...)
+		if err := deletePrivateSecrets(groupSvc, ids); err != nil {
+			return 0, err
+		}
+		deletedSecrets = len(ids)
+		deleteRotationPolicies(entry.SecretName)
+		publishSecretEvent(headers, constants.DELETED_EVENT, "", "", map[string]interface{}{
+			"group": entry.SecretName,
+		})
+	}
+
+	deleteAsap := true
+	_, err = svc.DeleteSecret(context.TODO(), &secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(entry.SecretName),
+		ForceDeleteWithoutRecovery: &deleteAsap,
+	})
+	if err != nil && !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		zap.L().Error("DeleteSecret Failed :: " + err.Error())
+		return deletedSecrets, err
+	}
+	invalidateSystemSecret(entry.SecretName)
+	unindexSystemSecret(entry.SecretName)
+	publishSystemSecretEvent(headers, constants.DEREGISTERED_EVENT, entry.SecretName, map[string]interface{}{})
+
+	return deletedSecrets, nil
+}
+
+// Helper function to find every registration of an organization in the System secret manager
+// ///////////////////////////////////////////////////////////////////////////////////////////////
+// - the projects come first, ordered by name, the organization registration last
+func discoverOrgRegistrations(orgId string) ([]inventoryEntry, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	// Name and description filters match prefixes, other organizations may start with the same ID
+	systemSecrets, err := listPrivateSecrets(svc, []types.Filter{
+		{Key: types.FilterNameStringTypeName, Values: []string{orgId}},
+		{Key: types.FilterNameStringTypeDescription, Values: []string{"Organization ID: " + orgId}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []inventoryEntry{}
+	for _, systemSecret := range systemSecrets {
+		entry, ok := getInventoryEntry(systemSecret)
+		if !ok || entry.OrgId != orgId || (entry.SecretName != orgId && !strings.HasPrefix(entry.SecretName, orgId+"_")) {
+			continue
+		}
+
+		metadata, err := getSystemSecretData(svc, entry.SecretName)
+		if err != nil {
+			if strings.Contains(err.Error(), "ResourceNotFoundException") {
+				continue
+			}
+			return nil, err
+		}
+		entry = getInventoryMetadata(entry, metadata)
+		if entry.Flow == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if (entries[i].ProjectId == "") != (entries[j].ProjectId == "") {
+			return entries[j].ProjectId == ""
+		}
+		return entries[i].SecretName < entries[j].SecretName
+	})
+
+	return entries, nil
+}
+
+// Registrations deleted by previous attempts of the job are no longer found
+func getDeletedOrgItems(ctx context.Context) []dtos.OrgDeletionItem {
+	items := []dtos.OrgDeletionItem{}
+	run, ok := ctx.Value(jobRunKey{}).(*jobRun)
+	if !ok {
+		return items
+	}
+
+	keys := []string{}
+	for key := range run.job.Checkpoint {
+		if strings.HasPrefix(key, "deleted:") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var item dtos.OrgDeletionItem
+		if err := json.Unmarshal([]byte(run.job.Checkpoint[key]), &item); err == nil {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func getOrgRegistration(entry inventoryEntry) dtos.OrgRegistration {
+	return dtos.OrgRegistration{
+		SecretName: entry.SecretName,
+		ProjectId:  entry.ProjectId,
+		Scope:      entry.Scope,
+		Flow:       entry.Flow,
+	}
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"go.uber.org/zap"
+)
+
+var ONBOARDING_ROLE_NAME = "Secret_Manager_CRUD_Access_Role_For_Skyu"
+var ONBOARDING_POLICY_NAME = "Secret_Manager_CRUD_Access_Policy_For_Skyu"
+
+var serviceAccountId string
+var serviceAccountMutex sync.Mutex
+
+// Returns the ExternalId sent when assuming the roles of an organization
+// //////////////////////////////////////////////////////////////////////////
+// - derived from the organization ID with EXTERNAL_ID_SECRET, nothing has to be stored
+// - empty when EXTERNAL_ID_SECRET isn't set
+func GetExternalId(orgId string) string {
+	secret := utils.GetEnvVar("EXTERNAL_ID_SECRET")
+	if secret == "" || orgId == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(orgId))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Renders the onboarding template of an organization, trusting the account of the service
+// ///////////////////////////////////////////////////////////////////////////////////////////
+// - 'kmsKeyIds' are the customer managed KMS keys the registrations will use, see RenderOnboardingTemplate
+func GetOnboardingTemplate(headers dtos.CustomHeaders, format string, kmsKeyIds []string) (dtos.OnboardingTemplate, error) {
+	format = strings.ToUpper(format)
+	if format != constants.CLOUDFORMATION_FORMAT && format != constants.TERRAFORM_FORMAT {
+		return dtos.OnboardingTemplate{}, constants.ErrInvalidTemplateFormat
+	}
+	if GetExternalId(headers.OrgId) == "" {
+		return dtos.OnboardingTemplate{}, constants.ErrExternalIdDisabled
+	}
+
+	accountId, err := getServiceAccountId()
+	if err != nil {
+		return dtos.OnboardingTemplate{}, err
+	}
+
+	return RenderOnboardingTemplate(headers.OrgId, format, accountId, kmsKeyIds)
+}
+
+// Renders the onboarding template of an organization
+// //////////////////////////////////////////////////////
+// - the role trusts the given account with the ExternalId of the organization
+// - the policy only reaches the PRIVATE secrets tagged with the secret groups of the organization,
+// and the probe secrets of the access verification
+// - the KMS keys are only usable through Secrets Manager, no KMS permission is granted without a key
+func RenderOnboardingTemplate(orgId string, format string, accountId string, kmsKeyIds []string) (dtos.OnboardingTemplate, error) {
+	onboarding := dtos.OnboardingTemplate{
+		OrgId:      orgId,
+		Format:     strings.ToUpper(format),
+		AccountId:  accountId,
+		ExternalId: GetExternalId(orgId),
+		RoleName:   ONBOARDING_ROLE_NAME,
+	}
+	if onboarding.ExternalId == "" {
+		return dtos.OnboardingTemplate{}, constants.ErrExternalIdDisabled
+	}
+	for _, kmsKeyId := range kmsKeyIds {
+		if _, _, err := dtos.ParseKmsKeyArn(kmsKeyId); err != nil {
+			return dtos.OnboardingTemplate{}, err
+		}
+	}
+	trustPolicy := getOnboardingTrustPolicy(accountId, onboarding.ExternalId)
+
+	switch onboarding.Format {
+	case constants.CLOUDFORMATION_FORMAT:
+		policy := getOnboardingPolicy(orgId, kmsKeyIds, func(name string) interface{} {
+			return map[string]interface{}{"Fn::Sub": "arn:${AWS::Partition}:secretsmanager:${AWS::Region}:${AWS::AccountId}:secret:" + name}
+		})
+		onboarding.Template = getCloudFormationTemplate(orgId, trustPolicy, policy)
+	case constants.TERRAFORM_FORMAT:
+		policy := getOnboardingPolicy(orgId, kmsKeyIds, func(name string) interface{} {
+			return "arn:${data.aws_partition.current.partition}:secretsmanager:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:secret:" + name
+		})
+		template, err := getTerraformTemplate(orgId, trustPolicy, policy)
+		if err != nil {
+			return dtos.OnboardingTemplate{}, err
+		}
+		onboarding.Template = template
+	default:
+		return dtos.OnboardingTemplate{}, constants.ErrInvalidTemplateFormat
+	}
+
+	return onboarding, nil
+}
+
+// Helper function to get the role trust policy, the ExternalId guards against confused deputies
+func getOnboardingTrustPolicy(accountId string, externalId string) map[string]interface{} {
+	return map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []interface{}{
+			map[string]interface{}{
+				"Effect":    "Allow",
+				"Principal": map[string]interface{}{"AWS": "arn:aws:iam::" + accountId + ":root"},
+				"Action":    "sts:AssumeRole",
+				"Condition": map[string]interface{}{
+					"StringEquals": map[string]interface{}{"sts:ExternalId": externalId},
+				},
+			},
+		},
+	}
+}
+
+// Helper function to get the least privilege policy of an organization
+// ///////////////////////////////////////////////////////////////////////////
+// - actions come from REENCRYPTION_PERMISSIONS, 'resource' returns the ARN of secret names in the template syntax
+// - secrets are created tagged with their secret group, see getSecretGroupTags
+// - the KMS_KEY_PERMISSIONS are granted on the given keys, aliases are matched with the aliases of the key
+func getOnboardingPolicy(orgId string, kmsKeyIds []string, resource func(name string) interface{}) map[string]interface{} {
+	secretGroups := []string{orgId, orgId + "_*"}
+	createActions := []string{"secretsmanager:CreateSecret", "secretsmanager:TagResource"}
+	probeActions := []string{}
+	manageActions := []string{}
+	for _, action := range REENCRYPTION_PERMISSIONS {
+		if action == "secretsmanager:ListSecrets" {
+			continue
+		}
+		probeActions = append(probeActions, action)
+		if action != "secretsmanager:CreateSecret" && action != "secretsmanager:TagResource" {
+			manageActions = append(manageActions, action)
+		}
+	}
+	secrets := resource(constants.PRIVATE_SECRET_PREFIX + "*")
+
+	statements := []interface{}{
+		// ListSecrets can't be restricted to resources, secrets are filtered by the service
+		map[string]interface{}{
+			"Sid":      "ListSecrets",
+			"Effect":   "Allow",
+			"Action":   []string{"secretsmanager:ListSecrets"},
+			"Resource": "*",
+		},
+		map[string]interface{}{
+			"Sid":      "CreateOrganizationSecrets",
+			"Effect":   "Allow",
+			"Action":   createActions,
+			"Resource": secrets,
+			"Condition": map[string]interface{}{
+				"StringLike": map[string]interface{}{"aws:RequestTag/" + constants.SECRET_GROUP_TAG: secretGroups},
+			},
+		},
+		map[string]interface{}{
+			"Sid":      "ManageOrganizationSecrets",
+			"Effect":   "Allow",
+			"Action":   manageActions,
+			"Resource": secrets,
+			"Condition": map[string]interface{}{
+				"StringLike": map[string]interface{}{"aws:ResourceTag/" + constants.SECRET_GROUP_TAG: secretGroups},
+			},
+		},
+		map[string]interface{}{
+			"Sid":      "VerifyAccess",
+			"Effect":   "Allow",
+			"Action":   probeActions,
+			"Resource": resource(constants.PERMISSION_PROBE_PREFIX + "*"),
+		},
+	}
+	statements = append(statements, getOnboardingKmsStatements(kmsKeyIds)...)
+
+	return map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	}
+}
+
+// Helper function to get the statements of the KMS keys of an organization
+// ///////////////////////////////////////////////////////////////////////////
+// - IAM only matches key ARNs as resources, aliases are matched on the keys of their account and region
+// - 'kms:ViaService' keeps the keys out of reach outside of Secrets Manager
+func getOnboardingKmsStatements(kmsKeyIds []string) []interface{} {
+	statements := []interface{}{}
+	for _, kmsKeyId := range kmsKeyIds {
+		_, kmsResource, err := dtos.ParseKmsKeyArn(kmsKeyId)
+		if err != nil {
+			continue
+		}
+
+		condition := map[string]interface{}{
+			"StringLike": map[string]interface{}{"kms:ViaService": "secretsmanager.*.amazonaws.com"},
+		}
+		resource := kmsKeyId
+		if strings.HasPrefix(kmsResource, "alias/") {
+			resource = strings.TrimSuffix(kmsKeyId, kmsResource) + "key/*"
+			condition["ForAnyValue:StringEquals"] = map[string]interface{}{"kms:ResourceAliases": kmsResource}
+		}
+		statements = append(statements, map[string]interface{}{
+			"Sid":       fmt.Sprintf("UseKmsKey%d", len(statements)+1),
+			"Effect":    "Allow",
+			"Action":    KMS_KEY_PERMISSIONS,
+			"Resource":  resource,
+			"Condition": condition,
+		})
+	}
+	return statements
+}
+
+func getCloudFormationTemplate(orgId string, trustPolicy map[string]interface{}, policy map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Description":              "IAM Role and Policy for Secrets Manager Access of the organization " + orgId,
+		"Resources": map[string]interface{}{
+			"SecretManagerCrudRole": map[string]interface{}{
+				"Type": "AWS::IAM::Role",
+				"Properties": map[string]interface{}{
+					"RoleName":                 ONBOARDING_ROLE_NAME,
+					"Description":              "Secret Manager CRUD Access Role for Skyu",
+					"AssumeRolePolicyDocument": trustPolicy,
+					"Policies": []interface{}{
+						map[string]interface{}{"PolicyName": ONBOARDING_POLICY_NAME, "PolicyDocument": policy},
+					},
+				},
+			},
+		},
+		"Outputs": map[string]interface{}{
+			"SecretManagerCrudRoleArn": map[string]interface{}{
+				"Description": "ARN of the Secrets Manager CRUD role",
+				"Value":       map[string]interface{}{"Fn::GetAtt": []string{"SecretManagerCrudRole", "Arn"}},
+			},
+		},
+	}
+}
+
+// Terraform JSON configuration, policies are JSON strings interpolated by Terraform
+func getTerraformTemplate(orgId string, trustPolicy map[string]interface{}, policy map[string]interface{}) (map[string]interface{}, error) {
+	trustPolicyJson, err := json.Marshal(trustPolicy)
+	if err != nil {
+		return nil, err
+	}
+	policyJson, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"data": map[string]interface{}{
+			"aws_caller_identity": map[string]interface{}{"current": map[string]interface{}{}},
+			"aws_partition":       map[string]interface{}{"current": map[string]interface{}{}},
+			"aws_region":          map[string]interface{}{"current": map[string]interface{}{}},
+		},
+		"resource": map[string]interface{}{
+			"aws_iam_role": map[string]interface{}{
+				"secret_manager_crud_role": map[string]interface{}{
+					"name":               ONBOARDING_ROLE_NAME,
+					"description":        "Secret Manager CRUD Access Role for Skyu (" + orgId + ")",
+					"assume_role_policy": string(trustPolicyJson),
+				},
+			},
+			"aws_iam_role_policy": map[string]interface{}{
+				"secret_manager_crud_policy": map[string]interface{}{
+					"name":   ONBOARDING_POLICY_NAME,
+					"role":   "${aws_iam_role.secret_manager_crud_role.id}",
+					"policy": string(policyJson),
+				},
+			},
+		},
+		"output": map[string]interface{}{
+			"secret_manager_crud_role_arn": map[string]interface{}{
+				"description": "ARN of the Secrets Manager CRUD role",
+				"value":       "${aws_iam_role.secret_manager_crud_role.arn}",
+			},
+		},
+	}, nil
+}
+
+// Helper function to get the account ID of the service, which is trusted by the roles
+func getServiceAccountId() (string, error) {
+	serviceAccountMutex.Lock()
+	defer serviceAccountMutex.Unlock()
+	if serviceAccountId != "" {
+		return serviceAccountId, nil
+	}
+
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	identity, err := sts.NewFromConfig(config).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		zap.L().Error("GetCallerIdentity Failed :: " + err.Error())
+		return "", err
+	}
+
+	serviceAccountId = aws.ToString(identity.Account)
+	return serviceAccountId, nil
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/bus"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var OUTBOX_BATCH_SIZE = 100
+var OUTBOX_LOCK_TTL = time.Minute
+var OUTBOX_DEFAULT_SUBJECT = "secrets.events"
+var OUTBOX_RECONCILE_LOCK_KEY = "outbox:reconcile-lock"
+
+// Age of a pending write after which its request is assumed lost, and the write is reconciled
+var OUTBOX_PENDING_TIMEOUT = 2 * time.Minute
+
+// Returns true when the secret manager was written since a pending write started, replaced in the tests
+var OutboxWriteApplied = SecretManagerWriteApplied
+
+var outboxPublisher bus.Publisher
+var useOutboxOnce sync.Once
+
+func outboxKey(orgId string) string {
+	return "outbox:events:" + orgId
+}
+
+func outboxLockKey(orgId string) string {
+	return "outbox:lock:" + orgId
+}
+
+func outboxPendingKey(eventId string) string {
+	return "outbox:pending:" + eventId
+}
+
+// Creates the event bus publisher configured by the OUTBOX_* env variables
+// ///////////////////////////////////////////////////////////////////////////
+func NewOutboxPublisher(kind string) (bus.Publisher, error) {
+	subject := utils.SetDefaultIfEmptyValue(utils.GetEnvVar("OUTBOX_SUBJECT"), OUTBOX_DEFAULT_SUBJECT)
+
+	switch kind {
+	case constants.NATS_PUBLISHER:
+		return bus.NewNatsPublisher(utils.GetEnvVar("OUTBOX_NATS_URL"), subject, utils.GetEnvVar("OUTBOX_NATS_JETSTREAM") == "true")
+
+	case constants.KAFKA_PUBLISHER:
+		return bus.NewKafkaPublisher(strings.Split(utils.GetEnvVar("OUTBOX_KAFKA_BROKERS"), ","), subject), nil
+
+	default:
+		return nil, constants.ErrInvalidOutboxPublisher
+	}
+}
+
+// Records every published event in the outbox of its organization
+// //////////////////////////////////////////////////////////////////
+// - events are recorded by a subscriber once the secret manager write returned, before the request returns
+// - secret writes are announced as pending first, see beginOutboxWrite, a lost record is reconciled
+// - events are delivered at-least-once, the outbox needs Redis to survive restarts
+func UseOutboxPublisher(publisher bus.Publisher) {
+	outboxPublisher = publisher
+
+	useOutboxOnce.Do(func() {
+		events.Subscribe(recordOutboxEvent)
+	})
+}
+
+// Starts the background publisher draining the outbox to the event bus
+// ///////////////////////////////////////////////////////////////////////
+func StartOutboxPublisher(interval time.Duration) {
+	zap.L().Info("Starting Outbox Publisher :: every " + interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			PublishOutboxEvents()
+		}
+	}()
+}
+
+// Helper function to announce a secret write before it's sent to the secret manager
+// /////////////////////////////////////////////////////////////////////////////////////
+// - the write has to fail when the announce fails, its event could be lost otherwise
+// - the event is published by completeOutboxWrite, or dropped by abortOutboxWrite when the write failed
+// - nothing is announced without an outbox publisher
+func beginOutboxWrite(headers dtos.CustomHeaders, eventType string, secretId string, secretName string, metadata map[string]interface{}) (events.Event, error) {
+	event := events.Event{
+		Id:        "evt_" + uuid.NewString(),
+		Type:      eventType,
+		OrgId:     headers.OrgId,
+		ProjectId: headers.ProjectId,
+		Scope:     headers.Scope,
+		SecretId:  secretId,
+		TraceId:   headers.TraceId,
+		Metadata:  metadata,
+	}
+	if outboxPublisher == nil {
+		return event, nil
+	}
+
+	write := dtos.OutboxWrite{
+		Event:      event,
+		SecretName: secretName,
+		ARN:        headers.ARN,
+		Region:     headers.Region,
+		StartedAt:  time.Now().UTC(),
+	}
+	if err := store.SetJSON(outboxPendingKey(event.Id), write, 0); err != nil {
+		zap.L().Error("Announcing Outbox Write Failed :: " + event.Id + " :: " + err.Error())
+		return event, err
+	}
+	return event, nil
+}
+
+// Publishes the event of a successful write announced by beginOutboxWrite
+func completeOutboxWrite(event events.Event, versionId string) {
+	event.VersionId = versionId
+	events.Publish(event)
+}
+
+// Drops the pending write of a failed write announced by beginOutboxWrite
+func abortOutboxWrite(event events.Event) {
+	if outboxPublisher != nil {
+		store.Default().Delete(outboxPendingKey(event.Id))
+	}
+}
+
+// Helper function to append an event to the outbox of its organization
+// ///////////////////////////////////////////////////////////////////////
+// - the pending write of the event is only removed once the event is recorded
+func recordOutboxEvent(event events.Event) {
+	if err := store.AppendJSON(outboxKey(event.OrgId), event); err != nil {
+		zap.L().Error("Recording Outbox Event Failed :: " + event.Id + " :: " + err.Error())
+		return
+	}
+	store.Default().Delete(outboxPendingKey(event.Id))
+}
+
+// Records the events of the pending writes whose request was lost
+// ///////////////////////////////////////////////////////////////////
+// - writes older than OUTBOX_PENDING_TIMEOUT are checked against the secret manager, by one replica at a time
+// - a secret changed since the write started is reported, even when another write changed it (at-least-once)
+// - writes which can't be checked are kept for the next run
+func ReconcileOutboxWrites(now time.Time) int {
+	acquired, err := store.Default().SetNX(OUTBOX_RECONCILE_LOCK_KEY, "1", OUTBOX_LOCK_TTL)
+	if err != nil || !acquired {
+		return 0
+	}
+	defer store.Default().Delete(OUTBOX_RECONCILE_LOCK_KEY)
+
+	keys, err := store.Default().Keys(outboxPendingKey(""))
+	if err != nil {
+		zap.L().Error("Listing Pending Outbox Writes Failed :: " + err.Error())
+		return 0
+	}
+
+	reconciled := 0
+	for _, key := range keys {
+		var write dtos.OutboxWrite
+		if err := store.GetJSON(key, &write); err != nil || now.Sub(write.StartedAt) < OUTBOX_PENDING_TIMEOUT {
+			continue
+		}
+
+		applied, err := OutboxWriteApplied(write)
+		if err != nil {
+			zap.L().Error("Reconciling Outbox Write Failed :: " + write.Event.Id + " :: " + err.Error())
+			continue
+		}
+		if applied {
+			event := write.Event
+			event.Timestamp = now
+			if err := store.AppendJSON(outboxKey(event.OrgId), event); err != nil {
+				zap.L().Error("Recording Outbox Event Failed :: " + event.Id + " :: " + err.Error())
+				continue
+			}
+			reconciled++
+		}
+		store.Default().Delete(key)
+	}
+
+	return reconciled
+}
+
+// Checks if the secret of a pending write changed since the write started
+// ////////////////////////////////////////////////////////////////////////////////////////////
+// - deleted secrets are changed, dates of the secret manager are truncated to the second
+func SecretManagerWriteApplied(write dtos.OutboxWrite) (bool, error) {
+	awsConfig, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(write.Region))
+	svc, err := getSecretManager(awsConfig, write.Event.OrgId, write.ARN, write.Region)
+	if err != nil {
+		return false, err
+	}
+
+	output, err := svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(write.SecretName)})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return write.Event.Type == constants.DELETED_EVENT, nil
+		}
+		return false, err
+	}
+
+	startedAt := write.StartedAt.Add(-time.Second)
+	switch {
+	case output.DeletedDate != nil:
+		return write.Event.Type == constants.DELETED_EVENT, nil
+	case output.LastChangedDate != nil:
+		return output.LastChangedDate.After(startedAt), nil
+	case output.CreatedDate != nil:
+		return output.CreatedDate.After(startedAt), nil
+	}
+	return false, nil
+}
+
+// Publishes the pending outbox events of every organization in order
+// /////////////////////////////////////////////////////////////////////
+// - events are removed once the bus accepted them (at-least-once)
+// - a failure stops the organization's batch so later events are not published first
+func PublishOutboxEvents() int {
+	if outboxPublisher == nil {
+		return 0
+	}
+	ReconcileOutboxWrites(time.Now().UTC())
+
+	keys, err := store.Default().Keys(outboxKey(""))
+	if err != nil {
+		zap.L().Error("Listing Outboxes Failed :: " + err.Error())
+		return 0
+	}
+
+	published := 0
+	for _, key := range keys {
+		orgId := strings.TrimPrefix(key, outboxKey(""))
+
+		// Only one replica publishes an organization's events at a time
+		acquired, err := store.Default().SetNX(outboxLockKey(orgId), "1", OUTBOX_LOCK_TTL)
+		if err != nil || !acquired {
+			continue
+		}
+
+		published += publishOutbox(orgId)
+		store.Default().Delete(outboxLockKey(orgId))
+	}
+
+	return published
+}
+
+// Helper function to publish a batch of an organization's outbox
+// /////////////////////////////////////////////////////////////////
+// - the lock is renewed after every event, the batch stops once the lock may have expired
+func publishOutbox(orgId string) int {
+	key := outboxKey(orgId)
+	entries, err := store.Default().List(key, 0, OUTBOX_BATCH_SIZE-1)
+	if err != nil {
+		zap.L().Error("Reading Outbox Failed :: " + orgId + " :: " + err.Error())
+		return 0
+	}
+
+	done := 0
+	renewedAt := time.Now()
+	for _, entry := range entries {
+		var event events.Event
+		if err := json.Unmarshal([]byte(entry), &event); err != nil {
+			// Unreadable entries would block the organization forever
+			zap.L().Error("Dropping Invalid Outbox Event :: " + orgId + " :: " + err.Error())
+			done++
+			continue
+		}
+
+		err := outboxPublisher.Publish(bus.Message{Key: orgId, Id: event.Id, Payload: []byte(entry)})
+		if err != nil {
+			zap.L().Error("Publishing Outbox Event Failed :: " + event.Id + " :: " + err.Error())
+			break
+		}
+		done++
+
+		if time.Since(renewedAt) >= OUTBOX_LOCK_TTL {
+			zap.L().Error("Outbox Lock Expired :: " + orgId)
+			break
+		}
+		if err := store.Default().Set(outboxLockKey(orgId), "1", OUTBOX_LOCK_TTL); err != nil {
+			zap.L().Error("Renewing Outbox Lock Failed :: " + orgId + " :: " + err.Error())
+			break
+		}
+		renewedAt = time.Now()
+	}
+
+	if done > 0 {
+		if err := store.Default().Trim(key, done, -1); err != nil {
+			zap.L().Error("Trimming Outbox Failed :: " + orgId + " :: " + err.Error())
+		}
+	}
+
+	return done
+}
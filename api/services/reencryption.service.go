@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Re-encrypts the secrets of a PRIVATE scope with the KMS key of its target
+// ////////////////////////////////////////////////////////////////////////////
+// - Secrets Manager only encrypts new versions with a new key, current and previous values are rewritten
+// - re-encrypted secrets are recorded one by one, interrupted runs continue where they stopped
+func reencryptMigrationScope(migration *dtos.Migration, scope *dtos.MigrationScopeState, save func()) error {
+	svc, err := getMigrationSecretManager(migration.OrgId, scope.Target)
+	if err != nil {
+		return err
+	}
+
+	ids, err := listPrivateGroupSecrets(svc, scope.SecretName)
+	if err != nil {
+		return err
+	}
+	sort.Strings(ids)
+	scope.SecretIds = append([]string{}, ids...)
+	save()
+
+	for _, id := range scope.SecretIds {
+		if utils.ArrayContains(scope.ReencryptedIds, id) {
+			continue
+		}
+
+		if err := reencryptPrivateSecret(svc, migration.Id, id, scope.Target.KmsKeyId); err != nil {
+			return err
+		}
+		scope.ReencryptedIds = append(scope.ReencryptedIds, id)
+		save()
+	}
+
+	return nil
+}
+
+// Checks the secrets of a re-encrypted scope use the KMS key of its target
+// ///////////////////////////////////////////////////////////////////////////
+func verifyReencryptedScope(orgId string, scope *dtos.MigrationScopeState) error {
+	svc, err := getMigrationSecretManager(orgId, scope.Target)
+	if err != nil {
+		return err
+	}
+
+	// Secrets added while re-encrypting were encrypted with the previous key
+	ids, err := listPrivateGroupSecrets(svc, scope.SecretName)
+	if err != nil {
+		return err
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != strings.Join(scope.SecretIds, ",") {
+		return fmt.Errorf("%w :: %s :: source secrets changed", constants.ErrMigrationVerificationFailed, scope.SecretName)
+	}
+
+	for _, id := range scope.SecretIds {
+		output, err := svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(id)})
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("DescribeSecret Failed :: %s :: ", id) + err.Error())
+			return err
+		}
+
+		if getSecretsManagerKmsKey(aws.ToString(output.KmsKeyId)) != getSecretsManagerKmsKey(scope.Target.KmsKeyId) {
+			return fmt.Errorf("%w :: %s :: KMS key not changed", constants.ErrMigrationVerificationFailed, id)
+		}
+	}
+
+	return nil
+}
+
+// Helper function to re-encrypt the current and previous values of a PRIVATE secret
+// ////////////////////////////////////////////////////////////////////////////////////
+// - versions are written with tokens derived from the migration, retries don't add versions
+// - the previous value is written under a custom staging label, then AWSPREVIOUS is moved to it
+func reencryptPrivateSecret(svc *secretsmanager.Client, migrationId string, id string, kmsKeyId string) error {
+	currentToken := uuid.NewSHA1(uuid.NameSpaceOID, []byte(migrationId+"/"+id+"/"+constants.CURRENT_STAGE)).String()
+	previousToken := uuid.NewSHA1(uuid.NameSpaceOID, []byte(migrationId+"/"+id+"/"+constants.PREVIOUS_STAGE)).String()
+
+	stages, err := getSecretVersionStages(svc, id)
+	if err != nil {
+		return err
+	}
+	_, currentWritten := stages[currentToken]
+	_, previousWritten := stages[previousToken]
+	previousVersion := getStagedVersion(stages, constants.PREVIOUS_STAGE)
+
+	// Once the current value is rewritten, AWSPREVIOUS holds the value it replaced
+	hasPrevious := previousWritten || (!currentWritten && previousVersion != "")
+
+	var previous *secretsmanager.GetSecretValueOutput
+	if hasPrevious && !previousWritten {
+		if previous, err = svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+			SecretId:  aws.String(id),
+			VersionId: aws.String(previousVersion),
+		}); err != nil {
+			zap.L().Error(fmt.Sprintf("Failed to GetSecretValue :: %s :: %s :: ", id, constants.PREVIOUS_STAGE) + err.Error())
+			return err
+		}
+	}
+
+	if err := updatePrivateSecretKmsKey(svc, id, getSecretsManagerKmsKey(kmsKeyId)); err != nil {
+		zap.L().Error(fmt.Sprintf("UpdateSecret Failed :: %s :: ", id) + err.Error())
+		return err
+	}
+
+	if previous != nil {
+		if _, err := svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+			SecretId:           aws.String(id),
+			SecretString:       previous.SecretString,
+			SecretBinary:       previous.SecretBinary,
+			ClientRequestToken: aws.String(previousToken),
+			VersionStages:      []string{constants.REENCRYPTION_STAGE},
+		}); err != nil {
+			zap.L().Error(fmt.Sprintf("PutSecretValue Failed :: %s :: %s :: ", id, constants.PREVIOUS_STAGE) + err.Error())
+			return err
+		}
+	}
+
+	if !currentWritten {
+		current, err := svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("Failed to GetSecretValue :: %s :: ", id) + err.Error())
+			return err
+		}
+		if _, err := svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+			SecretId:           aws.String(id),
+			SecretString:       current.SecretString,
+			SecretBinary:       current.SecretBinary,
+			ClientRequestToken: aws.String(currentToken),
+		}); err != nil {
+			zap.L().Error(fmt.Sprintf("PutSecretValue Failed :: %s :: ", id) + err.Error())
+			return err
+		}
+	}
+
+	if !hasPrevious {
+		return nil
+	}
+	return restorePreviousStage(svc, id, previousToken)
+}
+
+// Helper function to move AWSPREVIOUS to the re-encrypted previous value and drop its custom label
+// ///////////////////////////////////////////////////////////////////////////////////////////////////
+func restorePreviousStage(svc *secretsmanager.Client, id string, previousToken string) error {
+	stages, err := getSecretVersionStages(svc, id)
+	if err != nil {
+		return err
+	}
+
+	if previousVersion := getStagedVersion(stages, constants.PREVIOUS_STAGE); previousVersion != previousToken {
+		input := &secretsmanager.UpdateSecretVersionStageInput{
+			SecretId:        aws.String(id),
+			VersionStage:    aws.String(constants.PREVIOUS_STAGE),
+			MoveToVersionId: aws.String(previousToken),
+		}
+		if previousVersion != "" {
+			input.RemoveFromVersionId = aws.String(previousVersion)
+		}
+		if _, err := svc.UpdateSecretVersionStage(context.TODO(), input); err != nil {
+			zap.L().Error(fmt.Sprintf("UpdateSecretVersionStage Failed :: %s :: %s :: ", id, constants.PREVIOUS_STAGE) + err.Error())
+			return err
+		}
+	}
+
+	if containsStage(stages[previousToken], constants.REENCRYPTION_STAGE) {
+		if _, err := svc.UpdateSecretVersionStage(context.TODO(), &secretsmanager.UpdateSecretVersionStageInput{
+			SecretId:            aws.String(id),
+			VersionStage:        aws.String(constants.REENCRYPTION_STAGE),
+			RemoveFromVersionId: aws.String(previousToken),
+		}); err != nil {
+			zap.L().Error(fmt.Sprintf("UpdateSecretVersionStage Failed :: %s :: %s :: ", id, constants.REENCRYPTION_STAGE) + err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Helper function to point an existing PRIVATE secret to a KMS key, new versions are encrypted with it
+// ///////////////////////////////////////////////////////////////////////////////////////////////////////
+func updatePrivateSecretKmsKey(svc *secretsmanager.Client, id string, kmsKeyId string) error {
+	if kmsKeyId == "" {
+		return nil
+	}
+
+	_, err := svc.UpdateSecret(context.TODO(), &secretsmanager.UpdateSecretInput{
+		SecretId: aws.String(id),
+		KmsKeyId: aws.String(kmsKeyId),
+	})
+	return err
+}
+
+func getSecretVersionStages(svc *secretsmanager.Client, id string) (map[string][]string, error) {
+	output, err := svc.DescribeSecret(context.TODO(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(id)})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("DescribeSecret Failed :: %s :: ", id) + err.Error())
+		return nil, err
+	}
+
+	return output.VersionIdsToStages, nil
+}
+
+func getStagedVersion(stages map[string][]string, stage string) string {
+	for versionId, versionStages := range stages {
+		if containsStage(versionStages, stage) {
+			return versionId
+		}
+	}
+
+	return ""
+}
+
+// Secrets without a customer managed key use the AWS managed key of Secrets Manager
+func getSecretsManagerKmsKey(kmsKeyId string) string {
+	return utils.SetDefaultIfEmptyValue(kmsKeyId, constants.DEFAULT_SECRETS_MANAGER_KEY)
+}
@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/generators"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"go.uber.org/zap"
+)
+
+var ROTATION_HISTORY_LIMIT = 50
+var ROTATION_LOCK_TTL = 2 * time.Minute
+var ROTATION_RETRY_DELAY = 5 * time.Minute
+var SCHEDULER_TRACE_ID = "rotation-scheduler"
+
+// Lock used to serialize writes to a secret group outside of HTTP requests
+// - Replaced by the Redis lock in main when Redis is enabled
+var AcquireGroupLock = func(key string) (bool, error) { return true, nil }
+var ReleaseGroupLock = func(key string) {}
+
+// Returns true while a group lock of the prefix is held, used by jobs to wait for in-flight writes
+var GroupLocksHeld = func(prefix string) (bool, error) { return false, nil }
+
+func rotationPolicyKey(prefix string, id string) string {
+	return "rotation:policy:" + prefix + ":" + id
+}
+
+func rotationHistoryKey(prefix string, id string) string {
+	return "rotation:history:" + prefix + ":" + id
+}
+
+func rotationLockKey(prefix string, id string) string {
+	return "rotation:lock:" + prefix + ":" + id
+}
+
+// Creates or replaces the rotation policy of a secret
+// //////////////////////////////////////////////////////
+func SetRotationPolicy(headers dtos.CustomHeaders, id string, requestBody dtos.RotationPolicyReq) (dtos.RotationPolicy, error) {
+	prefix := utils.CreatePrefix(headers)
+	interval, _ := time.ParseDuration(requestBody.Interval)
+	zap.L().Info("Setting Rotation Policy :: " + prefix + " :: " + id)
+
+	// The secret must exist before it can be rotated
+	if _, err := getCurrentSecretValue(headers, id); err != nil {
+		return dtos.RotationPolicy{}, err
+	}
+
+	now := time.Now().UTC()
+	policy := dtos.RotationPolicy{
+		SecretId:     id,
+		OrgId:        headers.OrgId,
+		ProjectId:    headers.ProjectId,
+		Scope:        headers.Scope,
+		Interval:     requestBody.Interval,
+		Generator:    requestBody.Generator,
+		NextRotation: now.Add(interval),
+		CreatedAt:    now,
+	}
+
+	// Keep the rotation state when an existing policy is replaced
+	var existing dtos.RotationPolicy
+	if err := store.GetJSON(rotationPolicyKey(prefix, id), &existing); err == nil {
+		policy.CreatedAt = existing.CreatedAt
+		policy.LastRotated = existing.LastRotated
+		if existing.LastRotated != nil {
+			policy.NextRotation = existing.LastRotated.Add(interval)
+		}
+	}
+
+	if err := store.SetJSON(rotationPolicyKey(prefix, id), policy, 0); err != nil {
+		zap.L().Error("Saving Rotation Policy Failed :: " + err.Error())
+		return dtos.RotationPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// Returns the rotation policy of a secret
+// ///////////////////////////////////////////
+func GetRotationPolicy(headers dtos.CustomHeaders, id string) (dtos.RotationPolicy, error) {
+	prefix := utils.CreatePrefix(headers)
+	var policy dtos.RotationPolicy
+
+	if err := store.GetJSON(rotationPolicyKey(prefix, id), &policy); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.RotationPolicy{}, constants.ErrRotationPolicyNotFound
+		}
+		zap.L().Error("Getting Rotation Policy Failed :: " + err.Error())
+		return dtos.RotationPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// Returns the latest rotation history entries of a secret
+// ///////////////////////////////////////////////////////////
+func GetRotationHistory(headers dtos.CustomHeaders, id string) ([]dtos.RotationRecord, error) {
+	prefix := utils.CreatePrefix(headers)
+	entries, err := store.Default().List(rotationHistoryKey(prefix, id), -ROTATION_HISTORY_LIMIT, -1)
+	if err != nil {
+		zap.L().Error("Getting Rotation History Failed :: " + err.Error())
+		return nil, err
+	}
+
+	history := []dtos.RotationRecord{}
+	for _, entry := range entries {
+		var record dtos.RotationRecord
+		if err := json.Unmarshal([]byte(entry), &record); err == nil {
+			history = append(history, record)
+		}
+	}
+
+	return history, nil
+}
+
+// Deletes the rotation policy of a secret, the history is kept for auditing
+// ////////////////////////////////////////////////////////////////////////////
+func DeleteRotationPolicy(headers dtos.CustomHeaders, id string) (string, error) {
+	prefix := utils.CreatePrefix(headers)
+	if _, err := GetRotationPolicy(headers, id); err != nil {
+		return "", err
+	}
+
+	zap.L().Info("Deleting Rotation Policy :: " + prefix + " :: " + id)
+	if err := store.Default().Delete(rotationPolicyKey(prefix, id)); err != nil {
+		zap.L().Error("Deleting Rotation Policy Failed :: " + err.Error())
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Helper function to remove every rotation policy under a secret group
+// ///////////////////////////////////////////////////////////////////////
+func deleteRotationPolicies(prefix string) {
+	keys, err := store.Default().Keys(rotationPolicyKey(prefix, ""))
+	if err != nil {
+		zap.L().Error("Listing Rotation Policies Failed :: " + err.Error())
+		return
+	}
+
+	for _, key := range keys {
+		store.Default().Delete(key)
+	}
+}
+
+// Rotates a secret now using its rotation policy
+// ///////////////////////////////////////////////////
+// - The previous value is kept under the AWSPREVIOUS stage
+func RotateSecret(headers dtos.CustomHeaders, id string, trigger string) (dtos.RotationRecord, error) {
+	prefix := utils.CreatePrefix(headers)
+
+	// Prevents replicas from rotating the same secret at once
+	acquired, err := store.Default().SetNX(rotationLockKey(prefix, id), headers.TraceId, ROTATION_LOCK_TTL)
+	if err != nil {
+		return dtos.RotationRecord{}, err
+	}
+	if !acquired {
+		return dtos.RotationRecord{}, constants.ErrRotationInProgress
+	}
+	defer store.Default().Delete(rotationLockKey(prefix, id))
+
+	policy, err := GetRotationPolicy(headers, id)
+	if err != nil {
+		return dtos.RotationRecord{}, err
+	}
+
+	// Another replica may have rotated the secret since it was picked up
+	if trigger == constants.SCHEDULED_ROTATION && policy.NextRotation.After(time.Now().UTC()) {
+		return dtos.RotationRecord{}, constants.ErrRotationNotDue
+	}
+
+	zap.L().Info("Rotating Secret :: " + prefix + " :: " + id)
+	record := dtos.RotationRecord{
+		SecretId:  id,
+		Trigger:   trigger,
+		RotatedAt: time.Now().UTC(),
+	}
+
+	secretName := prefix
+	if headers.Flow == constants.PRIVATE_FLOW {
+		secretName = id
+	}
+	event, err := beginOutboxWrite(headers, constants.ROTATED_EVENT, id, secretName, map[string]interface{}{
+		"trigger": trigger,
+	})
+	if err != nil {
+		return dtos.RotationRecord{}, err
+	}
+
+	newValue, err := generators.Generate(policy.Generator)
+	if err == nil {
+		record.VersionId, err = putRotatedSecretValue(headers, id, newValue)
+	}
+
+	if err != nil {
+		abortOutboxWrite(event)
+		zap.L().Error("Rotating Secret Failed :: " + err.Error())
+		record.Outcome = constants.FAILURE_OUTCOME
+		record.Error = err.Error()
+		recordRotation(prefix, id, record)
+
+		// Failed scheduled rotations are retried after a delay instead of on every tick
+		if trigger == constants.SCHEDULED_ROTATION {
+			policy.NextRotation = record.RotatedAt.Add(ROTATION_RETRY_DELAY)
+			store.SetJSON(rotationPolicyKey(prefix, id), policy, 0)
+		}
+		return record, err
+	}
+
+	record.Outcome = constants.SUCCESS_OUTCOME
+	recordRotation(prefix, id, record)
+	completeOutboxWrite(event, record.VersionId)
+
+	interval, _ := time.ParseDuration(policy.Interval)
+	policy.LastRotated = &record.RotatedAt
+	policy.NextRotation = record.RotatedAt.Add(interval)
+	if err := store.SetJSON(rotationPolicyKey(prefix, id), policy, 0); err != nil {
+		zap.L().Error("Saving Rotation Policy Failed :: " + err.Error())
+	}
+
+	return record, nil
+}
+
+// Helper function to write a rotated value while keeping the previous one
+// //////////////////////////////////////////////////////////////////////////
+func putRotatedSecretValue(headers dtos.CustomHeaders, id string, secret string) (string, error) {
+	secretName := utils.CreatePrefix(headers)
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
+	svc, _ := getSecretManager(config, headers.OrgId, headers.ARN, headers.Region)
+
+	// PRIVATE flow secrets move AWSCURRENT to AWSPREVIOUS on every new version
+	//----------------------------------------------------------------------------------------------
+	if headers.Flow == constants.PRIVATE_FLOW {
+		secretString, err := json.Marshal(secret)
+		if err != nil {
+			return "", err
+		}
+
+		output, err := svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+			SecretId:     aws.String(id),
+			SecretString: aws.String(string(secretString)),
+		})
+		if err != nil {
+			zap.L().Error("PutSecretValue failed :: " + err.Error())
+			return "", err
+		}
+		return aws.ToString(output.VersionId), nil
+	}
+
+	// SHARED flow secrets keep the previous values of the group under a reserved key
+	//----------------------------------------------------------------------------------------------
+	input := getSecretInput(secretName, "")
+	getSecretValueResponse, err := svc.GetSecretValue(context.TODO(), &input)
+	if err != nil {
+		zap.L().Error("Failed to GetSecretValue :: " + err.Error())
+		return "", err
+	}
+
+	var secretData map[string]interface{}
+	if err := json.Unmarshal([]byte(*getSecretValueResponse.SecretString), &secretData); err != nil {
+		zap.L().Error("Unmarshalling json failed :: " + err.Error())
+		return "", err
+	}
+
+	currentValue, idExists := secretData[id]
+	if !idExists {
+		return "", constants.ErrKeyNotFound
+	}
+
+	previousValues, _ := secretData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{})
+	if previousValues == nil {
+		previousValues = map[string]interface{}{}
+	}
+	sealedSecret, err := sealSharedValue(headers.OrgId, headers.ProjectId, secretName, id, secret)
+	if err != nil {
+		return "", err
+	}
+	previousValues[id] = currentValue
+	secretData[constants.PREVIOUS_VALUES_KEY] = previousValues
+	secretData[id] = sealedSecret
+
+	updatedSecretString, err := json.Marshal(secretData)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := svc.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName),
+		SecretString: aws.String(string(updatedSecretString)),
+	})
+	if err != nil {
+		zap.L().Error("PutSecretValue failed :: " + err.Error())
+		return "", err
+	}
+
+	return aws.ToString(output.VersionId), nil
+}
+
+// Helper function to read the current raw value of a secret
+// ////////////////////////////////////////////////////////////
+func getCurrentSecretValue(headers dtos.CustomHeaders, id string) (interface{}, error) {
+	if id == constants.PREVIOUS_VALUES_KEY {
+		return nil, constants.ErrKeyNotFound
+	}
+
+	secretName := utils.CreatePrefix(headers)
+	if headers.Flow == constants.PRIVATE_FLOW {
+		secretName = id
+	}
+
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
+	svc, _ := getSecretManager(config, headers.OrgId, headers.ARN, headers.Region)
+	input := getSecretInput(secretName, "")
+	getSecretValueResponse, err := svc.GetSecretValue(context.TODO(), &input)
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return nil, constants.ErrKeyNotFound
+		}
+		zap.L().Error(fmt.Sprintf("Failed to GetSecretValue :: %s :: ", secretName) + err.Error())
+		return nil, err
+	}
+
+	if headers.Flow == constants.PRIVATE_FLOW {
+		return *getSecretValueResponse.SecretString, nil
+	}
+
+	var secretData map[string]interface{}
+	if err := json.Unmarshal([]byte(*getSecretValueResponse.SecretString), &secretData); err != nil {
+		zap.L().Error("Unmarshalling json failed :: " + err.Error())
+		return nil, err
+	}
+
+	value, idExists := secretData[id]
+	if !idExists {
+		return nil, constants.ErrKeyNotFound
+	}
+
+	return value, nil
+}
+
+// Starts the background scheduler rotating due secrets
+// ////////////////////////////////////////////////////////
+func StartRotationScheduler(interval time.Duration) {
+	zap.L().Info("Starting Rotation Scheduler :: every " + interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			RunDueRotations(time.Now().UTC())
+		}
+	}()
+}
+
+// Rotates every secret whose policy is due at the given time
+// /////////////////////////////////////////////////////////////
+func RunDueRotations(now time.Time) []dtos.RotationRecord {
+	var records []dtos.RotationRecord
+	for _, policy := range GetDueRotationPolicies(now) {
+		record, err := runScheduledRotation(policy)
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("Scheduled Rotation Failed :: %s :: ", policy.SecretId) + err.Error())
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// Returns the rotation policies which are due at the given time
+// ////////////////////////////////////////////////////////////////
+func GetDueRotationPolicies(now time.Time) []dtos.RotationPolicy {
+	keys, err := store.Default().Keys("rotation:policy:")
+	if err != nil {
+		zap.L().Error("Listing Rotation Policies Failed :: " + err.Error())
+		return nil
+	}
+
+	var duePolicies []dtos.RotationPolicy
+	for _, key := range keys {
+		var policy dtos.RotationPolicy
+		if err := store.GetJSON(key, &policy); err != nil {
+			continue
+		}
+		if !policy.NextRotation.After(now) {
+			duePolicies = append(duePolicies, policy)
+		}
+	}
+
+	return duePolicies
+}
+
+// Helper function to rotate a secret from the scheduler
+// ////////////////////////////////////////////////////////
+func runScheduledRotation(policy dtos.RotationPolicy) (record dtos.RotationRecord, err error) {
+	// getSecretManager panics on failed assume roles, which must not stop the scheduler
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rotation panicked :: %v", r)
+		}
+	}()
+
+	headers := dtos.CustomHeaders{
+		OrgId:     policy.OrgId,
+		ProjectId: policy.ProjectId,
+		Scope:     policy.Scope,
+		TraceId:   SCHEDULER_TRACE_ID,
+	}
+
+	// The registration is resolved on every run since migrations may change it
+	arn, region, provider, flow, err := LookupSystemSecret(headers, "")
+	if err != nil {
+		return dtos.RotationRecord{}, err
+	}
+	headers.ARN = arn
+	headers.Region = region
+	headers.Provider = provider
+	headers.Flow = flow
+
+	lockId := utils.CreatePrefix(headers)
+	acquired, err := AcquireGroupLock(lockId)
+	if !acquired {
+		return dtos.RotationRecord{}, err
+	}
+	defer ReleaseGroupLock(lockId)
+	if err := CheckSecretWritable(headers); err != nil {
+		return dtos.RotationRecord{}, err
+	}
+
+	return RotateSecret(headers, policy.SecretId, constants.SCHEDULED_ROTATION)
+}
+
+// Helper function to append a rotation to the history, only the last ROTATION_HISTORY_LIMIT are kept
+func recordRotation(prefix string, id string, record dtos.RotationRecord) {
+	key := rotationHistoryKey(prefix, id)
+	if err := store.AppendJSON(key, record); err != nil {
+		zap.L().Error("Recording Rotation Failed :: " + err.Error())
+		return
+	}
+	store.Default().Trim(key, -ROTATION_HISTORY_LIMIT, -1)
+}
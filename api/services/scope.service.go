@@ -0,0 +1,260 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+
+	"go.uber.org/zap"
+)
+
+func scopeKey(orgId string, name string) string {
+	return scopeRegistryPrefix(orgId) + name
+}
+
+func scopeRegistryPrefix(orgId string) string {
+	return "scope:registry:" + orgId + ":"
+}
+
+// Lists the scopes registered for an organization
+// ///////////////////////////////////////////////////
+// - the built-in scopes come first, followed by the custom scopes by name
+func ListScopes(orgId string) ([]dtos.Scope, error) {
+	scopes := []dtos.Scope{}
+	for _, name := range constants.ACCEPTED_SCOPES {
+		scopes = append(scopes, dtos.Scope{Name: name, OrgId: orgId, BuiltIn: true})
+	}
+
+	keys, err := store.Default().Keys(scopeRegistryPrefix(orgId))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var scope dtos.Scope
+		if err := store.GetJSON(key, &scope); err != nil {
+			if err == constants.ErrRecordNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		if scope.BuiltIn {
+			for i := range scopes {
+				if scopes[i].Name == scope.Name {
+					scopes[i] = scope
+				}
+			}
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+
+	// OTHERS stays the default scope until another scope is marked as default
+	hasDefault := false
+	for _, scope := range scopes {
+		hasDefault = hasDefault || scope.Default
+	}
+	if !hasDefault {
+		for i := range scopes {
+			scopes[i].Default = scopes[i].Name == constants.OTHERS_SCOPE
+		}
+	}
+
+	return scopes, nil
+}
+
+// Returns a scope registered for an organization
+// //////////////////////////////////////////////////
+func GetScope(orgId string, name string) (dtos.Scope, error) {
+	scopes, err := ListScopes(orgId)
+	if err != nil {
+		return dtos.Scope{}, err
+	}
+
+	for _, scope := range scopes {
+		if scope.Name == name {
+			return scope, nil
+		}
+	}
+
+	return dtos.Scope{}, constants.ErrScopeNotFound
+}
+
+// Registers a scope for an organization or updates its settings
+// /////////////////////////////////////////////////////////////////
+// - marking a scope as default unmarks the previous default scope
+func PutScope(orgId string, name string, requestBody dtos.ScopeReq) (dtos.Scope, error) {
+	now := time.Now().UTC()
+	scope := dtos.Scope{
+		Name:          name,
+		OrgId:         orgId,
+		DefaultFlow:   requestBody.DefaultFlow,
+		MaxSecretSize: requestBody.MaxSecretSize,
+		Masked:        requestBody.Masked,
+		Default:       requestBody.Default,
+		BuiltIn:       isBuiltInScope(name),
+		UpdatedAt:     &now,
+	}
+	zap.L().Info("Saving Scope :: " + orgId + " :: " + name)
+
+	if scope.Default {
+		scopes, err := ListScopes(orgId)
+		if err != nil {
+			return dtos.Scope{}, err
+		}
+
+		for _, existing := range scopes {
+			if existing.Default && existing.Name != name {
+				existing.Default = false
+				existing.UpdatedAt = &now
+				if err := store.SetJSON(scopeKey(orgId, existing.Name), existing, 0); err != nil {
+					return dtos.Scope{}, err
+				}
+			}
+		}
+	}
+
+	if err := store.SetJSON(scopeKey(orgId, name), scope, 0); err != nil {
+		zap.L().Error("Saving Scope Failed :: " + err.Error())
+		return dtos.Scope{}, err
+	}
+
+	return GetScope(orgId, name)
+}
+
+// Removes a scope of an organization
+// //////////////////////////////////////
+// - built-in scopes are reset to their default settings instead
+// - system secrets and secrets of a removed scope are kept, but can't be reached until it is registered again
+func DeleteScope(orgId string, name string) error {
+	if _, err := store.Default().Get(scopeKey(orgId, name)); err != nil {
+		if err == constants.ErrRecordNotFound && isBuiltInScope(name) {
+			return nil
+		}
+		if err == constants.ErrRecordNotFound {
+			return constants.ErrScopeNotFound
+		}
+		return err
+	}
+
+	zap.L().Info("Deleting Scope :: " + orgId + " :: " + name)
+	return store.Default().Delete(scopeKey(orgId, name))
+}
+
+// Returns the scope names of an organization
+// //////////////////////////////////////////////
+// - falls back to the built-in scopes when the registry can't be read
+func GetScopeNames(orgId string) []string {
+	scopes, err := ListScopes(orgId)
+	if err != nil {
+		zap.L().Error("Listing Scopes Failed :: " + orgId + " :: " + err.Error())
+		return constants.ACCEPTED_SCOPES[:]
+	}
+
+	var names []string
+	for _, scope := range scopes {
+		names = append(names, scope.Name)
+	}
+	return names
+}
+
+// Checks if a scope is registered for an organization
+// ///////////////////////////////////////////////////////
+func IsScopeRegistered(orgId string, name string) bool {
+	for _, scope := range GetScopeNames(orgId) {
+		if scope == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the scope used by secret routes without a x-scope header
+// ////////////////////////////////////////////////////////////////////
+func GetDefaultScope(orgId string) string {
+	scopes, err := ListScopes(orgId)
+	if err != nil {
+		zap.L().Error("Listing Scopes Failed :: " + orgId + " :: " + err.Error())
+		return constants.OTHERS_SCOPE
+	}
+
+	for _, scope := range scopes {
+		if scope.Default {
+			return scope.Name
+		}
+	}
+	return constants.OTHERS_SCOPE
+}
+
+// Checks if the secrets of the headers scope are masked
+// /////////////////////////////////////////////////////////
+func IsScopeMasked(headers dtos.CustomHeaders) bool {
+	if headers.Scope == "" {
+		return false
+	}
+
+	scope, err := GetScope(headers.OrgId, headers.Scope)
+	return err == nil && scope.Masked
+}
+
+// Helper function to check a secret against the max secret size of the headers scope
+// ///////////////////////////////////////////////////////////////////////////////////////
+func checkScopeSecretSize(headers dtos.CustomHeaders, secret string) error {
+	if headers.Scope == "" {
+		return nil
+	}
+
+	scope, err := GetScope(headers.OrgId, headers.Scope)
+	if err != nil {
+		return err
+	}
+
+	if scope.MaxSecretSize > 0 && len(secret) > scope.MaxSecretSize {
+		zap.L().Error(strings.Join([]string{headers.OrgId, headers.Scope, constants.ErrSecretTooLarge.Error()}, " :: "))
+		return constants.ErrSecretTooLarge
+	}
+	return nil
+}
+
+// Helper function to apply the default flows of scopes missing from a system secret request
+// //////////////////////////////////////////////////////////////////////////////////////////////
+// - only scopes without the top-level flow or their own settings use the default flow
+func applyScopeDefaultFlows(headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) dtos.SystemSecretReq {
+	if headers.ProjectId == "" || requestBody.Flow != "" {
+		return requestBody
+	}
+
+	scopes, err := ListScopes(headers.OrgId)
+	if err != nil {
+		zap.L().Error("Listing Scopes Failed :: " + headers.OrgId + " :: " + err.Error())
+		return requestBody
+	}
+
+	scopeRequests := map[string]dtos.SystemSecretReq{}
+	for name, scopeReq := range requestBody.Scopes {
+		scopeRequests[name] = scopeReq
+	}
+	for _, scope := range scopes {
+		if _, exists := scopeRequests[scope.Name]; !exists && scope.DefaultFlow != nil && (headers.Scope == "" || headers.Scope == scope.Name) {
+			scopeRequests[scope.Name] = *scope.DefaultFlow
+		}
+	}
+
+	requestBody.Scopes = scopeRequests
+	return requestBody
+}
+
+func isBuiltInScope(name string) bool {
+	for _, scope := range constants.ACCEPTED_SCOPES {
+		if scope == name {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,7 @@ import (
 
 	"secret-svc/api/dtos"
 	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
 	"secret-svc/pkg/utils"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -20,31 +21,44 @@ import (
 
 // Retrieves the cross account Shared/Private Secret Manager using assume roles
 // ////////////////////////////////////////////////////////////////////
-func getSecretManager(config aws.Config, arn, region string) (secretsmanager.Client, error) {
+func getSecretManager(config aws.Config, orgId, arn, region string) (secretsmanager.Client, error) {
+	assumedConfig, err := assumeRoleConfig(config, orgId, arn, region)
+	if err != nil {
+		zap.L().Panic("Failed to get Secret Manager Instance :: " + err.Error())
+		return secretsmanager.Client{}, err
+	}
+
+	return *secretsmanager.NewFromConfig(assumedConfig), nil
+}
+
+// Returns a config using the credentials of an assumed role
+// ////////////////////////////////////////////////////////////
+func assumeRoleConfig(config aws.Config, orgId, arn, region string) (aws.Config, error) {
 	stsClient := sts.NewFromConfig(config)
-	assumedRoleObject, err := stsClient.AssumeRole(context.TODO(), &sts.AssumeRoleInput{
+	input := &sts.AssumeRoleInput{
 		RoleArn:         &arn,
 		RoleSessionName: aws.String("ASSUME_ROLE_SESSION_NAME"),
-	})
+	}
+	// Roles created before the onboarding templates don't check the ExternalId, it's ignored by them
+	if externalId := GetExternalId(orgId); externalId != "" {
+		input.ExternalId = aws.String(externalId)
+	}
+	assumedRoleObject, err := stsClient.AssumeRole(context.TODO(), input)
 
 	if err != nil {
-		zap.L().Panic("Failed to get Secret Manager Instance :: " + err.Error())
-		return secretsmanager.Client{}, err
+		return aws.Config{}, err
 	}
 
 	credentails := assumedRoleObject.Credentials
-	credentialsProvider := credentials.NewStaticCredentialsProvider(
+	assumedConfig := config.Copy()
+	assumedConfig.Credentials = credentials.NewStaticCredentialsProvider(
 		*credentails.AccessKeyId,
 		*credentails.SecretAccessKey,
 		*credentails.SessionToken,
 	)
+	assumedConfig.Region = region
 
-	secretsManagerClient := secretsmanager.NewFromConfig(config, func(o *secretsmanager.Options) {
-		o.Credentials = credentialsProvider
-		o.Region = region
-	})
-
-	return *secretsManagerClient, nil
+	return assumedConfig, nil
 }
 
 // Helper function for getting secret inputs
@@ -65,7 +79,12 @@ func getSecretInput(secretName string, versionId string) secretsmanager.GetSecre
 
 // Retreives a secret from the Shared/Private Secret Manager by giving uuid
 // ////////////////////////////////////////////////////////////////////////
-func GetSecret(headers dtos.CustomHeaders, id string, version string) (string, error) {
+// - stage can be AWSPREVIOUS to read the value replaced by the last rotation
+func GetSecret(headers dtos.CustomHeaders, id string, version string, stage string) (string, error) {
+	if id == constants.PREVIOUS_VALUES_KEY {
+		return "", constants.ErrKeyNotFound
+	}
+
 	secretName := utils.CreatePrefix(headers)
 	if headers.Flow == constants.PRIVATE_FLOW {
 		secretName = id
@@ -73,8 +92,11 @@ func GetSecret(headers dtos.CustomHeaders, id string, version string) (string, e
 	zap.L().Info("Getting Secret :: " + secretName)
 
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
-	svc, _ := getSecretManager(config, headers.ARN, headers.Region)
+	svc, _ := getSecretManager(config, headers.OrgId, headers.ARN, headers.Region)
 	input := getSecretInput(secretName, version)
+	if stage != "" && version == "" && headers.Flow == constants.PRIVATE_FLOW {
+		input.VersionStage = aws.String(stage)
+	}
 	getSecretValueResponse, err := svc.GetSecretValue(context.TODO(), &input)
 
 	if err != nil {
@@ -90,7 +112,18 @@ func GetSecret(headers dtos.CustomHeaders, id string, version string) (string, e
 		return "", err
 	}
 
+	// SHARED flow previous values are kept under a reserved key of the group
+	if stage == constants.PREVIOUS_STAGE && headers.Flow != constants.PRIVATE_FLOW {
+		secretData, _ = secretData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{})
+	}
+
 	if data, dataExists := secretData[id]; dataExists {
+		// SHARED flow values are only decrypted when they are read
+		if headers.Flow != constants.PRIVATE_FLOW {
+			if data, err = openSharedValue(secretName, id, data); err != nil {
+				return "", err
+			}
+		}
 		jsonData, err := json.Marshal(data)
 		if err != nil {
 			zap.L().Error("Failed to marshal secret data to JSON string: " + err.Error())
@@ -113,7 +146,7 @@ func GetSecretVersions(headers dtos.CustomHeaders, id string) ([]types.SecretVer
 	zap.L().Info("Getting Secret Versions :: " + secretName)
 
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
-	svc, _ := getSecretManager(config, headers.ARN, headers.Region)
+	svc, _ := getSecretManager(config, headers.OrgId, headers.ARN, headers.Region)
 	input := &secretsmanager.ListSecretVersionIdsInput{
 		SecretId: &secretName,
 	}
@@ -129,12 +162,17 @@ func GetSecretVersions(headers dtos.CustomHeaders, id string) ([]types.SecretVer
 
 // Create a new secret in the Shared/Private Secret Manager
 // ///////////////////////////////////////////////////////////
+// - secrets larger than the max secret size of the scope are rejected
 func CreateSecret(headers dtos.CustomHeaders, secret string) (string, error) {
+	if err := checkScopeSecretSize(headers, secret); err != nil {
+		return "", err
+	}
+
 	uuid := utils.GetPrefixedUuid()
 	secretName := utils.CreatePrefix(headers)
 	secretDescription := fmt.Sprintf("Organization ID: %s", headers.OrgId)
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
-	svc, _ := getSecretManager(config, headers.ARN, headers.Region)
+	svc, _ := getSecretManager(config, headers.OrgId, headers.ARN, headers.Region)
 	input := getSecretInput(secretName, "")
 
 	// creating secrets for the PRIVATE flow
@@ -151,14 +189,29 @@ func CreateSecret(headers dtos.CustomHeaders, secret string) (string, error) {
 			Name:         &secretName,
 			Description:  &secretDescription,
 			SecretString: aws.String(string(updatedSecretString)),
+			Tags:         getSecretGroupTags(utils.CreatePrefix(headers)),
+		}
+		// Secrets are encrypted with the customer managed key of the registration, if any
+		kmsKeyId, err := LookupSystemSecretKmsKey(headers)
+		if err != nil {
+			return "", err
+		}
+		if kmsKeyId != "" {
+			input.KmsKeyId = aws.String(kmsKeyId)
 		}
 
-		_, err = svc.CreateSecret(context.TODO(), input)
+		event, err := beginOutboxWrite(headers, constants.CREATED_EVENT, uuid, secretName, nil)
+		if err != nil {
+			return "", err
+		}
+		output, err := svc.CreateSecret(context.TODO(), input)
 
 		if err != nil {
+			abortOutboxWrite(event)
 			zap.L().Error("Creating Secret Failed :: " + err.Error())
 			return "", err
 		}
+		completeOutboxWrite(event, aws.ToString(output.VersionId))
 		return uuid, nil
 	}
 
@@ -197,7 +250,11 @@ func CreateSecret(headers dtos.CustomHeaders, secret string) (string, error) {
 		return "", err
 	}
 
-	secretData[uuid] = secret
+	sealedSecret, err := sealSharedValue(headers.OrgId, headers.ProjectId, secretName, uuid, secret)
+	if err != nil {
+		return "", err
+	}
+	secretData[uuid] = sealedSecret
 
 	// Marshalling the updated secretData
 	updatedSecretString, err := json.Marshal(secretData)
@@ -211,22 +268,33 @@ func CreateSecret(headers dtos.CustomHeaders, secret string) (string, error) {
 		SecretString: aws.String(string(updatedSecretString)),
 	}
 
-	_, err = svc.PutSecretValue(context.TODO(), putSecretInput)
+	event, err := beginOutboxWrite(headers, constants.CREATED_EVENT, uuid, secretName, nil)
+	if err != nil {
+		return "", err
+	}
+	putSecretOutput, err := svc.PutSecretValue(context.TODO(), putSecretInput)
 
 	if err != nil {
+		abortOutboxWrite(event)
 		zap.L().Error("PutSecretValue failed :: " + err.Error())
 		return "", err
 	}
+	completeOutboxWrite(event, aws.ToString(putSecretOutput.VersionId))
 
 	return uuid, nil
 }
 
 // Updates a secret in the Shared/Private Secret Manager
 // ///////////////////////////////////////////////////////
+// - secrets larger than the max secret size of the scope are rejected
 func UpdateSecret(headers dtos.CustomHeaders, id string, secret string) (string, error) {
+	if err := checkScopeSecretSize(headers, secret); err != nil {
+		return "", err
+	}
+
 	secretName := utils.CreatePrefix(headers)
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
-	svc, _ := getSecretManager(config, headers.ARN, headers.Region)
+	svc, _ := getSecretManager(config, headers.OrgId, headers.ARN, headers.Region)
 
 	// Updating secrets in the PRIVATE Flow
 	//----------------------------------------------------------------------------------------------
@@ -243,12 +311,18 @@ func UpdateSecret(headers dtos.CustomHeaders, id string, secret string) (string,
 			SecretId:     aws.String(secretName),
 			SecretString: aws.String(string(updatedSecretString)),
 		}
-		_, err = svc.UpdateSecret(context.TODO(), updateInput)
+		event, err := beginOutboxWrite(headers, constants.UPDATED_EVENT, id, secretName, nil)
+		if err != nil {
+			return "", err
+		}
+		output, err := svc.UpdateSecret(context.TODO(), updateInput)
 
 		if err != nil {
+			abortOutboxWrite(event)
 			zap.L().Error("UpdateSecret failed :: " + err.Error())
 			return "", err
 		}
+		completeOutboxWrite(event, aws.ToString(output.VersionId))
 		return id, nil
 
 	}
@@ -274,9 +348,13 @@ func UpdateSecret(headers dtos.CustomHeaders, id string, secret string) (string,
 	}
 
 	// Check if the specified ID (UUID) exists under the organization key
-	if _, idExists := secretData[id]; idExists {
+	if _, idExists := secretData[id]; idExists && id != constants.PREVIOUS_VALUES_KEY {
 		// Update the secret value associated with the specified ID
-		secretData[id] = secret
+		sealedSecret, err := sealSharedValue(headers.OrgId, headers.ProjectId, secretName, id, secret)
+		if err != nil {
+			return "", err
+		}
+		secretData[id] = sealedSecret
 		// Serialize the updated secret data back to JSON
 		updatedSecretString, err := json.Marshal(secretData)
 		if err != nil {
@@ -289,12 +367,18 @@ func UpdateSecret(headers dtos.CustomHeaders, id string, secret string) (string,
 			SecretId:     aws.String(secretName),
 			SecretString: aws.String(string(updatedSecretString)),
 		}
-		_, err = svc.UpdateSecret(context.TODO(), updateInput)
+		event, err := beginOutboxWrite(headers, constants.UPDATED_EVENT, id, secretName, nil)
+		if err != nil {
+			return "", err
+		}
+		output, err := svc.UpdateSecret(context.TODO(), updateInput)
 
 		if err != nil {
+			abortOutboxWrite(event)
 			zap.L().Error("UpdateSecret failed :: " + err.Error())
 			return "", err
 		}
+		completeOutboxWrite(event, aws.ToString(output.VersionId))
 		return id, nil
 	}
 
@@ -306,7 +390,7 @@ func UpdateSecret(headers dtos.CustomHeaders, id string, secret string) (string,
 func DeleteSecret(headers dtos.CustomHeaders, id string) (string, error) {
 	secretName := utils.CreatePrefix(headers)
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(headers.Region))
-	svc, _ := getSecretManager(config, headers.ARN, headers.Region)
+	svc, _ := getSecretManager(config, headers.OrgId, headers.ARN, headers.Region)
 	deleteAsap := true // Bypasses the recovery window
 
 	// Deleting secrets in the PRIVATE Flow
@@ -320,11 +404,18 @@ func DeleteSecret(headers dtos.CustomHeaders, id string) (string, error) {
 			ForceDeleteWithoutRecovery: &deleteAsap,
 		}
 
-		_, err := svc.DeleteSecret(context.TODO(), input)
+		event, err := beginOutboxWrite(headers, constants.DELETED_EVENT, id, secretName, nil)
+		if err != nil {
+			return "", err
+		}
+		_, err = svc.DeleteSecret(context.TODO(), input)
 		if err != nil {
+			abortOutboxWrite(event)
 			zap.L().Error("DeleteSecret failed :: " + err.Error())
 			return "", err
 		}
+		store.Default().Delete(rotationPolicyKey(utils.CreatePrefix(headers), id))
+		completeOutboxWrite(event, "")
 		return id, nil
 	}
 
@@ -348,9 +439,12 @@ func DeleteSecret(headers dtos.CustomHeaders, id string) (string, error) {
 	}
 
 	// Check if the specified ID exists under the organization
-	if _, idExists := secretData[id]; idExists {
-		// Delete the ID data
+	if _, idExists := secretData[id]; idExists && id != constants.PREVIOUS_VALUES_KEY {
+		// Delete the ID data along with its previous value
 		delete(secretData, id)
+		if previousValues, ok := secretData[constants.PREVIOUS_VALUES_KEY].(map[string]interface{}); ok {
+			delete(previousValues, id)
+		}
 		// Encode the updated data to JSON
 		updatedSecretString, err := json.Marshal(secretData)
 
@@ -364,12 +458,19 @@ func DeleteSecret(headers dtos.CustomHeaders, id string) (string, error) {
 			SecretId:     aws.String(secretName),
 			SecretString: aws.String(string(updatedSecretString)),
 		}
-		_, err = svc.PutSecretValue(context.TODO(), putSecretInput)
+		event, err := beginOutboxWrite(headers, constants.DELETED_EVENT, id, secretName, nil)
+		if err != nil {
+			return "", err
+		}
+		output, err := svc.PutSecretValue(context.TODO(), putSecretInput)
 
 		if err != nil {
+			abortOutboxWrite(event)
 			zap.L().Error("PutSecretValue failed :: " + err.Error())
 			return "", err
 		}
+		store.Default().Delete(rotationPolicyKey(secretName, id))
+		completeOutboxWrite(event, aws.ToString(output.VersionId))
 		return id, nil
 	}
 	return "", constants.ErrKeyNotFound
@@ -380,7 +481,7 @@ func DeleteSecret(headers dtos.CustomHeaders, id string) (string, error) {
 func DeleteSecretGroup(headers dtos.CustomHeaders, arn, region string) (string, error) {
 	secretName := utils.CreatePrefix(headers)
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
-	svc, _ := getSecretManager(config, arn, region)
+	svc, _ := getSecretManager(config, headers.OrgId, arn, region)
 	deleteAsap := true // Bypasses the recovery window
 	zap.L().Info("Deleting Secret Group :: " + secretName)
 
@@ -390,97 +491,21 @@ func DeleteSecretGroup(headers dtos.CustomHeaders, arn, region string) (string,
 		ForceDeleteWithoutRecovery: &deleteAsap,
 	}
 
-	_, err := svc.DeleteSecret(context.TODO(), input)
-
+	event, err := beginOutboxWrite(headers, constants.DELETED_EVENT, "", secretName, map[string]interface{}{
+		"group": secretName,
+	})
 	if err != nil {
-		zap.L().Error("DeleteSecret failed :: " + err.Error())
 		return "", err
 	}
+	_, err = svc.DeleteSecret(context.TODO(), input)
 
-	return secretName, nil
-}
-
-// Migrating secrets from Shared acc to Pvt acc
-// /////////////////////////////////////////////////
-func MigrateSecretsSharedToPvt(headers dtos.CustomHeaders, secretName string, prevMetaData map[string]interface{}, newArn string, newRegion string) ([]string, error) {
-	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(newRegion))
-	secretDescription := fmt.Sprintf("Organization ID: %s", headers.OrgId)
-	svc, _ := getSecretManager(config, newArn, newRegion)
-	var keys []string
-
-	// Get Prev Account Data
-	secretData, err := getPrevAccountSecrets(secretName, prevMetaData)
-	if err != nil {
-		zap.L().Info(fmt.Sprintf("%s :: Secrets Doesn't Exist", secretName) + err.Error())
-		return keys, nil
-	}
-
-	// Insert them to the PRIVATE account
-	for key, value := range secretData {
-		valueStringyfied, _ := utils.StringifyJson(value)
-		input := &secretsmanager.CreateSecretInput{
-			Name:         &key,
-			Description:  &secretDescription,
-			SecretString: aws.String(valueStringyfied),
-		}
-
-		_, err = svc.CreateSecret(context.TODO(), input)
-		if err != nil {
-			zap.L().Error("CreateSecret Failed" + err.Error())
-			return nil, err
-		}
-		keys = append(keys, key)
-	}
-
-	// Delete Prev Account Data
-	_, err = deletePrevAccountSecrets(secretName, prevMetaData)
 	if err != nil {
-		zap.L().Error("DeleteSecretGroup Failed" + err.Error())
-		return keys, err
-	}
-
-	return keys, nil
-}
-
-func getPrevAccountSecrets(secretName string, prevMetaData map[string]interface{}) (map[string]interface{}, error) {
-	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(prevMetaData[constants.REGION_META_DATA].(string)))
-	svc, _ := getSecretManager(config, prevMetaData[constants.ARN_META_DATA].(string), prevMetaData[constants.REGION_META_DATA].(string))
-	input := getSecretInput(secretName, "")
-	getSecretValueResponse, err := svc.GetSecretValue(context.TODO(), &input)
-	zap.L().Info("Getting Previous Account Secrets :: " + secretName)
-
-	if err != nil {
-		zap.L().Error(fmt.Sprintf("Failed to GetSecretValue :: %s :: ", secretName) + err.Error())
-		return nil, err
-	}
-
-	secretString := *getSecretValueResponse.SecretString
-	var secretData map[string]interface{}
-
-	if err := json.Unmarshal([]byte(secretString), &secretData); err != nil {
-		zap.L().Error("json unmarshalling failed :: " + err.Error())
-		return nil, err
-	}
-
-	return secretData, err
-}
-
-func deletePrevAccountSecrets(secretName string, prevMetaData map[string]interface{}) (string, error) {
-	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(prevMetaData[constants.REGION_META_DATA].(string)))
-	svc, _ := getSecretManager(config, prevMetaData[constants.ARN_META_DATA].(string), prevMetaData[constants.REGION_META_DATA].(string))
-	deleteAsap := true
-	zap.L().Info("Deleting Previous Account Secrets :: " + secretName)
-
-	input := &secretsmanager.DeleteSecretInput{
-		SecretId:                   aws.String(secretName),
-		ForceDeleteWithoutRecovery: &deleteAsap,
-	}
-
-	_, err := svc.DeleteSecret(context.TODO(), input)
-	if err != nil {
-		zap.L().Error(fmt.Sprintf("DeleteSecret failed :: %s :: ", secretName) + err.Error())
+		abortOutboxWrite(event)
+		zap.L().Error("DeleteSecret failed :: " + err.Error())
 		return "", err
 	}
+	deleteRotationPolicies(secretName)
+	completeOutboxWrite(event, "")
 
 	return secretName, nil
 }
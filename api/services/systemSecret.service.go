@@ -7,7 +7,9 @@ import (
 	"secret-svc/api/dtos"
 	"secret-svc/pkg/constants"
 	"secret-svc/pkg/utils"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -56,36 +58,47 @@ func GetSystemSecret(headers dtos.CustomHeaders, version string) (map[string]int
 
 // Creates a new System Secret in the System secret manager
 // ////////////////////////////////////////////////////////////
+// - every targeted scope gets its own flow settings, see getScopeRequests
+// - scopes missing from the request use the default flow of the scope registry
 func CreateSystemSecret(headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) ([]string, error) {
 	REGION := utils.GetEnvVar("REGION")
 	ARN := utils.GetEnvVar("SHARED_SECRET_MNGR_ARN")
 	secretDescription := fmt.Sprintf("Organization ID: %s", headers.OrgId)
-	secretNames := getSecretNames(headers)
-	zap.L().Info("Creating System Secrets :: " + strings.Join(secretNames, ","))
-
-	// Construct the desired JSON format
-	jsonData := map[string]interface{}{
-		constants.ARN_META_DATA:      utils.SetDefaultIfEmptyValue(requestBody.ARN, ARN),
-		constants.PROVIDER_META_DATA: utils.SetDefaultIfEmptyValue(requestBody.Provider, "AWS"),
-		constants.REGION_META_DATA:   utils.SetDefaultIfEmptyValue(requestBody.Region, REGION),
-		constants.FLOW_META_DATA:     requestBody.Flow,
-	}
-
-	// Serialize the jsonData to a JSON string
-	secretString, err := utils.StringifyJson(jsonData)
+	secretNames, scopeRequests, err := getScopeRequests(headers, applyScopeDefaultFlows(headers, requestBody))
 	if err != nil {
-		zap.L().Error("StringifyJson failed :: " + err.Error())
 		return nil, err
 	}
+	zap.L().Info("Creating System Secrets :: " + strings.Join(secretNames, ","))
 
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
 	svc := secretsmanager.NewFromConfig(config)
 
 	for _, secretName := range secretNames {
+		scopeReq := scopeRequests[secretName]
+
+		// Construct the desired JSON format
+		jsonData := map[string]interface{}{
+			constants.ARN_META_DATA:      utils.SetDefaultIfEmptyValue(scopeReq.ARN, ARN),
+			constants.PROVIDER_META_DATA: utils.SetDefaultIfEmptyValue(scopeReq.Provider, "AWS"),
+			constants.REGION_META_DATA:   utils.SetDefaultIfEmptyValue(scopeReq.Region, REGION),
+			constants.FLOW_META_DATA:     scopeReq.Flow,
+		}
+		if scopeReq.KmsKeyId != "" {
+			jsonData[constants.KMS_KEY_META_DATA] = scopeReq.KmsKeyId
+		}
+
+		// Serialize the jsonData to a JSON string
+		secretString, err := utils.StringifyJson(jsonData)
+		if err != nil {
+			zap.L().Error("StringifyJson failed :: " + err.Error())
+			return nil, err
+		}
+
 		createSecretInput := &secretsmanager.CreateSecretInput{
-			Name:         &secretName,
+			Name:         aws.String(secretName),
 			Description:  &secretDescription,
 			SecretString: &secretString,
+			Tags:         getSystemSecretTags(headers, secretName),
 		}
 
 		_, err = svc.CreateSecret(context.TODO(), createSecretInput)
@@ -93,135 +106,246 @@ func CreateSystemSecret(headers dtos.CustomHeaders, requestBody dtos.SystemSecre
 			zap.L().Error(fmt.Sprintf("CreateSecret failed :: %s :: ", secretName) + err.Error())
 			return nil, err
 		}
+		invalidateSystemSecret(secretName)
+		indexSystemSecret(headers, secretName, jsonData)
+		publishSystemSecretEvent(headers, constants.REGISTERED_EVENT, secretName, map[string]interface{}{
+			"flow": scopeReq.Flow,
+		})
 	}
 
 	return secretNames, nil
 }
 
-// Updates a system secret value in the system secret manager
-// //////////////////////////////////////////////////////////////
-func UpdateSystemSecret(headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) ([]string, error) {
-	REGION := utils.GetEnvVar("REGION")
-	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
-	svc := secretsmanager.NewFromConfig(config)
-	secretNames := getSecretNames(headers)
-	var newIDs []string
-	zap.L().Info("Updating System Secrets :: " + strings.Join(secretNames, ","))
+// Verifies the PRIVATE secret managers of a registration before it is saved
+// /////////////////////////////////////////////////////////////////////////////
+// - every ARN and region is verified once, whatever the number of scopes using it
+func VerifySystemSecretAccess(headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) ([]dtos.AccessVerification, error) {
+	secretNames, scopeRequests, err := getScopeRequests(headers, applyScopeDefaultFlows(headers, requestBody))
+	if err != nil {
+		return nil, err
+	}
 
+	verifications := []dtos.AccessVerification{}
+	targets := map[string]int{}
 	for _, secretName := range secretNames {
-		getSecretInput := &secretsmanager.GetSecretValueInput{
-			SecretId: &secretName,
+		scopeReq := scopeRequests[secretName]
+		if scopeReq.Flow != constants.PRIVATE_FLOW {
+			continue
 		}
-		getSecretValueOutput, err := svc.GetSecretValue(context.TODO(), getSecretInput)
 
-		if err != nil {
-			zap.L().Error(fmt.Sprintf("GetSecretValue %s Failed :: ", secretName) + err.Error())
-			return nil, err
+		target := scopeReq.ARN + "|" + scopeReq.Region + "|" + scopeReq.KmsKeyId
+		if _, ok := targets[target]; !ok {
+			zap.L().Info("Verifying PRIVATE Secret Manager :: " + scopeReq.ARN + " :: " + scopeReq.Region)
+			targets[target] = len(verifications)
+			verifications = append(verifications, VerifySecretManagerAccess(headers.OrgId, scopeReq.ARN, scopeReq.Region, scopeReq.KmsKeyId))
 		}
+		if scope := getSecretNameScope(headers, secretName); scope != "" {
+			verifications[targets[target]].Scopes = append(verifications[targets[target]].Scopes, scope)
+		}
+	}
 
-		var existingData map[string]interface{}
-		if err := json.Unmarshal([]byte(*getSecretValueOutput.SecretString), &existingData); err != nil {
-			zap.L().Error("Unmarshalling json Failed :: " + err.Error())
-			return nil, err
+	for _, verification := range verifications {
+		if !verification.Verified {
+			return verifications, constants.ErrPrivateAccessDenied
 		}
+	}
+	return verifications, nil
+}
 
-		switch {
-		// SHARED -> PRIVATE Migration
-		case requestBody.Flow == constants.PRIVATE_FLOW && existingData[constants.FLOW_META_DATA] == constants.SHARED_FLOW:
-			zap.L().Info(fmt.Sprintf("Mirgating %s from SHARED to PRIVATE", secretName))
-			ids, err := MigrateSecretsSharedToPvt(headers, secretName, existingData, requestBody.ARN, requestBody.Region)
-			if err != nil {
-				zap.L().Error(fmt.Sprintf("MigrateSecretsSharedToPvt Failed :: %s :: ", secretName) + err.Error())
-				return nil, err
+// Returns the redacted registrations of the headers key
+// /////////////////////////////////////////////////////////
+// - a project without a x-scope header returns every registered scope
+func GetSystemSecretRegistrations(headers dtos.CustomHeaders) ([]dtos.SystemSecretRegistration, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	registrations := []dtos.SystemSecretRegistration{}
+	for _, secretName := range getSecretNames(headers) {
+		registration, _, err := getSystemSecretRegistration(svc, headers, secretName, "")
+		if err != nil {
+			if strings.Contains(err.Error(), "ResourceNotFoundException") {
+				continue
 			}
-			newIDs = append(newIDs, ids...)
+			return nil, err
+		}
+		if registration.Flow == constants.PRIVATE_FLOW {
+			registration.Health = GetRegistrationHealth(secretName)
+		}
+		registrations = append(registrations, registration)
+	}
 
-			//Get values for ARN, region, and provider and store
-			existingData[constants.ARN_META_DATA] = requestBody.ARN
-			existingData[constants.REGION_META_DATA] = requestBody.Region
-			existingData[constants.PROVIDER_META_DATA] = requestBody.Provider
-			existingData[constants.FLOW_META_DATA] = requestBody.Flow
+	if len(registrations) == 0 {
+		return nil, constants.ErrUnregisteredKey
+	}
+	return registrations, nil
+}
 
-		default:
-			zap.L().Error(constants.ErrInvalidMigration.Error())
+// Returns the different versions of the system secrets of the headers key
+// ///////////////////////////////////////////////////////////////////////////
+func GetSystemSecretVersions(headers dtos.CustomHeaders) ([]dtos.SystemSecretVersions, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	secretVersions := []dtos.SystemSecretVersions{}
+	for _, secretName := range getSecretNames(headers) {
+		zap.L().Info("Getting System Secret versions :: " + secretName)
+		versions := dtos.SystemSecretVersions{
+			SecretName: secretName,
+			Scope:      getSecretNameScope(headers, secretName),
+			Versions:   []dtos.SystemSecretVersion{},
 		}
 
-		// Serialize the updated data to a JSON string
-		updatedSecretString, err := utils.StringifyJson(existingData)
+		paginator := secretsmanager.NewListSecretVersionIdsPaginator(svc, &secretsmanager.ListSecretVersionIdsInput{
+			SecretId:          aws.String(secretName),
+			IncludeDeprecated: aws.Bool(true),
+		})
+		registered := true
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				if strings.Contains(err.Error(), "ResourceNotFoundException") {
+					registered = false
+					break
+				}
+				zap.L().Error(fmt.Sprintf("ListSecretVersionIds Failed :: %s :: ", secretName) + err.Error())
+				return nil, err
+			}
 
-		if err != nil {
-			zap.L().Error("StringifyJson Failed :: " + err.Error())
-			return nil, err
+			for _, version := range page.Versions {
+				versions.Versions = append(versions.Versions, dtos.SystemSecretVersion{
+					VersionId: aws.ToString(version.VersionId),
+					Stages:    version.VersionStages,
+					CreatedAt: version.CreatedDate,
+				})
+			}
 		}
 
-		// Update the existing secret
-		input := &secretsmanager.UpdateSecretInput{
-			SecretId:     &secretName,
-			SecretString: aws.String(string(updatedSecretString)),
+		if registered {
+			sort.Slice(versions.Versions, func(i, j int) bool {
+				return versionCreatedAt(versions.Versions[i]).After(versionCreatedAt(versions.Versions[j]))
+			})
+			secretVersions = append(secretVersions, versions)
 		}
+	}
 
-		_, err = svc.UpdateSecret(context.TODO(), input)
-		if err != nil {
-			zap.L().Error(fmt.Sprintf("UpdateSecret %s Failed :: ", secretName) + err.Error())
-			return nil, err
-		}
+	if len(secretVersions) == 0 {
+		return nil, constants.ErrUnregisteredKey
 	}
+	return secretVersions, nil
+}
 
-	return newIDs, nil
+// Returns a previous registration of the headers key
+// //////////////////////////////////////////////////////
+// - the version is searched in every targeted scope
+func GetSystemSecretVersion(headers dtos.CustomHeaders, versionId string) (dtos.SystemSecretRegistration, error) {
+	REGION := utils.GetEnvVar("REGION")
+	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+	svc := secretsmanager.NewFromConfig(config)
+
+	registration, _, err := findSystemSecretVersion(svc, headers, versionId)
+	return registration, err
 }
 
-// Returns the different versions of a secret
-// ///////////////////////////////////////////////
-func GetSystemSecretVersions(headers dtos.CustomHeaders) (secretsmanager.ListSecretVersionIdsOutput, error) {
+// Compares a previous registration of the headers key with another version
+// ////////////////////////////////////////////////////////////////////////////
+// - compares with the current registration when no other version is given
+func DiffSystemSecretVersions(headers dtos.CustomHeaders, versionId string, againstVersionId string) (dtos.SystemSecretDiff, error) {
 	REGION := utils.GetEnvVar("REGION")
-	secretName := utils.CreatePrefix(headers)
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
 	svc := secretsmanager.NewFromConfig(config)
-	input := &secretsmanager.ListSecretVersionIdsInput{
-		SecretId: &secretName,
-	}
 
-	zap.L().Info("Getting System Secret versions :: " + secretName)
-	result, err := svc.ListSecretVersionIds(context.TODO(), input)
+	from, fromMetadata, err := findSystemSecretVersion(svc, headers, versionId)
+	if err != nil {
+		return dtos.SystemSecretDiff{}, err
+	}
 
+	to, toMetadata, err := getSystemSecretRegistration(svc, headers, from.SecretName, againstVersionId)
 	if err != nil {
-		zap.L().Error(fmt.Sprintf("ListSecretVersionIds Failed :: %s :: ", secretName) + err.Error())
-		return secretsmanager.ListSecretVersionIdsOutput{}, err
+		if isVersionNotFound(err) {
+			return dtos.SystemSecretDiff{}, constants.ErrSystemSecretVersionNotFound
+		}
+		return dtos.SystemSecretDiff{}, err
+	}
+
+	return dtos.SystemSecretDiff{
+		SecretName: from.SecretName,
+		Scope:      from.Scope,
+		From:       from,
+		To:         to,
+		Changes:    DiffSystemSecretMetadata(fromMetadata, toMetadata),
+	}, nil
+}
+
+// Returns the flow attributes changed between two versions of a system secret
+// ///////////////////////////////////////////////////////////////////////////////
+// - values are redacted like the registrations, changes hidden by the redaction are still listed
+func DiffSystemSecretMetadata(fromMetadata map[string]interface{}, toMetadata map[string]interface{}) []dtos.SystemSecretChange {
+	from := dtos.CreateNewSystemSecretRegistration("", "", fromMetadata)
+	to := dtos.CreateNewSystemSecretRegistration("", "", toMetadata)
+	fields := []struct {
+		name string
+		key  string
+		from string
+		to   string
+	}{
+		{"flow", constants.FLOW_META_DATA, from.Flow, to.Flow},
+		{"arn", constants.ARN_META_DATA, from.ARN, to.ARN},
+		{"region", constants.REGION_META_DATA, from.Region, to.Region},
+		{"provider", constants.PROVIDER_META_DATA, from.Provider, to.Provider},
+		{"kmsKeyId", constants.KMS_KEY_META_DATA, from.KmsKeyId, to.KmsKeyId},
 	}
 
-	return *result, nil
+	changes := []dtos.SystemSecretChange{}
+	for _, field := range fields {
+		if fmt.Sprint(fromMetadata[field.key]) != fmt.Sprint(toMetadata[field.key]) {
+			changes = append(changes, dtos.SystemSecretChange{Field: field.name, From: field.from, To: field.to})
+		}
+	}
+
+	return changes
 }
 
 // Deletes a key from the System Secret Manager which may be sub projects and Scope(keys/values)
 // //////////////////////////////////////////////////////////////////////////////////////////////////
-func DeleteSystemSecret(headers dtos.CustomHeaders) ([]string, error) {
+// - every scope is handled on it's own, unregistered scopes are skipped
+// - only SHARED scopes have their secret group removed, PRIVATE secrets stay in the customer account
+func DeleteSystemSecret(ctx context.Context, headers dtos.CustomHeaders) ([]string, error) {
 	region := utils.GetEnvVar("REGION")
 	config, _ := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
 	svc := secretsmanager.NewFromConfig(config)
 	secretNames := getSecretNames(headers)
 	deleteAsap := true
+	var deletedNames []string
 	zap.L().Info("Deleting System Secrets :: " + strings.Join(secretNames, ","))
 
-	for _, secretName := range secretNames {
-		getSecretInput := &secretsmanager.GetSecretValueInput{
-			SecretId: &secretName,
+	for i, secretName := range secretNames {
+		if ctx.Err() != nil {
+			return deletedNames, constants.ErrJobCancelled
 		}
-		getSecretValueOutput, err := svc.GetSecretValue(context.TODO(), getSecretInput)
+		reportJobProgress(ctx, i, len(secretNames), "deleting "+secretName)
 
+		existingData, err := getSystemSecretData(svc, secretName)
 		if err != nil {
-			zap.L().Error(fmt.Sprintf("GetSecretValue Failed :: %s :: ", secretName) + err.Error())
+			if strings.Contains(err.Error(), "ResourceNotFoundException") {
+				zap.L().Info("Skipping unregistered System Secret :: " + secretName)
+				continue
+			}
 			return nil, err
 		}
 
-		var existingData map[string]interface{}
-		if err := json.Unmarshal([]byte(*getSecretValueOutput.SecretString), &existingData); err != nil {
-			zap.L().Error("Unmarshalling json Failed :: " + err.Error())
-			return nil, err
+		if existingData[constants.FLOW_META_DATA] == constants.SHARED_FLOW {
+			zap.L().Info("Deleting Sub-sequent Secrets from the shared secret manager :: " + secretName)
+			scopeHeaders := headers
+			scopeHeaders.Scope = getSecretNameScope(headers, secretName)
+			arn, _ := existingData[constants.ARN_META_DATA].(string)
+			storedRegion, _ := existingData[constants.REGION_META_DATA].(string)
+			if _, err := DeleteSecretGroup(scopeHeaders, arn, storedRegion); err != nil && !strings.Contains(err.Error(), "ResourceNotFoundException") {
+				return nil, err
+			}
 		}
 
-		zap.L().Info("Deleting Sub-sequent Secrets from the shared secret manager :: " + secretName)
-		DeleteSecretGroup(headers, existingData[constants.ARN_META_DATA].(string), existingData[constants.REGION_META_DATA].(string))
-
 		input := &secretsmanager.DeleteSecretInput{
 			SecretId:                   aws.String(secretName),
 			ForceDeleteWithoutRecovery: &deleteAsap,
@@ -232,17 +356,102 @@ func DeleteSystemSecret(headers dtos.CustomHeaders) ([]string, error) {
 			zap.L().Error("DeleteSecret Failed :: " + err.Error())
 			return nil, err
 		}
+		invalidateSystemSecret(secretName)
+		unindexSystemSecret(secretName)
+		publishSystemSecretEvent(headers, constants.DEREGISTERED_EVENT, secretName, map[string]interface{}{})
+		deletedNames = append(deletedNames, secretName)
 	}
 
-	return secretNames, nil
+	if len(deletedNames) == 0 {
+		return nil, constants.ErrUnregisteredKey
+	}
+
+	return deletedNames, nil
+}
+
+// Helper function to read the metadata of a system secret
+// ///////////////////////////////////////////////////////////
+func getSystemSecretData(svc *secretsmanager.Client, secretName string) (map[string]interface{}, error) {
+	getSecretValueOutput, err := svc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+		SecretId: &secretName,
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("GetSecretValue %s Failed :: ", secretName) + err.Error())
+		return nil, err
+	}
+
+	var existingData map[string]interface{}
+	if err := json.Unmarshal([]byte(*getSecretValueOutput.SecretString), &existingData); err != nil {
+		zap.L().Error("Unmarshalling json Failed :: " + err.Error())
+		return nil, err
+	}
+
+	return existingData, nil
+}
+
+// Helper function to read a redacted registration of a system secret
+// ///////////////////////////////////////////////////////////////////////
+// - reads the current version when no version is given
+func getSystemSecretRegistration(svc *secretsmanager.Client, headers dtos.CustomHeaders, secretName string, versionId string) (dtos.SystemSecretRegistration, map[string]interface{}, error) {
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretName)}
+	if versionId != "" {
+		input.VersionId = aws.String(versionId)
+	}
+
+	output, err := svc.GetSecretValue(context.TODO(), input)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("GetSecretValue %s Failed :: ", secretName) + err.Error())
+		return dtos.SystemSecretRegistration{}, nil, err
+	}
+
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(aws.ToString(output.SecretString)), &metadata); err != nil {
+		zap.L().Error("Unmarshalling json Failed :: " + err.Error())
+		return dtos.SystemSecretRegistration{}, nil, err
+	}
+
+	registration := dtos.CreateNewSystemSecretRegistration(secretName, getSecretNameScope(headers, secretName), metadata)
+	registration.VersionId = aws.ToString(output.VersionId)
+	registration.Stages = output.VersionStages
+	registration.CreatedAt = output.CreatedDate
+
+	return registration, metadata, nil
+}
+
+// Helper function to find a version in the targeted system secrets
+func findSystemSecretVersion(svc *secretsmanager.Client, headers dtos.CustomHeaders, versionId string) (dtos.SystemSecretRegistration, map[string]interface{}, error) {
+	for _, secretName := range getSecretNames(headers) {
+		registration, metadata, err := getSystemSecretRegistration(svc, headers, secretName, versionId)
+		if err == nil {
+			return registration, metadata, nil
+		}
+		if !isVersionNotFound(err) {
+			return dtos.SystemSecretRegistration{}, nil, err
+		}
+	}
+
+	return dtos.SystemSecretRegistration{}, nil, constants.ErrSystemSecretVersionNotFound
+}
+
+// Unknown or malformed version IDs are both reported as missing versions
+func isVersionNotFound(err error) bool {
+	return strings.Contains(err.Error(), "ResourceNotFoundException") || strings.Contains(err.Error(), "ValidationException")
+}
+
+func versionCreatedAt(version dtos.SystemSecretVersion) time.Time {
+	if version.CreatedAt == nil {
+		return time.Time{}
+	}
+	return *version.CreatedAt
 }
 
 // Helper function to get secretNames with scopes
 // ///////////////////////////////////////////////////
+// - a project without a x-scope header targets every scope registered for the organization
 func getSecretNames(headers dtos.CustomHeaders) []string {
 	var secretNames []string
-	if headers.ProjectId != "" {
-		for _, scope := range constants.ACCEPTED_SCOPES {
+	if headers.ProjectId != "" && headers.Scope == "" {
+		for _, scope := range GetScopeNames(headers.OrgId) {
 			headers.Scope = scope
 			secretNames = append(secretNames, utils.CreatePrefix(headers))
 		}
@@ -251,3 +460,70 @@ func getSecretNames(headers dtos.CustomHeaders) []string {
 	}
 	return secretNames
 }
+
+// Helper function to get the flow settings of every targeted scope
+// ////////////////////////////////////////////////////////////////////
+// - a scope in the 'scopes' map overrides the top-level flow
+// - scopes without any flow settings are left out
+func getScopeRequests(headers dtos.CustomHeaders, requestBody dtos.SystemSecretReq) ([]string, map[string]dtos.SystemSecretReq, error) {
+	if len(requestBody.Scopes) > 0 && headers.ProjectId == "" {
+		return nil, nil, constants.ErrEmptyProjId
+	}
+	for scope := range requestBody.Scopes {
+		if !IsScopeRegistered(headers.OrgId, scope) {
+			return nil, nil, constants.ErrInvalidScope
+		}
+		if headers.Scope != "" && scope != headers.Scope {
+			return nil, nil, constants.ErrUntargetedScope
+		}
+	}
+
+	var secretNames []string
+	scopeRequests := make(map[string]dtos.SystemSecretReq)
+	for _, secretName := range getSecretNames(headers) {
+		scopeReq := getScopeRequest(requestBody, getSecretNameScope(headers, secretName))
+		if scopeReq.Flow == "" {
+			continue
+		}
+
+		secretNames = append(secretNames, secretName)
+		scopeRequests[secretName] = scopeReq
+	}
+
+	if len(secretNames) == 0 {
+		return nil, nil, constants.ErrMissingFlowAttr
+	}
+
+	return secretNames, scopeRequests, nil
+}
+
+// Helper function to get the flow settings of a single scope
+// ///////////////////////////////////////////////////////////////
+func getScopeRequest(requestBody dtos.SystemSecretReq, scope string) dtos.SystemSecretReq {
+	if scopeReq, ok := requestBody.Scopes[scope]; ok {
+		return scopeReq
+	}
+
+	requestBody.Scopes = nil
+	return requestBody
+}
+
+// Helper function to get the scope of a system secret name
+// /////////////////////////////////////////////////////////////
+func getSecretNameScope(headers dtos.CustomHeaders, secretName string) string {
+	if headers.ProjectId == "" {
+		return ""
+	}
+	headers.Scope = ""
+	return strings.TrimPrefix(secretName, utils.CreatePrefix(headers)+"_")
+}
+
+// Helper function to publish an event for a system secret group
+// //////////////////////////////////////////////////////////////////
+// - the scope is taken from the system secret name
+func publishSystemSecretEvent(headers dtos.CustomHeaders, eventType string, secretName string, metadata map[string]interface{}) {
+	headers.Scope = getSecretNameScope(headers, secretName)
+
+	metadata["group"] = secretName
+	publishSecretEvent(headers, eventType, "", "", metadata)
+}
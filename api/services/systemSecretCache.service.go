@@ -0,0 +1,285 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var SYSTEM_SECRET_CACHE_WATCH_BUFFER = 256
+
+// Registry entry of a system secret, never holds secret values
+type systemSecretEntry struct {
+	ARN        string `json:"arn"`
+	Region     string `json:"region"`
+	Provider   string `json:"provider"`
+	Flow       string `json:"flow"`
+	KmsKeyId   string `json:"kmsKeyId,omitempty"`
+	Registered bool   `json:"registered"`
+}
+
+// Entry kept in the store for the other replicas, only served under the generation it was read in
+type sharedSystemSecret struct {
+	Generation string            `json:"generation"`
+	Entry      systemSecretEntry `json:"entry"`
+}
+
+type cachedSystemSecret struct {
+	entry     systemSecretEntry
+	expiresAt time.Time
+}
+
+// In-process cache of system secret registry entries, keyed by CreatePrefix
+// - generations keep lookups started before an invalidation from caching stale entries
+// - the epoch is bumped when the whole cache is dropped
+var systemSecretCache = struct {
+	sync.Mutex
+	ttl         time.Duration
+	shared      bool
+	epoch       uint64
+	entries     map[string]cachedSystemSecret
+	generations map[string]uint64
+	stats       dtos.SystemSecretCacheStats
+}{
+	entries:     map[string]cachedSystemSecret{},
+	generations: map[string]uint64{},
+}
+
+var startSystemSecretCacheOnce sync.Once
+
+func systemSecretCacheKey(secretName string) string {
+	return "registry:cache:" + secretName
+}
+
+// Shared generation of a system secret, replaced by the replica changing it
+func systemSecretGenerationKey(secretName string) string {
+	return "registry:generation:" + secretName
+}
+
+// Starts caching system secret registry lookups
+// /////////////////////////////////////////////////
+// - shared entries are also kept in the store (Redis) for the other replicas
+// - changes to system secrets invalidate the entries of every replica through the event broker
+func StartSystemSecretCache(ttl time.Duration, shared bool) {
+	systemSecretCache.Lock()
+	systemSecretCache.ttl = ttl
+	systemSecretCache.shared = shared
+	systemSecretCache.Unlock()
+	zap.L().Info("Starting System Secret Cache :: ttl " + ttl.String())
+
+	startSystemSecretCacheOnce.Do(func() {
+		go watchSystemSecretChanges()
+	})
+}
+
+// Looks up the flow, ARN, region and provider of the headers key
+// ///////////////////////////////////////////////////////////////////
+// - served from the cache when enabled, specific versions are always read from AWS
+func LookupSystemSecret(headers dtos.CustomHeaders, version string) (string, string, string, string, error) {
+	entry, err := lookupSystemSecretEntry(headers, version)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	return getSystemSecretEntry(entry)
+}
+
+// Looks up the KMS key of the PRIVATE secrets of the headers key, empty for the default key
+// /////////////////////////////////////////////////////////////////////////////////////////////
+func LookupSystemSecretKmsKey(headers dtos.CustomHeaders) (string, error) {
+	entry, err := lookupSystemSecretEntry(headers, "")
+	if err != nil {
+		return "", err
+	}
+	if !entry.Registered {
+		return "", constants.ErrUnregisteredKey
+	}
+	return entry.KmsKeyId, nil
+}
+
+// Helper function to look up the registry entry of the headers key, from the cache when enabled
+func lookupSystemSecretEntry(headers dtos.CustomHeaders, version string) (systemSecretEntry, error) {
+	secretName := utils.CreatePrefix(headers)
+
+	systemSecretCache.Lock()
+	enabled := systemSecretCache.ttl > 0 && version == ""
+	cached, found := systemSecretCache.entries[secretName]
+	generation := getSystemSecretGeneration(secretName)
+	if enabled && found && time.Now().Before(cached.expiresAt) {
+		systemSecretCache.stats.Hits++
+		systemSecretCache.Unlock()
+		return cached.entry, nil
+	}
+	if enabled {
+		systemSecretCache.stats.Misses++
+	}
+	shared := systemSecretCache.shared
+	systemSecretCache.Unlock()
+
+	if !enabled {
+		systemSecret, arn, region, provider, flow, err := GetSystemSecret(headers, version)
+		if err != nil {
+			return systemSecretEntry{}, err
+		}
+		return newSystemSecretEntry(systemSecret, arn, region, provider, flow, true), nil
+	}
+
+	// Shared entries written by a lookup which started before a change don't match the new generation
+	var sharedGeneration string
+	if shared {
+		var sharedEntry sharedSystemSecret
+		var err error
+		if sharedGeneration, err = getSharedSystemSecretGeneration(secretName); err != nil {
+			zap.L().Error("Reading Shared System Secret Generation Failed :: " + secretName + " :: " + err.Error())
+			shared = false
+		} else if store.GetJSON(systemSecretCacheKey(secretName), &sharedEntry) == nil && sharedEntry.Generation == sharedGeneration {
+			systemSecretCache.Lock()
+			systemSecretCache.stats.SharedHits++
+			systemSecretCache.Unlock()
+			cacheSystemSecret(secretName, sharedEntry.Entry, generation, sharedGeneration, false)
+			return sharedEntry.Entry, nil
+		}
+	}
+
+	systemSecret, arn, region, provider, flow, err := GetSystemSecret(headers, "")
+	if err != nil && err != constants.ErrUnregisteredKey {
+		return systemSecretEntry{}, err
+	}
+
+	// Unregistered keys are cached too, registering them invalidates the entry
+	entry := newSystemSecretEntry(systemSecret, arn, region, provider, flow, err == nil)
+	cacheSystemSecret(secretName, entry, generation, sharedGeneration, shared)
+
+	return entry, nil
+}
+
+func newSystemSecretEntry(systemSecret map[string]interface{}, arn, region, provider, flow string, registered bool) systemSecretEntry {
+	kmsKeyId, _ := systemSecret[constants.KMS_KEY_META_DATA].(string)
+	return systemSecretEntry{ARN: arn, Region: region, Provider: provider, Flow: flow, KmsKeyId: kmsKeyId, Registered: registered}
+}
+
+// Returns the cache statistics of this replica
+// ////////////////////////////////////////////////
+func GetSystemSecretCacheStats() dtos.SystemSecretCacheStats {
+	systemSecretCache.Lock()
+	defer systemSecretCache.Unlock()
+
+	stats := systemSecretCache.stats
+	stats.Enabled = systemSecretCache.ttl > 0
+	stats.Shared = systemSecretCache.shared
+	stats.Ttl = systemSecretCache.ttl.String()
+	stats.Entries = len(systemSecretCache.entries)
+	// Shared hits are misses of the in-process cache
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits+stats.SharedHits) / float64(lookups)
+	}
+
+	return stats
+}
+
+// Helper function to drop the cached entry of a system secret
+// ///////////////////////////////////////////////////////////////
+// - called by the replica changing the system secret, the others are notified by its event
+// - the shared generation is replaced first, entries read before the change can't be shared anymore
+func invalidateSystemSecret(secretName string) {
+	dropSystemSecret(secretName)
+
+	systemSecretCache.Lock()
+	shared := systemSecretCache.shared
+	systemSecretCache.Unlock()
+
+	if shared {
+		if err := store.Default().Set(systemSecretGenerationKey(secretName), uuid.NewString(), 0); err != nil {
+			zap.L().Error("Replacing Shared System Secret Generation Failed :: " + secretName + " :: " + err.Error())
+		}
+		if err := store.Default().Delete(systemSecretCacheKey(secretName)); err != nil && err != constants.ErrRecordNotFound {
+			zap.L().Error("Invalidating Shared System Secret Failed :: " + secretName + " :: " + err.Error())
+		}
+	}
+}
+
+// Helper function to keep a looked up entry, unless it was invalidated meanwhile
+// - shared entries are written with the shared generation read before the lookup
+func cacheSystemSecret(secretName string, entry systemSecretEntry, generation uint64, sharedGeneration string, share bool) {
+	systemSecretCache.Lock()
+	defer systemSecretCache.Unlock()
+
+	if getSystemSecretGeneration(secretName) != generation {
+		return
+	}
+	systemSecretCache.entries[secretName] = cachedSystemSecret{
+		entry:     entry,
+		expiresAt: time.Now().Add(systemSecretCache.ttl),
+	}
+
+	if share {
+		if err := store.SetJSON(systemSecretCacheKey(secretName), sharedSystemSecret{Generation: sharedGeneration, Entry: entry}, systemSecretCache.ttl); err != nil {
+			zap.L().Error("Sharing System Secret Failed :: " + secretName + " :: " + err.Error())
+		}
+	}
+}
+
+// Helper function to invalidate the entries changed on any replica
+// ////////////////////////////////////////////////////////////////////
+// - a watcher which fell behind may have missed changes, so the whole cache is dropped
+func watchSystemSecretChanges() {
+	for {
+		changes, stop := events.Watch(SYSTEM_SECRET_CACHE_WATCH_BUFFER)
+		clearSystemSecretCache()
+
+		for event := range changes {
+			if event.Type != constants.REGISTERED_EVENT && event.Type != constants.DEREGISTERED_EVENT && event.Type != constants.MIGRATED_EVENT {
+				continue
+			}
+			if secretName, ok := event.Metadata["group"].(string); ok {
+				dropSystemSecret(secretName)
+			}
+		}
+		stop()
+	}
+}
+
+func dropSystemSecret(secretName string) {
+	systemSecretCache.Lock()
+	defer systemSecretCache.Unlock()
+
+	delete(systemSecretCache.entries, secretName)
+	systemSecretCache.generations[secretName]++
+	systemSecretCache.stats.Invalidations++
+}
+
+func clearSystemSecretCache() {
+	systemSecretCache.Lock()
+	defer systemSecretCache.Unlock()
+
+	systemSecretCache.epoch++
+	systemSecretCache.entries = map[string]cachedSystemSecret{}
+}
+
+// Both counters only grow, so their sum changes with any invalidation
+func getSystemSecretGeneration(secretName string) uint64 {
+	return systemSecretCache.generations[secretName] + systemSecretCache.epoch
+}
+
+// Returns the shared generation of a system secret, empty until it's first changed
+func getSharedSystemSecretGeneration(secretName string) (string, error) {
+	generation, err := store.Default().Get(systemSecretGenerationKey(secretName))
+	if err == constants.ErrRecordNotFound {
+		return "", nil
+	}
+	return generation, err
+}
+
+func getSystemSecretEntry(entry systemSecretEntry) (string, string, string, string, error) {
+	if !entry.Registered {
+		return "", "", "", "", constants.ErrUnregisteredKey
+	}
+	return entry.ARN, entry.Region, entry.Provider, entry.Flow, nil
+}
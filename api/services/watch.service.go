@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/json"
+	"sync"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"go.uber.org/zap"
+)
+
+var WATCH_HISTORY_LIMIT = 1000
+var startSecretWatchOnce sync.Once
+
+func watchLogKey(orgId string) string {
+	return "watch:log:" + orgId
+}
+
+// Starts recording events so watchers can resume from their last event ID
+// //////////////////////////////////////////////////////////////////////////
+func StartSecretWatch() {
+	startSecretWatchOnce.Do(func() {
+		events.Subscribe(recordWatchEvent)
+	})
+}
+
+// Helper function to keep the latest events of every organization
+// ///////////////////////////////////////////////////////////////////
+func recordWatchEvent(event events.Event) {
+	key := watchLogKey(event.OrgId)
+	if err := store.AppendJSON(key, event); err != nil {
+		zap.L().Error("Recording Watch Event Failed :: " + err.Error())
+		return
+	}
+
+	store.Default().Trim(key, -WATCH_HISTORY_LIMIT, -1)
+}
+
+// Returns the events published after the last seen event
+// /////////////////////////////////////////////////////////
+// - found is false when the last event ID is no longer retained
+func GetMissedSecretEvents(headers dtos.CustomHeaders, ids []string, lastEventId string) ([]events.Event, bool, error) {
+	entries, err := store.Default().List(watchLogKey(headers.OrgId), 0, -1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	found := false
+	missed := []events.Event{}
+	for _, entry := range entries {
+		var event events.Event
+		if err := json.Unmarshal([]byte(entry), &event); err != nil {
+			continue
+		}
+
+		if !found {
+			found = event.Id == lastEventId
+			continue
+		}
+		if SecretEventMatches(headers, ids, event) {
+			missed = append(missed, event)
+		}
+	}
+
+	return missed, found, nil
+}
+
+// Checks if an event belongs to the headers key and the watched secret IDs
+// ///////////////////////////////////////////////////////////////////////////
+// - events without a secret ID (group deletions, migrations) match every watcher
+func SecretEventMatches(headers dtos.CustomHeaders, ids []string, event events.Event) bool {
+	if event.OrgId != headers.OrgId || event.ProjectId != headers.ProjectId || event.Scope != headers.Scope {
+		return false
+	}
+
+	return len(ids) == 0 || event.SecretId == "" || utils.ArrayContains(ids, event.SecretId)
+}
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/generators"
+	"secret-svc/pkg/store"
+	"secret-svc/pkg/utils"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var WEBHOOK_MAX_ATTEMPTS = 8
+var WEBHOOK_BASE_DELAY = 10 * time.Second
+var WEBHOOK_MAX_DELAY = time.Hour
+var WEBHOOK_LOCK_TTL = time.Minute
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+var WEBHOOK_ID_HEADER = "X-Webhook-Id"
+var WEBHOOK_DELIVERY_HEADER = "X-Webhook-Delivery"
+var WEBHOOK_EVENT_HEADER = "X-Webhook-Event"
+var WEBHOOK_TIMESTAMP_HEADER = "X-Webhook-Timestamp"
+var WEBHOOK_SIGNATURE_HEADER = "X-Webhook-Signature"
+
+func webhookKey(id string) string {
+	return "webhook:endpoint:" + id
+}
+
+func webhookSecretKey(id string) string {
+	return "webhook:secret:" + id
+}
+
+func webhookDeliveryKey(id string) string {
+	return "webhook:delivery:" + id
+}
+
+func webhookDeadLetterKey(id string) string {
+	return "webhook:deadletter:" + id
+}
+
+func webhookLockKey(id string) string {
+	return "webhook:lock:" + id
+}
+
+// Registers a new webhook endpoint for the headers key
+// ///////////////////////////////////////////////////////
+// - the signing secret is only returned once
+func CreateWebhook(headers dtos.CustomHeaders, requestBody dtos.WebhookReq) (dtos.Webhook, error) {
+	id, _ := uuid.NewRandom()
+	now := time.Now().UTC()
+	webhook := dtos.Webhook{
+		Id:          "wh_" + id.String(),
+		OrgId:       headers.OrgId,
+		ProjectId:   headers.ProjectId,
+		Scope:       headers.Scope,
+		Url:         requestBody.Url,
+		Events:      requestBody.Events,
+		Description: requestBody.Description,
+		Active:      requestBody.Active == nil || *requestBody.Active,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if len(webhook.Events) == 0 {
+		webhook.Events = constants.ACCEPTED_EVENTS[:]
+	}
+	zap.L().Info("Creating Webhook :: " + webhook.Id + " :: " + utils.CreatePrefix(headers))
+
+	signingSecret, err := generators.RandomBytes(32, constants.HEX_ENCODING)
+	if err != nil {
+		return dtos.Webhook{}, err
+	}
+
+	if err := store.Default().Set(webhookSecretKey(webhook.Id), "whsec_"+signingSecret, 0); err != nil {
+		zap.L().Error("Saving Webhook Secret Failed :: " + err.Error())
+		return dtos.Webhook{}, err
+	}
+	if err := store.SetJSON(webhookKey(webhook.Id), webhook, 0); err != nil {
+		zap.L().Error("Saving Webhook Failed :: " + err.Error())
+		return dtos.Webhook{}, err
+	}
+
+	webhook.SigningSecret = "whsec_" + signingSecret
+	return webhook, nil
+}
+
+// Returns the webhooks registered for the headers key
+// //////////////////////////////////////////////////////
+func ListWebhooks(headers dtos.CustomHeaders) ([]dtos.Webhook, error) {
+	webhooks, err := getAllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	owned := []dtos.Webhook{}
+	for _, webhook := range webhooks {
+		if isWebhookOwner(headers, webhook.OrgId, webhook.ProjectId, webhook.Scope) {
+			owned = append(owned, webhook)
+		}
+	}
+
+	return owned, nil
+}
+
+// Returns a webhook registered for the headers key
+// ////////////////////////////////////////////////////
+func GetWebhook(headers dtos.CustomHeaders, id string) (dtos.Webhook, error) {
+	var webhook dtos.Webhook
+	if err := store.GetJSON(webhookKey(id), &webhook); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.Webhook{}, constants.ErrWebhookNotFound
+		}
+		return dtos.Webhook{}, err
+	}
+
+	if !isWebhookOwner(headers, webhook.OrgId, webhook.ProjectId, webhook.Scope) {
+		return dtos.Webhook{}, constants.ErrWebhookNotFound
+	}
+
+	return webhook, nil
+}
+
+// Updates the url, events, description or state of a webhook
+// //////////////////////////////////////////////////////////////
+func UpdateWebhook(headers dtos.CustomHeaders, id string, requestBody dtos.WebhookReq) (dtos.Webhook, error) {
+	webhook, err := GetWebhook(headers, id)
+	if err != nil {
+		return dtos.Webhook{}, err
+	}
+
+	if requestBody.Url != "" {
+		webhook.Url = requestBody.Url
+	}
+	if len(requestBody.Events) > 0 {
+		webhook.Events = requestBody.Events
+	}
+	if requestBody.Description != "" {
+		webhook.Description = requestBody.Description
+	}
+	if requestBody.Active != nil {
+		webhook.Active = *requestBody.Active
+	}
+	webhook.UpdatedAt = time.Now().UTC()
+
+	zap.L().Info("Updating Webhook :: " + webhook.Id)
+	if err := store.SetJSON(webhookKey(webhook.Id), webhook, 0); err != nil {
+		zap.L().Error("Saving Webhook Failed :: " + err.Error())
+		return dtos.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// Deletes a webhook, pending deliveries are dropped on their next attempt
+// //////////////////////////////////////////////////////////////////////////
+func DeleteWebhook(headers dtos.CustomHeaders, id string) (string, error) {
+	if _, err := GetWebhook(headers, id); err != nil {
+		return "", err
+	}
+
+	zap.L().Info("Deleting Webhook :: " + id)
+	store.Default().Delete(webhookSecretKey(id))
+	if err := store.Default().Delete(webhookKey(id)); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Returns the dead-lettered deliveries of the headers key
+// //////////////////////////////////////////////////////////
+func ListDeadLetters(headers dtos.CustomHeaders) ([]dtos.WebhookDelivery, error) {
+	keys, err := store.Default().Keys(webhookDeadLetterKey(""))
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters := []dtos.WebhookDelivery{}
+	for _, key := range keys {
+		var delivery dtos.WebhookDelivery
+		if err := store.GetJSON(key, &delivery); err != nil {
+			continue
+		}
+		if isWebhookOwner(headers, delivery.OrgId, delivery.ProjectId, delivery.Scope) {
+			deadLetters = append(deadLetters, delivery)
+		}
+	}
+
+	return deadLetters, nil
+}
+
+// Moves a dead-lettered delivery back to the pending deliveries
+// ////////////////////////////////////////////////////////////////
+func ReplayDeadLetter(headers dtos.CustomHeaders, deliveryId string) (dtos.WebhookDelivery, error) {
+	delivery, err := getDeadLetter(headers, deliveryId)
+	if err != nil {
+		return dtos.WebhookDelivery{}, err
+	}
+
+	if _, err := GetWebhook(headers, delivery.WebhookId); err != nil {
+		return dtos.WebhookDelivery{}, err
+	}
+
+	delivery.Attempts = 0
+	delivery.DeadAt = nil
+	delivery.NextAttemptAt = time.Now().UTC()
+
+	zap.L().Info("Replaying Webhook Delivery :: " + delivery.Id)
+	if err := store.SetJSON(webhookDeliveryKey(delivery.Id), delivery, 0); err != nil {
+		return dtos.WebhookDelivery{}, err
+	}
+	store.Default().Delete(webhookDeadLetterKey(delivery.Id))
+
+	return delivery, nil
+}
+
+// Removes a dead-lettered delivery
+// ///////////////////////////////////
+func DeleteDeadLetter(headers dtos.CustomHeaders, deliveryId string) (string, error) {
+	if _, err := getDeadLetter(headers, deliveryId); err != nil {
+		return "", err
+	}
+
+	if err := store.Default().Delete(webhookDeadLetterKey(deliveryId)); err != nil {
+		return "", err
+	}
+
+	return deliveryId, nil
+}
+
+func getDeadLetter(headers dtos.CustomHeaders, deliveryId string) (dtos.WebhookDelivery, error) {
+	var delivery dtos.WebhookDelivery
+	if err := store.GetJSON(webhookDeadLetterKey(deliveryId), &delivery); err != nil {
+		if err == constants.ErrRecordNotFound {
+			return dtos.WebhookDelivery{}, constants.ErrDeliveryNotFound
+		}
+		return dtos.WebhookDelivery{}, err
+	}
+
+	if !isWebhookOwner(headers, delivery.OrgId, delivery.ProjectId, delivery.Scope) {
+		return dtos.WebhookDelivery{}, constants.ErrDeliveryNotFound
+	}
+
+	return delivery, nil
+}
+
+// Queues deliveries of an event for every matching webhook
+// ///////////////////////////////////////////////////////////
+func EnqueueWebhookDeliveries(event events.Event) {
+	webhooks, err := getAllWebhooks()
+	if err != nil {
+		zap.L().Error("Listing Webhooks Failed :: " + err.Error())
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Active || !webhookMatches(webhook, event) {
+			continue
+		}
+
+		id, _ := uuid.NewRandom()
+		delivery := dtos.WebhookDelivery{
+			Id:            "whd_" + id.String(),
+			WebhookId:     webhook.Id,
+			OrgId:         webhook.OrgId,
+			ProjectId:     webhook.ProjectId,
+			Scope:         webhook.Scope,
+			Event:         event,
+			NextAttemptAt: event.Timestamp,
+			CreatedAt:     time.Now().UTC(),
+		}
+
+		if err := store.SetJSON(webhookDeliveryKey(delivery.Id), delivery, 0); err != nil {
+			zap.L().Error("Saving Webhook Delivery Failed :: " + err.Error())
+		}
+	}
+}
+
+// Starts the background dispatcher delivering queued webhook events
+// ////////////////////////////////////////////////////////////////////
+func StartWebhookDispatcher(interval time.Duration) {
+	zap.L().Info("Starting Webhook Dispatcher :: every " + interval.String())
+	events.Subscribe(EnqueueWebhookDeliveries)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			DeliverDueWebhooks(time.Now().UTC())
+		}
+	}()
+}
+
+// Attempts every delivery which is due at the given time
+// /////////////////////////////////////////////////////////
+func DeliverDueWebhooks(now time.Time) []dtos.WebhookDelivery {
+	keys, err := store.Default().Keys(webhookDeliveryKey(""))
+	if err != nil {
+		zap.L().Error("Listing Webhook Deliveries Failed :: " + err.Error())
+		return nil
+	}
+
+	var attempted []dtos.WebhookDelivery
+	for _, key := range keys {
+		var delivery dtos.WebhookDelivery
+		if err := store.GetJSON(key, &delivery); err != nil || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+
+		// Prevents replicas from sending the same delivery at once
+		acquired, err := store.Default().SetNX(webhookLockKey(delivery.Id), delivery.WebhookId, WEBHOOK_LOCK_TTL)
+		if err != nil || !acquired {
+			continue
+		}
+
+		attempted = append(attempted, attemptWebhookDelivery(delivery, now))
+		store.Default().Delete(webhookLockKey(delivery.Id))
+	}
+
+	return attempted
+}
+
+// Helper function to send a delivery and schedule its retry or dead-letter it
+// //////////////////////////////////////////////////////////////////////////////
+func attemptWebhookDelivery(delivery dtos.WebhookDelivery, now time.Time) dtos.WebhookDelivery {
+	var webhook dtos.Webhook
+	err := store.GetJSON(webhookKey(delivery.WebhookId), &webhook)
+	signingSecret, secretErr := store.Default().Get(webhookSecretKey(delivery.WebhookId))
+
+	// Deliveries of deleted webhooks are dropped
+	if err == constants.ErrRecordNotFound || secretErr == constants.ErrRecordNotFound {
+		store.Default().Delete(webhookDeliveryKey(delivery.Id))
+		return delivery
+	}
+
+	delivery.Attempts++
+	if err == nil && secretErr == nil {
+		delivery.LastStatus, err = sendWebhook(webhook, delivery, signingSecret, now)
+	} else if err == nil {
+		err = secretErr
+	}
+
+	if err == nil {
+		zap.L().Info("Webhook Delivered :: " + delivery.Id + " :: " + webhook.Url)
+		store.Default().Delete(webhookDeliveryKey(delivery.Id))
+		return delivery
+	}
+
+	zap.L().Error(fmt.Sprintf("Webhook Delivery Failed :: %s :: attempt %d :: ", delivery.Id, delivery.Attempts) + err.Error())
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= WEBHOOK_MAX_ATTEMPTS {
+		delivery.DeadAt = &now
+		store.SetJSON(webhookDeadLetterKey(delivery.Id), delivery, 0)
+		store.Default().Delete(webhookDeliveryKey(delivery.Id))
+		return delivery
+	}
+
+	delivery.NextAttemptAt = now.Add(WebhookBackoff(delivery.Attempts))
+	store.SetJSON(webhookDeliveryKey(delivery.Id), delivery, 0)
+
+	return delivery
+}
+
+// Helper function to post a signed event to a webhook
+// //////////////////////////////////////////////////////
+func sendWebhook(webhook dtos.Webhook, delivery dtos.WebhookDelivery, signingSecret string, now time.Time) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	request, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WEBHOOK_ID_HEADER, webhook.Id)
+	request.Header.Set(WEBHOOK_DELIVERY_HEADER, delivery.Id)
+	request.Header.Set(WEBHOOK_EVENT_HEADER, delivery.Event.Type)
+	request.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+	request.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhookPayload(signingSecret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Signs a webhook payload as sha256=hex(hmac(secret, timestamp + "." + body))
+// //////////////////////////////////////////////////////////////////////////////
+func SignWebhookPayload(signingSecret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the delay before the next delivery attempt, doubling on every failure
+// ////////////////////////////////////////////////////////////////////////////////
+func WebhookBackoff(attempts int) time.Duration {
+	delay := WEBHOOK_BASE_DELAY
+	for i := 1; i < attempts && delay < WEBHOOK_MAX_DELAY; i++ {
+		delay *= 2
+	}
+
+	if delay > WEBHOOK_MAX_DELAY {
+		return WEBHOOK_MAX_DELAY
+	}
+
+	return delay
+}
+
+func getAllWebhooks() ([]dtos.Webhook, error) {
+	keys, err := store.Default().Keys(webhookKey(""))
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []dtos.Webhook
+	for _, key := range keys {
+		var webhook dtos.Webhook
+		if err := store.GetJSON(key, &webhook); err == nil {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	return webhooks, nil
+}
+
+// Webhooks receive the events of their organization, project or scope
+// ///////////////////////////////////////////////////////////////////////
+func webhookMatches(webhook dtos.Webhook, event events.Event) bool {
+	if webhook.OrgId != event.OrgId {
+		return false
+	}
+	if webhook.ProjectId != "" && webhook.ProjectId != event.ProjectId {
+		return false
+	}
+	if webhook.Scope != "" && webhook.Scope != event.Scope {
+		return false
+	}
+
+	return utils.ArrayContains(webhook.Events, event.Type)
+}
+
+func isWebhookOwner(headers dtos.CustomHeaders, orgId string, projectId string, scope string) bool {
+	return headers.OrgId == orgId && headers.ProjectId == projectId && headers.Scope == scope
+}
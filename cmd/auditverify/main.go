@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/audit"
+)
+
+// Verifies the audit chain of an organization outside of the service
+// //////////////////////////////////////////////////////////////////////
+// - reads a FILE sink (-file), a BATCH export (-batch) or a SQL sink (-sql)
+// - checkpoints come from an export of GET /audit/checkpoints (-checkpoints), trusted with -public-key
+// - prints the verification, exits with 1 when the chain is broken and 2 when it couldn't be verified
+func main() {
+	orgId := flag.String("org", "", "organization of the chain")
+	file := flag.String("file", "", "path of a FILE audit sink")
+	batchDir := flag.String("batch", "", "directory of a BATCH audit export")
+	sqlUrl := flag.String("sql", "", "connection URL of a SQL audit sink")
+	checkpointsFile := flag.String("checkpoints", "", "path of a checkpoint export")
+	publicKey := flag.String("public-key", "", "base64 ed25519 public key of the checkpoints, defaults to the key of the export")
+	flag.Parse()
+
+	if *orgId == "" {
+		exit(fmt.Errorf("-org is required"))
+	}
+
+	sink, err := openSink(*file, *batchDir, *sqlUrl)
+	if err != nil {
+		exit(err)
+	}
+	defer sink.Close()
+
+	var checkpoints []audit.Checkpoint
+	var key ed25519.PublicKey
+	if *checkpointsFile != "" {
+		data, err := os.ReadFile(*checkpointsFile)
+		if err != nil {
+			exit(err)
+		}
+		var export dtos.AuditCheckpointExport
+		if err := json.Unmarshal(data, &export); err != nil {
+			exit(err)
+		}
+		if *publicKey == "" {
+			fmt.Fprintln(os.Stderr, "warning: trusting the public key of the export, pass -public-key to pin it")
+			*publicKey = export.PublicKey
+		}
+		if key, err = audit.ParsePublicKey(*publicKey); err != nil {
+			exit(err)
+		}
+		checkpoints = export.Checkpoints
+	}
+
+	verification, err := audit.VerifyChain(sink, *orgId, checkpoints, key)
+	if err != nil {
+		exit(err)
+	}
+
+	output, _ := json.MarshalIndent(verification, "", "  ")
+	fmt.Println(string(output))
+	if !verification.Verified {
+		os.Exit(1)
+	}
+}
+
+// Helper function to open the sink given by the flags, exactly one is expected
+// ///////////////////////////////////////////////////////////////////////////////
+func openSink(file string, batchDir string, sqlUrl string) (audit.Sink, error) {
+	switch {
+	case file != "" && batchDir == "" && sqlUrl == "":
+		if _, err := os.Stat(file); err != nil {
+			return nil, err
+		}
+		return audit.NewFileSink(file)
+
+	case batchDir != "" && file == "" && sqlUrl == "":
+		if _, err := os.Stat(batchDir); err != nil {
+			return nil, err
+		}
+		return audit.NewBatchExporter(batchDir, 1, 0)
+
+	case sqlUrl != "" && file == "" && batchDir == "":
+		return audit.NewSQLSink(sqlUrl)
+	}
+
+	return nil, fmt.Errorf("pass one of -file, -batch or -sql")
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, "error: "+err.Error())
+	os.Exit(2)
+}
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"context"
+	"net/http"
 	"secret-svc/api"
 	"secret-svc/api/middlewares"
+	"secret-svc/api/services"
+	"secret-svc/pkg/audit"
+	"secret-svc/pkg/auth"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/envelope"
+	"secret-svc/pkg/events"
 	"secret-svc/pkg/loggers"
+	"secret-svc/pkg/store"
 	"secret-svc/pkg/utils"
+	"strconv"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
@@ -31,6 +44,33 @@ func main() {
 	REDIS_ADDR := utils.GetEnvVar("REDIS_HOST") + ":" + utils.GetEnvVar("REDIS_PORT")
 	REDIS_PASSWORD := utils.GetEnvVar("REDIS_PASSWORD")
 	BYPASS_REDIS := utils.GetEnvVar("BYPASS_REDIS")
+	ROTATION_SCHEDULER_INTERVAL := utils.GetEnvVar("ROTATION_SCHEDULER_INTERVAL")
+	LEASE_REAPER_INTERVAL := utils.GetEnvVar("LEASE_REAPER_INTERVAL")
+	HEALTH_CHECK_INTERVAL := utils.GetEnvVar("HEALTH_CHECK_INTERVAL")
+	WEBHOOK_DISPATCHER_INTERVAL := utils.GetEnvVar("WEBHOOK_DISPATCHER_INTERVAL")
+	OUTBOX_PUBLISHER := utils.GetEnvVar("OUTBOX_PUBLISHER")
+	OUTBOX_PUBLISHER_INTERVAL := utils.GetEnvVar("OUTBOX_PUBLISHER_INTERVAL")
+	MIGRATION_RESUMER_INTERVAL := utils.GetEnvVar("MIGRATION_RESUMER_INTERVAL")
+	JOB_WORKER_INTERVAL := utils.GetEnvVar("JOB_WORKER_INTERVAL")
+	JOB_WORKERS := utils.GetEnvVar("JOB_WORKERS")
+	SYSTEM_SECRET_CACHE_TTL := utils.GetEnvVar("SYSTEM_SECRET_CACHE_TTL")
+	SYSTEM_SECRET_CACHE_SHARED := utils.GetEnvVar("SYSTEM_SECRET_CACHE_SHARED")
+	AUTH_DISABLED := utils.GetEnvVar("AUTH_DISABLED")
+	AUTH_JWKS := utils.GetEnvVar("AUTH_JWKS")
+	AUTH_JWT_ISSUER := utils.GetEnvVar("AUTH_JWT_ISSUER")
+	AUTH_JWT_AUDIENCE := utils.GetEnvVar("AUTH_JWT_AUDIENCE")
+	TLS_CERT_FILE := utils.GetEnvVar("TLS_CERT_FILE")
+	TLS_KEY_FILE := utils.GetEnvVar("TLS_KEY_FILE")
+	TLS_CLIENT_CA_FILE := utils.GetEnvVar("TLS_CLIENT_CA_FILE")
+	AUTHZ_ENABLED := utils.GetEnvVar("AUTHZ_ENABLED")
+	AUTHZ_POLICY_FILE := utils.GetEnvVar("AUTHZ_POLICY_FILE")
+	REGION := utils.GetEnvVar("REGION")
+	ENVELOPE_KMS_KEY_ID := utils.GetEnvVar("ENVELOPE_KMS_KEY_ID")
+	ENVELOPE_MASTER_KEY := utils.GetEnvVar("ENVELOPE_MASTER_KEY")
+	ENVELOPE_KEY_SCOPE := utils.GetEnvVar("ENVELOPE_KEY_SCOPE")
+	AUDIT_SINK := utils.GetEnvVar("AUDIT_SINK")
+	AUDIT_SIGNING_KEY := utils.GetEnvVar("AUDIT_SIGNING_KEY")
+	AUDIT_CHECKPOINT_INTERVAL := utils.GetEnvVar("AUDIT_CHECKPOINT_INTERVAL")
 
 	// Setting the GIN mode
 	if GIN_MODE == "release" {
@@ -47,17 +87,205 @@ func main() {
 			zap.L().Fatal("Error Initializing Redis :: " + err.Error())
 		}
 
-		router.Use(middlewares.RedisLockMiddleware)
+		store.UseRedis(middlewares.GetRedisPool())
+		events.UseRedis(middlewares.GetRedisPool())
+		services.AcquireGroupLock = middlewares.AcquireLock
+		services.ReleaseGroupLock = middlewares.ReleaseLock
+		services.GroupLocksHeld = middlewares.GroupLocksHeld
 	} else {
 		zap.L().Info("Redis was bypassed based on the env config")
 	}
 
+	// Starting the secret rotation scheduler
+	rotationInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(ROTATION_SCHEDULER_INTERVAL, "1m"))
+	if err != nil {
+		zap.L().Fatal("Invalid ROTATION_SCHEDULER_INTERVAL :: " + err.Error())
+	}
+	if rotationInterval > 0 {
+		services.StartRotationScheduler(rotationInterval)
+	}
+
+	// Starting the dynamic secret lease reaper
+	leaseReaperInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(LEASE_REAPER_INTERVAL, "30s"))
+	if err != nil {
+		zap.L().Fatal("Invalid LEASE_REAPER_INTERVAL :: " + err.Error())
+	}
+	if leaseReaperInterval > 0 {
+		services.StartLeaseReaper(leaseReaperInterval)
+	}
+
+	// Caching the system secret lookups of the secret routes
+	systemSecretCacheTtl, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(SYSTEM_SECRET_CACHE_TTL, "1m"))
+	if err != nil {
+		zap.L().Fatal("Invalid SYSTEM_SECRET_CACHE_TTL :: " + err.Error())
+	}
+	if systemSecretCacheTtl > 0 {
+		services.StartSystemSecretCache(systemSecretCacheTtl, SYSTEM_SECRET_CACHE_SHARED == "true" && BYPASS_REDIS != "true")
+	}
+
+	// Starting the health checks of the PRIVATE registrations
+	healthCheckInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(HEALTH_CHECK_INTERVAL, "15m"))
+	if err != nil {
+		zap.L().Fatal("Invalid HEALTH_CHECK_INTERVAL :: " + err.Error())
+	}
+	if healthCheckInterval > 0 {
+		services.StartHealthChecker(healthCheckInterval)
+	}
+
+	// Recording events for resuming secret watchers
+	services.StartSecretWatch()
+
+	// Starting the webhook dispatcher
+	webhookInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(WEBHOOK_DISPATCHER_INTERVAL, "5s"))
+	if err != nil {
+		zap.L().Fatal("Invalid WEBHOOK_DISPATCHER_INTERVAL :: " + err.Error())
+	}
+	if webhookInterval > 0 {
+		services.StartWebhookDispatcher(webhookInterval)
+	}
+
+	// Starting the outbox publisher when an event bus is configured
+	if OUTBOX_PUBLISHER != "" {
+		if BYPASS_REDIS == "true" {
+			zap.L().Fatal(constants.ErrOutboxRequiresRedis.Error())
+		}
+		publisher, err := services.NewOutboxPublisher(OUTBOX_PUBLISHER)
+		if err != nil {
+			zap.L().Fatal("Error Initializing Outbox Publisher :: " + err.Error())
+		}
+		outboxInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(OUTBOX_PUBLISHER_INTERVAL, "1s"))
+		if err != nil || outboxInterval <= 0 {
+			zap.L().Fatal("Invalid OUTBOX_PUBLISHER_INTERVAL")
+		}
+		services.UseOutboxPublisher(publisher)
+		services.StartOutboxPublisher(outboxInterval)
+	}
+
+	// Starting the resumer of migrations interrupted by a restart
+	migrationInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(MIGRATION_RESUMER_INTERVAL, "1m"))
+	if err != nil {
+		zap.L().Fatal("Invalid MIGRATION_RESUMER_INTERVAL :: " + err.Error())
+	}
+	if migrationInterval > 0 && BYPASS_REDIS != "true" {
+		services.StartMigrationResumer(migrationInterval)
+	} else if migrationInterval > 0 {
+		zap.L().Warn("The migration resumer requires Redis, interrupted migrations are lost on restart")
+	}
+
+	// Starting the job workers
+	jobInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(JOB_WORKER_INTERVAL, "1s"))
+	if err != nil {
+		zap.L().Fatal("Invalid JOB_WORKER_INTERVAL :: " + err.Error())
+	}
+	jobWorkers, err := strconv.Atoi(utils.SetDefaultIfEmptyValue(JOB_WORKERS, "4"))
+	if err != nil {
+		zap.L().Fatal("Invalid JOB_WORKERS :: " + err.Error())
+	}
+	if jobInterval > 0 && jobWorkers > 0 {
+		services.StartJobWorkers(jobInterval, jobWorkers)
+	}
+
+	// Authenticating the callers with JWTs and/or client certificates
+	if AUTH_JWKS != "" {
+		keySet, err := auth.LoadKeySet(AUTH_JWKS)
+		if err != nil {
+			zap.L().Fatal("Error Loading AUTH_JWKS :: " + err.Error())
+		}
+		auth.UseJWT(&auth.JWTConfig{Keys: keySet, Issuer: AUTH_JWT_ISSUER, Audience: AUTH_JWT_AUDIENCE})
+	}
+	if TLS_CLIENT_CA_FILE != "" {
+		if TLS_CERT_FILE == "" || TLS_KEY_FILE == "" {
+			zap.L().Fatal("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		auth.UseClientCertificates(true)
+	}
+	if !auth.Enabled() {
+		if AUTH_DISABLED != "true" {
+			zap.L().Fatal(constants.ErrAuthNotConfigured.Error())
+		}
+		zap.L().Warn("Authentication was disabled based on the env config")
+	}
+
+	// Authorizing the requests with the policies of the file and the admin API
+	if AUTHZ_ENABLED == "true" || AUTHZ_POLICY_FILE != "" {
+		if err := services.UseAuthorization(AUTHZ_POLICY_FILE); err != nil {
+			zap.L().Fatal("Error Loading AUTHZ_POLICY_FILE :: " + err.Error())
+		}
+	}
+
+	// Encrypting the SHARED secret values with data keys wrapped by KMS, or by a local master key in dev mode
+	var keyWrapper envelope.KeyWrapper
+	if ENVELOPE_KMS_KEY_ID != "" {
+		awsConfig, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(REGION))
+		if err != nil {
+			zap.L().Fatal("Error Loading AWS Config :: " + err.Error())
+		}
+		keyWrapper = envelope.NewKMSKeyWrapper(kms.NewFromConfig(awsConfig), ENVELOPE_KMS_KEY_ID)
+	} else if ENVELOPE_MASTER_KEY != "" {
+		localWrapper, err := envelope.NewLocalKeyWrapper(ENVELOPE_MASTER_KEY)
+		if err != nil {
+			zap.L().Fatal(err.Error())
+		}
+		zap.L().Warn("SHARED secret values are encrypted with a local master key, use ENVELOPE_KMS_KEY_ID outside of dev mode")
+		keyWrapper = localWrapper
+	}
+	if keyWrapper != nil {
+		if err := services.UseEnvelopeEncryption(keyWrapper, utils.SetDefaultIfEmptyValue(ENVELOPE_KEY_SCOPE, constants.ORGANIZATION_KEY_SCOPE)); err != nil {
+			zap.L().Fatal(err.Error())
+		}
+	}
+
+	// Recording the audit events of the secret and system operations
+	if AUDIT_SINK != "NONE" {
+		auditSink, err := services.NewAuditSink(utils.SetDefaultIfEmptyValue(AUDIT_SINK, audit.FILE_SINK))
+		if err != nil {
+			zap.L().Fatal("Error Initializing Audit Sink :: " + err.Error())
+		}
+		services.UseAuditSink(auditSink)
+
+		// Signing checkpoints of the audit chains
+		if err := services.UseAuditSigningKey(AUDIT_SIGNING_KEY); err != nil {
+			zap.L().Fatal(err.Error())
+		}
+		checkpointInterval, err := time.ParseDuration(utils.SetDefaultIfEmptyValue(AUDIT_CHECKPOINT_INTERVAL, services.AUDIT_DEFAULT_CHECKPOINT_INTERVAL.String()))
+		if err != nil {
+			zap.L().Fatal("Invalid AUDIT_CHECKPOINT_INTERVAL :: " + err.Error())
+		}
+		if AUDIT_SIGNING_KEY == "" {
+			zap.L().Warn("Audit checkpoints are disabled, set AUDIT_SIGNING_KEY to sign them")
+		} else if checkpointInterval > 0 {
+			services.StartAuditCheckpointer(checkpointInterval)
+		}
+	} else {
+		zap.L().Warn("Auditing was disabled based on the env config")
+	}
+
 	api.SetHealthRoute(router)
+	router.Use(middlewares.Audit)
+	router.Use(middlewares.Authenticate)
 	router.Use(middlewares.CheckHeaders)
+	router.Use(middlewares.Authorize)
 	api.SetSystemSecretRoutes(router)
+	api.SetWebhookRoutes(router)
+	api.SetJobRoutes(router)
+	api.SetAdminRoutes(router)
+	api.SetAuditRoutes(router)
 	router.Use(middlewares.AddDefaultScope)
 	api.SetSecretRoutes(router)
+	api.SetDynamicSecretRoutes(router)
 
 	// Listening to Ports
-	router.Run(BASE + ":" + PORT)
+	if TLS_CERT_FILE == "" {
+		router.Run(BASE + ":" + PORT)
+		return
+	}
+
+	tlsConfig, err := auth.ServerTLSConfig(TLS_CLIENT_CA_FILE)
+	if err != nil {
+		zap.L().Fatal("Error Loading TLS_CLIENT_CA_FILE :: " + err.Error())
+	}
+	server := &http.Server{Addr: BASE + ":" + PORT, Handler: router, TLSConfig: tlsConfig}
+	if err := server.ListenAndServeTLS(TLS_CERT_FILE, TLS_KEY_FILE); err != nil {
+		zap.L().Fatal("Error Listening :: " + err.Error())
+	}
 }
@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"sync"
+	"time"
+
+	"secret-svc/pkg/constants"
+
+	"github.com/google/uuid"
+)
+
+// Audit record of a secret or system operation, never carries secret values
+type Event struct {
+	Id        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	TraceId   string    `json:"traceId,omitempty"`
+	OrgId     string    `json:"orgId"`
+	ProjectId string    `json:"projectId,omitempty"`
+	Scope     string    `json:"scope,omitempty"`
+	SecretId  string    `json:"secretId,omitempty"`
+	Action    string    `json:"action"`
+	Path      string    `json:"path,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	// Position in the chain of the organization and hashes linking the event to the previous one, see Record
+	Seq      int64  `json:"seq,omitempty"`
+	PrevHash string `json:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Filters of an audit query, empty attributes match every event
+// - After is the position returned by the previous page, its format depends on the sink
+type Filter struct {
+	OrgId     string
+	ProjectId string
+	Scope     string
+	SecretId  string
+	Actor     string
+	Action    string
+	Outcome   string
+	TraceId   string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	After     string
+}
+
+type Page struct {
+	Events []Event `json:"events"`
+	Next   string  `json:"-"`
+}
+
+// Append-only storage of the audit events
+// - Write never changes the events written before, Query returns them in the order they were written
+type Sink interface {
+	Name() string
+	Write(event Event) error
+	Query(filter Filter) (Page, error)
+	Close() error
+}
+
+var sink Sink
+var mutex sync.RWMutex
+
+// Method for recording the audit events in a sink
+// ///////////////////////////////////////////////////
+// - nil disables the auditing, the previous sink is closed
+func Use(auditSink Sink) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if sink != nil {
+		sink.Close()
+	}
+	sink = auditSink
+	resetLocalHeads()
+}
+
+// Returns true when the audit events are recorded
+func Enabled() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return sink != nil
+}
+
+// Records an event, its ID and time are set when missing
+// //////////////////////////////////////////////////////////
+// - the event is chained to the last event of its organization, one writer per organization at a time
+// - a ChainedSink links the event to its head itself, the other sinks are written by this process only
+// - times are kept to the microsecond, the precision of the SQL sink, so hashes survive a round trip
+func Record(event Event) (Event, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if sink == nil {
+		return event, constants.ErrAuditDisabled
+	}
+
+	if event.Id == "" {
+		event.Id = "audit_" + uuid.NewString()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC().Truncate(time.Microsecond)
+
+	unlock, err := lockChain(sink, event.OrgId)
+	if err != nil {
+		return event, err
+	}
+	defer unlock()
+
+	if chained, ok := sink.(ChainedSink); ok {
+		return chained.WriteChained(event)
+	}
+
+	head, err := getChainHead(sink, event.OrgId)
+	if err != nil {
+		return event, err
+	}
+	event = ChainEvent(event, head)
+	if err := sink.Write(event); err != nil {
+		return event, err
+	}
+
+	setChainHead(event.OrgId, Head{Seq: event.Seq, Hash: event.Hash})
+	return event, nil
+}
+
+// Verifies the chain of an organization in the sink in use, see VerifyChain
+// ////////////////////////////////////////////////////////////////////////////
+func Verify(orgId string, checkpoints []Checkpoint, publicKey ed25519.PublicKey) (Verification, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if sink == nil {
+		return Verification{}, constants.ErrAuditDisabled
+	}
+
+	return VerifyChain(sink, orgId, checkpoints, publicKey)
+}
+
+// Queries the recorded events, oldest first
+// ////////////////////////////////////////////
+func Query(filter Filter) (Page, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if sink == nil {
+		return Page{}, constants.ErrAuditDisabled
+	}
+
+	return sink.Query(filter)
+}
+
+// Returns true when an event matches the filter, used by the sinks reading their events back
+// //////////////////////////////////////////////////////////////////////////////////////////////
+func Matches(filter Filter, event Event) bool {
+	switch {
+	case filter.OrgId != "" && event.OrgId != filter.OrgId:
+		return false
+	case filter.ProjectId != "" && event.ProjectId != filter.ProjectId:
+		return false
+	case filter.Scope != "" && event.Scope != filter.Scope:
+		return false
+	case filter.SecretId != "" && event.SecretId != filter.SecretId:
+		return false
+	case filter.Actor != "" && event.Actor != filter.Actor:
+		return false
+	case filter.Action != "" && event.Action != filter.Action:
+		return false
+	case filter.Outcome != "" && event.Outcome != filter.Outcome:
+		return false
+	case filter.TraceId != "" && event.TraceId != filter.TraceId:
+		return false
+	case !filter.From.IsZero() && event.Time.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !event.Time.Before(filter.To):
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,244 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"secret-svc/pkg/constants"
+
+	"go.uber.org/zap"
+)
+
+var BATCH_SINK = "BATCH"
+
+var BATCH_MANIFEST_FILE = "manifest.json"
+
+// Entry of a COPY manifest, see https://docs.aws.amazon.com/redshift/latest/dg/loading-data-files-using-manifest.html
+type ManifestEntry struct {
+	Url       string `json:"url"`
+	Mandatory bool   `json:"mandatory"`
+	Meta      struct {
+		ContentLength int64 `json:"content_length"`
+	} `json:"meta"`
+}
+
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// Stand-in of a warehouse (Redshift) exporter, buffering the events into batches
+// - every batch is a JSON lines file listed in a COPY manifest, files are never rewritten
+// - buffered events are lost if the process dies before they are flushed
+type BatchExporter struct {
+	dir       string
+	batchSize int
+	manifest  Manifest
+	buffer    []Event
+	stop      chan struct{}
+	mutex     sync.Mutex
+}
+
+// Creates a batch exporter writing its batches to dir, flushed by size or every interval
+// //////////////////////////////////////////////////////////////////////////////////////////
+// - batches of a previous run are kept, the manifest is continued
+func NewBatchExporter(dir string, batchSize int, interval time.Duration) (*BatchExporter, error) {
+	if batchSize < 1 {
+		return nil, constants.ErrInvalidAuditBatch
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	exporter := &BatchExporter{dir: dir, batchSize: batchSize, stop: make(chan struct{})}
+	data, err := os.ReadFile(filepath.Join(dir, BATCH_MANIFEST_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &exporter.manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	if interval > 0 {
+		go exporter.flushEvery(interval)
+	}
+	return exporter, nil
+}
+
+func (e *BatchExporter) Name() string {
+	return BATCH_SINK
+}
+
+// Full batches are flushed before the write returns
+func (e *BatchExporter) Write(event Event) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.buffer = append(e.buffer, event)
+	if len(e.buffer) >= e.batchSize {
+		return e.flush()
+	}
+	return nil
+}
+
+// Flushes the buffered events as a new batch
+func (e *BatchExporter) Flush() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.flush()
+}
+
+// Reads the exported batches, then the buffered events, positions are event offsets
+func (e *BatchExporter) Query(filter Filter) (Page, error) {
+	after := 0
+	if filter.After != "" {
+		position, err := strconv.Atoi(filter.After)
+		if err != nil || position < 0 {
+			return Page{}, constants.ErrInvalidNextToken
+		}
+		after = position
+	}
+
+	e.mutex.Lock()
+	entries := append([]ManifestEntry{}, e.manifest.Entries...)
+	buffered := append([]Event{}, e.buffer...)
+	e.mutex.Unlock()
+
+	page := Page{Events: []Event{}}
+	position := 0
+	collect := func(event Event) bool {
+		position++
+		if position <= after || !Matches(filter, event) {
+			return false
+		}
+		page.Events = append(page.Events, event)
+		if len(page.Events) == filter.Limit {
+			page.Next = strconv.Itoa(position)
+			return true
+		}
+		return false
+	}
+
+	for _, entry := range entries {
+		events, err := readBatch(entry.Url)
+		if err != nil {
+			return Page{}, err
+		}
+		for _, event := range events {
+			if collect(event) {
+				return page, nil
+			}
+		}
+	}
+	for _, event := range buffered {
+		if collect(event) {
+			return page, nil
+		}
+	}
+
+	return page, nil
+}
+
+func (e *BatchExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	select {
+	case <-e.stop:
+	default:
+		close(e.stop)
+	}
+	return e.flush()
+}
+
+func (e *BatchExporter) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			if err := e.Flush(); err != nil {
+				zap.L().Error("Flushing Audit Batch Failed :: " + err.Error())
+			}
+		}
+	}
+}
+
+// Helper function to write the buffer as a batch file and list it in the manifest
+// //////////////////////////////////////////////////////////////////////////////////
+// - files are written to a temporary name first, a failed flush keeps the buffer
+func (e *BatchExporter) flush() error {
+	if len(e.buffer) == 0 {
+		return nil
+	}
+
+	var data []byte
+	for _, event := range e.buffer {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	path := filepath.Join(e.dir, fmt.Sprintf("batch-%06d.jsonl", len(e.manifest.Entries)+1))
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+
+	entry := ManifestEntry{Url: path, Mandatory: true}
+	entry.Meta.ContentLength = int64(len(data))
+	manifest := Manifest{Entries: append(append([]ManifestEntry{}, e.manifest.Entries...), entry)}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(e.dir, BATCH_MANIFEST_FILE), manifestData); err != nil {
+		return err
+	}
+
+	e.manifest = manifest
+	e.buffer = nil
+	return nil
+}
+
+func readBatch(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), MAX_EVENT_SIZE)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(temporary, path)
+}
@@ -0,0 +1,358 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+)
+
+var CHAIN_LOCK_TTL = 10 * time.Second
+
+var CHAIN_PAGE_SIZE = 500
+
+// Prefix of the signed checkpoint messages, a checkpoint signature can't be replayed as another signature
+var CHECKPOINT_CONTEXT = "secret-svc audit checkpoint v1"
+
+// Heads of the chains of a FILE or BATCH sink, only the process writing the sink knows them
+var localHeads = map[string]Head{}
+var localHeadsMutex sync.Mutex
+var localChainMutex sync.Mutex
+
+// Sink shared by the replicas, chaining the events itself where they are stored
+// - the head of a chain is read from the sink when an event is appended, never from a copy which could be stale
+type ChainedSink interface {
+	Sink
+	WriteChained(event Event) (Event, error)
+	ChainHeads() (map[string]Head, error)
+}
+
+// Last event of the chain of an organization
+type Head struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Signed statement of the head of a chain at a point in time
+// - checkpoints are stored outside of the sink, a rewritten sink can't match them
+type Checkpoint struct {
+	OrgId     string    `json:"orgId"`
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+	KeyId     string    `json:"keyId"`
+	Signature string    `json:"signature"`
+}
+
+// First event where the chain doesn't hold
+type ChainBreak struct {
+	Seq     int64  `json:"seq"`
+	EventId string `json:"eventId,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+type Verification struct {
+	OrgId       string      `json:"orgId"`
+	Verified    bool        `json:"verified"`
+	Events      int         `json:"events"`
+	Unchained   int         `json:"unchained,omitempty"`
+	Checkpoints int         `json:"checkpoints"`
+	Head        Head        `json:"head"`
+	Break       *ChainBreak `json:"break,omitempty"`
+}
+
+// Links an event to the head of its chain
+// ///////////////////////////////////////////
+func ChainEvent(event Event, head Head) Event {
+	event.Seq = head.Seq + 1
+	event.PrevHash = head.Hash
+	event.Hash = HashEvent(event)
+	return event
+}
+
+// Returns the hex SHA-256 of the JSON of an event without its own hash
+// ///////////////////////////////////////////////////////////////////////
+func HashEvent(event Event) string {
+	event.Hash = ""
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Signs the head of the chain of an organization
+// //////////////////////////////////////////////////
+func SignCheckpoint(privateKey ed25519.PrivateKey, orgId string, head Head, createdAt time.Time) Checkpoint {
+	checkpoint := Checkpoint{
+		OrgId:     orgId,
+		Seq:       head.Seq,
+		Hash:      head.Hash,
+		CreatedAt: createdAt.UTC().Truncate(time.Microsecond),
+		KeyId:     KeyId(privateKey.Public().(ed25519.PublicKey)),
+	}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, checkpointMessage(checkpoint)))
+	return checkpoint
+}
+
+// Returns true when the checkpoint was signed by the key
+func VerifyCheckpoint(publicKey ed25519.PublicKey, checkpoint Checkpoint) bool {
+	signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+	if err != nil {
+		return false
+	}
+
+	return checkpoint.KeyId == KeyId(publicKey) && ed25519.Verify(publicKey, checkpointMessage(checkpoint), signature)
+}
+
+// Short identifier of a public key, the first 8 bytes of its SHA-256
+func KeyId(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Parses a base64 ed25519 signing key, a 32 byte seed or a 64 byte private key
+// //////////////////////////////////////////////////////////////////////////////
+func ParseSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	switch {
+	case err != nil:
+		return nil, constants.ErrInvalidAuditSigningKey
+	case len(key) == ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case len(key) == ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+
+	return nil, constants.ErrInvalidAuditSigningKey
+}
+
+// Parses a base64 ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, constants.ErrInvalidAuditPublicKey
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// Walks the chain of an organization and its checkpoints one event at a time
+// - events recorded before the chaining was introduced have no hash, they are counted as unchained
+type ChainVerifier struct {
+	verification Verification
+	checkpoints  map[int64]Checkpoint
+	chained      bool
+}
+
+// Creates a verifier of the chain of an organization
+// //////////////////////////////////////////////////////
+// - checkpoints of other organizations are ignored, checkpoints are only trusted with the public key
+// - a checkpoint with an invalid signature is reported as the break
+func NewChainVerifier(orgId string, checkpoints []Checkpoint, publicKey ed25519.PublicKey) *ChainVerifier {
+	verifier := &ChainVerifier{verification: Verification{OrgId: orgId}, checkpoints: map[int64]Checkpoint{}}
+	if publicKey == nil {
+		return verifier
+	}
+
+	for _, checkpoint := range checkpoints {
+		if checkpoint.OrgId != orgId {
+			continue
+		}
+		if !VerifyCheckpoint(publicKey, checkpoint) {
+			verifier.fail(ChainBreak{Seq: checkpoint.Seq, Reason: "invalid checkpoint signature"})
+			continue
+		}
+		verifier.checkpoints[checkpoint.Seq] = checkpoint
+		verifier.verification.Checkpoints++
+	}
+	return verifier
+}
+
+// Adds the next event of the chain, returns false once the chain is broken
+// ////////////////////////////////////////////////////////////////////////////
+func (v *ChainVerifier) Add(event Event) bool {
+	if v.verification.Break != nil {
+		return false
+	}
+
+	head := v.verification.Head
+	switch {
+	case event.Hash == "" && !v.chained:
+		v.verification.Unchained++
+		return true
+	case event.Hash == "":
+		return v.fail(ChainBreak{Seq: head.Seq + 1, EventId: event.Id, Reason: "event without a hash after the start of the chain"})
+	case event.Seq != head.Seq+1:
+		return v.fail(ChainBreak{Seq: head.Seq + 1, EventId: event.Id, Reason: fmt.Sprintf("expected event %d, found event %d", head.Seq+1, event.Seq)})
+	case event.PrevHash != head.Hash:
+		return v.fail(ChainBreak{Seq: event.Seq, EventId: event.Id, Reason: "previous hash doesn't match the previous event"})
+	case HashEvent(event) != event.Hash:
+		return v.fail(ChainBreak{Seq: event.Seq, EventId: event.Id, Reason: "hash doesn't match the event, the event was altered"})
+	}
+	if checkpoint, ok := v.checkpoints[event.Seq]; ok && checkpoint.Hash != event.Hash {
+		return v.fail(ChainBreak{Seq: event.Seq, EventId: event.Id, Reason: "hash doesn't match the signed checkpoint"})
+	}
+
+	v.chained = true
+	v.verification.Events++
+	v.verification.Head = Head{Seq: event.Seq, Hash: event.Hash}
+	return true
+}
+
+// Returns the verification once every event was added
+// - checkpoints past the last event mean the end of the chain was removed
+func (v *ChainVerifier) Finish() Verification {
+	var truncated int64
+	for seq := range v.checkpoints {
+		if seq > v.verification.Head.Seq && (truncated == 0 || seq < truncated) {
+			truncated = seq
+		}
+	}
+	if truncated > 0 {
+		v.fail(ChainBreak{Seq: v.verification.Head.Seq + 1, Reason: fmt.Sprintf("chain ends before the signed checkpoint of event %d", truncated)})
+	}
+
+	v.verification.Verified = v.verification.Break == nil
+	return v.verification
+}
+
+// Helper function to keep the first break of the chain
+func (v *ChainVerifier) fail(chainBreak ChainBreak) bool {
+	if v.verification.Break == nil {
+		v.verification.Break = &chainBreak
+	}
+	return false
+}
+
+// Verifies the chain of an organization in a sink, see ChainVerifier
+// /////////////////////////////////////////////////////////////////////
+func VerifyChain(sink Sink, orgId string, checkpoints []Checkpoint, publicKey ed25519.PublicKey) (Verification, error) {
+	verifier := NewChainVerifier(orgId, checkpoints, publicKey)
+	filter := Filter{OrgId: orgId, Limit: CHAIN_PAGE_SIZE}
+	for {
+		page, err := sink.Query(filter)
+		if err != nil {
+			return Verification{}, err
+		}
+		for _, event := range page.Events {
+			if !verifier.Add(event) {
+				return verifier.Finish(), nil
+			}
+		}
+		if page.Next == "" {
+			return verifier.Finish(), nil
+		}
+		filter.After = page.Next
+	}
+}
+
+// Returns the heads of the chains of every organization in the sink in use
+// ////////////////////////////////////////////////////////////////////////////
+// - buffered events are flushed first, a head is never ahead of the events the sink kept
+func ListChainHeads() (map[string]Head, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if sink == nil {
+		return nil, constants.ErrAuditDisabled
+	}
+	if flusher, ok := sink.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	if chained, ok := sink.(ChainedSink); ok {
+		return chained.ChainHeads()
+	}
+
+	localHeadsMutex.Lock()
+	defer localHeadsMutex.Unlock()
+
+	heads := map[string]Head{}
+	for orgId, head := range localHeads {
+		heads[orgId] = head
+	}
+	return heads, nil
+}
+
+// Helper function to forget the heads of the chains of the previous sink
+func resetLocalHeads() {
+	localHeadsMutex.Lock()
+	defer localHeadsMutex.Unlock()
+
+	localHeads = map[string]Head{}
+}
+
+// Helper function to read the head of a chain of a FILE or BATCH sink, recovered from the sink when it isn't known yet
+// //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+func getChainHead(sink Sink, orgId string) (Head, error) {
+	localHeadsMutex.Lock()
+	head, found := localHeads[orgId]
+	localHeadsMutex.Unlock()
+	if found {
+		return head, nil
+	}
+
+	filter := Filter{OrgId: orgId, Limit: CHAIN_PAGE_SIZE}
+	for {
+		page, err := sink.Query(filter)
+		if err != nil {
+			return Head{}, err
+		}
+		for _, event := range page.Events {
+			if event.Hash != "" {
+				head = Head{Seq: event.Seq, Hash: event.Hash}
+			}
+		}
+		if page.Next == "" {
+			return head, nil
+		}
+		filter.After = page.Next
+	}
+}
+
+func setChainHead(orgId string, head Head) {
+	localHeadsMutex.Lock()
+	defer localHeadsMutex.Unlock()
+
+	localHeads[orgId] = head
+}
+
+// Helper function to hold the chain of an organization while an event is appended
+// ///////////////////////////////////////////////////////////////////////////////////
+// - the lock of a chained sink expires after CHAIN_LOCK_TTL, a crashed writer doesn't block the chain
+// - the lock only spares conflicts, the chained sink rejects an event appended to a stale head
+// - the chains of the other sinks are only written by this process
+func lockChain(sink Sink, orgId string) (func(), error) {
+	if _, ok := sink.(ChainedSink); !ok {
+		localChainMutex.Lock()
+		return localChainMutex.Unlock, nil
+	}
+
+	key := "audit:chain-lock:" + orgId
+	deadline := time.Now().Add(CHAIN_LOCK_TTL)
+	for {
+		acquired, err := store.Default().SetNX(key, "1", CHAIN_LOCK_TTL)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return func() { store.Default().Delete(key) }, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, constants.ErrAuditChainLocked
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func checkpointMessage(checkpoint Checkpoint) []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%s\n%s", CHECKPOINT_CONTEXT, checkpoint.OrgId, checkpoint.Seq, checkpoint.Hash, checkpoint.CreatedAt.Format(time.RFC3339Nano)))
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"secret-svc/pkg/constants"
+)
+
+var FILE_SINK = "FILE"
+
+// Longest JSON line read back from an audit file
+var MAX_EVENT_SIZE = 1024 * 1024
+
+// Sink appending the events to a JSON lines file
+// - the file is opened in append mode, positions of the pages are byte offsets of the next line
+type FileSink struct {
+	path  string
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// Opens (or creates) an audit file, events written before are kept
+// ///////////////////////////////////////////////////////////////////
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{path: path, file: file}, nil
+}
+
+func (s *FileSink) Name() string {
+	return FILE_SINK
+}
+
+// Every event is synced to the disk before the request returns
+func (s *FileSink) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Pages start at the offset of their token, the lines before it are never read again
+func (s *FileSink) Query(filter Filter) (Page, error) {
+	var offset int64
+	if filter.After != "" {
+		position, err := strconv.ParseInt(filter.After, 10, 64)
+		if err != nil || position < 0 {
+			return Page{}, constants.ErrInvalidNextToken
+		}
+		offset = position
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return Page{}, err
+	}
+	defer file.Close()
+
+	if err := seekLine(file, offset); err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Events: []Event{}}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), MAX_EVENT_SIZE)
+	for scanner.Scan() {
+		offset += int64(len(scanner.Bytes())) + 1
+
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return Page{}, err
+		}
+		if !Matches(filter, event) {
+			continue
+		}
+
+		page.Events = append(page.Events, event)
+		if len(page.Events) == filter.Limit {
+			page.Next = strconv.FormatInt(offset, 10)
+			break
+		}
+	}
+
+	return page, scanner.Err()
+}
+
+// Helper function to move to the line starting at an offset of the file
+// /////////////////////////////////////////////////////////////////////////
+// - offsets past the end of the file or in the middle of a line aren't tokens of this file
+func seekLine(file *os.File, offset int64) error {
+	if offset == 0 {
+		return nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	previous := make([]byte, 1)
+	if offset > info.Size() {
+		return constants.ErrInvalidNextToken
+	}
+	if _, err := file.ReadAt(previous, offset-1); err != nil {
+		return err
+	}
+	if previous[0] != '\n' {
+		return constants.ErrInvalidNextToken
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.file.Close()
+}
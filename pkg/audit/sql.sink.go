@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"secret-svc/pkg/constants"
+
+	"github.com/lib/pq"
+)
+
+var SQL_SINK = "SQL"
+
+var SQL_STATEMENT_TIMEOUT = 10 * time.Second
+
+// Events are only ever inserted, seq orders them and positions the pages
+var AUDIT_TABLE_STATEMENT = `CREATE TABLE IF NOT EXISTS audit_events (
+	seq BIGSERIAL PRIMARY KEY,
+	id TEXT NOT NULL UNIQUE,
+	time TIMESTAMPTZ NOT NULL,
+	actor TEXT NOT NULL,
+	trace_id TEXT NOT NULL,
+	org_id TEXT NOT NULL,
+	project_id TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	secret_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	path TEXT NOT NULL,
+	outcome TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	version TEXT NOT NULL
+)`
+
+var AUDIT_INDEX_STATEMENT = `CREATE INDEX IF NOT EXISTS audit_events_org_idx ON audit_events (org_id, seq)`
+
+// Chain columns of the tables created before the events were chained, their events keep empty hashes
+var AUDIT_CHAIN_STATEMENT = `ALTER TABLE audit_events
+	ADD COLUMN IF NOT EXISTS chain_seq BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS prev_hash TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS hash TEXT NOT NULL DEFAULT ''`
+
+// One event per position of a chain, two replicas appending to the same head conflict instead of forking the chain
+// - unchained events recorded before the chaining all have the position 0, they are left out
+var AUDIT_CHAIN_INDEX_STATEMENT = `CREATE UNIQUE INDEX IF NOT EXISTS audit_events_chain_idx ON audit_events (org_id, chain_seq) WHERE hash <> ''`
+
+var auditColumns = "id, time, actor, trace_id, org_id, project_id, scope, secret_id, action, path, outcome, status, version, chain_seq, prev_hash, hash"
+
+// Sink inserting the events into a PostgreSQL table
+// - the role of the service only needs INSERT and SELECT on the table
+type SQLSink struct {
+	db *sql.DB
+}
+
+// Opens a PostgreSQL connection pool and creates the audit table
+// ////////////////////////////////////////////////////////////////
+func NewSQLSink(connectionUrl string) (*SQLSink, error) {
+	db, err := sql.Open("postgres", connectionUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SQL_STATEMENT_TIMEOUT)
+	defer cancel()
+	for _, statement := range []string{AUDIT_TABLE_STATEMENT, AUDIT_INDEX_STATEMENT, AUDIT_CHAIN_STATEMENT, AUDIT_CHAIN_INDEX_STATEMENT} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &SQLSink{db: db}, nil
+}
+
+func (s *SQLSink) Name() string {
+	return SQL_SINK
+}
+
+func (s *SQLSink) Write(event Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SQL_STATEMENT_TIMEOUT)
+	defer cancel()
+
+	return insertAuditEvent(ctx, s.db, event)
+}
+
+// Chains an event to the head of its organization in the table, inside the transaction inserting it
+// /////////////////////////////////////////////////////////////////////////////////////////////////////
+// - a concurrent insert of the same position fails on the chain index, the event isn't written
+func (s *SQLSink) WriteChained(event Event) (Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SQL_STATEMENT_TIMEOUT)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return event, err
+	}
+	defer tx.Rollback()
+
+	var head Head
+	err = tx.QueryRowContext(ctx,
+		"SELECT chain_seq, hash FROM audit_events WHERE org_id = $1 AND hash <> '' ORDER BY chain_seq DESC LIMIT 1", event.OrgId,
+	).Scan(&head.Seq, &head.Hash)
+	if err != nil && err != sql.ErrNoRows {
+		return event, err
+	}
+
+	event = ChainEvent(event, head)
+	if err := insertAuditEvent(ctx, tx, event); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return event, constants.ErrAuditChainConflict
+		}
+		return event, err
+	}
+
+	return event, tx.Commit()
+}
+
+// Returns the last chained event of every organization in the table
+func (s *SQLSink) ChainHeads() (map[string]Head, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SQL_STATEMENT_TIMEOUT)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT DISTINCT ON (org_id) org_id, chain_seq, hash FROM audit_events WHERE hash <> '' ORDER BY org_id, chain_seq DESC",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	heads := map[string]Head{}
+	for rows.Next() {
+		var orgId string
+		var head Head
+		if err := rows.Scan(&orgId, &head.Seq, &head.Hash); err != nil {
+			return nil, err
+		}
+		heads[orgId] = head
+	}
+
+	return heads, rows.Err()
+}
+
+func (s *SQLSink) Query(filter Filter) (Page, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.After != "" {
+		seq, err := strconv.ParseInt(filter.After, 10, 64)
+		if err != nil || seq < 0 {
+			return Page{}, constants.ErrInvalidNextToken
+		}
+		addCondition("seq > $%d", seq)
+	}
+	for column, value := range map[string]string{
+		"org_id":     filter.OrgId,
+		"project_id": filter.ProjectId,
+		"scope":      filter.Scope,
+		"secret_id":  filter.SecretId,
+		"actor":      filter.Actor,
+		"action":     filter.Action,
+		"outcome":    filter.Outcome,
+		"trace_id":   filter.TraceId,
+	} {
+		if value != "" {
+			addCondition(column+" = $%d", value)
+		}
+	}
+	if !filter.From.IsZero() {
+		addCondition("time >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("time < $%d", filter.To)
+	}
+
+	query := "SELECT seq, " + auditColumns + " FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY seq LIMIT $%d", len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), SQL_STATEMENT_TIMEOUT)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	page := Page{Events: []Event{}}
+	var seq int64
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&seq, &event.Id, &event.Time, &event.Actor, &event.TraceId, &event.OrgId, &event.ProjectId, &event.Scope,
+			&event.SecretId, &event.Action, &event.Path, &event.Outcome, &event.Status, &event.Version, &event.Seq, &event.PrevHash, &event.Hash); err != nil {
+			return Page{}, err
+		}
+		event.Time = event.Time.UTC()
+		page.Events = append(page.Events, event)
+	}
+	if len(page.Events) == filter.Limit {
+		page.Next = strconv.FormatInt(seq, 10)
+	}
+
+	return page, rows.Err()
+}
+
+func (s *SQLSink) Close() error {
+	return s.db.Close()
+}
+
+// Helper function to insert an event with the pool or a transaction
+func insertAuditEvent(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}, event Event) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO audit_events ("+auditColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)",
+		event.Id, event.Time, event.Actor, event.TraceId, event.OrgId, event.ProjectId, event.Scope,
+		event.SecretId, event.Action, event.Path, event.Outcome, event.Status, event.Version, event.Seq, event.PrevHash, event.Hash,
+	)
+	return err
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+	"time"
+
+	"secret-svc/pkg/constants"
+)
+
+var MTLS_METHOD = "MTLS"
+var JWT_METHOD = "JWT"
+
+// Authenticated caller of the service
+// - Subject is the 'sub' claim of a JWT, or the URI SAN (SPIFFE ID) / common name of a client certificate
+type Identity struct {
+	Method    string                 `json:"method"`
+	Subject   string                 `json:"subject"`
+	Issuer    string                 `json:"issuer,omitempty"`
+	ExpiresAt *time.Time             `json:"expiresAt,omitempty"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+}
+
+// Verifier of the JWTs, nil when JWTs aren't accepted
+type JWTConfig struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+}
+
+type identityKey struct{}
+
+var jwtConfig *JWTConfig
+var clientCertificates bool
+
+// Method for accepting JWTs signed by the keys of a JWKS
+// /////////////////////////////////////////////////////////
+func UseJWT(config *JWTConfig) {
+	jwtConfig = config
+}
+
+// Method for accepting client certificates verified by the TLS server
+// ///////////////////////////////////////////////////////////////////////
+func UseClientCertificates(enabled bool) {
+	clientCertificates = enabled
+}
+
+// Returns true when an authentication method is configured
+func Enabled() bool {
+	return jwtConfig != nil || clientCertificates
+}
+
+// Authenticates the caller of a request
+// /////////////////////////////////////////
+// - a verified client certificate is used first, then the bearer token of the Authorization header
+func Authenticate(request *http.Request) (Identity, error) {
+	if clientCertificates && request.TLS != nil && len(request.TLS.VerifiedChains) > 0 && len(request.TLS.VerifiedChains[0]) > 0 {
+		return IdentityFromCertificate(request.TLS.VerifiedChains[0][0]), nil
+	}
+
+	authorization := request.Header.Get("Authorization")
+	if jwtConfig != nil && authorization != "" {
+		token, found := strings.CutPrefix(authorization, "Bearer ")
+		if !found {
+			return Identity{}, constants.ErrInvalidToken
+		}
+		return VerifyJWT(strings.TrimSpace(token), *jwtConfig, time.Now())
+	}
+
+	return Identity{}, constants.ErrMissingCredentials
+}
+
+// Returns the identity of a client certificate
+// ////////////////////////////////////////////////
+// - the URI SAN (ex: spiffe://cluster/ns/default/sa/deployer) is preferred over the common name
+func IdentityFromCertificate(certificate *x509.Certificate) Identity {
+	identity := Identity{
+		Method:    MTLS_METHOD,
+		Subject:   certificate.Subject.CommonName,
+		Issuer:    certificate.Issuer.CommonName,
+		ExpiresAt: &certificate.NotAfter,
+	}
+	if len(certificate.URIs) > 0 {
+		identity.Subject = certificate.URIs[0].String()
+	}
+
+	return identity
+}
+
+// Returns a context carrying the identity of the caller
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Returns the identity of the caller, false for unauthenticated requests
+func GetIdentity(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"secret-svc/pkg/constants"
+
+	"go.uber.org/zap"
+)
+
+var JWKS_REFRESH_INTERVAL = time.Hour
+var JWKS_MIN_REFRESH_INTERVAL = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// Signing keys of a JWKS, loaded from a file or an URL
+// - keys of an URL are refreshed every JWKS_REFRESH_INTERVAL, and when a token is signed by an unknown key
+type KeySet struct {
+	source    string
+	mutex     sync.Mutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+// Loads the JWKS of a file path or an http(s) URL
+// ///////////////////////////////////////////////////
+func LoadKeySet(source string) (*KeySet, error) {
+	keySet := &KeySet{source: source}
+	if err := keySet.refresh(); err != nil {
+		return nil, err
+	}
+
+	return keySet, nil
+}
+
+// Parses a JWKS, keys which aren't used for signatures are left out
+// ////////////////////////////////////////////////////////////////////
+func ParseKeySet(data []byte) (*KeySet, error) {
+	keys, err := parseKeys(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySet{keys: keys, fetchedAt: time.Now()}, nil
+}
+
+// Helper method to find the key of a token, an empty kid matches the only key of the set
+func (keySet *KeySet) get(kid string) (publicKey, bool) {
+	keySet.mutex.Lock()
+	defer keySet.mutex.Unlock()
+
+	key, found := keySet.find(kid)
+	isUrl := strings.HasPrefix(keySet.source, "http://") || strings.HasPrefix(keySet.source, "https://")
+	if isUrl && ((!found && time.Since(keySet.fetchedAt) > JWKS_MIN_REFRESH_INTERVAL) || time.Since(keySet.fetchedAt) > JWKS_REFRESH_INTERVAL) {
+		if keys, err := readKeys(keySet.source); err != nil {
+			zap.L().Error("Refreshing JWKS Failed :: " + err.Error())
+		} else {
+			keySet.keys = keys
+		}
+		keySet.fetchedAt = time.Now()
+		key, found = keySet.find(kid)
+	}
+
+	return key, found
+}
+
+func (keySet *KeySet) find(kid string) (publicKey, bool) {
+	if kid == "" && len(keySet.keys) == 1 {
+		for _, key := range keySet.keys {
+			return key, true
+		}
+	}
+	key, found := keySet.keys[kid]
+	return key, found
+}
+
+func (keySet *KeySet) refresh() error {
+	keys, err := readKeys(keySet.source)
+	if err != nil {
+		return err
+	}
+
+	keySet.keys = keys
+	keySet.fetchedAt = time.Now()
+	return nil
+}
+
+// Helper function to read the keys of a file path or an URL
+func readKeys(source string) (map[string]publicKey, error) {
+	var data []byte
+	var err error
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := http.Client{Timeout: 10 * time.Second}
+		response, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, constants.ErrInvalidJWKS
+		}
+		data, err = io.ReadAll(io.LimitReader(response.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data, err = os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return parseKeys(data)
+}
+
+func parseKeys(data []byte) (map[string]publicKey, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, constants.ErrInvalidJWKS
+	}
+
+	keys := map[string]publicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseKey(jwk)
+		if err != nil {
+			zap.L().Error("Skipping JWK :: " + jwk.Kid + " :: " + err.Error())
+			continue
+		}
+		keys[jwk.Kid] = publicKey{key: key, alg: jwk.Alg}
+	}
+	if len(keys) == 0 {
+		return nil, constants.ErrInvalidJWKS
+	}
+
+	return keys, nil
+}
+
+// Helper function to decode an RSA, EC (P-256, P-384, P-521) or Ed25519 public key
+func parseKey(jwk jsonWebKey) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, constants.ErrInvalidJWKS
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, constants.ErrInvalidJWKS
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, constants.ErrInvalidJWKS
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, constants.ErrInvalidJWKS
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, constants.ErrInvalidJWKS
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil, constants.ErrInvalidJWKS
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"secret-svc/pkg/constants"
+)
+
+// Clock skew tolerated on the exp and nbf claims
+var JWT_LEEWAY = time.Minute
+
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// Verifies a JWT, returning the identity of its subject
+// /////////////////////////////////////////////////////////
+// - RS*, PS*, ES* and EdDSA signatures are accepted, 'none' and HMAC signatures never are
+// - exp is required, iss and aud are checked when they are configured
+func VerifyJWT(token string, config JWTConfig, now time.Time) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || config.Keys == nil {
+		return Identity{}, constants.ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, constants.ErrInvalidToken
+	}
+
+	key, found := config.Keys.get(header.Kid)
+	if !found {
+		return Identity{}, constants.ErrUnknownSigningKey
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return Identity{}, constants.ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), signature) {
+		return Identity{}, constants.ErrInvalidToken
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, constants.ErrInvalidToken
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return Identity{}, constants.ErrInvalidToken
+	}
+	expiresAt := time.Unix(int64(exp), 0).UTC()
+	if now.After(expiresAt.Add(JWT_LEEWAY)) {
+		return Identity{}, constants.ErrExpiredToken
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(JWT_LEEWAY).Before(time.Unix(int64(nbf), 0)) {
+		return Identity{}, constants.ErrInvalidToken
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if config.Issuer != "" && issuer != config.Issuer {
+		return Identity{}, constants.ErrInvalidToken
+	}
+	if config.Audience != "" && !hasAudience(claims["aud"], config.Audience) {
+		return Identity{}, constants.ErrInvalidToken
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return Identity{}, constants.ErrInvalidToken
+	}
+
+	return Identity{
+		Method:    JWT_METHOD,
+		Subject:   subject,
+		Issuer:    issuer,
+		ExpiresAt: &expiresAt,
+		Claims:    claims,
+	}, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) bool {
+	if alg == "EdDSA" {
+		edKey, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(edKey, signed, signature)
+	}
+
+	hash, ok := jwtHashes[alg]
+	if !ok {
+		return false
+	}
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature) == nil
+	case "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(rsaKey, hash, digest, signature, nil) == nil
+	case "ES":
+		// Signatures are the fixed size R || S of the curve
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(ecKey, digest, r, s)
+	}
+
+	return false
+}
+
+// The aud claim is a string or an array of strings
+func hasAudience(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
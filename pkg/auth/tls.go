@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"secret-svc/pkg/constants"
+)
+
+// Returns the TLS config of the server, verifying the client certificates signed by the CA bundle
+// ///////////////////////////////////////////////////////////////////////////////////////////////////
+// - certificates are optional during the handshake, callers without one need a bearer token
+func ServerTLSConfig(clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	bundle, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(bundle) {
+		return nil, constants.ErrInvalidClientCA
+	}
+	config.ClientCAs = clientCAs
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return config, nil
+}
@@ -0,0 +1,32 @@
+package bus
+
+import (
+	"strings"
+)
+
+// Message delivered to the event bus
+// - Key keeps the messages of an organization ordered (NATS subject / Kafka partition key)
+// - Id lets consumers and brokers drop redelivered messages
+type Message struct {
+	Key     string
+	Id      string
+	Payload []byte
+}
+
+// Publisher delivering messages to an event bus, Publish returns once the bus accepted the message
+type Publisher interface {
+	Publish(message Message) error
+	Close() error
+}
+
+var subjectReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_")
+
+// Helper function to use a key as a single NATS subject token
+// //////////////////////////////////////////////////////////////
+func subjectToken(key string) string {
+	if key == "" {
+		return "_"
+	}
+
+	return subjectReplacer.Replace(key)
+}
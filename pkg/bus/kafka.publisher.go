@@ -0,0 +1,44 @@
+package bus
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var KAFKA_WRITE_TIMEOUT = 10 * time.Second
+
+// Kafka publisher using the key as partition key, acknowledged by all in-sync replicas
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			WriteTimeout: KAFKA_WRITE_TIMEOUT,
+			// Messages are written one by one, waiting for a batch only delays them
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+func (k *KafkaPublisher) Publish(message Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), KAFKA_WRITE_TIMEOUT)
+	defer cancel()
+
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(message.Key),
+		Value:   message.Payload,
+		Headers: []kafka.Header{{Key: "event-id", Value: []byte(message.Id)}},
+	})
+}
+
+func (k *KafkaPublisher) Close() error {
+	return k.writer.Close()
+}
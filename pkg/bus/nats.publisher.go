@@ -0,0 +1,55 @@
+package bus
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+var NATS_FLUSH_TIMEOUT = 5 * time.Second
+
+// NATS publisher sending messages to <subject>.<key>
+// - with JetStream every message is acknowledged by the stream and de-duplicated using its Id
+type NatsPublisher struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+func NewNatsPublisher(url string, subject string, jetStream bool) (*NatsPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("secret-svc"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	publisher := &NatsPublisher{conn: conn, subject: subject}
+	if jetStream {
+		publisher.js, err = conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return publisher, nil
+}
+
+func (n *NatsPublisher) Publish(message Message) error {
+	subject := n.subject + "." + subjectToken(message.Key)
+
+	if n.js != nil {
+		_, err := n.js.Publish(subject, message.Payload, nats.MsgId(message.Id))
+		return err
+	}
+
+	if err := n.conn.Publish(subject, message.Payload); err != nil {
+		return err
+	}
+
+	// Waits for the server to receive the message
+	return n.conn.FlushTimeout(NATS_FLUSH_TIMEOUT)
+}
+
+func (n *NatsPublisher) Close() error {
+	return n.conn.Drain()
+}
@@ -7,10 +7,141 @@ var ACCEPTED_FLOWS = [2]string{SHARED_FLOW, PRIVATE_FLOW}
 var CREDENTIALS_SCOPE = "CREDENTIALS"
 var CONFIGS_SCOPE = "CONFIGS"
 var OTHERS_SCOPE = "OTHERS"
+
+// Built-in scopes of every organization, more can be registered through the scope registry
 var ACCEPTED_SCOPES = [3]string{CREDENTIALS_SCOPE, CONFIGS_SCOPE, OTHERS_SCOPE}
 
+// Value returned for the secrets of masked scopes
+var MASKED_SECRET_VALUE = "********"
+
 var FLOW_META_DATA = "Flow"
 var ARN_META_DATA = "ARN"
 var REGION_META_DATA = "Region"
 var PROVIDER_META_DATA = "Provider"
 var SECRET_META_DATA = "Secret"
+var KMS_KEY_META_DATA = "KmsKeyId"
+
+// Key used by Secrets Manager when a PRIVATE registration has no KMS key
+var DEFAULT_SECRETS_MANAGER_KEY = "alias/aws/secretsmanager"
+
+var PASSWORD_GENERATOR = "PASSWORD"
+var RANDOM_BYTES_GENERATOR = "RANDOM_BYTES"
+var API_KEY_GENERATOR = "API_KEY"
+var HEX_TOKEN_GENERATOR = "HEX_TOKEN"
+var BASE64_TOKEN_GENERATOR = "BASE64_TOKEN"
+var UUID_GENERATOR = "UUID"
+var ED25519_KEYPAIR_GENERATOR = "ED25519_KEYPAIR"
+var RSA_KEYPAIR_GENERATOR = "RSA_KEYPAIR"
+var ACCEPTED_GENERATORS = [8]string{PASSWORD_GENERATOR, RANDOM_BYTES_GENERATOR, API_KEY_GENERATOR, HEX_TOKEN_GENERATOR, BASE64_TOKEN_GENERATOR, UUID_GENERATOR, ED25519_KEYPAIR_GENERATOR, RSA_KEYPAIR_GENERATOR}
+
+var HEX_ENCODING = "HEX"
+var BASE64_ENCODING = "BASE64"
+var BASE64URL_ENCODING = "BASE64URL"
+
+var CURRENT_STAGE = "AWSCURRENT"
+var PREVIOUS_STAGE = "AWSPREVIOUS"
+var PREVIOUS_VALUES_KEY = "__" + PREVIOUS_STAGE
+
+// Staging label keeping a re-encrypted previous value until AWSPREVIOUS is moved to it
+var REENCRYPTION_STAGE = "SECRETSVC_REENCRYPTION"
+
+// Tag used to find the PRIVATE secrets of a secret group
+var SECRET_GROUP_TAG = "SecretGroup"
+
+// Tags of the system secrets, used to rebuild the inventory
+var ORGANIZATION_TAG = "OrganizationId"
+var PROJECT_TAG = "ProjectId"
+var SCOPE_TAG = "Scope"
+
+var PERMISSION_ALLOWED = "ALLOWED"
+var PERMISSION_DENIED = "DENIED"
+var PERMISSION_UNVERIFIED = "UNVERIFIED"
+var PERMISSION_PROBE_PREFIX = "secret-svc-probe-"
+
+// Name prefix of the PRIVATE secrets, followed by a UUID
+var PRIVATE_SECRET_PREFIX = "secret_"
+
+// Effects and sources of the authorization policies
+var ALLOW_EFFECT = "ALLOW"
+var DENY_EFFECT = "DENY"
+var FILE_POLICY_SOURCE = "FILE"
+var API_POLICY_SOURCE = "API"
+
+// Routes matched by the authorization policies
+var SYSTEM_ROUTE = "SYSTEM"
+var SECRET_ROUTE = "SECRET"
+var DYNAMIC_ROUTE = "DYNAMIC"
+var WEBHOOK_ROUTE = "WEBHOOK"
+var JOB_ROUTE = "JOB"
+var ADMIN_ROUTE = "ADMIN"
+var AUDIT_ROUTE = "AUDIT"
+var ACCEPTED_ROUTES = [7]string{SYSTEM_ROUTE, SECRET_ROUTE, DYNAMIC_ROUTE, WEBHOOK_ROUTE, JOB_ROUTE, ADMIN_ROUTE, AUDIT_ROUTE}
+var ACCEPTED_METHODS = [6]string{"GET", "POST", "PUT", "PATCH", "DELETE", REVEAL_METHOD}
+
+// Method of the authorization requests revealing the secret values of masked scopes (GET /secret/:id?reveal=true)
+var REVEAL_METHOD = "REVEAL"
+
+// Tenants of the data keys sealing the SHARED secret values
+var ORGANIZATION_KEY_SCOPE = "ORGANIZATION"
+var PROJECT_KEY_SCOPE = "PROJECT"
+
+// Formats of the onboarding templates
+var CLOUDFORMATION_FORMAT = "CLOUDFORMATION"
+var TERRAFORM_FORMAT = "TERRAFORM"
+
+var PLANNED_STATUS = "PLANNED"
+var RUNNING_STATUS = "RUNNING"
+var EXECUTED_STATUS = "EXECUTED"
+var FAILED_STATUS = "FAILED"
+var COMPLETED_STATUS = "COMPLETED"
+var ROLLED_BACK_STATUS = "ROLLED_BACK"
+var QUEUED_STATUS = "QUEUED"
+var SUCCEEDED_STATUS = "SUCCEEDED"
+var CANCELLED_STATUS = "CANCELLED"
+var DELETED_STATUS = "DELETED"
+var SKIPPED_STATUS = "SKIPPED"
+var HEALTHY_STATUS = "HEALTHY"
+var UNHEALTHY_STATUS = "UNHEALTHY"
+var UNKNOWN_STATUS = "UNKNOWN"
+
+// Long-running operations processed by the job workers
+var PLAN_APPROVAL_JOB = "PLAN_APPROVAL"
+var MIGRATION_RESUME_JOB = "MIGRATION_RESUME"
+var MIGRATION_ROLLBACK_JOB = "MIGRATION_ROLLBACK"
+var SYSTEM_DELETION_JOB = "SYSTEM_DELETION"
+var GROUP_DELETION_JOB = "GROUP_DELETION"
+var INVENTORY_REBUILD_JOB = "INVENTORY_REBUILD"
+var ORG_DELETION_JOB = "ORG_DELETION"
+var SECRET_ADOPTION_JOB = "SECRET_ADOPTION"
+
+// Migration phases, in order
+var COPY_PHASE = "COPY"
+var VERIFY_PHASE = "VERIFY"
+var SWITCH_PHASE = "SWITCH"
+var DELETE_PHASE = "DELETE"
+var ROLLBACK_PHASE = "ROLLBACK"
+
+var SCHEDULED_ROTATION = "SCHEDULED"
+var MANUAL_ROTATION = "MANUAL"
+var SUCCESS_OUTCOME = "SUCCESS"
+var FAILURE_OUTCOME = "FAILURE"
+var DENIED_OUTCOME = "DENIED"
+var POSTGRES_ENGINE = "POSTGRES"
+
+var CREATED_EVENT = "created"
+var UPDATED_EVENT = "updated"
+var DELETED_EVENT = "deleted"
+var ROTATED_EVENT = "rotated"
+var MIGRATED_EVENT = "migrated"
+var REGISTERED_EVENT = "registered"
+var DEREGISTERED_EVENT = "deregistered"
+var ACCEPTED_EVENTS = [7]string{CREATED_EVENT, UPDATED_EVENT, DELETED_EVENT, ROTATED_EVENT, MIGRATED_EVENT, REGISTERED_EVENT, DEREGISTERED_EVENT}
+
+// Sent to watchers resuming from an event which is no longer retained
+var RESET_EVENT = "reset"
+
+var NATS_PUBLISHER = "nats"
+var KAFKA_PUBLISHER = "kafka"
+
+// Actor of the audit events recorded by background work (schedulers, jobs)
+var SYSTEM_ACTOR = "system"
@@ -3,13 +3,17 @@ package constants
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var ErrFormat = errors.New("invalid request format. expected a json object with key-value pairs")
 var ErrInvalidFlow = fmt.Errorf("invalid 'flow' type in request body. the flow can be '%s' or '%s'", ACCEPTED_FLOWS[0], ACCEPTED_FLOWS[1])
-var ErrInvalidScope = fmt.Errorf("invalid 'scope' in headers. x-scope can be  '%s', '%s' or '%s'", ACCEPTED_SCOPES[0], ACCEPTED_SCOPES[1], ACCEPTED_SCOPES[2])
+var ErrInvalidScope = errors.New("invalid 'scope'. the scope must be registered for the organization, see GET /admin/scopes")
+var ErrInvalidScopesAttr = errors.New("'scopes' attribute must be an object mapping a scope to its flow settings in request body")
+var ErrUntargetedScope = errors.New("'scopes' attribute lists a scope that is not targeted by the x-scope header")
 var ErrMissingFlowAttr = errors.New("'flow' attribute missing or not a string in request body")
 var ErrMissingSecretAttr = errors.New("'secret' attribute missing or not a string in request body")
+var ErrConflictingSecretAttrs = errors.New("only one of 'secret' or 'generate' attributes can be provided in request body")
 var ErrSecretNotBase64Encoded = errors.New("'secret' attribute value might not be base64 encoded")
 var ErrEmptyOrgId = errors.New("organization id cannot be empty. check headers")
 var ErrEmptyProjId = errors.New("scope can't exists without a project. check headers")
@@ -22,4 +26,102 @@ var ErrUUIDsNotFound = errors.New("uuid not found ")
 var ErrSecretsNotFound = errors.New("provided key does not have secrets for migration")
 var ErrKeyExsists = errors.New("key already exsist  check headers")
 var ErrUnregisteredKey = errors.New("provided key is not registered to use the secret service  check headers")
-var ErrInvalidMigration = errors.New("invalid migration attempt. migrations can only be done from shared->external or external->external")
+var ErrInvalidMigration = errors.New("invalid migration attempt. migrations can only be done from shared->private, private->private or private->shared")
+var ErrRecordNotFound = errors.New("record not found")
+var ErrInvalidGeneratorType = fmt.Errorf("invalid generator 'type'. the type can be one of '%s'", strings.Join(ACCEPTED_GENERATORS[:], "', '"))
+var ErrInvalidGeneratorLength = errors.New("invalid generator 'length'. the length must be between 1 and 4096")
+var ErrInvalidGeneratorEncoding = fmt.Errorf("invalid generator 'encoding'. the encoding can be '%s', '%s' or '%s'", HEX_ENCODING, BASE64_ENCODING, BASE64URL_ENCODING)
+var ErrMissingIntervalAttr = errors.New("'interval' attribute missing or not a valid duration of at least 1m in request body. ex: 720h")
+var ErrMissingGeneratorAttr = errors.New("'generator' attribute missing or not an object in request body")
+var ErrRotationPolicyNotFound = errors.New("rotation policy not found for the secret")
+var ErrRotationInProgress = errors.New("rotation already in progress for the secret")
+var ErrRotationNotDue = errors.New("rotation is not due for the secret")
+var ErrInvalidStage = fmt.Errorf("invalid 'stage' query param. the stage can be '%s' or '%s'", CURRENT_STAGE, PREVIOUS_STAGE)
+var ErrInvalidGeneratorComplexity = errors.New("invalid generator complexity rules. the minimum character counts can't exceed the length or the allowed characters")
+var ErrInvalidKeySize = errors.New("invalid generator 'bits'. rsa keys can be 2048, 3072 or 4096 bits")
+var ErrMissingConnectionUrlAttr = errors.New("'connectionUrl' attribute missing or not a string in request body")
+var ErrDynamicConfigNotFound = errors.New("dynamic secret engine connection not configured for the key")
+var ErrDynamicRoleNotFound = errors.New("dynamic secret role not found")
+var ErrLeaseNotFound = errors.New("lease not found")
+var ErrInvalidTtl = errors.New("invalid ttl. ttl values must be valid durations of at least 1m and 'defaultTtl' can't exceed 'maxTtl'. ex: 1h")
+var ErrInvalidStatementsAttr = errors.New("statement attributes must be arrays of strings in request body")
+var ErrInvalidRoleName = errors.New("invalid role name. role names can only contain letters, digits, - and _")
+var ErrRevocationInProgress = errors.New("lease revocation already in progress")
+var ErrMissingUrlAttr = errors.New("'url' attribute missing or not a valid http(s) url in request body")
+var ErrInvalidEventsAttr = fmt.Errorf("invalid 'events' attribute in request body. events can be '%s'", strings.Join(ACCEPTED_EVENTS[:], "', '"))
+var ErrWebhookNotFound = errors.New("webhook not found")
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+var ErrInvalidOutboxPublisher = errors.New("invalid OUTBOX_PUBLISHER. publisher can be 'nats' or 'kafka'")
+var ErrSameMigrationTarget = errors.New("invalid migration attempt. the secrets are already stored in the given arn and region")
+var ErrUntaggedPrivateSecrets = fmt.Errorf("invalid migration attempt. the private secret manager has secrets of the organization without a '%s' tag", SECRET_GROUP_TAG)
+var ErrMigrationPlanNotFound = errors.New("migration plan not found")
+var ErrMigrationPlanExpired = errors.New("migration plan expired. create a new plan")
+var ErrMigrationPlanNotApprovable = errors.New("migration plan has errors and can't be approved")
+var ErrMigrationPlanUsed = errors.New("migration plan was already approved")
+var ErrMigrationPlanStale = errors.New("system secrets changed since the migration plan was created. create a new plan")
+var ErrMigrationNotFound = errors.New("migration not found")
+var ErrMigrationInProgress = errors.New("a migration of these system secrets is already in progress")
+var ErrMigrationFinished = errors.New("migration already completed or rolled back")
+var ErrMigrationRollbackNotAllowed = errors.New("source secrets are being deleted. the migration can only be resumed")
+var ErrMigrationVerificationFailed = errors.New("migrated secrets don't match their source")
+var ErrJobNotFound = errors.New("job not found")
+var ErrJobFinished = errors.New("job already finished")
+var ErrJobCancelled = errors.New("job cancelled")
+var ErrInvalidJobType = errors.New("invalid job type")
+var ErrScopeNotFound = errors.New("scope not found for the organization")
+var ErrInvalidScopeName = errors.New("invalid scope name. scope names must be 1-32 uppercase letters, digits or underscores starting with a letter")
+var ErrInvalidMaxSecretSize = errors.New("'maxSecretSize' attribute must be a positive number of bytes in request body")
+var ErrSecretTooLarge = errors.New("secret exceeds the max secret size of the scope")
+var ErrAdminApiDisabled = errors.New("admin API is disabled. set ADMIN_API_KEY to enable it")
+var ErrInvalidAdminKey = errors.New("invalid admin key. check the x-admin-key header")
+var ErrSystemSecretVersionNotFound = errors.New("system secret version not found for the provided key")
+var ErrInvalidInventoryLimit = errors.New("'limit' must be a number between 1 and 100")
+var ErrInvalidNextToken = errors.New("invalid 'nextToken'. use the token returned by the previous page")
+var ErrOrgOffboardingProject = errors.New("organizations are offboarded with the x-organization-id header only")
+var ErrMissingConfirmationToken = errors.New("missing confirmation token. request one with POST /system/org/offboard")
+var ErrInvalidConfirmationToken = errors.New("invalid or expired confirmation token. request a new one with POST /system/org/offboard")
+var ErrOrgDeletionIncomplete = errors.New("some registrations of the organization couldn't be deleted")
+var ErrPrivateAccessDenied = errors.New("the PRIVATE secret manager failed the access verification. check the report for missing permissions")
+var ErrInvalidRegion = errors.New("invalid region for the 'Private' flow")
+var ErrInvalidHealthStatus = errors.New("invalid status. status can be HEALTHY, UNHEALTHY, UNKNOWN or ALL")
+var ErrInvalidTemplateFormat = errors.New("invalid format. format can be CLOUDFORMATION or TERRAFORM")
+var ErrExternalIdDisabled = errors.New("onboarding templates are disabled. set EXTERNAL_ID_SECRET to enable them")
+var ErrMissingCredentials = errors.New("unauthenticated request. send a client certificate or a bearer token")
+var ErrInvalidToken = errors.New("invalid bearer token")
+var ErrExpiredToken = errors.New("expired bearer token")
+var ErrUnknownSigningKey = errors.New("bearer token signed by an unknown key")
+var ErrInvalidJWKS = errors.New("invalid JWKS. no usable signing key was found")
+var ErrAuthNotConfigured = errors.New("no authentication method is configured. set AUTH_JWKS or TLS_CLIENT_CA_FILE, or AUTH_DISABLED=true")
+var ErrInvalidClientCA = errors.New("invalid TLS_CLIENT_CA_FILE. no PEM certificate was found")
+var ErrAccessDenied = errors.New("access denied. no policy allows the request")
+var ErrInvalidPolicyId = errors.New("invalid policy ID. use up to 64 letters, digits, '_', '.' or '-'")
+var ErrInvalidPolicyEffect = errors.New("invalid effect. effect can be ALLOW or DENY")
+var ErrMissingPolicySubjects = errors.New("'subjects' must be a non-empty list of caller identities")
+var ErrInvalidPolicyMethods = errors.New("invalid 'methods'. methods can be GET, POST, PUT, PATCH, DELETE or REVEAL")
+var ErrInvalidPolicyRoutes = errors.New("invalid 'routes'. routes can be SYSTEM, SECRET, DYNAMIC, WEBHOOK, JOB, ADMIN or AUDIT")
+var ErrPolicyNotFound = errors.New("policy not found for the provided ID")
+var ErrReadOnlyPolicy = errors.New("policies of the policy file can't be changed through the API")
+var ErrInvalidMasterKey = errors.New("invalid ENVELOPE_MASTER_KEY. use a base64 encoded 32 byte key")
+var ErrInvalidEnvelopeKeyScope = errors.New("invalid ENVELOPE_KEY_SCOPE. scope can be ORGANIZATION or PROJECT")
+var ErrEnvelopeKeyUnavailable = errors.New("the data key of the encrypted secret value is unavailable. check the envelope encryption settings")
+var ErrInvalidEnvelope = errors.New("encrypted secret value couldn't be decrypted")
+var ErrInvalidKmsKey = errors.New("invalid 'kmsKeyId'. use the ARN of a KMS key or alias")
+var ErrKmsKeyRegionMismatch = errors.New("the KMS key must be in the region of the 'Private' flow")
+var ErrKmsKeyNotPrivate = errors.New("'kmsKeyId' is only accepted for the 'Private' flow")
+var ErrAuditDisabled = errors.New("auditing is disabled. set AUDIT_SINK to record the audit events")
+var ErrInvalidAuditSink = errors.New("invalid AUDIT_SINK. sink can be FILE, SQL, BATCH or NONE")
+var ErrInvalidAuditBatch = errors.New("invalid AUDIT_BATCH_SIZE. use a positive number of events")
+var ErrInvalidAuditLimit = errors.New("invalid limit. limit should be between 1 and 500")
+var ErrInvalidAuditTime = errors.New("invalid 'from' or 'to'. use RFC 3339 timestamps")
+var ErrInvalidAuditOutcome = errors.New("invalid outcome. outcome can be SUCCESS, FAILURE or DENIED")
+var ErrInvalidAuditSigningKey = errors.New("invalid AUDIT_SIGNING_KEY. use a base64 encoded ed25519 seed or private key")
+var ErrInvalidAuditPublicKey = errors.New("invalid public key. use a base64 encoded ed25519 public key")
+var ErrAuditChainLocked = errors.New("the audit chain of the organization is locked by another writer. try again")
+var ErrAuditCheckpointsDisabled = errors.New("audit checkpoints are disabled. set AUDIT_SIGNING_KEY to sign them")
+var ErrOutboxRequiresRedis = errors.New("OUTBOX_PUBLISHER requires Redis. the in-memory store loses the outbox on restart, unset BYPASS_REDIS")
+var ErrSecretGroupBusy = errors.New("a job or migration is rewriting the secret groups of this key. try again once it finished")
+var ErrInvalidGeneratorCharset = errors.New("invalid generator charset. use printable ASCII characters")
+var ErrLeaseExpired = errors.New("lease expired. expired leases can't be renewed, issue new credentials")
+var ErrAdoptionNotPrivate = errors.New("invalid adoption attempt. untagged secrets can only be adopted by a key registered with the PRIVATE flow")
+var ErrSecretNotUntagged = errors.New("invalid 'secretIds'. only untagged secrets of the organization can be adopted")
+var ErrAuditChainConflict = errors.New("another replica appended the same event of the audit chain of the organization. try again")
@@ -8,3 +8,8 @@ var TRACE_ID_HEADER = "x-trace-id"
 var ARN_HEADER = "x-arn"
 var REGION_HEADER = "x-region"
 var PROVIDER_HEADER = "x-provider"
+var ADMIN_KEY_HEADER = "x-admin-key"
+var CONFIRMATION_TOKEN_HEADER = "x-confirmation-token"
+
+// Key of the caller identity in the gin context
+var IDENTITY_CONTEXT_KEY = "identity"
@@ -0,0 +1,150 @@
+package dynamic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"secret-svc/pkg/generators"
+
+	_ "github.com/lib/pq"
+)
+
+var DEFAULT_CREATION_STATEMENTS = []string{
+	`CREATE ROLE "{{name}}" WITH LOGIN PASSWORD '{{password}}' VALID UNTIL '{{expiration}}';`,
+}
+var DEFAULT_RENEW_STATEMENTS = []string{
+	`ALTER ROLE "{{name}}" VALID UNTIL '{{expiration}}';`,
+}
+var DEFAULT_REVOCATION_STATEMENTS = []string{
+	`REASSIGN OWNED BY "{{name}}" TO CURRENT_USER;`,
+	`DROP OWNED BY "{{name}}";`,
+	`DROP ROLE IF EXISTS "{{name}}";`,
+}
+
+var ROLE_NAME_LIMIT = 30
+var POSTGRES_PASSWORD_LENGTH = 32
+var STATEMENT_TIMEOUT = 30 * time.Second
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// Generated credentials for a dynamic database user
+type Credentials struct {
+	Username   string
+	Password   string
+	Expiration time.Time
+}
+
+// Opens a PostgreSQL connection pool and checks the connection
+// ///////////////////////////////////////////////////////////////
+func OpenPostgres(connectionUrl string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connectionUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), STATEMENT_TIMEOUT)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Creates a new database user using the role creation statements
+// //////////////////////////////////////////////////////////////////
+func CreatePostgresUser(db *sql.DB, role string, statements []string, expiration time.Time) (Credentials, error) {
+	password, err := generators.RandomPassword(POSTGRES_PASSWORD_LENGTH, generators.DEFAULT_CHARSET)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	credentials := Credentials{
+		Username:   GenerateUsername(role),
+		Password:   password,
+		Expiration: expiration.UTC(),
+	}
+
+	err = execStatements(db, defaultIfEmpty(statements, DEFAULT_CREATION_STATEMENTS), credentials)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return credentials, nil
+}
+
+// Extends the expiration of a database user
+// /////////////////////////////////////////////
+func RenewPostgresUser(db *sql.DB, username string, statements []string, expiration time.Time) error {
+	return execStatements(db, defaultIfEmpty(statements, DEFAULT_RENEW_STATEMENTS), Credentials{
+		Username:   username,
+		Expiration: expiration.UTC(),
+	})
+}
+
+// Removes a database user using the role revocation statements
+// ////////////////////////////////////////////////////////////////
+func RevokePostgresUser(db *sql.DB, username string, statements []string) error {
+	return execStatements(db, defaultIfEmpty(statements, DEFAULT_REVOCATION_STATEMENTS), Credentials{
+		Username: username,
+	})
+}
+
+// Replaces the template placeholders of a statement
+// ////////////////////////////////////////////////////
+// - {{name}}, {{password}} and {{expiration}} are supported
+func RenderStatement(statement string, credentials Credentials) string {
+	return strings.NewReplacer(
+		"{{name}}", credentials.Username,
+		"{{password}}", credentials.Password,
+		"{{expiration}}", credentials.Expiration.Format(time.RFC3339),
+	).Replace(statement)
+}
+
+// Generates a unique PostgreSQL safe username for a role
+// /////////////////////////////////////////////////////////
+func GenerateUsername(role string) string {
+	suffix, _ := generators.RandomPassword(8, generators.LOWERCASE_CHARSET+generators.DIGITS_CHARSET)
+	roleName := invalidNameChars.ReplaceAllString(strings.ToLower(role), "_")
+
+	// Keeping the username within the PostgreSQL identifier limit
+	if len(roleName) > ROLE_NAME_LIMIT {
+		roleName = roleName[:ROLE_NAME_LIMIT]
+	}
+
+	return fmt.Sprintf("v_%s_%s_%d", roleName, suffix, time.Now().Unix())
+}
+
+// Helper function to run statements in a single transaction
+// ////////////////////////////////////////////////////////////
+func execStatements(db *sql.DB, statements []string, credentials Credentials) error {
+	ctx, cancel := context.WithTimeout(context.Background(), STATEMENT_TIMEOUT)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, RenderStatement(statement, credentials)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func defaultIfEmpty(statements []string, defaultStatements []string) []string {
+	if len(statements) == 0 {
+		return defaultStatements
+	}
+
+	return statements
+}
@@ -0,0 +1,266 @@
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+
+	"go.uber.org/zap"
+)
+
+// Version of the envelope format, stored under ENVELOPE_MARKER
+var ENVELOPE_VERSION = 1
+var ENVELOPE_MARKER = "__envelope"
+
+// Wraps and unwraps the data keys sealing the secret values
+// - keyName identifies the tenant of a data key, it's bound to the wrapped key
+type KeyWrapper interface {
+	Name() string
+	GenerateDataKey(ctx context.Context, keyName string) ([]byte, []byte, error)
+	UnwrapDataKey(ctx context.Context, keyName string, wrappedKey []byte) ([]byte, error)
+}
+
+// Secret value sealed with a data key, the wrapped data key travels with the value
+// - the ciphertext is bound to the location of the value (AAD), it can't be moved to another secret
+type Envelope struct {
+	Version    int    `json:"__envelope"`
+	Wrapper    string `json:"wrapper"`
+	KeyName    string `json:"keyName"`
+	DataKey    string `json:"dataKey"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type dataKey struct {
+	plaintext []byte
+	wrapped   []byte
+}
+
+var wrapper KeyWrapper
+var mutex sync.Mutex
+
+// Plaintext data keys by key name (sealing) and by wrapped key (opening)
+var sealingKeys = map[string]dataKey{}
+var openingKeys = map[string][]byte{}
+
+func dataKeyKey(wrapperName string, keyName string) string {
+	return "envelope:datakey:" + wrapperName + ":" + keyName
+}
+
+// Method for sealing the secret values with the data keys of a key wrapper
+// ///////////////////////////////////////////////////////////////////////////
+// - nil disables the sealing, sealed values can't be opened anymore
+func Use(keyWrapper KeyWrapper) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	wrapper = keyWrapper
+	sealingKeys = map[string]dataKey{}
+	openingKeys = map[string][]byte{}
+}
+
+// Returns true when the secret values are sealed
+func Enabled() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return wrapper != nil
+}
+
+// Seals a value with the data key of keyName
+// //////////////////////////////////////////////
+// - the data key is generated on first use, its wrapped form is kept in the store
+func Seal(keyName string, aad string, plaintext []byte) (Envelope, error) {
+	mutex.Lock()
+	keyWrapper := wrapper
+	mutex.Unlock()
+	if keyWrapper == nil {
+		return Envelope{}, constants.ErrEnvelopeKeyUnavailable
+	}
+
+	key, err := getSealingKey(keyWrapper, keyName)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	gcm, err := newGCM(key.plaintext)
+	if err != nil {
+		return Envelope{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		Version:    ENVELOPE_VERSION,
+		Wrapper:    keyWrapper.Name(),
+		KeyName:    keyName,
+		DataKey:    base64.StdEncoding.EncodeToString(key.wrapped),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, []byte(aad))),
+	}, nil
+}
+
+// Opens a sealed value, the AAD must be the one it was sealed with
+// ////////////////////////////////////////////////////////////////////
+func Open(envelope Envelope, aad string) ([]byte, error) {
+	mutex.Lock()
+	keyWrapper := wrapper
+	mutex.Unlock()
+	if keyWrapper == nil || keyWrapper.Name() != envelope.Wrapper {
+		return nil, constants.ErrEnvelopeKeyUnavailable
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(envelope.DataKey)
+	if err != nil {
+		return nil, constants.ErrInvalidEnvelope
+	}
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, constants.ErrInvalidEnvelope
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, constants.ErrInvalidEnvelope
+	}
+
+	key, err := getOpeningKey(keyWrapper, envelope.KeyName, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, constants.ErrInvalidEnvelope
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return nil, constants.ErrInvalidEnvelope
+	}
+	return plaintext, nil
+}
+
+// Returns the envelope of a stored value, false for plaintext values
+// ///////////////////////////////////////////////////////////////////////
+func FromValue(value interface{}) (Envelope, bool) {
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return Envelope{}, false
+	}
+	if _, sealed := valueMap[ENVELOPE_MARKER]; !sealed {
+		return Envelope{}, false
+	}
+
+	data, err := json.Marshal(valueMap)
+	if err != nil {
+		return Envelope{}, false
+	}
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Version != ENVELOPE_VERSION {
+		return Envelope{}, false
+	}
+
+	return envelope, true
+}
+
+// Helper function to get the data key of keyName, generating and storing it on first use
+// //////////////////////////////////////////////////////////////////////////////////////////
+// - instances racing on a new key keep the one stored first
+func getSealingKey(keyWrapper KeyWrapper, keyName string) (dataKey, error) {
+	mutex.Lock()
+	key, found := sealingKeys[keyName]
+	mutex.Unlock()
+	if found {
+		return key, nil
+	}
+
+	storeKey := dataKeyKey(keyWrapper.Name(), keyName)
+	stored, err := store.Default().Get(storeKey)
+	if err != nil && err != constants.ErrRecordNotFound {
+		return dataKey{}, err
+	}
+
+	if err == constants.ErrRecordNotFound {
+		plaintext, wrapped, err := keyWrapper.GenerateDataKey(context.TODO(), keyName)
+		if err != nil {
+			zap.L().Error("Generating Data Key Failed :: " + keyName + " :: " + err.Error())
+			return dataKey{}, err
+		}
+
+		created, err := store.Default().SetNX(storeKey, base64.StdEncoding.EncodeToString(wrapped), 0)
+		if err != nil {
+			return dataKey{}, err
+		}
+		if created {
+			zap.L().Info("Data Key Generated :: " + keyName)
+			key = dataKey{plaintext: plaintext, wrapped: wrapped}
+			cacheDataKey(keyName, key)
+			return key, nil
+		}
+		if stored, err = store.Default().Get(storeKey); err != nil {
+			return dataKey{}, err
+		}
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return dataKey{}, constants.ErrInvalidEnvelope
+	}
+	plaintext, err := getOpeningKey(keyWrapper, keyName, wrapped)
+	if err != nil {
+		return dataKey{}, err
+	}
+
+	key = dataKey{plaintext: plaintext, wrapped: wrapped}
+	cacheDataKey(keyName, key)
+	return key, nil
+}
+
+// Helper function to unwrap a data key, unwrapped keys are cached
+func getOpeningKey(keyWrapper KeyWrapper, keyName string, wrapped []byte) ([]byte, error) {
+	cacheKey := keyName + ":" + base64.StdEncoding.EncodeToString(wrapped)
+	mutex.Lock()
+	plaintext, found := openingKeys[cacheKey]
+	mutex.Unlock()
+	if found {
+		return plaintext, nil
+	}
+
+	plaintext, err := keyWrapper.UnwrapDataKey(context.TODO(), keyName, wrapped)
+	if err != nil {
+		zap.L().Error("Unwrapping Data Key Failed :: " + keyName + " :: " + err.Error())
+		return nil, constants.ErrEnvelopeKeyUnavailable
+	}
+
+	mutex.Lock()
+	openingKeys[cacheKey] = plaintext
+	mutex.Unlock()
+	return plaintext, nil
+}
+
+func cacheDataKey(keyName string, key dataKey) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	sealingKeys[keyName] = key
+	openingKeys[keyName+":"+base64.StdEncoding.EncodeToString(key.wrapped)] = key.plaintext
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,113 @@
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+
+	"secret-svc/pkg/constants"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+var LOCAL_WRAPPER = "LOCAL"
+var KMS_WRAPPER = "KMS"
+
+// Encryption context of the KMS data keys, binding them to their tenant
+var KMS_CONTEXT_KEY = "dataKey"
+
+// Key wrapper of the dev mode, wrapping the data keys with a local AES-256 master key
+type LocalKeyWrapper struct {
+	masterKey []byte
+}
+
+// Creates a local key wrapper from a base64 encoded 32 byte master key
+// ///////////////////////////////////////////////////////////////////////
+func NewLocalKeyWrapper(encodedKey string) (*LocalKeyWrapper, error) {
+	masterKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(masterKey) != 32 {
+		return nil, constants.ErrInvalidMasterKey
+	}
+
+	return &LocalKeyWrapper{masterKey: masterKey}, nil
+}
+
+func (w *LocalKeyWrapper) Name() string {
+	return LOCAL_WRAPPER
+}
+
+// Wrapped keys are nonce || ciphertext, the key name is the AAD
+func (w *LocalKeyWrapper) GenerateDataKey(ctx context.Context, keyName string) ([]byte, []byte, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := newGCM(w.masterKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return plaintext, gcm.Seal(nonce, nonce, plaintext, []byte(keyName)), nil
+}
+
+func (w *LocalKeyWrapper) UnwrapDataKey(ctx context.Context, keyName string, wrappedKey []byte) ([]byte, error) {
+	gcm, err := newGCM(w.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappedKey) < gcm.NonceSize() {
+		return nil, constants.ErrInvalidEnvelope
+	}
+
+	nonce, ciphertext := wrappedKey[:gcm.NonceSize()], wrappedKey[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(keyName))
+}
+
+// Key wrapper using a KMS key, data keys are generated by KMS
+type KMSKeyWrapper struct {
+	client *kms.Client
+	keyId  string
+}
+
+// Creates a KMS key wrapper, keyId is the ID, ARN or alias of a symmetric key
+// ////////////////////////////////////////////////////////////////////////////////
+func NewKMSKeyWrapper(client *kms.Client, keyId string) *KMSKeyWrapper {
+	return &KMSKeyWrapper{client: client, keyId: keyId}
+}
+
+func (w *KMSKeyWrapper) Name() string {
+	return KMS_WRAPPER
+}
+
+func (w *KMSKeyWrapper) GenerateDataKey(ctx context.Context, keyName string) ([]byte, []byte, error) {
+	output, err := w.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(w.keyId),
+		KeySpec:           types.DataKeySpecAes256,
+		EncryptionContext: map[string]string{KMS_CONTEXT_KEY: keyName},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+// The wrapped key names its KMS key, keys sealed before a key change stay readable
+func (w *KMSKeyWrapper) UnwrapDataKey(ctx context.Context, keyName string, wrappedKey []byte) ([]byte, error) {
+	output, err := w.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    wrappedKey,
+		EncryptionContext: map[string]string{KMS_CONTEXT_KEY: keyName},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Plaintext, nil
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Secret lifecycle event, never carries secret values
+type Event struct {
+	Id        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	OrgId     string                 `json:"orgId"`
+	ProjectId string                 `json:"projectId,omitempty"`
+	Scope     string                 `json:"scope,omitempty"`
+	SecretId  string                 `json:"secretId,omitempty"`
+	VersionId string                 `json:"versionId,omitempty"`
+	TraceId   string                 `json:"traceId,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// Subscribers must return quickly, slow work has to be queued
+type Subscriber func(event Event)
+
+var mu sync.RWMutex
+var subscribers []Subscriber
+
+// Registers a subscriber for every published event
+// ////////////////////////////////////////////////////
+func Subscribe(subscriber Subscriber) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscribers = append(subscribers, subscriber)
+}
+
+// Publishes an event to every subscriber and broadcasts it to the watchers
+// ///////////////////////////////////////////////////////////////////////////
+// - subscribers only run on the replica publishing the event
+func Publish(event Event) Event {
+	if event.Id == "" {
+		id, _ := uuid.NewRandom()
+		event.Id = "evt_" + id.String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	mu.RLock()
+	for _, subscriber := range subscribers {
+		notify(subscriber, event)
+	}
+	mu.RUnlock()
+
+	if err := broker.Broadcast(event); err != nil {
+		zap.L().Error("Broadcasting Event Failed :: " + err.Error())
+	}
+
+	return event
+}
+
+// Helper function to keep a failing subscriber from breaking the publisher
+// ///////////////////////////////////////////////////////////////////////////
+func notify(subscriber Subscriber, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			zap.L().Error("Event Subscriber Failed", zap.Any("error", r), zap.String("event", event.Type))
+		}
+	}()
+
+	subscriber(event)
+}
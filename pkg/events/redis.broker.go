@@ -0,0 +1,75 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+var REDIS_EVENTS_CHANNEL = "secretsvc:events"
+var REDIS_RECONNECT_DELAY = time.Second
+
+// Redis pub/sub broker delivering events to the watchers of all replicas
+type RedisBroker struct {
+	pool *redis.Pool
+}
+
+// Method for broadcasting events through Redis pub/sub
+// ///////////////////////////////////////////////////////
+// - starts listening to the events channel in the background
+func UseRedis(pool *redis.Pool) {
+	redisBroker := &RedisBroker{pool: pool}
+	UseBroker(redisBroker)
+
+	go redisBroker.listen()
+}
+
+func (r *RedisBroker) Broadcast(event Event) error {
+	jsonBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("PUBLISH", REDIS_EVENTS_CHANNEL, jsonBytes)
+	return err
+}
+
+// Helper function to subscribe to the events channel, reconnecting on failures
+// ///////////////////////////////////////////////////////////////////////////////
+func (r *RedisBroker) listen() {
+	for {
+		if err := r.receive(); err != nil {
+			zap.L().Error("Redis Events Subscription Failed :: " + err.Error())
+		}
+		time.Sleep(REDIS_RECONNECT_DELAY)
+	}
+}
+
+func (r *RedisBroker) receive() error {
+	pubSubConn := redis.PubSubConn{Conn: r.pool.Get()}
+	defer pubSubConn.Close()
+
+	if err := pubSubConn.Subscribe(REDIS_EVENTS_CHANNEL); err != nil {
+		return err
+	}
+
+	for {
+		switch message := pubSubConn.ReceiveWithTimeout(0).(type) {
+		case redis.Message:
+			var event Event
+			if err := json.Unmarshal(message.Data, &event); err != nil {
+				zap.L().Error("Invalid Event Received :: " + err.Error())
+				continue
+			}
+			deliver(event)
+
+		case error:
+			return message
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"sync"
+)
+
+// Broker fans published events out to the watchers of every replica
+type Broker interface {
+	Broadcast(event Event) error
+}
+
+// Without Redis events only reach the watchers of this replica
+type localBroker struct{}
+
+func (localBroker) Broadcast(event Event) error {
+	deliver(event)
+	return nil
+}
+
+var broker Broker = localBroker{}
+
+var watchersMu sync.Mutex
+var watchers = map[chan Event]struct{}{}
+
+// Method for replacing the broker used to broadcast events
+// ///////////////////////////////////////////////////////////
+func UseBroker(b Broker) {
+	broker = b
+}
+
+// Registers a watcher receiving the events broadcast to this replica
+// /////////////////////////////////////////////////////////////////////
+// - the channel is closed when the watcher falls behind by more than buffer events
+// - the returned function stops the watcher
+func Watch(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	watchersMu.Lock()
+	watchers[ch] = struct{}{}
+	watchersMu.Unlock()
+
+	return ch, func() {
+		watchersMu.Lock()
+		defer watchersMu.Unlock()
+
+		if _, ok := watchers[ch]; ok {
+			delete(watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Helper function to hand an event to the local watchers without blocking
+// ///////////////////////////////////////////////////////////////////////////
+func deliver(event Event) {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	for ch := range watchers {
+		select {
+		case ch <- event:
+		default:
+			// Slow watchers are dropped and resume using their last event ID
+			delete(watchers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package generators
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"secret-svc/pkg/constants"
+
+	"github.com/google/uuid"
+)
+
+var LOWERCASE_CHARSET = "abcdefghijklmnopqrstuvwxyz"
+var UPPERCASE_CHARSET = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+var DIGITS_CHARSET = "0123456789"
+var SYMBOLS_CHARSET = "!#$%&*+-=?@^_"
+var DEFAULT_CHARSET = LOWERCASE_CHARSET + UPPERCASE_CHARSET + DIGITS_CHARSET
+
+var DEFAULT_PASSWORD_LENGTH = 32
+var DEFAULT_BYTES_LENGTH = 32
+var MAX_LENGTH = 4096
+
+// Generator settings used to produce new secret values
+type Spec struct {
+	Type         string `json:"type"`
+	Length       int    `json:"length,omitempty"`
+	Charset      string `json:"charset,omitempty"`
+	Encoding     string `json:"encoding,omitempty"`
+	Prefix       string `json:"prefix,omitempty"`
+	MinLower     int    `json:"minLower,omitempty"`
+	MinUpper     int    `json:"minUpper,omitempty"`
+	MinDigits    int    `json:"minDigits,omitempty"`
+	MinSymbols   int    `json:"minSymbols,omitempty"`
+	ExcludeChars string `json:"excludeChars,omitempty"`
+	Bits         int    `json:"bits,omitempty"`
+}
+
+// Generated key pairs are stored as a JSON object of PEM encoded keys
+type KeyPair struct {
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey"`
+}
+
+// Generates a new secret value based on the generator spec
+// ///////////////////////////////////////////////////////////
+func Generate(spec Spec) (string, error) {
+	if spec.Length < 0 || spec.Length > MAX_LENGTH {
+		return "", constants.ErrInvalidGeneratorLength
+	}
+
+	switch spec.Type {
+	case constants.PASSWORD_GENERATOR:
+		return ComplexPassword(spec)
+
+	case constants.RANDOM_BYTES_GENERATOR:
+		return RandomBytes(lengthOrDefault(spec.Length, DEFAULT_BYTES_LENGTH), spec.Encoding)
+
+	case constants.HEX_TOKEN_GENERATOR:
+		return RandomBytes(lengthOrDefault(spec.Length, DEFAULT_BYTES_LENGTH), constants.HEX_ENCODING)
+
+	case constants.BASE64_TOKEN_GENERATOR:
+		return RandomBytes(lengthOrDefault(spec.Length, DEFAULT_BYTES_LENGTH), encodingOrDefault(spec.Encoding, constants.BASE64_ENCODING))
+
+	case constants.API_KEY_GENERATOR:
+		key, err := RandomPassword(lengthOrDefault(spec.Length, DEFAULT_PASSWORD_LENGTH), DEFAULT_CHARSET)
+		if err != nil {
+			return "", err
+		}
+		return spec.Prefix + key, nil
+
+	case constants.UUID_GENERATOR:
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+
+	case constants.ED25519_KEYPAIR_GENERATOR:
+		return marshalKeyPair(Ed25519KeyPair())
+
+	case constants.RSA_KEYPAIR_GENERATOR:
+		return marshalKeyPair(RSAKeyPair(spec.Bits))
+	}
+
+	return "", constants.ErrInvalidGeneratorType
+}
+
+// Validates a generator spec without generating expensive values
+// //////////////////////////////////////////////////////////////////
+func Validate(spec Spec) error {
+	switch spec.Type {
+	case constants.ED25519_KEYPAIR_GENERATOR:
+		return nil
+
+	case constants.RSA_KEYPAIR_GENERATOR:
+		for _, acceptedBits := range ACCEPTED_RSA_BITS {
+			if spec.Bits == 0 || spec.Bits == acceptedBits {
+				return nil
+			}
+		}
+		return constants.ErrInvalidKeySize
+	}
+
+	_, err := Generate(spec)
+	return err
+}
+
+// Returns the public part of a generated value, empty for symmetric values
+// ///////////////////////////////////////////////////////////////////////////
+func PublicPart(spec Spec, value string) string {
+	if spec.Type != constants.ED25519_KEYPAIR_GENERATOR && spec.Type != constants.RSA_KEYPAIR_GENERATOR {
+		return ""
+	}
+
+	var keyPair KeyPair
+	if err := json.Unmarshal([]byte(value), &keyPair); err != nil {
+		return ""
+	}
+
+	return keyPair.PublicKey
+}
+
+// Generates a password satisfying the complexity rules of the spec
+// ///////////////////////////////////////////////////////////////////
+func ComplexPassword(spec Spec) (string, error) {
+	length := lengthOrDefault(spec.Length, DEFAULT_PASSWORD_LENGTH)
+	if spec.MinLower < 0 || spec.MinUpper < 0 || spec.MinDigits < 0 || spec.MinSymbols < 0 {
+		return "", constants.ErrInvalidGeneratorComplexity
+	}
+
+	rules := []struct {
+		charset string
+		count   int
+	}{
+		{LOWERCASE_CHARSET, spec.MinLower},
+		{UPPERCASE_CHARSET, spec.MinUpper},
+		{DIGITS_CHARSET, spec.MinDigits},
+		{SYMBOLS_CHARSET, spec.MinSymbols},
+	}
+
+	charset := charsetOrDefault(spec.Charset)
+	if spec.Charset == "" && spec.MinSymbols > 0 {
+		charset += SYMBOLS_CHARSET
+	}
+	charset = excludeChars(charset, spec.ExcludeChars)
+	if charset == "" {
+		return "", constants.ErrInvalidGeneratorComplexity
+	}
+
+	// Required characters of each class are picked first
+	var password []byte
+	for _, rule := range rules {
+		if rule.count == 0 {
+			continue
+		}
+
+		classCharset := excludeChars(rule.charset, spec.ExcludeChars)
+		if classCharset == "" {
+			return "", constants.ErrInvalidGeneratorComplexity
+		}
+
+		chars, err := RandomPassword(rule.count, classCharset)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, chars...)
+	}
+
+	if len(password) > length {
+		return "", constants.ErrInvalidGeneratorComplexity
+	}
+
+	rest, err := RandomPassword(length-len(password), charset)
+	if err != nil {
+		return "", err
+	}
+	password = append(password, rest...)
+
+	// Shuffling so the required characters are not always leading
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	return string(password), nil
+}
+
+// Generates a random password using the given charset
+// ///////////////////////////////////////////////////////
+// - chars are picked by byte, charsets are limited to printable ASCII
+func RandomPassword(length int, charset string) (string, error) {
+	charset = charsetOrDefault(charset)
+	for i := 0; i < len(charset); i++ {
+		if charset[i] < ' ' || charset[i] > '~' {
+			return "", constants.ErrInvalidGeneratorCharset
+		}
+	}
+	password := make([]byte, length)
+
+	for i := range password {
+		char, err := randomChar(charset)
+		if err != nil {
+			return "", err
+		}
+		password[i] = char
+	}
+
+	return string(password), nil
+}
+
+// Generates random bytes encoded as hex or base64
+// //////////////////////////////////////////////////
+func RandomBytes(length int, encoding string) (string, error) {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	switch encoding {
+	case "", constants.HEX_ENCODING:
+		return hex.EncodeToString(bytes), nil
+	case constants.BASE64_ENCODING:
+		return base64.StdEncoding.EncodeToString(bytes), nil
+	case constants.BASE64URL_ENCODING:
+		return base64.RawURLEncoding.EncodeToString(bytes), nil
+	}
+
+	return "", constants.ErrInvalidGeneratorEncoding
+}
+
+// Helper function to pick a uniformly distributed char from a charset
+// //////////////////////////////////////////////////////////////////////
+func randomChar(charset string) (byte, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, err
+	}
+
+	return charset[index.Int64()], nil
+}
+
+func marshalKeyPair(keyPair KeyPair, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.Marshal(keyPair)
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonBytes), nil
+}
+
+func excludeChars(charset string, excluded string) string {
+	if excluded == "" {
+		return charset
+	}
+
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(excluded, r) {
+			return -1
+		}
+		return r
+	}, charset)
+}
+
+func lengthOrDefault(length int, defaultLength int) int {
+	if length == 0 {
+		return defaultLength
+	}
+
+	return length
+}
+
+func charsetOrDefault(charset string) string {
+	if charset == "" {
+		return DEFAULT_CHARSET
+	}
+
+	return charset
+}
+
+func encodingOrDefault(encoding string, defaultEncoding string) string {
+	if encoding == "" {
+		return defaultEncoding
+	}
+
+	return encoding
+}
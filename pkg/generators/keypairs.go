@@ -0,0 +1,67 @@
+package generators
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"secret-svc/pkg/constants"
+)
+
+var DEFAULT_RSA_BITS = 2048
+var ACCEPTED_RSA_BITS = [3]int{2048, 3072, 4096}
+
+// Generates an ed25519 key pair encoded as PKIX/PKCS8 PEM blocks
+// /////////////////////////////////////////////////////////////////
+func Ed25519KeyPair() (KeyPair, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return encodeKeyPair(publicKey, privateKey)
+}
+
+// Generates an RSA key pair encoded as PKIX/PKCS8 PEM blocks
+// /////////////////////////////////////////////////////////////
+func RSAKeyPair(bits int) (KeyPair, error) {
+	if bits == 0 {
+		bits = DEFAULT_RSA_BITS
+	}
+
+	accepted := false
+	for _, acceptedBits := range ACCEPTED_RSA_BITS {
+		if bits == acceptedBits {
+			accepted = true
+		}
+	}
+	if !accepted {
+		return KeyPair{}, constants.ErrInvalidKeySize
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return encodeKeyPair(&privateKey.PublicKey, privateKey)
+}
+
+func encodeKeyPair(publicKey interface{}, privateKey interface{}) (KeyPair, error) {
+	publicBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	privateBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes})),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateBytes})),
+	}, nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"secret-svc/pkg/constants"
+)
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// In-memory store used when Redis is bypassed (single replica / local development)
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	lists   map[string][]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		lists:   make(map[string][]string),
+	}
+}
+
+func (m *MemoryStore) lookup(key string) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if ok && !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+
+	return entry, ok
+}
+
+func (m *MemoryStore) Get(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok {
+		return "", constants.ErrRecordNotFound
+	}
+
+	return entry.value, nil
+}
+
+func (m *MemoryStore) Set(key string, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	m.entries[key] = entry
+
+	return nil
+}
+
+func (m *MemoryStore) SetNX(key string, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookup(key); ok {
+		return false, nil
+	}
+
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	m.entries[key] = entry
+
+	return true, nil
+}
+
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	delete(m.lists, key)
+
+	return nil
+}
+
+func (m *MemoryStore) Keys(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key := range m.entries {
+		if _, ok := m.lookup(key); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range m.lists {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (m *MemoryStore) Append(key string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lists[key] = append(m.lists[key], value)
+
+	return nil
+}
+
+// Returns list items between start and stop (inclusive), negative indexes count from the end
+func (m *MemoryStore) List(key string, start int, stop int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := m.lists[key]
+	start, stop, ok := listBounds(len(list), start, stop)
+	if !ok {
+		return []string{}, nil
+	}
+
+	items := make([]string, stop-start+1)
+	copy(items, list[start:stop+1])
+
+	return items, nil
+}
+
+// Keeps only the list items between start and stop (inclusive)
+func (m *MemoryStore) Trim(key string, start int, stop int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := m.lists[key]
+	start, stop, ok := listBounds(len(list), start, stop)
+	if !ok {
+		delete(m.lists, key)
+		return nil
+	}
+
+	items := make([]string, stop-start+1)
+	copy(items, list[start:stop+1])
+	m.lists[key] = items
+
+	return nil
+}
+
+// Helper function resolving list indexes the same way Redis does
+func listBounds(length int, start int, stop int) (int, int, bool) {
+	if start < 0 {
+		start = length + start
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	return start, stop, length > 0 && start <= stop
+}
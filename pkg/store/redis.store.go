@@ -0,0 +1,121 @@
+package store
+
+import (
+	"time"
+
+	"secret-svc/pkg/constants"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var keyPrefix = "secretsvc:"
+
+// Redis backed store shared by all service replicas
+type RedisStore struct {
+	pool *redis.Pool
+}
+
+func NewRedisStore(pool *redis.Pool) *RedisStore {
+	return &RedisStore{pool: pool}
+}
+
+func (r *RedisStore) Get(key string) (string, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	value, err := redis.String(conn.Do("GET", keyPrefix+key))
+	if err == redis.ErrNil {
+		return "", constants.ErrRecordNotFound
+	}
+
+	return value, err
+}
+
+func (r *RedisStore) Set(key string, value string, ttl time.Duration) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	var err error
+	if ttl > 0 {
+		_, err = conn.Do("SET", keyPrefix+key, value, "PX", ttl.Milliseconds())
+	} else {
+		_, err = conn.Do("SET", keyPrefix+key, value)
+	}
+
+	return err
+}
+
+func (r *RedisStore) SetNX(key string, value string, ttl time.Duration) (bool, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	var reply interface{}
+	var err error
+	if ttl > 0 {
+		reply, err = conn.Do("SET", keyPrefix+key, value, "PX", ttl.Milliseconds(), "NX")
+	} else {
+		reply, err = conn.Do("SET", keyPrefix+key, value, "NX")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return reply != nil, nil
+}
+
+func (r *RedisStore) Delete(key string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", keyPrefix+key)
+	return err
+}
+
+func (r *RedisStore) Keys(prefix string) ([]string, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	var keys []string
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", keyPrefix+prefix+"*", "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
+
+		cursor, _ = redis.Int(values[0], nil)
+		batch, _ := redis.Strings(values[1], nil)
+		for _, key := range batch {
+			keys = append(keys, key[len(keyPrefix):])
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return keys, nil
+}
+
+func (r *RedisStore) Append(key string, value string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("RPUSH", keyPrefix+key, value)
+	return err
+}
+
+func (r *RedisStore) List(key string, start int, stop int) ([]string, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	return redis.Strings(conn.Do("LRANGE", keyPrefix+key, start, stop))
+}
+
+func (r *RedisStore) Trim(key string, start int, stop int) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("LTRIM", keyPrefix+key, start, stop)
+	return err
+}
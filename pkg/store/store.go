@@ -0,0 +1,74 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Store used by the service to persist its own state (policies, histories, leases, etc.)
+// - Secret values are never written to the store, only metadata about them.
+type Store interface {
+	Get(key string) (string, error)
+	Set(key string, value string, ttl time.Duration) error
+	SetNX(key string, value string, ttl time.Duration) (bool, error)
+	Delete(key string) error
+	Keys(prefix string) ([]string, error)
+	Append(key string, value string) error
+	List(key string, start int, stop int) ([]string, error)
+	Trim(key string, start int, stop int) error
+}
+
+var current Store = NewMemoryStore()
+
+// Method for using Redis as the backing store
+// ///////////////////////////////////////////////
+func UseRedis(pool *redis.Pool) {
+	current = NewRedisStore(pool)
+}
+
+// Method for replacing the backing store
+// //////////////////////////////////////////
+func Use(s Store) {
+	current = s
+}
+
+// Returns the store currently in use
+// //////////////////////////////////////
+func Default() Store {
+	return current
+}
+
+// Helper function to read a JSON record from the store
+// ///////////////////////////////////////////////////////
+func GetJSON(key string, template interface{}) error {
+	value, err := current.Get(key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(value), template)
+}
+
+// Helper function to write a JSON record to the store
+// //////////////////////////////////////////////////////
+func SetJSON(key string, value interface{}, ttl time.Duration) error {
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return current.Set(key, string(jsonBytes), ttl)
+}
+
+// Helper function to append a JSON record to a list in the store
+// ////////////////////////////////////////////////////////////////
+func AppendJSON(key string, value interface{}) error {
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return current.Append(key, string(jsonBytes))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +21,7 @@ func GetEnvVar(key string) string {
 
 func GetPrefixedUuid() string {
 	uuid, _ := uuid.NewRandom()
-	return "secret_" + uuid.String()
+	return constants.PRIVATE_SECRET_PREFIX + uuid.String()
 }
 
 // Helper function to SetDefaultValus
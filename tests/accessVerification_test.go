@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"secret-svc/api/dtos"
+	"secret-svc/api/handlers"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySecretManagerAccessRegion(t *testing.T) {
+	verification := services.VerifySecretManagerAccess("org1", "arn:aws:iam::111111111111:role/secrets", "us-east", "")
+	assert.False(t, verification.Verified)
+	assert.False(t, verification.AssumeRole)
+	assert.Equal(t, constants.ErrInvalidRegion.Error(), verification.Error)
+
+	assert.True(t, services.AWS_REGION_REGEX.MatchString("ap-southeast-2"))
+	assert.True(t, services.AWS_REGION_REGEX.MatchString("us-gov-west-1"))
+}
+
+func TestVerifySystemSecretAccessShared(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org-access", ProjectId: "project"}
+
+	// Only PRIVATE secret managers are verified
+	verifications, err := services.VerifySystemSecretAccess(headers, dtos.SystemSecretReq{Flow: constants.SHARED_FLOW})
+	assert.Nil(t, err)
+	assert.Empty(t, verifications)
+}
+
+func TestPostSystemSecretInvalidRegion(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	ctx := GetTestGinContext(w)
+	headers := MockSystemSecretHeaders(ctx)
+	headers.Del(constants.SCOPE_HEADER)
+	MockJsonPost(ctx, dtos.SystemSecretReq{
+		Flow:     constants.PRIVATE_FLOW,
+		ARN:      "arn:aws:iam::111111111111:role/secrets",
+		Region:   "mars-1",
+		Provider: "AWS",
+	}, []gin.Param{}, url.Values{}, headers)
+
+	handlers.CreateSystemSecretHandler(ctx)
+	assert.EqualValues(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrPrivateAccessDenied.Error())
+	assert.Contains(t, w.Body.String(), constants.ErrInvalidRegion.Error())
+}
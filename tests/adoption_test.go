@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"secret-svc/api/dtos"
+	"secret-svc/api/handlers"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretAdoptionReq(t *testing.T) {
+	request, err := dtos.CreateNewSecretAdoptionReq(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, request.SecretIds)
+
+	request, err = dtos.CreateNewSecretAdoptionReq(map[string]interface{}{"secretIds": []interface{}{"db-url", "api-key"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db-url", "api-key"}, request.SecretIds)
+
+	for _, secretIds := range []interface{}{[]interface{}{}, "db-url", []interface{}{""}, []interface{}{"db-url,api-key"}} {
+		_, err = dtos.CreateNewSecretAdoptionReq(map[string]interface{}{"secretIds": secretIds})
+		assert.Equal(t, constants.ErrSecretNotUntagged, err)
+	}
+}
+
+func TestSecretAdoptionRequiresPrivateFlow(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1", Flow: constants.SHARED_FLOW}
+
+	_, err := services.ListUntaggedSecrets(headers)
+	assert.Equal(t, constants.ErrAdoptionNotPrivate, err)
+
+	w := httptest.NewRecorder()
+	c := GetTestGinContext(w)
+	MockJsonPost(c, map[string]interface{}{}, nil, nil, map[string][]string{})
+	c.Request.Header.Set(constants.ORG_ID_HEADER, "org1")
+	c.Request.Header.Set(constants.FLOW_HEADER, constants.SHARED_FLOW)
+	handlers.AdoptUntaggedSecretsHandler(c)
+	assert.Equal(t, 409, w.Code)
+	assert.False(t, services.ProcessNextJob())
+
+	// Jobs enqueued for other keys fail without being retried
+	job, _ := services.EnqueueJob(headers, constants.SECRET_ADOPTION_JOB, nil, "db-url")
+	assert.True(t, services.ProcessNextJob())
+	job, _ = services.GetJob(headers, job.Id)
+	assert.Equal(t, constants.FAILED_STATUS, job.Status)
+	assert.Equal(t, constants.ErrAdoptionNotPrivate.Error(), job.Error)
+
+	var response dtos.ApiResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, constants.ErrAdoptionNotPrivate.Error(), response.Error)
+}
@@ -0,0 +1,375 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"secret-svc/api/dtos"
+	"secret-svc/api/middlewares"
+	"secret-svc/api/services"
+	"secret-svc/pkg/audit"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockAuditEvents(sink audit.Sink, count int) {
+	for i := 0; i < count; i++ {
+		orgId := "org1"
+		if i%2 == 1 {
+			orgId = "org2"
+		}
+		sink.Write(audit.Event{Id: "audit_" + string(rune('a'+i)), Time: time.Now().UTC(), Actor: "deployer", OrgId: orgId, Action: "SECRET_READ", Outcome: constants.SUCCESS_OUTCOME})
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.NewFileSink(path)
+	assert.Nil(t, err)
+	mockAuditEvents(sink, 5)
+
+	page, err := sink.Query(audit.Filter{OrgId: "org1", Limit: 2})
+	assert.Nil(t, err)
+	assert.Len(t, page.Events, 2)
+	assert.Equal(t, "audit_a", page.Events[0].Id)
+	assert.Equal(t, "audit_c", page.Events[1].Id)
+
+	page, err = sink.Query(audit.Filter{OrgId: "org1", Limit: 2, After: page.Next})
+	assert.Nil(t, err)
+	assert.Len(t, page.Events, 1)
+	assert.Equal(t, "audit_e", page.Events[0].Id)
+	assert.Equal(t, "", page.Next)
+
+	_, err = sink.Query(audit.Filter{Limit: 2, After: "first"})
+	assert.Equal(t, constants.ErrInvalidNextToken, err)
+
+	// Tokens are byte offsets of a line
+	page, _ = sink.Query(audit.Filter{Limit: 1})
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, strconv.Itoa(strings.Index(string(data), "\n")+1), page.Next)
+	info, _ := os.Stat(path)
+	_, err = sink.Query(audit.Filter{Limit: 2, After: "1"})
+	assert.Equal(t, constants.ErrInvalidNextToken, err)
+	_, err = sink.Query(audit.Filter{Limit: 2, After: strconv.FormatInt(info.Size()+1, 10)})
+	assert.Equal(t, constants.ErrInvalidNextToken, err)
+	page, err = sink.Query(audit.Filter{Limit: 2, After: strconv.FormatInt(info.Size(), 10)})
+	assert.Nil(t, err)
+	assert.Len(t, page.Events, 0)
+
+	// Reopened files are appended to
+	sink.Close()
+	sink, _ = audit.NewFileSink(path)
+	defer sink.Close()
+	mockAuditEvents(sink, 1)
+	page, _ = sink.Query(audit.Filter{Limit: 10})
+	assert.Len(t, page.Events, 6)
+}
+
+func TestBatchAuditExporter(t *testing.T) {
+	dir := t.TempDir()
+	_, err := audit.NewBatchExporter(dir, 0, 0)
+	assert.Equal(t, constants.ErrInvalidAuditBatch, err)
+
+	exporter, err := audit.NewBatchExporter(dir, 2, 0)
+	assert.Nil(t, err)
+	mockAuditEvents(exporter, 3)
+
+	var manifest audit.Manifest
+	data, _ := os.ReadFile(filepath.Join(dir, audit.BATCH_MANIFEST_FILE))
+	json.Unmarshal(data, &manifest)
+	assert.Len(t, manifest.Entries, 1)
+	assert.True(t, manifest.Entries[0].Mandatory)
+
+	// Buffered events are queried with the exported ones
+	page, err := exporter.Query(audit.Filter{Limit: 10})
+	assert.Nil(t, err)
+	assert.Len(t, page.Events, 3)
+
+	page, _ = exporter.Query(audit.Filter{Limit: 1, After: "2"})
+	assert.Equal(t, "audit_c", page.Events[0].Id)
+	assert.Equal(t, "3", page.Next)
+
+	// Closing flushes the buffer, a new exporter continues the manifest
+	assert.Nil(t, exporter.Close())
+	exporter, _ = audit.NewBatchExporter(dir, 2, 0)
+	mockAuditEvents(exporter, 2)
+	data, _ = os.ReadFile(filepath.Join(dir, audit.BATCH_MANIFEST_FILE))
+	json.Unmarshal(data, &manifest)
+	assert.Len(t, manifest.Entries, 3)
+	assert.FileExists(t, filepath.Join(dir, "batch-000003.jsonl"))
+}
+
+func TestCreateNewAuditFilter(t *testing.T) {
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	filter, err := dtos.CreateNewAuditFilter(url.Values{
+		"orgId":     {"org2"},
+		"projectId": {"project1"},
+		"outcome":   {"denied"},
+		"from":      {"2024-01-01T00:00:00Z"},
+		"limit":     {"10"},
+	}, headers)
+	assert.Nil(t, err)
+	assert.Equal(t, "org1", filter.OrgId)
+	assert.Equal(t, "project1", filter.ProjectId)
+	assert.Equal(t, constants.DENIED_OUTCOME, filter.Outcome)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), filter.From)
+	assert.Equal(t, 10, filter.Limit)
+
+	// The project of the headers can't be widened
+	filter, _ = dtos.CreateNewAuditFilter(url.Values{"projectId": {"project2"}}, dtos.CustomHeaders{OrgId: "org1", ProjectId: "project1"})
+	assert.Equal(t, "project1", filter.ProjectId)
+	assert.Equal(t, dtos.AUDIT_DEFAULT_LIMIT, filter.Limit)
+
+	_, err = dtos.CreateNewAuditFilter(url.Values{"outcome": {"MAYBE"}}, headers)
+	assert.Equal(t, constants.ErrInvalidAuditOutcome, err)
+	_, err = dtos.CreateNewAuditFilter(url.Values{"to": {"yesterday"}}, headers)
+	assert.Equal(t, constants.ErrInvalidAuditTime, err)
+	_, err = dtos.CreateNewAuditFilter(url.Values{"limit": {"501"}}, headers)
+	assert.Equal(t, constants.ErrInvalidAuditLimit, err)
+	_, err = dtos.CreateNewAuditFilter(url.Values{"nextToken": {"***"}}, headers)
+	assert.Equal(t, constants.ErrInvalidNextToken, err)
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	assert.Nil(t, err)
+	services.UseAuditSink(sink)
+	defer audit.Use(nil)
+
+	router := gin.New()
+	router.Use(middlewares.Audit)
+	router.GET("/secret/:id", func(c *gin.Context) { c.String(200, "ok") })
+	router.POST("/secret/", func(c *gin.Context) {
+		events.Publish(events.Event{Type: constants.CREATED_EVENT, OrgId: "org1", SecretId: "secret_new", VersionId: "v1", TraceId: c.GetHeader(constants.TRACE_ID_HEADER)})
+		c.String(200, "ok")
+	})
+	router.DELETE("/secret/:id", func(c *gin.Context) { c.String(403, "denied") })
+	router.GET("/health", func(c *gin.Context) { c.String(200, "ok") })
+
+	for _, call := range [][2]string{{"GET", "/secret/secret_1"}, {"POST", "/secret/"}, {"DELETE", "/secret/secret_1"}, {"GET", "/health"}} {
+		request := httptest.NewRequest(call[0], call[1], nil)
+		request.Header.Set(constants.TRACE_ID_HEADER, "trace-"+call[0])
+		request.Header.Set(constants.ORG_ID_HEADER, "org1")
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	// Events published outside of a request are recorded on their own
+	events.Publish(events.Event{Type: constants.ROTATED_EVENT, OrgId: "org1", SecretId: "secret_1", VersionId: "v2"})
+
+	page, err := services.QueryAuditEvents(audit.Filter{OrgId: "org1", Limit: 10})
+	assert.Nil(t, err)
+	assert.Len(t, page.Events, 4)
+
+	assert.Equal(t, "SECRET_READ", page.Events[0].Action)
+	assert.Equal(t, "secret_1", page.Events[0].SecretId)
+	assert.Equal(t, services.ANONYMOUS_SUBJECT, page.Events[0].Actor)
+	assert.Equal(t, constants.SUCCESS_OUTCOME, page.Events[0].Outcome)
+	assert.Equal(t, "trace-GET", page.Events[0].TraceId)
+
+	assert.Equal(t, "SECRET_CREATE", page.Events[1].Action)
+	assert.Equal(t, "secret_new", page.Events[1].SecretId)
+	assert.Equal(t, "v1", page.Events[1].Version)
+
+	assert.Equal(t, "SECRET_DELETE", page.Events[2].Action)
+	assert.Equal(t, constants.DENIED_OUTCOME, page.Events[2].Outcome)
+
+	assert.Equal(t, "SECRET_ROTATED", page.Events[3].Action)
+	assert.Equal(t, constants.SYSTEM_ACTOR, page.Events[3].Actor)
+	assert.Equal(t, "v2", page.Events[3].Version)
+
+	page, _ = services.QueryAuditEvents(audit.Filter{OrgId: "org1", Limit: 1})
+	assert.NotEmpty(t, page.NextToken)
+}
+
+func TestAuditChain(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.NewFileSink(path)
+	assert.Nil(t, err)
+	audit.Use(sink)
+	defer audit.Use(nil)
+
+	// Events recorded before the chaining are unchained
+	mockAuditEvents(sink, 1)
+	for i := 0; i < 4; i++ {
+		orgId := []string{"org1", "org2"}[i%2]
+		_, err := audit.Record(audit.Event{Actor: "deployer", OrgId: orgId, Action: "SECRET_READ", Outcome: constants.SUCCESS_OUTCOME})
+		assert.Nil(t, err)
+	}
+
+	page, _ := audit.Query(audit.Filter{OrgId: "org1", Limit: 10})
+	assert.Equal(t, int64(2), page.Events[2].Seq)
+	assert.Equal(t, page.Events[1].Hash, page.Events[2].PrevHash)
+
+	verification, err := audit.Verify("org1", nil, nil)
+	assert.Nil(t, err)
+	assert.True(t, verification.Verified)
+	assert.Equal(t, 2, verification.Events)
+	assert.Equal(t, 1, verification.Unchained)
+
+	// Heads of a FILE sink aren't shared in the store, they are recovered from the sink after a restart
+	keys, _ := store.Default().Keys("audit:chain:")
+	assert.Len(t, keys, 0)
+	sink, _ = audit.NewFileSink(path)
+	audit.Use(sink)
+	event, _ := audit.Record(audit.Event{Actor: "deployer", OrgId: "org1", Action: "SECRET_DELETE", Outcome: constants.SUCCESS_OUTCOME})
+	assert.Equal(t, int64(3), event.Seq)
+
+	// Altering an event breaks the chain at that event
+	audit.Use(nil)
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), "SECRET_DELETE", "SECRET_READ", 1)), 0600)
+	sink, _ = audit.NewFileSink(path)
+	defer sink.Close()
+	verification, err = audit.VerifyChain(sink, "org1", nil, nil)
+	assert.Nil(t, err)
+	assert.False(t, verification.Verified)
+	assert.Equal(t, int64(3), verification.Break.Seq)
+	assert.Equal(t, event.Id, verification.Break.EventId)
+}
+
+func TestBatchAuditChainHeads(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	dir := t.TempDir()
+	exporter, err := audit.NewBatchExporter(dir, 10, 0)
+	assert.Nil(t, err)
+	audit.Use(exporter)
+	defer audit.Use(nil)
+
+	event, err := audit.Record(audit.Event{Actor: "deployer", OrgId: "org1", Action: "SECRET_READ", Outcome: constants.SUCCESS_OUTCOME})
+	assert.Nil(t, err)
+
+	// The buffered event is flushed before its head is listed
+	heads, err := audit.ListChainHeads()
+	assert.Nil(t, err)
+	assert.Equal(t, event.Hash, heads["org1"].Hash)
+	var manifest audit.Manifest
+	data, _ := os.ReadFile(filepath.Join(dir, audit.BATCH_MANIFEST_FILE))
+	json.Unmarshal(data, &manifest)
+	assert.Len(t, manifest.Entries, 1)
+
+	// A new exporter recovers the head from the batches
+	exporter, _ = audit.NewBatchExporter(dir, 10, 0)
+	audit.Use(exporter)
+	event, _ = audit.Record(audit.Event{Actor: "deployer", OrgId: "org1", Action: "SECRET_READ", Outcome: constants.SUCCESS_OUTCOME})
+	assert.Equal(t, int64(2), event.Seq)
+}
+
+// Sink shared with another replica, chaining the events from the head of its own events like the SQL sink
+type sharedAuditSink struct {
+	*audit.FileSink
+}
+
+func (s sharedAuditSink) WriteChained(event audit.Event) (audit.Event, error) {
+	heads, err := s.ChainHeads()
+	if err != nil {
+		return event, err
+	}
+	event = audit.ChainEvent(event, heads[event.OrgId])
+	return event, s.Write(event)
+}
+
+func (s sharedAuditSink) ChainHeads() (map[string]audit.Head, error) {
+	page, err := s.Query(audit.Filter{Limit: 100})
+	heads := map[string]audit.Head{}
+	for _, event := range page.Events {
+		heads[event.OrgId] = audit.Head{Seq: event.Seq, Hash: event.Hash}
+	}
+	return heads, err
+}
+
+func TestChainedAuditSink(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	assert.Nil(t, err)
+	audit.Use(sharedAuditSink{sink})
+	defer audit.Use(nil)
+
+	first, err := audit.Record(audit.Event{Actor: "deployer", OrgId: "org1", Action: "SECRET_READ", Outcome: constants.SUCCESS_OUTCOME})
+	assert.Nil(t, err)
+
+	// Appended by another replica, the next event is chained to it
+	other := audit.ChainEvent(audit.Event{Id: "audit_other", Time: time.Now().UTC().Truncate(time.Microsecond), Actor: "deployer", OrgId: "org1", Action: "SECRET_READ", Outcome: constants.SUCCESS_OUTCOME}, audit.Head{Seq: first.Seq, Hash: first.Hash})
+	assert.Nil(t, sink.Write(other))
+	event, err := audit.Record(audit.Event{Actor: "deployer", OrgId: "org1", Action: "SECRET_DELETE", Outcome: constants.SUCCESS_OUTCOME})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), event.Seq)
+	assert.Equal(t, other.Hash, event.PrevHash)
+
+	verification, err := audit.Verify("org1", nil, nil)
+	assert.Nil(t, err)
+	assert.True(t, verification.Verified)
+
+	// Heads come from the sink, none are kept in the store
+	heads, err := audit.ListChainHeads()
+	assert.Nil(t, err)
+	assert.Equal(t, event.Hash, heads["org1"].Hash)
+	keys, _ := store.Default().Keys("audit:chain:")
+	assert.Len(t, keys, 0)
+}
+
+func TestAuditCheckpoints(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	assert.Nil(t, err)
+	audit.Use(sink)
+	defer audit.Use(nil)
+	defer services.UseAuditSigningKey("")
+
+	_, err = services.ExportAuditCheckpoints("org1")
+	assert.Equal(t, constants.ErrAuditCheckpointsDisabled, err)
+	assert.Equal(t, constants.ErrInvalidAuditSigningKey, services.UseAuditSigningKey("c2hvcnQ="))
+
+	_, privateKey, _ := ed25519.GenerateKey(nil)
+	assert.Nil(t, services.UseAuditSigningKey(base64.StdEncoding.EncodeToString(privateKey.Seed())))
+
+	for i := 0; i < 3; i++ {
+		audit.Record(audit.Event{Actor: "deployer", OrgId: "org1", Action: "SECRET_READ", Outcome: constants.SUCCESS_OUTCOME})
+	}
+	assert.Len(t, services.CreateAuditCheckpoints(time.Now()), 1)
+	assert.Len(t, services.CreateAuditCheckpoints(time.Now()), 0)
+
+	export, err := services.ExportAuditCheckpoints("org1")
+	assert.Nil(t, err)
+	assert.Len(t, export.Checkpoints, 1)
+	assert.Equal(t, int64(3), export.Checkpoints[0].Seq)
+
+	publicKey, err := audit.ParsePublicKey(export.PublicKey)
+	assert.Nil(t, err)
+	assert.True(t, audit.VerifyCheckpoint(publicKey, export.Checkpoints[0]))
+
+	verification, err := services.VerifyAuditChain("org1")
+	assert.Nil(t, err)
+	assert.True(t, verification.Verified)
+	assert.Equal(t, 1, verification.Checkpoints)
+
+	// A forged checkpoint is reported
+	forged := export.Checkpoints[0]
+	forged.Seq = 2
+	verification = audit.NewChainVerifier("org1", []audit.Checkpoint{forged}, publicKey).Finish()
+	assert.Equal(t, "invalid checkpoint signature", verification.Break.Reason)
+
+	// A chain ending before a checkpoint was truncated
+	truncated, _ := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	defer truncated.Close()
+	page, _ := audit.Query(audit.Filter{OrgId: "org1", Limit: 2})
+	for _, event := range page.Events {
+		truncated.Write(event)
+	}
+	verification, err = audit.VerifyChain(truncated, "org1", export.Checkpoints, publicKey)
+	assert.Nil(t, err)
+	assert.False(t, verification.Verified)
+	assert.Equal(t, int64(3), verification.Break.Seq)
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"secret-svc/api/middlewares"
+	"secret-svc/pkg/auth"
+	"secret-svc/pkg/constants"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockJWKS(t *testing.T, key *rsa.PrivateKey) *auth.KeySet {
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.Nil(t, os.WriteFile(path, jwks, 0600))
+
+	keySet, err := auth.LoadKeySet(path)
+	assert.Nil(t, err)
+	return keySet
+}
+
+func mockJWT(key *rsa.PrivateKey, alg string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func authenticatedRequest(authorization string, state *tls.ConnectionState) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(middlewares.Authenticate)
+	router.GET("/secret/:id", func(c *gin.Context) {
+		identity, _ := auth.GetIdentity(c.Request.Context())
+		c.String(200, identity.Method+" "+identity.Subject)
+	})
+
+	request := httptest.NewRequest("GET", "/secret/secret_1", nil)
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	request.TLS = state
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	auth.UseJWT(&auth.JWTConfig{Keys: mockJWKS(t, key), Issuer: "https://issuer.test", Audience: "secret-svc"})
+	defer auth.UseJWT(nil)
+
+	claims := map[string]interface{}{"sub": "deployer", "iss": "https://issuer.test", "aud": []string{"secret-svc"}, "exp": time.Now().Add(time.Hour).Unix()}
+	w := authenticatedRequest("Bearer "+mockJWT(key, "RS256", claims), nil)
+	assert.EqualValues(t, 200, w.Code)
+	assert.Equal(t, "JWT deployer", w.Body.String())
+
+	// Unauthenticated
+	w = authenticatedRequest("", nil)
+	assert.EqualValues(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrMissingCredentials.Error())
+
+	// Expired
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	w = authenticatedRequest("Bearer "+mockJWT(key, "RS256", claims), nil)
+	assert.EqualValues(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrExpiredToken.Error())
+
+	// Other audience
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = "other-svc"
+	w = authenticatedRequest("Bearer "+mockJWT(key, "RS256", claims), nil)
+	assert.EqualValues(t, 401, w.Code)
+
+	// Unsigned and tampered tokens
+	claims["aud"] = "secret-svc"
+	token := mockJWT(key, "RS256", claims)
+	header, _ := json.Marshal(map[string]string{"alg": "none", "kid": "test-key"})
+	payload := strings.Split(token, ".")[1]
+	w = authenticatedRequest("Bearer "+base64.RawURLEncoding.EncodeToString(header)+"."+payload+".", nil)
+	assert.EqualValues(t, 401, w.Code)
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	w = authenticatedRequest("Bearer "+mockJWT(otherKey, "RS256", claims), nil)
+	assert.EqualValues(t, 401, w.Code)
+}
+
+func TestAuthenticateClientCertificate(t *testing.T) {
+	auth.UseClientCertificates(true)
+	defer auth.UseClientCertificates(false)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	spiffeId, _ := url.Parse("spiffe://cluster.local/ns/default/sa/deployer")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "deployer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{spiffeId},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	certificate, _ := x509.ParseCertificate(der)
+
+	w := authenticatedRequest("", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}})
+	assert.EqualValues(t, 200, w.Code)
+	assert.Equal(t, "MTLS spiffe://cluster.local/ns/default/sa/deployer", w.Body.String())
+
+	// Certificates which weren't verified by the TLS server are ignored
+	w = authenticatedRequest("", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}})
+	assert.EqualValues(t, 401, w.Code)
+}
+
+func TestParseKeySetWithoutSigningKeys(t *testing.T) {
+	_, err := auth.ParseKeySet([]byte(`{"keys": [{"kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`))
+	assert.Equal(t, constants.ErrInvalidJWKS, err)
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"secret-svc/api/dtos"
+	"secret-svc/api/middlewares"
+	"secret-svc/api/services"
+	"secret-svc/pkg/auth"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var mockPolicyFile = `[
+	{"id": "billing-read", "effect": "ALLOW", "subjects": ["billing-svc"], "methods": ["GET"], "routes": ["SECRET"], "scopes": ["CREDENTIALS"]},
+	{"id": "billing-no-write", "effect": "DENY", "subjects": ["billing-svc"], "methods": ["POST", "PUT", "PATCH", "DELETE"]},
+	{"id": "deploy-configs", "effect": "ALLOW", "subjects": ["spiffe://cluster.local/*/deploy-svc"], "scopes": ["CONFIGS"]}
+]`
+
+func mockAuthorization(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	assert.Nil(t, os.WriteFile(path, []byte(mockPolicyFile), 0600))
+	store.Use(store.NewMemoryStore())
+	assert.Nil(t, services.UseAuthorization(path))
+}
+
+func TestExplainAuthorization(t *testing.T) {
+	mockAuthorization(t)
+	defer services.DisableAuthorization()
+
+	request := dtos.AuthorizationReq{Subject: "billing-svc", Method: "GET", Route: constants.SECRET_ROUTE, OrgId: "org1", ProjectId: "project1", Scope: constants.CREDENTIALS_SCOPE, Secret: "secret_1"}
+	decision, err := services.ExplainAuthorization(request)
+	assert.Nil(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "billing-read", decision.PolicyId)
+	assert.Len(t, decision.Policies, 3)
+
+	// Deny policies override allow policies
+	request.Method = "PUT"
+	decision, _ = services.ExplainAuthorization(request)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "billing-no-write", decision.PolicyId)
+
+	request = dtos.AuthorizationReq{Subject: "spiffe://cluster.local/ns/deploy-svc", Method: "PUT", Route: constants.SECRET_ROUTE, OrgId: "org1", ProjectId: "project1", Scope: constants.CONFIGS_SCOPE}
+	decision, _ = services.ExplainAuthorization(request)
+	assert.True(t, decision.Allowed)
+
+	request.Scope = constants.CREDENTIALS_SCOPE
+	decision, _ = services.ExplainAuthorization(request)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, constants.ErrAccessDenied.Error(), decision.Reason)
+
+	// Requests reaching every scope aren't allowed by policies restricted to some scopes
+	request = dtos.AuthorizationReq{Subject: "spiffe://cluster.local/ns/deploy-svc", Method: "DELETE", Route: constants.SYSTEM_ROUTE, OrgId: "org1", ProjectId: "project1"}
+	decision, _ = services.ExplainAuthorization(request)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "scopes", decision.Policies[2].Mismatch)
+}
+
+func TestAuthorizeMiddleware(t *testing.T) {
+	mockAuthorization(t)
+	defer services.DisableAuthorization()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), auth.Identity{Method: auth.JWT_METHOD, Subject: "billing-svc"}))
+	})
+	router.Use(middlewares.Authorize)
+	router.GET("/secret/:id", func(c *gin.Context) { c.String(200, "ok") })
+	router.DELETE("/secret/:id", func(c *gin.Context) { c.String(200, "ok") })
+
+	request := httptest.NewRequest("GET", "/secret/secret_1", nil)
+	request.Header.Set(constants.ORG_ID_HEADER, "org1")
+	request.Header.Set(constants.PROJECT_ID_HEADER, "project1")
+	request.Header.Set(constants.SCOPE_HEADER, constants.CREDENTIALS_SCOPE)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.EqualValues(t, 200, w.Code)
+
+	request = httptest.NewRequest("DELETE", "/secret/secret_1", nil)
+	request.Header.Set(constants.ORG_ID_HEADER, "org1")
+	request.Header.Set(constants.PROJECT_ID_HEADER, "project1")
+	request.Header.Set(constants.SCOPE_HEADER, constants.CREDENTIALS_SCOPE)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.EqualValues(t, 403, w.Code)
+
+	// Every decision is recorded, newest first
+	decisions, err := services.ListAuthorizationDecisions(10)
+	assert.Nil(t, err)
+	assert.Len(t, decisions, 2)
+	assert.False(t, decisions[0].Allowed)
+	assert.Equal(t, "/secret/:id", decisions[0].Request.Path)
+	assert.Equal(t, "secret_1", decisions[0].Request.Secret)
+	assert.True(t, decisions[1].Allowed)
+}
+
+func TestAuthorizeReveal(t *testing.T) {
+	mockAuthorization(t)
+	defer services.DisableAuthorization()
+	services.PutScope("org1", "CERTIFICATES", dtos.ScopeReq{Masked: true})
+	services.PutPolicy("billing-certificates", dtos.PolicyReq{Effect: constants.ALLOW_EFFECT, Subjects: []string{"billing-svc"}, Methods: []string{"GET"}, Scopes: []string{"CERTIFICATES"}})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), auth.Identity{Method: auth.JWT_METHOD, Subject: "billing-svc"}))
+	})
+	router.Use(middlewares.Authorize)
+	router.GET("/secret/:id", func(c *gin.Context) { c.String(200, "ok") })
+	get := func(path string) int {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set(constants.ORG_ID_HEADER, "org1")
+		request.Header.Set(constants.PROJECT_ID_HEADER, "project1")
+		request.Header.Set(constants.SCOPE_HEADER, "CERTIFICATES")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Code
+	}
+
+	// Reading a masked secret doesn't allow revealing it
+	assert.EqualValues(t, 200, get("/secret/secret_1"))
+	assert.EqualValues(t, 403, get("/secret/secret_1?reveal=true"))
+
+	services.PutPolicy("billing-reveal", dtos.PolicyReq{Effect: constants.ALLOW_EFFECT, Subjects: []string{"billing-svc"}, Methods: []string{constants.REVEAL_METHOD}, Scopes: []string{"CERTIFICATES"}})
+	assert.EqualValues(t, 200, get("/secret/secret_1?reveal=true"))
+}
+
+func TestPolicyAdminApi(t *testing.T) {
+	mockAuthorization(t)
+	defer services.DisableAuthorization()
+
+	_, err := services.PutPolicy("billing-read", dtos.PolicyReq{Effect: constants.ALLOW_EFFECT, Subjects: []string{"*"}})
+	assert.Equal(t, constants.ErrReadOnlyPolicy, err)
+
+	policyReq, err := dtos.CreateNewPolicyReq(map[string]interface{}{"effect": "allow", "subjects": []interface{}{"admin-svc"}, "routes": []interface{}{"admin"}})
+	assert.Nil(t, err)
+	policy, err := services.PutPolicy("admin", policyReq)
+	assert.Nil(t, err)
+	assert.Equal(t, constants.API_POLICY_SOURCE, policy.Source)
+	assert.Equal(t, []string{constants.ADMIN_ROUTE}, policy.Routes)
+
+	policies, _ := services.ListPolicies()
+	assert.Len(t, policies, 4)
+	assert.Nil(t, services.DeletePolicy("admin"))
+	assert.Equal(t, constants.ErrPolicyNotFound, services.DeletePolicy("admin"))
+
+	_, err = dtos.CreateNewPolicyReq(map[string]interface{}{"effect": "ALLOW", "subjects": []interface{}{"admin-svc"}, "methods": []interface{}{"TRACE"}})
+	assert.Equal(t, constants.ErrInvalidPolicyMethods, err)
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/envelope"
+	"secret-svc/pkg/store"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockLocalKeyWrapper(t *testing.T, fill string) envelope.KeyWrapper {
+	keyWrapper, err := envelope.NewLocalKeyWrapper(base64.StdEncoding.EncodeToString([]byte(strings.Repeat(fill, 32))))
+	assert.Nil(t, err)
+	return keyWrapper
+}
+
+func TestNewLocalKeyWrapper(t *testing.T) {
+	_, err := envelope.NewLocalKeyWrapper("not base64")
+	assert.Equal(t, constants.ErrInvalidMasterKey, err)
+
+	_, err = envelope.NewLocalKeyWrapper(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Equal(t, constants.ErrInvalidMasterKey, err)
+}
+
+func TestEnvelopeSealAndOpen(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	envelope.Use(mockLocalKeyWrapper(t, "k"))
+	defer envelope.Use(nil)
+
+	sealed, err := envelope.Seal("org1", "org1_project1_CREDENTIALS/secret_1", []byte(`"value"`))
+	assert.Nil(t, err)
+	assert.Equal(t, envelope.LOCAL_WRAPPER, sealed.Wrapper)
+	assert.Equal(t, "org1", sealed.KeyName)
+	assert.NotContains(t, sealed.Ciphertext, "value")
+
+	plaintext, err := envelope.Open(sealed, "org1_project1_CREDENTIALS/secret_1")
+	assert.Nil(t, err)
+	assert.Equal(t, `"value"`, string(plaintext))
+
+	// Values can't be moved to another secret
+	_, err = envelope.Open(sealed, "org1_project1_CREDENTIALS/secret_2")
+	assert.Equal(t, constants.ErrInvalidEnvelope, err)
+}
+
+func TestEnvelopeDataKeys(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	envelope.Use(mockLocalKeyWrapper(t, "k"))
+	defer envelope.Use(nil)
+
+	first, _ := envelope.Seal("org1", "aad", []byte("1"))
+	second, _ := envelope.Seal("org1", "aad", []byte("2"))
+	other, _ := envelope.Seal("org2", "aad", []byte("3"))
+	assert.Equal(t, first.DataKey, second.DataKey)
+	assert.NotEqual(t, first.DataKey, other.DataKey)
+
+	stored, err := store.Default().Get("envelope:datakey:LOCAL:org1")
+	assert.Nil(t, err)
+	assert.Equal(t, first.DataKey, stored)
+
+	// A restarted instance unwraps the stored data key
+	envelope.Use(mockLocalKeyWrapper(t, "k"))
+	restarted, _ := envelope.Seal("org1", "aad", []byte("4"))
+	assert.Equal(t, first.DataKey, restarted.DataKey)
+	plaintext, err := envelope.Open(first, "aad")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(plaintext))
+
+	// Data keys wrapped by another master key can't be unwrapped
+	envelope.Use(mockLocalKeyWrapper(t, "x"))
+	_, err = envelope.Open(first, "aad")
+	assert.Equal(t, constants.ErrEnvelopeKeyUnavailable, err)
+
+	envelope.Use(nil)
+	_, err = envelope.Open(first, "aad")
+	assert.Equal(t, constants.ErrEnvelopeKeyUnavailable, err)
+}
+
+func TestEnvelopeFromValue(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	envelope.Use(mockLocalKeyWrapper(t, "k"))
+	defer envelope.Use(nil)
+
+	sealed, _ := envelope.Seal("org1", "aad", []byte(`"value"`))
+	data, _ := json.Marshal(sealed)
+	var value interface{}
+	json.Unmarshal(data, &value)
+
+	parsed, ok := envelope.FromValue(value)
+	assert.True(t, ok)
+	assert.Equal(t, sealed, parsed)
+
+	// Plaintext values written before the encryption are left as they are
+	_, ok = envelope.FromValue("value")
+	assert.False(t, ok)
+	_, ok = envelope.FromValue(map[string]interface{}{"ciphertext": "value"})
+	assert.False(t, ok)
+}
+
+func TestUseEnvelopeEncryption(t *testing.T) {
+	defer envelope.Use(nil)
+
+	err := services.UseEnvelopeEncryption(mockLocalKeyWrapper(t, "k"), "SCOPE")
+	assert.Equal(t, constants.ErrInvalidEnvelopeKeyScope, err)
+	assert.False(t, envelope.Enabled())
+
+	err = services.UseEnvelopeEncryption(mockLocalKeyWrapper(t, "k"), constants.PROJECT_KEY_SCOPE)
+	assert.Nil(t, err)
+	assert.True(t, envelope.Enabled())
+	services.UseEnvelopeEncryption(mockLocalKeyWrapper(t, "k"), constants.ORGANIZATION_KEY_SCOPE)
+}
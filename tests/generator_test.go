@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"secret-svc/api/dtos"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/generators"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateComplexPassword(t *testing.T) {
+	value, err := generators.Generate(generators.Spec{
+		Type:         constants.PASSWORD_GENERATOR,
+		Length:       16,
+		MinUpper:     3,
+		MinDigits:    3,
+		MinSymbols:   2,
+		ExcludeChars: "0O1l",
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, value, 16)
+	assert.GreaterOrEqual(t, countIn(value, generators.UPPERCASE_CHARSET), 3)
+	assert.GreaterOrEqual(t, countIn(value, generators.DIGITS_CHARSET), 3)
+	assert.GreaterOrEqual(t, countIn(value, generators.SYMBOLS_CHARSET), 2)
+	assert.False(t, strings.ContainsAny(value, "0O1l"))
+
+	_, err = generators.Generate(generators.Spec{
+		Type:      constants.PASSWORD_GENERATOR,
+		Length:    4,
+		MinDigits: 5,
+	})
+	assert.Equal(t, constants.ErrInvalidGeneratorComplexity, err)
+
+	_, err = generators.Generate(generators.Spec{
+		Type:    constants.PASSWORD_GENERATOR,
+		Charset: "abcé€",
+	})
+	assert.Equal(t, constants.ErrInvalidGeneratorCharset, err)
+}
+
+func TestGenerateUUID(t *testing.T) {
+	value, err := generators.Generate(generators.Spec{Type: constants.UUID_GENERATOR})
+
+	assert.Nil(t, err)
+	_, err = uuid.Parse(value)
+	assert.Nil(t, err)
+}
+
+func TestGenerateKeyPairs(t *testing.T) {
+	for _, spec := range []generators.Spec{
+		{Type: constants.ED25519_KEYPAIR_GENERATOR},
+		{Type: constants.RSA_KEYPAIR_GENERATOR, Bits: 2048},
+	} {
+		value, err := generators.Generate(spec)
+		assert.Nil(t, err)
+
+		var keyPair generators.KeyPair
+		assert.Nil(t, json.Unmarshal([]byte(value), &keyPair))
+		assert.Equal(t, keyPair.PublicKey, generators.PublicPart(spec, value))
+
+		block, _ := pem.Decode([]byte(keyPair.PrivateKey))
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, constants.ErrInvalidKeySize, generators.Validate(generators.Spec{
+		Type: constants.RSA_KEYPAIR_GENERATOR,
+		Bits: 1024,
+	}))
+}
+
+func TestCreateNewSecretReqWithGenerate(t *testing.T) {
+	requestBody, err := dtos.CreateNewSecretReq(map[string]interface{}{
+		"generate": map[string]interface{}{
+			"type":   constants.HEX_TOKEN_GENERATOR,
+			"length": float64(16),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, constants.HEX_TOKEN_GENERATOR, requestBody.Generate.Type)
+
+	_, err = dtos.CreateNewSecretReq(map[string]interface{}{
+		"secret":   "c2VjcmV0",
+		"generate": map[string]interface{}{"type": constants.UUID_GENERATOR},
+	})
+	assert.Equal(t, constants.ErrConflictingSecretAttrs, err)
+}
+
+func countIn(value string, charset string) int {
+	count := 0
+	for _, char := range value {
+		if strings.ContainsRune(charset, char) {
+			count++
+		}
+	}
+
+	return count
+}
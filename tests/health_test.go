@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"secret-svc/api/handlers"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivateRegistrationHealth(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	mockInventoryEntry("org1_project1_CONFIGS", "org1", "project1", constants.CONFIGS_SCOPE, constants.SHARED_FLOW)
+	mockInventoryEntry("org1_project1_CREDENTIALS", "org1", "project1", constants.CREDENTIALS_SCOPE, constants.PRIVATE_FLOW)
+	mockInventoryEntry("org2_project1_CREDENTIALS", "org2", "project1", constants.CREDENTIALS_SCOPE, constants.PRIVATE_FLOW)
+	store.SetJSON("registry:health:org1_project1_CREDENTIALS", map[string]interface{}{
+		"status": constants.UNHEALTHY_STATUS, "checkedAt": time.Now(), "consecutiveFailures": 2, "denied": []string{"secretsmanager:GetSecretValue"},
+	}, 0)
+
+	registrations, err := services.ListPrivateRegistrationHealth(constants.UNHEALTHY_STATUS)
+	assert.Nil(t, err)
+	assert.Len(t, registrations, 1)
+	assert.Equal(t, "org1_project1_CREDENTIALS", registrations[0].SecretName)
+	assert.Equal(t, 2, registrations[0].Health.ConsecutiveFailures)
+
+	// Registrations which weren't checked yet
+	registrations, _ = services.ListPrivateRegistrationHealth(constants.UNKNOWN_STATUS)
+	assert.Len(t, registrations, 1)
+	assert.Equal(t, "org2_project1_CREDENTIALS", registrations[0].SecretName)
+
+	metrics := services.GetHealthMetrics()
+	assert.Contains(t, metrics, `secret_svc_private_registrations{status="unhealthy"} 1`)
+	assert.Contains(t, metrics, `secret_svc_private_registrations{status="unknown"} 1`)
+	assert.Contains(t, metrics, `secret_svc_private_registrations{status="healthy"} 0`)
+}
+
+func TestRunHealthChecksWithoutPrivateRegistrations(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	mockInventoryEntry("org1_project1_CONFIGS", "org1", "project1", constants.CONFIGS_SCOPE, constants.SHARED_FLOW)
+	store.SetJSON(services.INVENTORY_INDEXED_AT_KEY, time.Now().UTC(), 0)
+
+	run, err := services.RunHealthChecks()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, run.Registrations)
+	assert.Contains(t, services.GetHealthMetrics(), "secret_svc_private_health_check_last_run_timestamp_seconds")
+}
+
+func TestListPrivateHealthInvalidStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+	ctx := GetTestGinContext(w)
+	MockJsonGet(ctx, []gin.Param{}, url.Values{"status": {"SICK"}}, MockSystemSecretHeaders(ctx))
+
+	handlers.ListPrivateHealthHandler(ctx)
+	assert.EqualValues(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrInvalidHealthStatus.Error())
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"net/url"
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockInventoryEntry(secretName string, orgId string, projectId string, scope string, flow string) {
+	store.SetJSON("registry:index:"+secretName, map[string]interface{}{
+		"secretName": secretName, "orgId": orgId, "projectId": projectId, "scope": scope,
+		"flow": flow, "region": "us-east-1", "provider": "AWS",
+	}, 0)
+}
+
+func TestListInventory(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	mockInventoryEntry("org1", "org1", "", "", constants.SHARED_FLOW)
+	mockInventoryEntry("org1_project1_CONFIGS", "org1", "project1", constants.CONFIGS_SCOPE, constants.SHARED_FLOW)
+	mockInventoryEntry("org1_project1_CREDENTIALS", "org1", "project1", constants.CREDENTIALS_SCOPE, constants.PRIVATE_FLOW)
+	mockInventoryEntry("org2_project1_OTHERS", "org2", "project1", constants.OTHERS_SCOPE, constants.SHARED_FLOW)
+
+	filter, err := dtos.CreateNewInventoryFilter(url.Values{"limit": {"2"}, "counts": {"false"}})
+	assert.Nil(t, err)
+	page, err := services.ListInventory(filter)
+	assert.Nil(t, err)
+	assert.Len(t, page.Registrations, 2)
+	assert.Equal(t, "org1", page.Registrations[0].OrgId)
+	assert.Equal(t, "", page.Registrations[0].ProjectId)
+	assert.Equal(t, []string{constants.PRIVATE_FLOW, constants.SHARED_FLOW}, page.Registrations[1].Flows)
+	assert.Len(t, page.Registrations[1].Scopes, 2)
+	assert.Nil(t, page.Registrations[1].SecretCount)
+	assert.NotEmpty(t, page.NextToken)
+
+	// Next page
+	filter, err = dtos.CreateNewInventoryFilter(url.Values{"limit": {"2"}, "counts": {"false"}, "nextToken": {page.NextToken}})
+	assert.Nil(t, err)
+	page, err = services.ListInventory(filter)
+	assert.Nil(t, err)
+	assert.Len(t, page.Registrations, 1)
+	assert.Equal(t, "org2", page.Registrations[0].OrgId)
+	assert.Empty(t, page.NextToken)
+
+	// Scope attributes filter the scopes of every registration
+	filter, _ = dtos.CreateNewInventoryFilter(url.Values{"flow": {"private"}, "counts": {"false"}})
+	page, err = services.ListInventory(filter)
+	assert.Nil(t, err)
+	assert.Len(t, page.Registrations, 1)
+	assert.Equal(t, constants.CREDENTIALS_SCOPE, page.Registrations[0].Scopes[0].Scope)
+}
+
+func TestCreateInventoryFilter(t *testing.T) {
+	filter, err := dtos.CreateNewInventoryFilter(url.Values{})
+	assert.Nil(t, err)
+	assert.True(t, filter.Counts)
+	assert.Equal(t, dtos.INVENTORY_DEFAULT_LIMIT, filter.Limit)
+
+	_, err = dtos.CreateNewInventoryFilter(url.Values{"limit": {"1000"}})
+	assert.Equal(t, constants.ErrInvalidInventoryLimit, err)
+
+	_, err = dtos.CreateNewInventoryFilter(url.Values{"flow": {"HYBRID"}})
+	assert.Equal(t, constants.ErrInvalidFlow, err)
+
+	_, err = dtos.CreateNewInventoryFilter(url.Values{"nextToken": {"%%%"}})
+	assert.Equal(t, constants.ErrInvalidNextToken, err)
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobRunsMigrationRollback(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	scope := dtos.MigrationScopeState{SecretName: "org1", SecretIds: []string{}}
+	saveTestMigration(t, dtos.Migration{Id: "migration_1", OrgId: "org1", Phase: constants.COPY_PHASE, Status: constants.FAILED_STATUS, Scopes: []dtos.MigrationScopeState{scope}})
+
+	job, err := services.EnqueueJob(headers, constants.MIGRATION_ROLLBACK_JOB, nil, "migration_1")
+	assert.Nil(t, err)
+	assert.Equal(t, constants.QUEUED_STATUS, job.Status)
+
+	assert.True(t, services.ProcessNextJob())
+	assert.False(t, services.ProcessNextJob())
+
+	job, err = services.GetJob(headers, job.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, constants.SUCCEEDED_STATUS, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+
+	migration, _ := services.GetMigration(headers, "migration_1")
+	assert.Equal(t, constants.ROLLED_BACK_STATUS, migration.Status)
+
+	// Finished migrations can't be rolled back again, retrying won't help
+	job, _ = services.EnqueueJob(headers, constants.MIGRATION_ROLLBACK_JOB, nil, "migration_1")
+	assert.True(t, services.ProcessNextJob())
+	job, _ = services.GetJob(headers, job.Id)
+	assert.Equal(t, constants.FAILED_STATUS, job.Status)
+	assert.Equal(t, constants.ErrMigrationFinished.Error(), job.Error)
+	assert.Equal(t, 1, job.Attempts)
+}
+
+func TestJobCancellation(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+
+	_, err := services.EnqueueJob(headers, "UNKNOWN", nil, "")
+	assert.Equal(t, constants.ErrInvalidJobType, err)
+
+	queued, _ := services.EnqueueJob(headers, constants.SYSTEM_DELETION_JOB, nil, "")
+	job, err := services.CancelJob(headers, queued.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, constants.CANCELLED_STATUS, job.Status)
+	assert.False(t, services.ProcessNextJob())
+
+	_, err = services.CancelJob(headers, queued.Id)
+	assert.Equal(t, constants.ErrJobFinished, err)
+	_, err = services.CancelJob(dtos.CustomHeaders{OrgId: "org2"}, queued.Id)
+	assert.Equal(t, constants.ErrJobNotFound, err)
+
+	// Claimed by a worker, cancelled at its next checkpoint
+	running, _ := services.EnqueueJob(headers, constants.SYSTEM_DELETION_JOB, nil, "")
+	store.Default().Set("job:lock:"+running.Id, "1", time.Minute)
+	job, err = services.CancelJob(headers, running.Id)
+	assert.Nil(t, err)
+	assert.True(t, job.CancelRequested)
+	assert.Equal(t, constants.QUEUED_STATUS, job.Status)
+}
+
+func TestJobsOfAKeyRunOneAtATime(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	saveTestMigration(t, dtos.Migration{Id: "migration_1", OrgId: "org1", Phase: constants.COPY_PHASE, Status: constants.FAILED_STATUS})
+
+	services.EnqueueJob(headers, constants.MIGRATION_ROLLBACK_JOB, nil, "migration_1")
+	store.Default().Set("job:key:org1", "job_other", time.Minute)
+	assert.False(t, services.ProcessNextJob())
+
+	store.Default().Delete("job:key:org1")
+	assert.True(t, services.ProcessNextJob())
+}
+
+func TestSecretWritesWaitForJobs(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1", ProjectId: "project1", Scope: "CREDENTIALS"}
+	assert.Nil(t, services.CheckSecretWritable(headers))
+
+	// Jobs of the organization and of the project, and running migrations, rewrite the groups
+	for _, key := range []string{"job:key:org1", "job:key:org1_project1", "migration:active:org1_project1"} {
+		store.Default().Set(key, "owner", time.Minute)
+		assert.Equal(t, constants.ErrSecretGroupBusy, services.CheckSecretWritable(headers))
+		store.Default().Delete(key)
+	}
+	store.Default().Set("job:key:org1_project2", "owner", time.Minute)
+	assert.Nil(t, services.CheckSecretWritable(headers))
+
+	// Jobs wait for the writes which started before them
+	saveTestMigration(t, dtos.Migration{Id: "migration_1", OrgId: "org1", Phase: constants.COPY_PHASE, Status: constants.FAILED_STATUS})
+	services.EnqueueJob(dtos.CustomHeaders{OrgId: "org1"}, constants.MIGRATION_ROLLBACK_JOB, nil, "migration_1")
+	writes := 3
+	services.GroupLocksHeld = func(prefix string) (bool, error) {
+		writes--
+		return writes > 0, nil
+	}
+	defer func() { services.GroupLocksHeld = func(prefix string) (bool, error) { return false, nil } }()
+	assert.True(t, services.ProcessNextJob())
+	assert.Equal(t, 0, writes)
+}
+
+func TestJobBackoff(t *testing.T) {
+	assert.Equal(t, services.JOB_BASE_DELAY, services.JobBackoff(1))
+	assert.Equal(t, 4*services.JOB_BASE_DELAY, services.JobBackoff(3))
+}
+
+func TestRetriedPlanApprovalJobResumesItsMigration(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	plan := dtos.MigrationPlan{Id: "plan_1", OrgId: "org1", Status: constants.RUNNING_STATUS, Approvable: true, ExpiresAt: time.Now().Add(time.Hour)}
+	assert.Nil(t, store.SetJSON("migration:plan:plan_1", plan, time.Hour))
+	saveTestMigration(t, dtos.Migration{Id: "migration_1", OrgId: "org1", Phase: constants.DELETE_PHASE, Status: constants.COMPLETED_STATUS, SecretIds: []string{"db-url"}})
+
+	// The approval job was interrupted once its migration completed
+	job, err := services.EnqueueJob(headers, constants.PLAN_APPROVAL_JOB, nil, "plan_1")
+	assert.Nil(t, err)
+	job.Checkpoint = map[string]string{"migrationId": "migration_1"}
+	assert.Nil(t, store.SetJSON("job:record:"+job.Id, job, time.Hour))
+
+	assert.True(t, services.ProcessNextJob())
+	job, _ = services.GetJob(headers, job.Id)
+	assert.Equal(t, constants.SUCCEEDED_STATUS, job.Status)
+
+	plan, err = services.GetMigrationPlan(headers, "plan_1")
+	assert.Nil(t, err)
+	assert.Equal(t, constants.EXECUTED_STATUS, plan.Status)
+	assert.Equal(t, "migration_1", plan.MigrationId)
+	assert.Equal(t, []string{"db-url"}, plan.MigratedIds)
+}
+
+// Store letting another replica update a job between its listing and its claim
+type racingJobStore struct {
+	*store.MemoryStore
+	update func(job *dtos.Job)
+}
+
+func (s *racingJobStore) SetNX(key string, value string, ttl time.Duration) (bool, error) {
+	if id := strings.TrimPrefix(key, "job:lock:"); id != key && s.update != nil {
+		var job dtos.Job
+		store.GetJSON("job:record:"+id, &job)
+		s.update(&job)
+		s.update = nil
+		store.SetJSON("job:record:"+id, job, time.Hour)
+	}
+	return s.MemoryStore.SetNX(key, value, ttl)
+}
+
+func TestJobClaimReloadsTheJob(t *testing.T) {
+	racingStore := &racingJobStore{MemoryStore: store.NewMemoryStore()}
+	store.Use(racingStore)
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	saveTestMigration(t, dtos.Migration{Id: "migration_1", OrgId: "org1", Phase: constants.COPY_PHASE, Status: constants.FAILED_STATUS})
+	queued, _ := services.EnqueueJob(headers, constants.MIGRATION_ROLLBACK_JOB, nil, "migration_1")
+
+	// Finished by another replica
+	racingStore.update = func(job *dtos.Job) { job.Status = constants.SUCCEEDED_STATUS }
+	assert.False(t, services.ProcessNextJob())
+	job, _ := services.GetJob(headers, queued.Id)
+	assert.Equal(t, constants.SUCCEEDED_STATUS, job.Status)
+	assert.Equal(t, 0, job.Attempts)
+	_, err := store.Default().Get("job:lock:" + queued.Id)
+	assert.Equal(t, constants.ErrRecordNotFound, err)
+
+	// Rescheduled by another replica
+	job.Status = constants.QUEUED_STATUS
+	assert.Nil(t, store.SetJSON("job:record:"+job.Id, job, time.Hour))
+	racingStore.update = func(job *dtos.Job) { job.NextAttemptAt = time.Now().Add(time.Hour) }
+	assert.False(t, services.ProcessNextJob())
+	job, _ = services.GetJob(headers, queued.Id)
+	assert.Equal(t, constants.QUEUED_STATUS, job.Status)
+	_, err = store.Default().Get("job:lock:" + queued.Id)
+	assert.Equal(t, constants.ErrRecordNotFound, err)
+
+	// The reloaded record is run, with the attempts counted since the listing
+	job.NextAttemptAt = time.Time{}
+	assert.Nil(t, store.SetJSON("job:record:"+job.Id, job, time.Hour))
+	racingStore.update = func(job *dtos.Job) { job.Attempts = 2 }
+	assert.True(t, services.ProcessNextJob())
+	job, _ = services.GetJob(headers, queued.Id)
+	assert.Equal(t, constants.SUCCEEDED_STATUS, job.Status)
+	assert.Equal(t, 3, job.Attempts)
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"context"
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateMigrationApiCalls(t *testing.T) {
+	sharedToPrivate := services.EstimateMigrationApiCalls(constants.SHARED_FLOW, constants.PRIVATE_FLOW, 5, 2)
+	assert.Equal(t, 5, sharedToPrivate["CreateSecret"])
+	assert.Equal(t, 2, sharedToPrivate["PutSecretValue"])
+	assert.Equal(t, 1, sharedToPrivate["DeleteSecret"])
+	assert.Equal(t, 2, sharedToPrivate["GetSecretValue"])
+
+	privateToPrivate := services.EstimateMigrationApiCalls(constants.PRIVATE_FLOW, constants.PRIVATE_FLOW, 150, 0)
+	assert.Equal(t, 4, privateToPrivate["ListSecrets"])
+	assert.Equal(t, 301, privateToPrivate["GetSecretValue"])
+	assert.Equal(t, 150, privateToPrivate["CreateSecret"])
+	assert.Equal(t, 150, privateToPrivate["DeleteSecret"])
+
+	privateToShared := services.EstimateMigrationApiCalls(constants.PRIVATE_FLOW, constants.SHARED_FLOW, 3, 1)
+	assert.Equal(t, 1, privateToShared["PutSecretValue"])
+	assert.Equal(t, 0, privateToShared["CreateSecret"])
+	assert.Equal(t, 3, privateToShared["DeleteSecret"])
+	assert.Equal(t, 3, privateToShared["AssumeRole"])
+
+	reencryption := services.EstimateReencryptionApiCalls(4, 1)
+	assert.Equal(t, 0, reencryption["CreateSecret"])
+	assert.Equal(t, 0, reencryption["DeleteSecret"])
+	assert.Equal(t, 5, reencryption["PutSecretValue"])
+	assert.Equal(t, 5, reencryption["UpdateSecret"])
+	assert.Equal(t, 2, reencryption["UpdateSecretVersionStage"])
+	assert.Equal(t, 2, reencryption["AssumeRole"])
+}
+
+func TestApproveMigrationPlanStates(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1", ProjectId: "proj1"}
+	now := time.Now().UTC()
+
+	plans := map[string]dtos.MigrationPlan{
+		"plan_other":    {Id: "plan_other", OrgId: "org2", Status: constants.PLANNED_STATUS, Approvable: true, ExpiresAt: now.Add(time.Hour)},
+		"plan_expired":  {Id: "plan_expired", OrgId: "org1", ProjectId: "proj1", Status: constants.PLANNED_STATUS, Approvable: true, ExpiresAt: now.Add(-time.Minute)},
+		"plan_used":     {Id: "plan_used", OrgId: "org1", ProjectId: "proj1", Status: constants.EXECUTED_STATUS, Approvable: true, ExpiresAt: now.Add(time.Hour)},
+		"plan_rejected": {Id: "plan_rejected", OrgId: "org1", ProjectId: "proj1", Status: constants.PLANNED_STATUS, Errors: []string{"denied"}, ExpiresAt: now.Add(time.Hour)},
+	}
+	for id, plan := range plans {
+		assert.Nil(t, store.SetJSON("migration:plan:"+id, plan, time.Hour))
+	}
+
+	_, err := services.ApproveMigrationPlan(context.Background(), headers, "plan_other")
+	assert.Equal(t, constants.ErrMigrationPlanNotFound, err)
+	_, err = services.ApproveMigrationPlan(context.Background(), headers, "plan_missing")
+	assert.Equal(t, constants.ErrMigrationPlanNotFound, err)
+	_, err = services.ApproveMigrationPlan(context.Background(), headers, "plan_expired")
+	assert.Equal(t, constants.ErrMigrationPlanExpired, err)
+	_, err = services.ApproveMigrationPlan(context.Background(), headers, "plan_used")
+	assert.Equal(t, constants.ErrMigrationPlanUsed, err)
+	_, err = services.ApproveMigrationPlan(context.Background(), headers, "plan_rejected")
+	assert.Equal(t, constants.ErrMigrationPlanNotApprovable, err)
+
+	plan, err := services.GetMigrationPlan(headers, "plan_used")
+	assert.Nil(t, err)
+	assert.Equal(t, constants.EXECUTED_STATUS, plan.Status)
+}
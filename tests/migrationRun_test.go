@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func saveTestMigration(t *testing.T, migration dtos.Migration) {
+	assert.Nil(t, store.SetJSON("migration:run:"+migration.Id, migration, time.Hour))
+}
+
+// Store taking its time to save the outcome of a migration, reporting whether its lock was kept meanwhile
+type slowMigrationStore struct {
+	*store.MemoryStore
+	delay    time.Duration
+	lockKept chan bool
+}
+
+func (s *slowMigrationStore) Set(key string, value string, ttl time.Duration) error {
+	if strings.HasPrefix(key, "migration:run:") && strings.Contains(value, constants.ROLLED_BACK_STATUS) {
+		time.Sleep(s.delay)
+		_, err := s.MemoryStore.Get("migration:lock:" + strings.TrimPrefix(key, "migration:run:"))
+		s.lockKept <- err == nil
+	}
+	return s.MemoryStore.Set(key, value, ttl)
+}
+
+func TestMigrationLockHeartbeat(t *testing.T) {
+	slowStore := &slowMigrationStore{MemoryStore: store.NewMemoryStore(), delay: 50 * time.Millisecond, lockKept: make(chan bool, 1)}
+	store.Use(slowStore)
+	defer func(ttl time.Duration, heartbeat time.Duration) {
+		services.MIGRATION_LOCK_TTL = ttl
+		services.MIGRATION_HEARTBEAT = heartbeat
+	}(services.MIGRATION_LOCK_TTL, services.MIGRATION_HEARTBEAT)
+	services.MIGRATION_LOCK_TTL = 10 * time.Millisecond
+	services.MIGRATION_HEARTBEAT = 2 * time.Millisecond
+
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	scope := dtos.MigrationScopeState{SecretName: "org1", SecretIds: []string{}}
+	saveTestMigration(t, dtos.Migration{Id: "migration_1", OrgId: "org1", Phase: constants.COPY_PHASE, Status: constants.FAILED_STATUS, Scopes: []dtos.MigrationScopeState{scope}})
+
+	migration, err := services.RollbackMigration(headers, "migration_1")
+	assert.Nil(t, err)
+	assert.Equal(t, constants.ROLLED_BACK_STATUS, migration.Status)
+	assert.True(t, <-slowStore.lockKept)
+
+	// Released once the migration stopped, the heartbeat doesn't bring it back
+	time.Sleep(10 * time.Millisecond)
+	_, err = store.Default().Get("migration:lock:migration_1")
+	assert.Equal(t, constants.ErrRecordNotFound, err)
+}
+
+func TestMigrationClaims(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+
+	saveTestMigration(t, dtos.Migration{Id: "migration_other", OrgId: "org2", Phase: constants.COPY_PHASE, Status: constants.FAILED_STATUS})
+	saveTestMigration(t, dtos.Migration{Id: "migration_done", OrgId: "org1", Phase: constants.DELETE_PHASE, Status: constants.COMPLETED_STATUS})
+	saveTestMigration(t, dtos.Migration{Id: "migration_deleting", OrgId: "org1", Phase: constants.DELETE_PHASE, Status: constants.FAILED_STATUS})
+	saveTestMigration(t, dtos.Migration{Id: "migration_running", OrgId: "org1", Phase: constants.COPY_PHASE, Status: constants.RUNNING_STATUS})
+	store.Default().Set("migration:lock:migration_running", "1", time.Minute)
+
+	_, err := services.GetMigration(headers, "migration_other")
+	assert.Equal(t, constants.ErrMigrationNotFound, err)
+	_, err = services.ResumeMigration(context.Background(), headers, "migration_done")
+	assert.Equal(t, constants.ErrMigrationFinished, err)
+	_, err = services.RollbackMigration(headers, "migration_deleting")
+	assert.Equal(t, constants.ErrMigrationRollbackNotAllowed, err)
+	_, err = services.RollbackMigration(headers, "migration_running")
+	assert.Equal(t, constants.ErrMigrationInProgress, err)
+
+	migrations, err := services.ListMigrations(headers)
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 3)
+}
+
+func TestResumeInterruptedMigrations(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	scope := dtos.MigrationScopeState{SecretName: "org1", SecretIds: []string{}}
+
+	// Interrupted while rolling back, nothing left to undo
+	saveTestMigration(t, dtos.Migration{Id: "migration_crashed", OrgId: "org1", Phase: constants.ROLLBACK_PHASE, Status: constants.RUNNING_STATUS, Scopes: []dtos.MigrationScopeState{scope}})
+	store.Default().Set("migration:active:org1", "migration_crashed", 0)
+
+	// Still owned by a live replica
+	saveTestMigration(t, dtos.Migration{Id: "migration_owned", OrgId: "org2", Phase: constants.COPY_PHASE, Status: constants.RUNNING_STATUS})
+	store.Default().Set("migration:lock:migration_owned", "1", time.Minute)
+
+	assert.Equal(t, 1, services.ResumeInterruptedMigrations())
+
+	migration, err := services.GetMigration(headers, "migration_crashed")
+	assert.Nil(t, err)
+	assert.Equal(t, constants.ROLLED_BACK_STATUS, migration.Status)
+	_, err = store.Default().Get("migration:active:org1")
+	assert.Equal(t, constants.ErrRecordNotFound, err)
+
+	assert.Equal(t, 0, services.ResumeInterruptedMigrations())
+}
+
+func TestMigrationActiveKey(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+
+	// Failed migrations released the key, another migration of the key may have started since
+	saveTestMigration(t, dtos.Migration{Id: "migration_failed", OrgId: "org1", Phase: constants.COPY_PHASE, Status: constants.FAILED_STATUS})
+	store.Default().Set("migration:active:org1", "migration_next", 0)
+	_, err := services.RollbackMigration(headers, "migration_failed")
+	assert.Equal(t, constants.ErrMigrationInProgress, err)
+
+	store.Default().Delete("migration:active:org1")
+	migration, err := services.RollbackMigration(headers, "migration_failed")
+	assert.Nil(t, err)
+	assert.Equal(t, constants.ROLLED_BACK_STATUS, migration.Status)
+	_, err = store.Default().Get("migration:active:org1")
+	assert.Equal(t, constants.ErrRecordNotFound, err)
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckMigration(t *testing.T) {
+	shared := map[string]interface{}{
+		constants.FLOW_META_DATA:   constants.SHARED_FLOW,
+		constants.ARN_META_DATA:    "arn:aws:iam::111111111111:role/shared",
+		constants.REGION_META_DATA: "us-east-1",
+	}
+	private := map[string]interface{}{
+		constants.FLOW_META_DATA:   constants.PRIVATE_FLOW,
+		constants.ARN_META_DATA:    "arn:aws:iam::222222222222:role/customer",
+		constants.REGION_META_DATA: "us-east-1",
+	}
+	toShared := dtos.SystemSecretReq{Flow: constants.SHARED_FLOW}
+	toPrivate := dtos.SystemSecretReq{Flow: constants.PRIVATE_FLOW, ARN: "arn:aws:iam::333333333333:role/customer", Region: "us-east-1"}
+
+	assert.Nil(t, services.CheckMigration(shared, toPrivate))
+	assert.Nil(t, services.CheckMigration(private, toShared))
+	assert.Nil(t, services.CheckMigration(private, toPrivate))
+	assert.Equal(t, constants.ErrInvalidMigration, services.CheckMigration(shared, toShared))
+
+	// Moving to another region of the same account
+	toRegion := dtos.SystemSecretReq{Flow: constants.PRIVATE_FLOW, ARN: private[constants.ARN_META_DATA].(string), Region: "eu-west-1"}
+	assert.Nil(t, services.CheckMigration(private, toRegion))
+
+	toRegion.Region = "us-east-1"
+	assert.Equal(t, constants.ErrSameMigrationTarget, services.CheckMigration(private, toRegion))
+
+	// Changing the KMS key re-encrypts the secrets in place
+	toKmsKey := dtos.SystemSecretReq{Flow: constants.PRIVATE_FLOW, ARN: toRegion.ARN, Region: "us-east-1", KmsKeyId: "arn:aws:kms:us-east-1:222222222222:alias/secrets"}
+	assert.Nil(t, services.CheckMigration(private, toKmsKey))
+
+	private[constants.KMS_KEY_META_DATA] = toKmsKey.KmsKeyId
+	assert.Equal(t, constants.ErrSameMigrationTarget, services.CheckMigration(private, toKmsKey))
+	assert.Nil(t, services.CheckMigration(private, toRegion))
+}
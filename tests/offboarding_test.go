@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"secret-svc/api/dtos"
+	"secret-svc/api/handlers"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmOrgOffboarding(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	headers := dtos.CustomHeaders{OrgId: "org-offboarding"}
+	store.SetJSON("offboarding:token:org-offboarding", map[string]interface{}{
+		"token": "confirmation-token", "expiresAt": time.Now().Add(time.Minute),
+	}, time.Minute)
+
+	assert.Equal(t, constants.ErrMissingConfirmationToken, services.ConfirmOrgOffboarding(headers, ""))
+	assert.Equal(t, constants.ErrInvalidConfirmationToken, services.ConfirmOrgOffboarding(headers, "other-token"))
+	assert.Equal(t, constants.ErrOrgOffboardingProject, services.ConfirmOrgOffboarding(dtos.CustomHeaders{OrgId: "org-offboarding", ProjectId: "project"}, "confirmation-token"))
+
+	// Tokens are used once
+	assert.Nil(t, services.ConfirmOrgOffboarding(headers, "confirmation-token"))
+	assert.Equal(t, constants.ErrInvalidConfirmationToken, services.ConfirmOrgOffboarding(headers, "confirmation-token"))
+}
+
+func TestDeleteOrganizationWithoutConfirmation(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	ctx := GetTestGinContext(w)
+	headers := MockSystemSecretHeaders(ctx)
+	headers.Del(constants.PROJECT_ID_HEADER)
+	headers.Del(constants.SCOPE_HEADER)
+	MockJsonDelete(ctx, []gin.Param{}, url.Values{}, headers)
+
+	handlers.DeleteOrganizationHandler(ctx)
+	assert.EqualValues(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrMissingConfirmationToken.Error())
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"secret-svc/api/handlers"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetExternalId(t *testing.T) {
+	t.Setenv("EXTERNAL_ID_SECRET", "")
+	assert.Equal(t, "", services.GetExternalId("org1"))
+
+	t.Setenv("EXTERNAL_ID_SECRET", "secret")
+	assert.Len(t, services.GetExternalId("org1"), 64)
+	assert.Equal(t, services.GetExternalId("org1"), services.GetExternalId("org1"))
+	assert.NotEqual(t, services.GetExternalId("org1"), services.GetExternalId("org2"))
+}
+
+func TestRenderCloudFormationTemplate(t *testing.T) {
+	t.Setenv("EXTERNAL_ID_SECRET", "secret")
+	onboarding, err := services.RenderOnboardingTemplate("org1", "cloudformation", "111111111111", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, constants.CLOUDFORMATION_FORMAT, onboarding.Format)
+
+	template, _ := json.Marshal(onboarding.Template)
+	assert.Contains(t, string(template), `"AWS":"arn:aws:iam::111111111111:root"`)
+	assert.Contains(t, string(template), `"sts:ExternalId":"`+services.GetExternalId("org1")+`"`)
+	assert.Contains(t, string(template), `"aws:ResourceTag/SecretGroup":["org1","org1_*"]`)
+	assert.Contains(t, string(template), `"aws:RequestTag/SecretGroup":["org1","org1_*"]`)
+	assert.Contains(t, string(template), `:secret:secret_*"`)
+	assert.Contains(t, string(template), `:secret:secret-svc-probe-*"`)
+	assert.NotContains(t, string(template), "secretsmanager:*")
+}
+
+func TestRenderTerraformTemplate(t *testing.T) {
+	t.Setenv("EXTERNAL_ID_SECRET", "secret")
+	onboarding, err := services.RenderOnboardingTemplate("org1", "terraform", "111111111111", nil)
+	assert.Nil(t, err)
+
+	resources := onboarding.Template["resource"].(map[string]interface{})
+	policy := resources["aws_iam_role_policy"].(map[string]interface{})["secret_manager_crud_policy"].(map[string]interface{})["policy"].(string)
+	assert.Contains(t, policy, "${data.aws_region.current.name}")
+	assert.Contains(t, policy, `"aws:ResourceTag/SecretGroup":["org1","org1_*"]`)
+
+	_, err = services.RenderOnboardingTemplate("org1", "pulumi", "111111111111", nil)
+	assert.Equal(t, constants.ErrInvalidTemplateFormat, err)
+}
+
+func TestRenderOnboardingPolicyPermissions(t *testing.T) {
+	t.Setenv("EXTERNAL_ID_SECRET", "secret")
+	keyArn := "arn:aws:kms:us-east-1:222222222222:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	onboarding, err := services.RenderOnboardingTemplate("org1", "terraform", "111111111111", []string{keyArn, "arn:aws:kms:us-east-1:222222222222:alias/secrets"})
+	assert.Nil(t, err)
+
+	resources := onboarding.Template["resource"].(map[string]interface{})
+	policy := resources["aws_iam_role_policy"].(map[string]interface{})["secret_manager_crud_policy"].(map[string]interface{})["policy"].(string)
+	for _, action := range append(append([]string{}, services.REENCRYPTION_PERMISSIONS...), services.KMS_KEY_PERMISSIONS...) {
+		assert.Contains(t, policy, `"`+action+`"`)
+	}
+	assert.Contains(t, policy, `"Resource":"`+keyArn+`"`)
+	assert.Contains(t, policy, `"Resource":"arn:aws:kms:us-east-1:222222222222:key/*"`)
+	assert.Contains(t, policy, `"kms:ResourceAliases":"alias/secrets"`)
+	assert.Contains(t, policy, `"kms:ViaService":"secretsmanager.*.amazonaws.com"`)
+	assert.NotContains(t, policy, "kms:*")
+
+	// Without a customer managed key nothing is granted on KMS
+	onboarding, _ = services.RenderOnboardingTemplate("org1", "cloudformation", "111111111111", nil)
+	template, _ := json.Marshal(onboarding.Template)
+	assert.Contains(t, string(template), "secretsmanager:UpdateSecretVersionStage")
+	assert.NotContains(t, string(template), "kms:")
+
+	_, err = services.RenderOnboardingTemplate("org1", "cloudformation", "111111111111", []string{"alias/secrets"})
+	assert.Equal(t, constants.ErrInvalidKmsKey, err)
+}
+
+func TestGetOnboardingTemplateHandlerErrors(t *testing.T) {
+	t.Setenv("EXTERNAL_ID_SECRET", "secret")
+	w := httptest.NewRecorder()
+	ctx := GetTestGinContext(w)
+	MockJsonGet(ctx, []gin.Param{}, url.Values{"format": {"pulumi"}}, MockSystemSecretHeaders(ctx))
+	handlers.GetOnboardingTemplateHandler(ctx)
+	assert.EqualValues(t, 401, w.Code)
+
+	t.Setenv("EXTERNAL_ID_SECRET", "")
+	w = httptest.NewRecorder()
+	ctx = GetTestGinContext(w)
+	MockJsonGet(ctx, []gin.Param{}, url.Values{}, MockSystemSecretHeaders(ctx))
+	handlers.GetOnboardingTemplateHandler(ctx)
+	assert.EqualValues(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrExternalIdDisabled.Error())
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/bus"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+// Publisher failing after a number of messages
+type flakyPublisher struct {
+	remaining int
+	published []string
+}
+
+func (f *flakyPublisher) Publish(message bus.Message) error {
+	if f.remaining == 0 {
+		return errors.New("bus unavailable")
+	}
+	f.remaining--
+	f.published = append(f.published, message.Id)
+	return nil
+}
+
+func (f *flakyPublisher) Close() error {
+	return nil
+}
+
+func startNatsServer(t *testing.T) *server.Server {
+	natsServer, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	go natsServer.Start()
+	if !natsServer.ReadyForConnections(5 * time.Second) {
+		t.Fatal("embedded NATS server did not start")
+	}
+	t.Cleanup(natsServer.Shutdown)
+
+	return natsServer
+}
+
+func TestOutboxKeepsOrderOnFailures(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	publisher := &flakyPublisher{remaining: 1}
+	services.UseOutboxPublisher(publisher)
+
+	first := events.Publish(events.Event{Type: constants.CREATED_EVENT, OrgId: "org1", SecretId: "db"})
+	second := events.Publish(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", SecretId: "db"})
+	third := events.Publish(events.Event{Type: constants.DELETED_EVENT, OrgId: "org1", SecretId: "db"})
+
+	assert.Equal(t, 1, services.PublishOutboxEvents())
+	assert.Equal(t, []string{first.Id}, publisher.published)
+
+	publisher.remaining = -1
+	assert.Equal(t, 2, services.PublishOutboxEvents())
+	assert.Equal(t, []string{first.Id, second.Id, third.Id}, publisher.published)
+	assert.Equal(t, 0, services.PublishOutboxEvents())
+}
+
+func TestOutboxPublishesToNats(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	natsServer := startNatsServer(t)
+
+	conn, err := nats.Connect(natsServer.ClientURL())
+	assert.Nil(t, err)
+	defer conn.Close()
+	subscription, err := conn.SubscribeSync("secrets.events.>")
+	assert.Nil(t, err)
+	conn.Flush()
+
+	publisher, err := bus.NewNatsPublisher(natsServer.ClientURL(), "secrets.events", false)
+	assert.Nil(t, err)
+	defer publisher.Close()
+	services.UseOutboxPublisher(publisher)
+
+	first := events.Publish(events.Event{Type: constants.CREATED_EVENT, OrgId: "org.1", SecretId: "db"})
+	second := events.Publish(events.Event{Type: constants.REGISTERED_EVENT, OrgId: "org.1"})
+	assert.Equal(t, 2, services.PublishOutboxEvents())
+
+	for _, expected := range []events.Event{first, second} {
+		message, err := subscription.NextMsg(2 * time.Second)
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		var event events.Event
+		assert.Nil(t, json.Unmarshal(message.Data, &event))
+		assert.Equal(t, "secrets.events.org_1", message.Subject)
+		assert.Equal(t, expected.Id, event.Id)
+	}
+}
+
+func TestOutboxPublishesToJetStream(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	natsServer := startNatsServer(t)
+
+	conn, err := nats.Connect(natsServer.ClientURL())
+	assert.Nil(t, err)
+	defer conn.Close()
+	js, _ := conn.JetStream()
+	_, err = js.AddStream(&nats.StreamConfig{Name: "SECRETS", Subjects: []string{"secrets.events.>"}})
+	assert.Nil(t, err)
+
+	publisher, err := bus.NewNatsPublisher(natsServer.ClientURL(), "secrets.events", true)
+	assert.Nil(t, err)
+	defer publisher.Close()
+	services.UseOutboxPublisher(publisher)
+
+	event := events.Publish(events.Event{Type: constants.CREATED_EVENT, OrgId: "org1", SecretId: "db"})
+	assert.Equal(t, 1, services.PublishOutboxEvents())
+
+	// Redeliveries are dropped by the stream using the event ID
+	payload, _ := json.Marshal(event)
+	assert.Nil(t, publisher.Publish(bus.Message{Key: "org1", Id: event.Id, Payload: payload}))
+
+	info, err := js.StreamInfo("SECRETS")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), info.State.Msgs)
+}
+
+func TestOutboxReconcilesPendingWrites(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	publisher := &flakyPublisher{remaining: -1}
+	services.UseOutboxPublisher(publisher)
+	defer func() { services.OutboxWriteApplied = services.SecretManagerWriteApplied }()
+
+	// Requests lost between the write and the record of their event
+	startedAt := time.Now().UTC().Add(-services.OUTBOX_PENDING_TIMEOUT)
+	applied := dtos.OutboxWrite{Event: events.Event{Id: "evt_applied", Type: constants.UPDATED_EVENT, OrgId: "org1", SecretId: "db"}, SecretName: "org1_project1_CONFIGS", StartedAt: startedAt}
+	skipped := dtos.OutboxWrite{Event: events.Event{Id: "evt_skipped", Type: constants.UPDATED_EVENT, OrgId: "org1", SecretId: "api"}, SecretName: "org1_project1_CONFIGS", StartedAt: startedAt}
+	recent := dtos.OutboxWrite{Event: events.Event{Id: "evt_recent", Type: constants.UPDATED_EVENT, OrgId: "org1", SecretId: "db"}, SecretName: "org1_project1_CONFIGS", StartedAt: time.Now().UTC()}
+	for _, write := range []dtos.OutboxWrite{applied, skipped, recent} {
+		store.SetJSON("outbox:pending:"+write.Event.Id, write, 0)
+	}
+	services.OutboxWriteApplied = func(write dtos.OutboxWrite) (bool, error) {
+		return write.Event.Id == "evt_applied", nil
+	}
+
+	assert.Equal(t, 1, services.ReconcileOutboxWrites(time.Now().UTC()))
+	assert.Equal(t, 1, services.PublishOutboxEvents())
+	assert.Equal(t, []string{"evt_applied"}, publisher.published)
+
+	// Writes still running are left to their request
+	keys, _ := store.Default().Keys("outbox:pending:")
+	assert.Equal(t, []string{"outbox:pending:evt_recent"}, keys)
+
+	// Recorded events remove their pending write
+	events.Publish(recent.Event)
+	keys, _ = store.Default().Keys("outbox:pending:")
+	assert.Len(t, keys, 0)
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/generators"
+	"secret-svc/pkg/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	value, err := generators.Generate(generators.Spec{
+		Type:    constants.PASSWORD_GENERATOR,
+		Length:  24,
+		Charset: "abc",
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, value, 24)
+	assert.Empty(t, strings.Trim(value, "abc"))
+}
+
+func TestGenerateRandomBytesAndApiKey(t *testing.T) {
+	value, err := generators.Generate(generators.Spec{
+		Type:   constants.RANDOM_BYTES_GENERATOR,
+		Length: 16,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, value, 32)
+
+	value, err = generators.Generate(generators.Spec{
+		Type:   constants.API_KEY_GENERATOR,
+		Prefix: "sk_",
+	})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(value, "sk_"))
+
+	_, err = generators.Generate(generators.Spec{Type: "UNKNOWN"})
+	assert.Equal(t, constants.ErrInvalidGeneratorType, err)
+}
+
+func TestCreateNewRotationPolicyReq(t *testing.T) {
+	requestBody, err := dtos.CreateNewRotationPolicyReq(map[string]interface{}{
+		"interval": "720h",
+		"generator": map[string]interface{}{
+			"type":   constants.PASSWORD_GENERATOR,
+			"length": float64(40),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 40, requestBody.Generator.Length)
+
+	_, err = dtos.CreateNewRotationPolicyReq(map[string]interface{}{
+		"interval":  "10s",
+		"generator": map[string]interface{}{"type": constants.PASSWORD_GENERATOR},
+	})
+	assert.Equal(t, constants.ErrMissingIntervalAttr, err)
+}
+
+func TestGetDueRotationPolicies(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	now := time.Now().UTC()
+
+	store.SetJSON("rotation:policy:test-111_test-222_CONFIGS:secret_due", dtos.RotationPolicy{
+		SecretId:     "secret_due",
+		NextRotation: now.Add(-time.Minute),
+	}, 0)
+	store.SetJSON("rotation:policy:test-111_test-222_CONFIGS:secret_later", dtos.RotationPolicy{
+		SecretId:     "secret_later",
+		NextRotation: now.Add(time.Hour),
+	}, 0)
+
+	duePolicies := services.GetDueRotationPolicies(now)
+	assert.Len(t, duePolicies, 1)
+	assert.Equal(t, "secret_due", duePolicies[0].SecretId)
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"secret-svc/api/dtos"
+	"secret-svc/api/handlers"
+	"secret-svc/api/middlewares"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/store"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeRegistry(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+
+	scopes, err := services.ListScopes("org-scopes")
+	assert.Nil(t, err)
+	assert.Len(t, scopes, 3)
+	assert.Equal(t, constants.OTHERS_SCOPE, services.GetDefaultScope("org-scopes"))
+	assert.False(t, services.IsScopeRegistered("org-scopes", "CERTIFICATES"))
+
+	scope, err := services.PutScope("org-scopes", "CERTIFICATES", dtos.ScopeReq{MaxSecretSize: 4, Masked: true, Default: true})
+	assert.Nil(t, err)
+	assert.False(t, scope.BuiltIn)
+	assert.True(t, services.IsScopeRegistered("org-scopes", "CERTIFICATES"))
+	assert.Equal(t, "CERTIFICATES", services.GetDefaultScope("org-scopes"))
+	assert.True(t, services.IsScopeMasked(dtos.CustomHeaders{OrgId: "org-scopes", Scope: "CERTIFICATES"}))
+
+	// Other organizations keep the built-in scopes
+	assert.False(t, services.IsScopeRegistered("org-other", "CERTIFICATES"))
+	assert.Equal(t, constants.OTHERS_SCOPE, services.GetDefaultScope("org-other"))
+
+	// Built-in scopes are reset instead of removed
+	_, err = services.PutScope("org-scopes", constants.CONFIGS_SCOPE, dtos.ScopeReq{Masked: true})
+	assert.Nil(t, err)
+	assert.Nil(t, services.DeleteScope("org-scopes", constants.CONFIGS_SCOPE))
+	assert.True(t, services.IsScopeRegistered("org-scopes", constants.CONFIGS_SCOPE))
+	assert.False(t, services.IsScopeMasked(dtos.CustomHeaders{OrgId: "org-scopes", Scope: constants.CONFIGS_SCOPE}))
+
+	assert.Nil(t, services.DeleteScope("org-scopes", "CERTIFICATES"))
+	assert.Equal(t, constants.OTHERS_SCOPE, services.GetDefaultScope("org-scopes"))
+	assert.Equal(t, constants.ErrScopeNotFound, services.DeleteScope("org-scopes", "CERTIFICATES"))
+}
+
+func TestScopeMaxSecretSize(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	services.PutScope("org-scopes", "CERTIFICATES", dtos.ScopeReq{MaxSecretSize: 4})
+	headers := dtos.CustomHeaders{OrgId: "org-scopes", ProjectId: "project", Scope: "CERTIFICATES"}
+
+	_, err := services.CreateSecret(headers, "12345")
+	assert.Equal(t, constants.ErrSecretTooLarge, err)
+
+	_, err = services.UpdateSecret(headers, "secret_1", "12345")
+	assert.Equal(t, constants.ErrSecretTooLarge, err)
+}
+
+func TestCreateScopeReq(t *testing.T) {
+	requestBody, err := dtos.CreateNewScopeReq(map[string]interface{}{
+		"defaultFlow":   map[string]interface{}{"flow": constants.SHARED_FLOW},
+		"maxSecretSize": float64(2048),
+		"masked":        true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, constants.SHARED_FLOW, requestBody.DefaultFlow.Flow)
+	assert.Equal(t, 2048, requestBody.MaxSecretSize)
+	assert.True(t, requestBody.Masked)
+
+	_, err = dtos.CreateNewScopeReq(map[string]interface{}{"maxSecretSize": float64(-1)})
+	assert.Equal(t, constants.ErrInvalidMaxSecretSize, err)
+
+	_, err = dtos.CreateNewScopeReq(map[string]interface{}{"defaultFlow": map[string]interface{}{"flow": "HYBRID"}})
+	assert.Equal(t, constants.ErrInvalidFlow, err)
+
+	assert.Nil(t, dtos.CheckScopeName("FEATURE_FLAGS"))
+	assert.Equal(t, constants.ErrInvalidScopeName, dtos.CheckScopeName("feature-flags"))
+}
+
+func TestCheckHeadersScopeRegistry(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	ctx := GetTestGinContext(w)
+	headers := MockSystemSecretHeaders(ctx)
+	headers.Set(constants.SCOPE_HEADER, "FEATURE_FLAGS")
+	MockJsonGet(ctx, []gin.Param{}, url.Values{}, headers)
+
+	middlewares.CheckHeaders(ctx)
+	assert.True(t, ctx.IsAborted())
+	assert.EqualValues(t, 401, w.Code)
+
+	services.PutScope(headers.Get(constants.ORG_ID_HEADER), "FEATURE_FLAGS", dtos.ScopeReq{})
+	w = httptest.NewRecorder()
+	ctx = GetTestGinContext(w)
+	MockJsonGet(ctx, []gin.Param{}, url.Values{}, headers)
+
+	middlewares.CheckHeaders(ctx)
+	assert.False(t, ctx.IsAborted())
+}
+
+func TestPostSystemSecretUnregisteredScope(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	ctx := GetTestGinContext(w)
+	headers := MockSystemSecretHeaders(ctx)
+	headers.Del(constants.SCOPE_HEADER)
+	MockJsonPost(ctx, dtos.SystemSecretReq{
+		Scopes: map[string]dtos.SystemSecretReq{
+			"FEATURE_FLAGS": {Flow: constants.SHARED_FLOW},
+		},
+	}, []gin.Param{}, url.Values{}, headers)
+
+	handlers.CreateSystemSecretHandler(ctx)
+	assert.EqualValues(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrInvalidScope.Error())
+}
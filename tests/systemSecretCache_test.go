@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemSecretCache(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	services.StartSystemSecretCache(time.Minute, true)
+	defer services.StartSystemSecretCache(0, false)
+	// Letting the invalidation watcher start before entries are cached
+	time.Sleep(50 * time.Millisecond)
+
+	headers := dtos.CustomHeaders{OrgId: "org-cache", ProjectId: "project", Scope: constants.OTHERS_SCOPE}
+	store.SetJSON("registry:cache:org-cache_project_OTHERS", map[string]interface{}{"generation": "", "entry": map[string]interface{}{
+		"arn": "arn:aws:iam::111111111111:role/secrets", "region": "us-east-1", "provider": "AWS", "flow": constants.SHARED_FLOW, "registered": true,
+	}}, 0)
+	store.SetJSON("registry:cache:org-cache_project_CONFIGS", map[string]interface{}{"generation": "", "entry": map[string]interface{}{"registered": false}}, 0)
+	before := services.GetSystemSecretCacheStats()
+
+	// Served by the shared entry, then by the in-process cache
+	arn, region, _, flow, err := services.LookupSystemSecret(headers, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::111111111111:role/secrets", arn)
+	assert.Equal(t, "us-east-1", region)
+	assert.Equal(t, constants.SHARED_FLOW, flow)
+
+	_, _, _, flow, err = services.LookupSystemSecret(headers, "")
+	assert.Nil(t, err)
+	assert.Equal(t, constants.SHARED_FLOW, flow)
+
+	stats := services.GetSystemSecretCacheStats()
+	assert.True(t, stats.Enabled)
+	assert.Equal(t, before.Hits+1, stats.Hits)
+	assert.Equal(t, before.SharedHits+1, stats.SharedHits)
+	assert.Equal(t, before.Misses+1, stats.Misses)
+
+	// Unregistered keys are cached as well
+	headers.Scope = constants.CONFIGS_SCOPE
+	_, _, _, _, err = services.LookupSystemSecret(headers, "")
+	assert.Equal(t, constants.ErrUnregisteredKey, err)
+
+	// Changes published by any replica drop the entry
+	events.Publish(events.Event{
+		Type:     constants.MIGRATED_EVENT,
+		OrgId:    "org-cache",
+		Metadata: map[string]interface{}{"group": "org-cache_project_OTHERS"},
+	})
+	assert.Eventually(t, func() bool {
+		return services.GetSystemSecretCacheStats().Invalidations > stats.Invalidations
+	}, time.Second, 10*time.Millisecond)
+
+	headers.Scope = constants.OTHERS_SCOPE
+	services.LookupSystemSecret(headers, "")
+	assert.Equal(t, stats.SharedHits+2, services.GetSystemSecretCacheStats().SharedHits)
+
+	// Shared entries of a previous generation were read before a change, they are not served
+	store.Default().Set("registry:generation:org-cache_project_SECRETS", "generation-2", 0)
+	store.SetJSON("registry:cache:org-cache_project_SECRETS", map[string]interface{}{"generation": "generation-1", "entry": map[string]interface{}{"registered": false}}, 0)
+	headers.Scope = "SECRETS"
+	before = services.GetSystemSecretCacheStats()
+	services.LookupSystemSecret(headers, "")
+	assert.Equal(t, before.SharedHits, services.GetSystemSecretCacheStats().SharedHits)
+}
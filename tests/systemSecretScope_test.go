@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"secret-svc/api/dtos"
+	"secret-svc/api/handlers"
+	"secret-svc/pkg/constants"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSystemSecretReqScopes(t *testing.T) {
+	requestBody, err := dtos.CreateNewSystemSecretReq(map[string]interface{}{
+		"flow": constants.SHARED_FLOW,
+		"scopes": map[string]interface{}{
+			constants.ACCEPTED_SCOPES[0]: map[string]interface{}{
+				"flow":     constants.PRIVATE_FLOW,
+				"arn":      "arn:aws:iam::111111111111:role/secrets",
+				"region":   "us-east-1",
+				"provider": "AWS",
+			},
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, constants.SHARED_FLOW, requestBody.Flow)
+	assert.Len(t, requestBody.Scopes, 1)
+	assert.Equal(t, constants.PRIVATE_FLOW, requestBody.Scopes[constants.ACCEPTED_SCOPES[0]].Flow)
+	assert.Nil(t, dtos.CheckSystemSecretFlows(requestBody))
+
+	// The top-level flow is optional with scopes
+	requestBody, err = dtos.CreateNewSystemSecretReq(map[string]interface{}{
+		"scopes": map[string]interface{}{
+			constants.ACCEPTED_SCOPES[1]: map[string]interface{}{"flow": constants.SHARED_FLOW},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "", requestBody.Flow)
+
+	_, err = dtos.CreateNewSystemSecretReq(map[string]interface{}{"scopes": []interface{}{}})
+	assert.Equal(t, constants.ErrInvalidScopesAttr, err)
+
+	_, err = dtos.CreateNewSystemSecretReq(map[string]interface{}{
+		"scopes": map[string]interface{}{
+			constants.ACCEPTED_SCOPES[0]: map[string]interface{}{"flow": constants.PRIVATE_FLOW},
+		},
+	})
+	assert.ErrorContains(t, err, "missing arn, region, provider for 'Private' flow")
+
+	requestBody, _ = dtos.CreateNewSystemSecretReq(map[string]interface{}{
+		"scopes": map[string]interface{}{
+			constants.ACCEPTED_SCOPES[0]: map[string]interface{}{"flow": "HYBRID"},
+		},
+	})
+	assert.Equal(t, constants.ErrInvalidFlow, dtos.CheckSystemSecretFlows(requestBody))
+}
+
+func TestPostSystemSecretUntargetedScope(t *testing.T) {
+	w := httptest.NewRecorder()
+	ctx := GetTestGinContext(w)
+
+	headers := MockSystemSecretHeaders(ctx)
+	headers.Set(constants.SCOPE_HEADER, constants.ACCEPTED_SCOPES[0])
+	MockJsonPost(ctx, dtos.SystemSecretReq{
+		Scopes: map[string]dtos.SystemSecretReq{
+			constants.ACCEPTED_SCOPES[1]: {Flow: constants.SHARED_FLOW},
+		},
+	}, []gin.Param{}, url.Values{}, headers)
+
+	handlers.CreateSystemSecretHandler(ctx)
+	assert.EqualValues(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), constants.ErrUntargetedScope.Error())
+}
+
+func TestCreateSystemSecretReqKmsKey(t *testing.T) {
+	body := map[string]interface{}{
+		"flow":     constants.PRIVATE_FLOW,
+		"arn":      "arn:aws:iam::111111111111:role/secrets",
+		"region":   "us-east-1",
+		"provider": "AWS",
+		"kmsKeyId": "arn:aws:kms:us-east-1:111111111111:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+	}
+	requestBody, err := dtos.CreateNewSystemSecretReq(body)
+	assert.Nil(t, err)
+	assert.Equal(t, body["kmsKeyId"], requestBody.KmsKeyId)
+
+	body["kmsKeyId"] = "arn:aws:kms:us-east-1:111111111111:alias/secrets"
+	_, err = dtos.CreateNewSystemSecretReq(body)
+	assert.Nil(t, err)
+
+	body["kmsKeyId"] = "1234abcd-12ab-34cd-56ef-1234567890ab"
+	_, err = dtos.CreateNewSystemSecretReq(body)
+	assert.Equal(t, constants.ErrInvalidKmsKey, err)
+
+	body["kmsKeyId"] = "arn:aws:kms:eu-west-1:111111111111:alias/secrets"
+	_, err = dtos.CreateNewSystemSecretReq(body)
+	assert.Equal(t, constants.ErrKmsKeyRegionMismatch, err)
+
+	// SHARED secrets are encrypted with the key of the service
+	_, err = dtos.CreateNewSystemSecretReq(map[string]interface{}{
+		"flow":     constants.SHARED_FLOW,
+		"kmsKeyId": "arn:aws:kms:us-east-1:111111111111:alias/secrets",
+	})
+	assert.Equal(t, constants.ErrKmsKeyNotPrivate, err)
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactArn(t *testing.T) {
+	assert.Equal(t, "arn:aws:iam::********3713:role/Secrets", dtos.RedactArn(constants.PRIVATE_FLOW, "arn:aws:iam::438463683713:role/Secrets"))
+	assert.Equal(t, "", dtos.RedactArn(constants.SHARED_FLOW, "arn:aws:iam::438463683713:role/Secrets"))
+	assert.Equal(t, "*******", dtos.RedactArn(constants.PRIVATE_FLOW, "invalid"))
+}
+
+func TestCreateSystemSecretRegistration(t *testing.T) {
+	registration := dtos.CreateNewSystemSecretRegistration("org_project_OTHERS", constants.OTHERS_SCOPE, map[string]interface{}{
+		constants.FLOW_META_DATA:     constants.PRIVATE_FLOW,
+		constants.ARN_META_DATA:      "arn:aws:iam::438463683713:role/Secrets",
+		constants.REGION_META_DATA:   "us-east-1",
+		constants.PROVIDER_META_DATA: "AWS",
+		"secret_1":                   "value",
+	})
+
+	assert.Equal(t, "org_project_OTHERS", registration.SecretName)
+	assert.Equal(t, constants.PRIVATE_FLOW, registration.Flow)
+	assert.Equal(t, "arn:aws:iam::********3713:role/Secrets", registration.ARN)
+	assert.Equal(t, "us-east-1", registration.Region)
+	assert.Equal(t, "AWS", registration.Provider)
+	assert.Equal(t, "", registration.KmsKeyId)
+
+	registration = dtos.CreateNewSystemSecretRegistration("org_project_OTHERS", constants.OTHERS_SCOPE, map[string]interface{}{
+		constants.FLOW_META_DATA:    constants.PRIVATE_FLOW,
+		constants.ARN_META_DATA:     "arn:aws:iam::438463683713:role/Secrets",
+		constants.KMS_KEY_META_DATA: "arn:aws:kms:us-east-1:438463683713:alias/secrets",
+	})
+	assert.NotContains(t, registration.KmsKeyId, "438463683713")
+}
+
+func TestDiffSystemSecretMetadata(t *testing.T) {
+	from := map[string]interface{}{
+		constants.FLOW_META_DATA:     constants.PRIVATE_FLOW,
+		constants.ARN_META_DATA:      "arn:aws:iam::438463683713:role/Secrets",
+		constants.REGION_META_DATA:   "us-east-1",
+		constants.PROVIDER_META_DATA: "AWS",
+	}
+	to := map[string]interface{}{
+		constants.FLOW_META_DATA: constants.SHARED_FLOW,
+	}
+
+	changes := services.DiffSystemSecretMetadata(from, to)
+	assert.Len(t, changes, 4)
+	assert.Equal(t, dtos.SystemSecretChange{Field: "flow", From: constants.PRIVATE_FLOW, To: constants.SHARED_FLOW}, changes[0])
+	assert.Equal(t, dtos.SystemSecretChange{Field: "arn", From: "arn:aws:iam::********3713:role/Secrets", To: ""}, changes[1])
+
+	// Changes hidden by the redaction are still listed
+	to = map[string]interface{}{}
+	for key, value := range from {
+		to[key] = value
+	}
+	to[constants.ARN_META_DATA] = "arn:aws:iam::999999993713:role/Secrets"
+	changes = services.DiffSystemSecretMetadata(from, to)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "arn", changes[0].Field)
+
+	assert.Empty(t, services.DiffSystemSecretMetadata(from, from))
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"secret-svc/api/dtos"
+	"secret-svc/api/handlers"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMissedSecretEvents(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	services.StartSecretWatch()
+	services.WATCH_HISTORY_LIMIT = 3
+	defer func() { services.WATCH_HISTORY_LIMIT = 1000 }()
+
+	headers := dtos.CustomHeaders{OrgId: "org1", ProjectId: "proj1", Scope: "CONFIGS"}
+	first := events.Publish(events.Event{Type: constants.CREATED_EVENT, OrgId: "org1", ProjectId: "proj1", Scope: "CONFIGS", SecretId: "db"})
+	second := events.Publish(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", ProjectId: "proj1", Scope: "CONFIGS", SecretId: "db"})
+	events.Publish(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", ProjectId: "proj1", Scope: "CONFIGS", SecretId: "api"})
+	events.Publish(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", ProjectId: "proj1", Scope: "SECRETS", SecretId: "db"})
+
+	// The first event was trimmed from the history
+	_, found, err := services.GetMissedSecretEvents(headers, nil, first.Id)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	missed, found, err := services.GetMissedSecretEvents(headers, []string{"db"}, second.Id)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Empty(t, missed)
+
+	missed, _, _ = services.GetMissedSecretEvents(headers, nil, second.Id)
+	assert.Len(t, missed, 1)
+	assert.Equal(t, "api", missed[0].SecretId)
+}
+
+func TestWatchSecretsHandler(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+	services.StartSecretWatch()
+
+	router := gin.New()
+	router.GET("/secret/watch", handlers.WatchSecretsHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	previous := events.Publish(events.Event{Type: constants.CREATED_EVENT, OrgId: "org1", SecretId: "db"})
+	missed := events.Publish(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", SecretId: "db", VersionId: "v2"})
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/secret/watch?ids=db,cache", nil)
+	request.Header.Set(constants.ORG_ID_HEADER, "org1")
+	request.Header.Set("Last-Event-ID", previous.Id)
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	events.Publish(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", SecretId: "api"})
+	events.Publish(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org2", SecretId: "db"})
+	live := events.Publish(events.Event{Type: constants.DELETED_EVENT, OrgId: "org1", SecretId: "cache"})
+
+	var ids []string
+	var data []string
+	reader := bufio.NewReader(response.Body)
+	for len(data) < 2 {
+		line, err := reader.ReadString('\n')
+		if !assert.Nil(t, err) {
+			return
+		}
+		if strings.HasPrefix(line, "id:") {
+			ids = append(ids, strings.TrimSpace(strings.TrimPrefix(line, "id:")))
+		}
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, line)
+		}
+	}
+
+	assert.Equal(t, []string{missed.Id, live.Id}, ids)
+	assert.Contains(t, data[0], `"versionId":"v2"`)
+	assert.Contains(t, data[1], `"id":"cache"`)
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"secret-svc/api/dtos"
+	"secret-svc/api/services"
+	"secret-svc/pkg/constants"
+	"secret-svc/pkg/events"
+	"secret-svc/pkg/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateNewWebhookReq(t *testing.T) {
+	_, err := dtos.CreateNewWebhookReq(map[string]interface{}{"url": "ftp://example.com"}, true)
+	assert.Equal(t, constants.ErrMissingUrlAttr, err)
+
+	_, err = dtos.CreateNewWebhookReq(map[string]interface{}{
+		"url":    "https://example.com/hook",
+		"events": []interface{}{"created", "exploded"},
+	}, true)
+	assert.Equal(t, constants.ErrInvalidEventsAttr, err)
+
+	requestBody, err := dtos.CreateNewWebhookReq(map[string]interface{}{"events": []interface{}{"rotated"}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{constants.ROTATED_EVENT}, requestBody.Events)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, services.WebhookBackoff(1))
+	assert.Equal(t, 40*time.Second, services.WebhookBackoff(3))
+	assert.Equal(t, time.Hour, services.WebhookBackoff(20))
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	headers := dtos.CustomHeaders{OrgId: "org1", ProjectId: "proj1"}
+	webhook, err := services.CreateWebhook(headers, dtos.WebhookReq{
+		Url:    server.URL,
+		Events: []string{constants.UPDATED_EVENT},
+	})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(webhook.SigningSecret, "whsec_"))
+
+	// Only matching events of the project are queued
+	services.EnqueueWebhookDeliveries(events.Event{Type: constants.CREATED_EVENT, OrgId: "org1", ProjectId: "proj1"})
+	services.EnqueueWebhookDeliveries(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", ProjectId: "proj2"})
+	services.EnqueueWebhookDeliveries(events.Event{Type: constants.UPDATED_EVENT, OrgId: "org1", ProjectId: "proj1", Scope: "CONFIGS", SecretId: "db"})
+
+	now := time.Now().UTC()
+	attempted := services.DeliverDueWebhooks(now)
+	assert.Len(t, attempted, 1)
+	assert.NotNil(t, received)
+
+	timestamp := received.Header.Get(services.WEBHOOK_TIMESTAMP_HEADER)
+	assert.Equal(t, services.SignWebhookPayload(webhook.SigningSecret, timestamp, receivedBody), received.Header.Get(services.WEBHOOK_SIGNATURE_HEADER))
+	assert.Equal(t, constants.UPDATED_EVENT, received.Header.Get(services.WEBHOOK_EVENT_HEADER))
+	assert.Contains(t, string(receivedBody), `"secretId":"db"`)
+
+	assert.Empty(t, services.DeliverDueWebhooks(now))
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	store.Use(store.NewMemoryStore())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	headers := dtos.CustomHeaders{OrgId: "org1"}
+	_, err := services.CreateWebhook(headers, dtos.WebhookReq{Url: server.URL})
+	assert.Nil(t, err)
+
+	services.EnqueueWebhookDeliveries(events.Event{Type: constants.DELETED_EVENT, OrgId: "org1", Timestamp: time.Now().UTC()})
+
+	now := time.Now().UTC()
+	for i := 0; i < services.WEBHOOK_MAX_ATTEMPTS; i++ {
+		attempted := services.DeliverDueWebhooks(now)
+		assert.Len(t, attempted, 1)
+		assert.Equal(t, 500, attempted[0].LastStatus)
+		now = now.Add(time.Hour)
+	}
+
+	deadLetters, err := services.ListDeadLetters(headers)
+	assert.Nil(t, err)
+	assert.Len(t, deadLetters, 1)
+	assert.Empty(t, services.DeliverDueWebhooks(now))
+
+	replayed, err := services.ReplayDeadLetter(headers, deadLetters[0].Id)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, replayed.Attempts)
+	assert.Len(t, services.DeliverDueWebhooks(now), 1)
+
+	_, err = services.ReplayDeadLetter(dtos.CustomHeaders{OrgId: "org2"}, deadLetters[0].Id)
+	assert.Equal(t, constants.ErrDeliveryNotFound, err)
+}